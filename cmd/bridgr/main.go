@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime"
 	"time"
 
@@ -33,6 +34,7 @@ var (
 	threadsPtr     = flag.Int("threads", 1, "Number of threads to use for fetching artifacts")
 	dryrunPtr      = flag.Bool("dry-run", false, "Dry-run only. Do not actually download content")
 	fileTimeoutPtr = flag.Duration("file-timeout", defaultTimeout, "Timeout duration for downloading files, uses Golang duration strings")
+	lockedPtr      = flag.Bool("locked", false, "Fetch exactly the artifacts pinned in bridge.lock, failing if they have drifted")
 )
 
 func init() {
@@ -73,11 +75,25 @@ func main() {
 		exit(success)
 	}
 
+	if flag.Arg(0) == "bundle" {
+		exit(bundle(flag.Args()[1:]))
+	}
+
 	if *dryrunPtr {
 		bridgr.DryRun = *dryrunPtr
 		log.Info("Dry-Run requested, will not download artifacts.")
 	}
 
+	if *lockedPtr {
+		bridgr.Locked = *lockedPtr
+		log.Info("Locked run requested, will fetch the artifacts pinned in %s.", lockFile())
+	}
+
+	if *threadsPtr > 0 {
+		bridgr.Threads = *threadsPtr
+		log.Trace("using %d threads for fetching artifacts", *threadsPtr)
+	}
+
 	if fileTimeoutPtr != nil {
 		bridgr.FileTimeout = *fileTimeoutPtr
 		log.Trace("setting file timeout to %s", *fileTimeoutPtr)
@@ -93,17 +109,59 @@ func main() {
 	}
 	config, err := cmd.New(configFile)
 	if err != nil {
-		log.Info("%s", err.Error())
-		exit(execErr)
+		log.Error("Invalid bridgr config \"%s\": %s", *configPtr, err)
+		exit(cfgErr)
+	}
+
+	if err := readLock(); err != nil {
+		log.Error("Unable to read lock file \"%s\": %s", lockFile(), err)
+		exit(cfgErr)
 	}
 
-	if err := config.Execute(flag.Args()); err != nil {
-		log.Info("%s", err.Error())
+	if err := bridgr.ReadCache(); err != nil {
+		log.Warn("Unable to read the content cache, every artifact will be fetched: %s", err)
+	}
+
+	err = config.Execute(flag.Args())
+	if !bridgr.DryRun {
+		if cacheErr := bridgr.WriteCache(); cacheErr != nil {
+			log.Warn("Unable to write the content cache \"%s\": %s", bridgr.CacheFile(), cacheErr)
+		}
+	}
+	if err != nil {
+		log.Error("%s", err.Error())
 		exit(execErr)
 	}
+
+	if !bridgr.DryRun && !bridgr.Locked {
+		if err := writeLock(); err != nil {
+			log.Error("Unable to write lock file \"%s\": %s", lockFile(), err)
+			exit(execErr)
+		}
+	}
 	exit(success)
 }
 
+// bundle writes the packages directory to a single archive, as `bridgr bundle [options] [worker...]`
+func bundle(args []string) int {
+	opts := bridgr.BundleOptions{}
+	flags := flag.NewFlagSet("bundle", flag.ContinueOnError)
+	flags.StringVar(&opts.Output, "output", "bridgr-bundle.tar.zst", "The bundle file to write, its format is taken from its extension (.tar, .tar.zst or .iso)")
+	flags.StringVar(&opts.Output, "o", "bridgr-bundle.tar.zst", "The bundle file to write, its format is taken from its extension (.tar, .tar.zst or .iso)")
+	flags.StringVar(&opts.Format, "format", "", "The bundle format, one of tar, tar.zst or iso")
+	flags.StringVar(&opts.SigningKey, "sign-key", "", "A PEM encoded ed25519 private key for signing the manifest")
+	flags.StringVar(&opts.GPGKey, "gpg-key", "", "A GPG secret key for signing the manifest, its passphrase is read from BRIDGR_GPG_PASSPHRASE")
+	if err := flags.Parse(args); err != nil {
+		return cfgErr
+	}
+	opts.Workers = flags.Args()
+	if err := bridgr.Bundle(opts); err != nil {
+		log.Error("Unable to write bundle \"%s\": %s", opts.Output, err)
+		return execErr
+	}
+	return success
+}
+
 func exit(code int) {
 	log.Stop()
 	os.Exit(code)
@@ -116,6 +174,39 @@ func openConfig() (io.ReadCloser, error) {
 	return os.Open(*configPtr)
 }
 
+// lockFile is bridge.lock, next to the config file
+func lockFile() string {
+	return filepath.Join(filepath.Dir(*configPtr), "bridge.lock")
+}
+
+// readLock reads the pins of an earlier run. The lock file is required for a locked run.
+func readLock() error {
+	if !fileExists(lockFile()) {
+		if bridgr.Locked {
+			return fmt.Errorf("file does not exist")
+		}
+		return nil
+	}
+	f, err := os.Open(lockFile())
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return bridgr.ReadLock(f)
+}
+
+func writeLock() error {
+	f, err := os.Create(lockFile())
+	if err != nil {
+		return err
+	}
+	if err := bridgr.WriteLock(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
 func fileExists(filename string) bool {
 	info, err := os.Stat(filename)
 	if os.IsNotExist(err) {
@@ -0,0 +1,515 @@
+package bridgr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/distribution/reference"
+	"github.com/mitchellh/mapstructure"
+	"gopkg.in/yaml.v3"
+	log "unknwon.dev/clog/v2"
+)
+
+const defaultAnsibleServer = "https://galaxy.ansible.com"
+
+// ansibleRoleArchive is where role versions are downloaded from. Galaxy only indexes roles, their content stays on GitHub.
+var ansibleRoleArchive = "https://github.com/%s/%s/archive/%s.tar.gz"
+
+// Ansible is the configuration object for creating a static Ansible Galaxy server
+type Ansible struct {
+	Server      string
+	Host        string
+	Collections []ansibleContent
+	Roles       []ansibleContent
+}
+
+// ansibleContent is a collection or role, by its "namespace.name" and an optional version range
+type ansibleContent struct {
+	Name    string
+	Version string
+}
+
+// ansibleVersion is the detail of one collection version from the Galaxy v3 API, with the fields needed to resolve dependencies.
+// The metadata is the collection_info of the collection's MANIFEST.json, which Galaxy builds from galaxy.yml.
+type ansibleVersion struct {
+	Namespace struct {
+		Name string `json:"name"`
+	} `json:"namespace"`
+	Collection struct {
+		Name string `json:"name"`
+	} `json:"collection"`
+	Version     string `json:"version"`
+	DownloadURL string `json:"download_url"`
+	Artifact    struct {
+		Filename string `json:"filename"`
+		Sha256   string `json:"sha256"`
+	} `json:"artifact"`
+	Metadata struct {
+		Dependencies map[string]string `json:"dependencies"`
+	} `json:"metadata"`
+	raw map[string]interface{}
+}
+
+// ansibleRole is a role from the Galaxy v1 API
+type ansibleRole struct {
+	GithubUser    string `json:"github_user"`
+	GithubRepo    string `json:"github_repo"`
+	GithubBranch  string `json:"github_branch"`
+	SummaryFields struct {
+		Versions []struct {
+			Name string `json:"name"`
+		} `json:"versions"`
+	} `json:"summary_fields"`
+}
+
+// ansibleRequirement is an entry in the roles requirements.yml file
+type ansibleRequirement struct {
+	Name    string `yaml:"name"`
+	Src     string `yaml:"src"`
+	Version string `yaml:"version"`
+}
+
+func (ac ansibleContent) String() string {
+	if ac.Version != "" {
+		return ac.Name + ":" + ac.Version
+	}
+	return ac.Name
+}
+
+// name gives the "namespace.name" of a collection version
+func (av ansibleVersion) name() string {
+	return av.Namespace.Name + "." + av.Collection.Name
+}
+
+// split gives the namespace and name of a collection or role
+func (ac ansibleContent) split() (string, string, error) {
+	parts := strings.Split(ac.Name, ".")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("%s is not in the form namespace.name", ac.Name)
+	}
+	return parts[0], parts[1], nil
+}
+
+// dir is the top-level directory name for all objects written out under the Ansible worker
+func (a Ansible) dir() string {
+	return BaseDir(a.Name())
+}
+
+// Name returns the name of this Configuration
+func (a Ansible) Name() string {
+	return "ansible"
+}
+
+// Image implements the Imager interface
+func (a Ansible) Image() reference.Named {
+	return nil
+}
+
+// stringToAnsibleContent reads a collection or role the same way as ansible-galaxy does on the command line, ie "community.general:>=8.0.0"
+func stringToAnsibleContent(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf(ansibleContent{}) {
+		return data, nil
+	}
+	parts := strings.SplitN(data.(string), ":", 2)
+	content := ansibleContent{Name: strings.TrimSpace(parts[0])}
+	if len(parts) > 1 {
+		content.Version = strings.TrimSpace(parts[1])
+	}
+	return content, nil
+}
+
+func arrayToAnsible(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Slice || t != reflect.TypeOf(Ansible{}) {
+		return data, nil
+	}
+	return map[string]interface{}{"collections": data}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (a *Ansible) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		arrayToAnsible,
+		stringToAnsibleContent,
+	)
+}
+
+// Setup prepares the directory for the Galaxy server
+func (a *Ansible) Setup() error {
+	log.Trace("Called Ansible.Setup()")
+	if a.Server == "" {
+		a.Server = defaultAnsibleServer
+	}
+	a.Server = strings.TrimSuffix(strings.TrimSuffix(a.Server, "/"), "/api")
+	if a.Host == "" {
+		log.Warn("Ansible: no host is configured, download URLs will be relative and ansible-galaxy will not be able to use them")
+	}
+	return os.MkdirAll(a.dir(), os.ModePerm)
+}
+
+// Run resolves the configured collections and their dependencies, downloads them and writes the Galaxy v3 API documents.
+// Roles are downloaded along with a requirements.yml that installs them from Bridgr.
+func (a *Ansible) Run() error {
+	if err := a.Setup(); err != nil {
+		return err
+	}
+	resolver := ansibleResolver{ansible: a, versions: map[string][]string{}, details: map[string]ansibleVersion{}}
+	resolved := resolver.resolve(a.Collections)
+
+	updated := map[string]bool{}
+	mu := sync.Mutex{}
+	forEach(len(resolved), func(i int) {
+		if err := a.fetchCollection(resolved[i]); err != nil {
+			log.Info("Ansible: unable to download %s %s - %s", resolved[i].name(), resolved[i].Version, err)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		updated[resolved[i].name()] = true
+	})
+	for name := range updated {
+		if err := a.writeCollectionIndexes(name); err != nil {
+			log.Info("Ansible: unable to write API documents for %s - %s", name, err)
+		}
+	}
+	if err := a.writeJSON(path.Join(a.dir(), "api", "index.json"), map[string]interface{}{
+		"description":        "Bridgr Galaxy",
+		"available_versions": map[string]string{"v3": "v3/"},
+	}); err != nil {
+		return err
+	}
+
+	forEach(len(a.Roles), func(i int) {
+		if err := a.fetchRole(a.Roles[i]); err != nil {
+			log.Info("Ansible: unable to download role %s - %s", a.Roles[i], err)
+		}
+	})
+	if len(a.Roles) > 0 {
+		return a.writeRequirements()
+	}
+	return nil
+}
+
+// url gives the location of a path in the Galaxy server when it is hosted by Bridgr
+func (a *Ansible) url(parts ...string) string {
+	return strings.TrimSuffix(a.Host, "/") + "/" + path.Join(append([]string{a.Name()}, parts...)...)
+}
+
+func (a *Ansible) writeJSON(file string, doc interface{}) error {
+	if err := os.MkdirAll(path.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	content, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, content, 0644) //nolint:gosec // repository content is meant to be readable
+}
+
+// fetchCollection downloads a collection tarball, verifies it against the artifact checksum and writes its version document
+func (a *Ansible) fetchCollection(version ansibleVersion) error {
+	namespace, collection := version.Namespace.Name, version.Collection.Name
+	filename := version.Artifact.Filename
+	if filename == "" {
+		filename = fmt.Sprintf("%s-%s-%s.tar.gz", namespace, collection, version.Version)
+	}
+	target := path.Join(a.dir(), "download", filename)
+	if sum, err := fileChecksum(target, "sha256"); err != nil || sum != version.Artifact.Sha256 {
+		source, err := url.Parse(version.DownloadURL)
+		if err != nil {
+			return err
+		}
+		if err := download(source, target); err != nil {
+			return err
+		}
+		if sum, err = fileChecksum(target, "sha256"); err != nil {
+			return err
+		}
+		if version.Artifact.Sha256 != "" && sum != version.Artifact.Sha256 {
+			_ = os.Remove(target)
+			return fmt.Errorf("checksum mismatch, expected %s but got %s", version.Artifact.Sha256, sum)
+		}
+	} else if err := lockExisting(target); err != nil {
+		return err
+	}
+
+	doc := map[string]interface{}{}
+	for key, value := range version.raw {
+		doc[key] = value
+	}
+	versionPath := []string{"api", "v3", "collections", namespace, collection, "versions", version.Version}
+	doc["href"] = a.url(versionPath...) + "/"
+	doc["download_url"] = a.url("download", filename)
+	return a.writeJSON(path.Join(append([]string{a.dir()}, append(versionPath, "index.json")...)...), doc)
+}
+
+// writeCollectionIndexes writes the collection and version list documents of a collection. Every version with a version
+// document is listed, so versions from earlier runs stay available.
+func (a *Ansible) writeCollectionIndexes(name string) error {
+	namespace, collection, err := ansibleContent{Name: name}.split()
+	if err != nil {
+		return err
+	}
+	collectionPath := []string{"api", "v3", "collections", namespace, collection}
+	collectionDir := path.Join(append([]string{a.dir()}, collectionPath...)...)
+	docs, err := filepath.Glob(path.Join(collectionDir, "versions", "*", "index.json"))
+	if err != nil {
+		return err
+	}
+	var versions []*semver.Version
+	for _, doc := range docs {
+		if v, err := semver.NewVersion(path.Base(path.Dir(doc))); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		return errors.New("no versions have been downloaded")
+	}
+	sort.Sort(sort.Reverse(semver.Collection(versions)))
+
+	data := make([]map[string]interface{}, 0, len(versions))
+	for _, v := range versions {
+		data = append(data, map[string]interface{}{
+			"version": v.Original(),
+			"href":    a.url(append(collectionPath, "versions", v.Original())...) + "/",
+		})
+	}
+	versionsURL := a.url(append(collectionPath, "versions")...) + "/"
+	list := map[string]interface{}{
+		"meta":  map[string]int{"count": len(data)},
+		"links": map[string]interface{}{"first": versionsURL, "previous": nil, "next": nil, "last": versionsURL},
+		"data":  data,
+	}
+	if err := a.writeJSON(path.Join(collectionDir, "versions", "index.json"), list); err != nil {
+		return err
+	}
+	return a.writeJSON(path.Join(collectionDir, "index.json"), map[string]interface{}{
+		"namespace":       namespace,
+		"name":            collection,
+		"href":            a.url(collectionPath...) + "/",
+		"versions_url":    versionsURL,
+		"highest_version": data[0],
+	})
+}
+
+// fetchRole downloads the newest version of a role matching its version range
+func (a *Ansible) fetchRole(role ansibleContent) error {
+	namespace, name, err := role.split()
+	if err != nil {
+		return err
+	}
+	results := struct {
+		Results []ansibleRole `json:"results"`
+	}{}
+	query := url.Values{"owner__username": {namespace}, "name": {name}}
+	if err := getJSON(a.Server+"/api/v1/roles/?"+query.Encode(), &results); err != nil {
+		return err
+	}
+	if len(results.Results) == 0 {
+		return errors.New("role not found")
+	}
+	info := results.Results[0]
+
+	versions := make([]string, 0, len(info.SummaryFields.Versions))
+	for _, v := range info.SummaryFields.Versions {
+		versions = append(versions, v.Name)
+	}
+	version, err := pickAnsibleVersion(versions, role.Version)
+	if err != nil {
+		if len(versions) > 0 || role.Version != "" {
+			return err
+		}
+		version = info.GithubBranch
+		if version == "" {
+			version = "master"
+		}
+		log.Info("Ansible: role %s has no versions, using the %s branch", role.Name, version)
+	}
+	source, err := url.Parse(fmt.Sprintf(ansibleRoleArchive, info.GithubUser, info.GithubRepo, version))
+	if err != nil {
+		return err
+	}
+	target := path.Join(a.dir(), "roles", role.Name, version+".tar.gz")
+	if _, err := os.Stat(target); err == nil {
+		return lockExisting(target)
+	}
+	return download(source, target)
+}
+
+// writeRequirements writes roles/requirements.yml, for "ansible-galaxy role install -r" to install every downloaded role from Bridgr
+func (a *Ansible) writeRequirements() error {
+	archives, err := filepath.Glob(path.Join(a.dir(), "roles", "*", "*.tar.gz"))
+	if err != nil {
+		return err
+	}
+	requirements := make([]ansibleRequirement, 0, len(archives))
+	for _, archive := range archives {
+		name := path.Base(path.Dir(archive))
+		version := strings.TrimSuffix(path.Base(archive), ".tar.gz")
+		requirements = append(requirements, ansibleRequirement{Name: name, Src: a.url("roles", name, version+".tar.gz"), Version: version})
+	}
+	content, err := yaml.Marshal(requirements)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(a.dir(), "roles", "requirements.yml"), content, 0644) //nolint:gosec // repository content is meant to be readable
+}
+
+type ansibleResolver struct {
+	ansible  *Ansible
+	mu       sync.Mutex
+	versions map[string][]string
+	details  map[string]ansibleVersion
+}
+
+// resolve gives every collection version needed for the configured collections. Each collection and dependency uses the newest
+// version matching its range, the same as ansible-galaxy prefers.
+func (r *ansibleResolver) resolve(collections []ansibleContent) []ansibleVersion {
+	queue := collections
+	seen := map[string]bool{}
+	var resolved []ansibleVersion
+	for len(queue) > 0 {
+		picked := make([]*ansibleVersion, len(queue))
+		forEach(len(queue), func(i int) {
+			version, err := r.pick(queue[i])
+			if err != nil {
+				log.Info("Ansible: unable to resolve %s - %s", queue[i], err)
+				return
+			}
+			picked[i] = &version
+		})
+		var next []ansibleContent
+		for i, req := range queue {
+			if picked[i] == nil || seen[req.Name+"@"+picked[i].Version] {
+				continue
+			}
+			seen[req.Name+"@"+picked[i].Version] = true
+			resolved = append(resolved, *picked[i])
+			for dep, spec := range picked[i].Metadata.Dependencies {
+				next = append(next, ansibleContent{Name: dep, Version: spec})
+			}
+		}
+		queue = next
+	}
+	return resolved
+}
+
+// pick gets the detail of the newest version of a collection matching the range
+func (r *ansibleResolver) pick(collection ansibleContent) (ansibleVersion, error) {
+	namespace, name, err := collection.split()
+	if err != nil {
+		return ansibleVersion{}, err
+	}
+	versions, err := r.list(namespace, name)
+	if err != nil {
+		return ansibleVersion{}, err
+	}
+	version, err := pickAnsibleVersion(versions, collection.Version)
+	if err != nil {
+		return ansibleVersion{}, err
+	}
+	return r.detail(namespace, name, version)
+}
+
+// list gets every version of a collection from the upstream Galaxy server, following the pages of the version list
+func (r *ansibleResolver) list(namespace, name string) ([]string, error) {
+	key := namespace + "." + name
+	r.mu.Lock()
+	versions, ok := r.versions[key]
+	r.mu.Unlock()
+	if ok {
+		return versions, nil
+	}
+	page, err := url.Parse(r.ansible.Server + "/api/v3/collections/" + namespace + "/" + name + "/versions/?limit=100")
+	if err != nil {
+		return nil, err
+	}
+	for page != nil {
+		list := struct {
+			Links struct {
+				Next string `json:"next"`
+			} `json:"links"`
+			Data []struct {
+				Version string `json:"version"`
+			} `json:"data"`
+		}{}
+		if err := getJSON(page.String(), &list); err != nil {
+			return nil, err
+		}
+		for _, v := range list.Data {
+			versions = append(versions, v.Version)
+		}
+		next := page
+		page = nil
+		if list.Links.Next != "" {
+			if page, err = next.Parse(list.Links.Next); err != nil {
+				return nil, err
+			}
+		}
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.versions[key] = versions
+	return versions, nil
+}
+
+// detail gets the document of a collection version from the upstream Galaxy server
+func (r *ansibleResolver) detail(namespace, name, version string) (ansibleVersion, error) {
+	key := namespace + "." + name + "@" + version
+	r.mu.Lock()
+	detail, ok := r.details[key]
+	r.mu.Unlock()
+	if ok {
+		return detail, nil
+	}
+	raw := json.RawMessage{}
+	if err := getJSON(r.ansible.Server+"/api/v3/collections/"+namespace+"/"+name+"/versions/"+version+"/", &raw); err != nil {
+		return ansibleVersion{}, err
+	}
+	if err := json.Unmarshal(raw, &detail); err != nil {
+		return ansibleVersion{}, err
+	}
+	if err := json.Unmarshal(raw, &detail.raw); err != nil {
+		return ansibleVersion{}, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.details[key] = detail
+	return detail, nil
+}
+
+// pickAnsibleVersion gives the newest version matching an ansible-galaxy version range, ie "*", "1.2.0", ">=1.0.0,<2.0.0" or "!=1.1.0".
+// Pre-releases are only picked when asked for exactly.
+func pickAnsibleVersion(versions []string, spec string) (string, error) {
+	spec = strings.ReplaceAll(strings.TrimSpace(spec), "==", "=")
+	if spec == "" {
+		spec = "*"
+	}
+	constraint, err := semver.NewConstraint(spec)
+	if err != nil {
+		return "", err
+	}
+	var best *semver.Version
+	for _, candidate := range versions {
+		parsed, err := semver.NewVersion(candidate)
+		if err != nil || !constraint.Check(parsed) {
+			continue
+		}
+		if best == nil || parsed.GreaterThan(best) {
+			best = parsed
+		}
+	}
+	if best == nil {
+		return "", fmt.Errorf("no version matching %s", spec)
+	}
+	return best.Original(), nil
+}
@@ -0,0 +1,186 @@
+package bridgr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func galaxyServer() *httptest.Server {
+	sum := func(content string) string {
+		digest := sha256.Sum256([]byte(content))
+		return hex.EncodeToString(digest[:])
+	}
+	version := func(namespace, name, version, deps string) string {
+		filename := fmt.Sprintf("%s-%s-%s.tar.gz", namespace, name, version)
+		return fmt.Sprintf(`{"namespace":{"name":"%s"},"collection":{"name":"%s"},"version":"%s","download_url":"http://%%s/download/%s","artifact":{"filename":"%s","sha256":"%s"},"metadata":{"dependencies":%s}}`,
+			namespace, name, version, filename, filename, sum(filename), deps)
+	}
+	documents := map[string]string{
+		"/api/v3/collections/bluth/banana/versions/":        `{"links":{"next":"/api/v3/collections/bluth/banana/versions/?page=2"},"data":[{"version":"1.0.0"},{"version":"1.1.0"}]}`,
+		"/api/v3/collections/bluth/banana/versions/?page=2": `{"links":{"next":null},"data":[{"version":"2.0.0"}]}`,
+		"/api/v3/collections/bluth/stand/versions/":         `{"links":{"next":null},"data":[{"version":"1.0.0"},{"version":"1.5.0"},{"version":"2.0.0"}]}`,
+		"/api/v3/collections/bluth/banana/versions/1.1.0/":  version("bluth", "banana", "1.1.0", `{"bluth.stand":">=1.0.0,<2.0.0"}`),
+		"/api/v3/collections/bluth/stand/versions/1.5.0/":   version("bluth", "stand", "1.5.0", `{}`),
+		"/api/v1/roles/": `{"results":[{"github_user":"bluth","github_repo":"ansible-seal","summary_fields":{"versions":[{"name":"v1.0.0"},{"name":"v1.2.0"}]}}]}`,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.URL.Path
+		if page := r.URL.Query().Get("page"); page != "" {
+			key += "?page=" + page
+		}
+		if doc, ok := documents[key]; ok {
+			fmt.Fprintf(w, doc, r.Host)
+			return
+		}
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/download/"):
+			fmt.Fprint(w, path.Base(r.URL.Path))
+		case r.URL.Path == "/github/bluth/ansible-seal/archive/v1.2.0.tar.gz":
+			fmt.Fprint(w, "seal")
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestAnsibleDir(t *testing.T) {
+	expected := BaseDir("ansible")
+	result := Ansible{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestStringToAnsibleContent(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  interface{}
+		expect interface{}
+	}{
+		{"name only", "community.general", ansibleContent{Name: "community.general"}},
+		{"with version", "community.general:>=8.0.0,<9.0.0", ansibleContent{Name: "community.general", Version: ">=8.0.0,<9.0.0"}},
+		{"not a string", 42, 42},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := stringToAnsibleContent(reflect.TypeOf(test.input), reflect.TypeOf(ansibleContent{}), test.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestArrayToAnsible(t *testing.T) {
+	input := []interface{}{"community.general"}
+	result, _ := arrayToAnsible(reflect.TypeOf(input), reflect.TypeOf(Ansible{}), input)
+	expect := map[string]interface{}{"collections": input}
+	if !cmp.Equal(expect, result) {
+		t.Error(cmp.Diff(expect, result))
+	}
+}
+
+func TestPickAnsibleVersion(t *testing.T) {
+	versions := []string{"1.0.0", "1.2.0", "2.0.0", "2.1.0", "3.0.0-beta.1"}
+	tests := []struct {
+		spec   string
+		expect string
+	}{
+		{"", "2.1.0"},
+		{"*", "2.1.0"},
+		{"1.2.0", "1.2.0"},
+		{"==2.0.0", "2.0.0"},
+		{">=1.0.0,<2.0.0", "1.2.0"},
+		{"!=2.1.0", "2.0.0"},
+		{"3.0.0-beta.1", "3.0.0-beta.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			result, err := pickAnsibleVersion(versions, test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+
+	if _, err := pickAnsibleVersion(versions, ">=4.0.0"); err == nil {
+		t.Error("expected an error when no version matches")
+	}
+}
+
+func TestAnsibleRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := galaxyServer()
+	defer server.Close()
+	archive := ansibleRoleArchive
+	ansibleRoleArchive = server.URL + "/github/%s/%s/archive/%s.tar.gz"
+	defer func() { ansibleRoleArchive = archive }()
+
+	ansible := Ansible{
+		Server:      server.URL + "/api/",
+		Host:        "http://bridgr.bluth.com",
+		Collections: []ansibleContent{{Name: "bluth.banana", Version: ">=1.0.0,<2.0.0"}},
+		Roles:       []ansibleContent{{Name: "bluth.seal"}},
+	}
+	if err := ansible.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectFiles := []string{
+		"api/index.json",
+		"download/bluth-banana-1.1.0.tar.gz",
+		"download/bluth-stand-1.5.0.tar.gz",
+		"api/v3/collections/bluth/stand/index.json",
+		"roles/bluth.seal/v1.2.0.tar.gz",
+	}
+	for _, file := range expectFiles {
+		if _, err := os.Stat(path.Join(ansible.dir(), file)); err != nil {
+			t.Errorf("expected %s to be written: %s", file, err)
+		}
+	}
+
+	detail := map[string]interface{}{}
+	content, _ := os.ReadFile(path.Join(ansible.dir(), "api/v3/collections/bluth/banana/versions/1.1.0/index.json"))
+	if err := json.Unmarshal(content, &detail); err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal("http://bridgr.bluth.com/ansible/download/bluth-banana-1.1.0.tar.gz", detail["download_url"]) {
+		t.Error(cmp.Diff("http://bridgr.bluth.com/ansible/download/bluth-banana-1.1.0.tar.gz", detail["download_url"]))
+	}
+
+	list := struct {
+		Data []struct {
+			Version string `json:"version"`
+		} `json:"data"`
+	}{}
+	content, _ = os.ReadFile(path.Join(ansible.dir(), "api/v3/collections/bluth/banana/versions/index.json"))
+	if err := json.Unmarshal(content, &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Data) != 1 || list.Data[0].Version != "1.1.0" {
+		t.Errorf("expected only version 1.1.0 to be listed, got %s", content)
+	}
+
+	requirements, _ := os.ReadFile(path.Join(ansible.dir(), "roles", "requirements.yml"))
+	expect := "- name: bluth.seal\n  src: http://bridgr.bluth.com/ansible/roles/bluth.seal/v1.2.0.tar.gz\n  version: v1.2.0\n"
+	if !cmp.Equal(expect, string(requirements)) {
+		t.Error(cmp.Diff(expect, string(requirements)))
+	}
+}
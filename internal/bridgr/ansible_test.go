@@ -0,0 +1,33 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAnsibleImage(t *testing.T) {
+	ansible := bridgr.Ansible{}
+	if ansible.Image() != nil {
+		t.Errorf("expected nil, but got %+v", ansible.Image())
+	}
+}
+
+func TestAnsibleName(t *testing.T) {
+	expected := "ansible"
+	ansible := bridgr.Ansible{}
+	if !cmp.Equal(expected, ansible.Name()) {
+		t.Error(cmp.Diff(expected, ansible.Name()))
+	}
+}
+
+func TestAnsibleHook(t *testing.T) {
+	ansible := bridgr.Ansible{}
+	result := reflect.TypeOf(ansible.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
@@ -0,0 +1,175 @@
+package bridgr
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/aztechian/bridgr/internal/bridgr/asset"
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/mitchellh/mapstructure"
+	log "unknwon.dev/clog/v2"
+)
+
+const (
+	defaultApkBranch       = "latest-stable"
+	defaultApkMirror       = "https://dl-cdn.alpinelinux.org/alpine"
+	defaultApkArchitecture = "x86_64"
+)
+
+var (
+	apkScript       *template.Template
+	apkRepositories *template.Template
+)
+
+func init() {
+	apkScript = asset.Template("apk.sh")
+	apkRepositories = asset.Template("apk.repositories")
+}
+
+// Apk sets up and creates an Alpine APK repository based on user configuration
+type Apk struct {
+	Branch        string
+	BaseImage     apkImage `mapstructure:"image"`
+	Mirror        string
+	Repositories  []string
+	Architectures []string
+	Packages      []string
+	Key           string
+}
+
+type apkImage reference.Named
+
+// apkSource is an upstream repository that packages are fetched from, and the name of the repository they are published in
+type apkSource struct {
+	Name string
+	URL  string
+}
+
+// dir is the top-level directory name for all objects written out under the Apk worker
+func (a Apk) dir() string {
+	return BaseDir(a.Name())
+}
+
+// Name returns the name of this Configuration
+func (a Apk) Name() string {
+	return "apk"
+}
+
+// Image returns the docker image that will be used for the batch execution. By default, this is the Alpine image for the branch.
+func (a Apk) Image() reference.Named {
+	if a.BaseImage != nil {
+		return a.BaseImage
+	}
+	tag := strings.TrimPrefix(a.Branch, "v")
+	if tag == "" || tag == defaultApkBranch {
+		tag = "latest"
+	}
+	img, _ := reference.ParseNormalizedNamed("alpine:" + tag)
+	return img
+}
+
+// Sources gives the upstream location of each configured repository. Repositories are either a name under the branch
+// on the mirror (ie, "community"), or the full URL of a repository.
+func (a Apk) Sources() []apkSource {
+	sources := make([]apkSource, 0, len(a.Repositories))
+	for _, repo := range a.Repositories {
+		repo = strings.TrimSuffix(repo, "/")
+		if strings.Contains(repo, "://") {
+			sources = append(sources, apkSource{Name: path.Base(repo), URL: repo})
+			continue
+		}
+		sources = append(sources, apkSource{Name: repo, URL: strings.TrimSuffix(a.Mirror, "/") + "/" + a.Branch + "/" + repo})
+	}
+	return sources
+}
+
+// KeyName is the file name of the signing key. The index signature refers to the public key by this name, with ".pub" appended.
+func (a Apk) KeyName() string {
+	return filepath.Base(a.Key)
+}
+
+func stringToApkImage(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf((*apkImage)(nil)).Elem() {
+		return data, nil
+	}
+	return reference.ParseNormalizedNamed(data.(string))
+}
+
+func arrayToApk(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Slice || t != reflect.TypeOf(Apk{}) {
+		return data, nil
+	}
+	var pkgList []string
+	for _, pkg := range data.([]interface{}) {
+		if pkg, ok := pkg.(string); ok {
+			pkgList = append(pkgList, pkg)
+		}
+	}
+	return Apk{Packages: pkgList}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (a *Apk) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		stringToApkImage,
+		arrayToApk,
+	)
+}
+
+// Run sets up, creates and fetches an Alpine APK repository based on the settings from the config file
+func (a *Apk) Run() error {
+	if err := a.Setup(); err != nil {
+		return err
+	}
+
+	script := bytes.Buffer{}
+	if err := asset.Render(apkScript, a, &script); err != nil {
+		return err
+	}
+
+	batcher := newBatch(a.Image().String(), a.dir(), path.Join(a.dir(), "bridgr.repositories"), "/bridgr.repositories")
+	if a.Key != "" {
+		key, err := filepath.Abs(a.Key)
+		if err != nil {
+			return err
+		}
+		batcher.Mounts = append(batcher.Mounts, mount.Mount{Type: mount.TypeBind, Source: key, Target: "/keys/" + a.KeyName(), ReadOnly: true})
+	}
+	return batcher.runContainer("bridgr_apk", script.String())
+}
+
+// Setup only does the setup step of the APK worker
+func (a *Apk) Setup() error {
+	log.Trace("Called Apk Setup()")
+	if a.Branch == "" {
+		a.Branch = defaultApkBranch
+	}
+	if a.Mirror == "" {
+		a.Mirror = defaultApkMirror
+	}
+	if len(a.Repositories) == 0 {
+		a.Repositories = []string{"main", "community"}
+	}
+	if len(a.Architectures) == 0 {
+		a.Architectures = []string{defaultApkArchitecture}
+	}
+	if a.Key != "" {
+		if _, err := os.Stat(a.Key); err != nil {
+			return fmt.Errorf("unable to read APK signing key: %s", err)
+		}
+	}
+	_ = os.MkdirAll(a.dir(), os.ModePerm)
+
+	repoFile, err := os.Create(path.Join(a.dir(), "bridgr.repositories"))
+	if err != nil {
+		return fmt.Errorf("Unable to create APK repositories file: %s", err)
+	}
+	return asset.RenderFile(apkRepositories, a.Sources(), repoFile)
+}
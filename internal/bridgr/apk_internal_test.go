@@ -0,0 +1,146 @@
+package bridgr
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr/asset"
+	"github.com/distribution/reference"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestApkDir(t *testing.T) {
+	expected := BaseDir("apk")
+	result := Apk{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestApkSources(t *testing.T) {
+	apk := Apk{
+		Branch:       "v3.19",
+		Mirror:       "https://mirror.bluth.com/alpine/",
+		Repositories: []string{"main", "https://packages.bluth.com/alpine/v3.19/banana/"},
+	}
+	expect := []apkSource{
+		{Name: "main", URL: "https://mirror.bluth.com/alpine/v3.19/main"},
+		{Name: "banana", URL: "https://packages.bluth.com/alpine/v3.19/banana"},
+	}
+	if !cmp.Equal(expect, apk.Sources()) {
+		t.Error(cmp.Diff(expect, apk.Sources()))
+	}
+}
+
+func TestStringToApkImage(t *testing.T) {
+	img, _ := reference.ParseNormalizedNamed("alpine:3.18")
+	target := reflect.TypeOf((*apkImage)(nil)).Elem()
+	result, err := stringToApkImage(reflect.TypeOf(""), target, "alpine:3.18")
+	if err != nil {
+		t.Error(err)
+	}
+	if !cmp.Equal(img, result, namedComparer) {
+		t.Error(cmp.Diff(img, result, namedComparer))
+	}
+
+	other, _ := stringToApkImage(reflect.TypeOf(""), reflect.TypeOf(""), "3.18")
+	if !cmp.Equal("3.18", other) {
+		t.Error(cmp.Diff("3.18", other))
+	}
+}
+
+func TestArrayToApk(t *testing.T) {
+	tests := []struct {
+		name   string
+		target reflect.Type
+		input  interface{}
+		expect interface{}
+	}{
+		{"invalid target", reflect.TypeOf(4.23), "monster", "monster"},
+		{"invalid input", reflect.TypeOf(Apk{}), 33, 33},
+		{"valid", reflect.TypeOf(Apk{}), []interface{}{"curl", "git"}, Apk{Packages: []string{"curl", "git"}}},
+		{"invalid array", reflect.TypeOf(Apk{}), []interface{}{83, 9.4822}, Apk{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := arrayToApk(reflect.TypeOf(test.input), test.target, test.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestApkSetup(t *testing.T) {
+	t.Chdir(t.TempDir())
+	apk := Apk{Branch: "v3.19"}
+	if err := apk.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	expect := Apk{Branch: "v3.19", Mirror: defaultApkMirror, Repositories: []string{"main", "community"}, Architectures: []string{"x86_64"}}
+	if !cmp.Equal(expect, apk) {
+		t.Error(cmp.Diff(expect, apk))
+	}
+	content, _ := os.ReadFile(path.Join(apk.dir(), "bridgr.repositories"))
+	repos := defaultApkMirror + "/v3.19/main\n" + defaultApkMirror + "/v3.19/community\n"
+	if !strings.HasPrefix(string(content), repos) {
+		t.Error(cmp.Diff(repos, string(content)))
+	}
+
+	missing := Apk{Key: "no-key-for-you.rsa"}
+	if err := missing.Setup(); err == nil {
+		t.Error("expected an error for a missing signing key")
+	}
+}
+
+func TestApkScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		apk    Apk
+		expect []string
+		absent []string
+	}{
+		{
+			"upstream signatures",
+			Apk{Branch: "v3.19", Mirror: defaultApkMirror, Repositories: []string{"main", "community"}, Architectures: []string{"x86_64", "aarch64"}, Packages: []string{"curl", "git"}},
+			[]string{"for arch in x86_64 aarch64", "fetch -q --recursive -o /tmp/apks-$arch curl git", "/packages/v3.19/community/$arch/APKINDEX.tar.gz"},
+			[]string{"abuild-sign"},
+		},
+		{
+			"signed",
+			Apk{Branch: "v3.19", Mirror: defaultApkMirror, Repositories: []string{"main"}, Architectures: []string{"x86_64"}, Packages: []string{"curl"}, Key: "keys/bluth@bridgr.rsa"},
+			[]string{
+				`if ls "/packages/v3.19/main/$arch"/*.apk >/dev/null 2>&1; then`,
+				"abuild-sign -q -k /keys/bluth@bridgr.rsa -p bluth@bridgr.rsa.pub", "-out /packages/bluth@bridgr.rsa.pub",
+			},
+			[]string{"cp /tmp/APKINDEX.tar.gz"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			script := bytes.Buffer{}
+			if err := asset.Render(apkScript, test.apk, &script); err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range test.expect {
+				if !strings.Contains(script.String(), s) {
+					t.Errorf("expected script to contain %q", s)
+				}
+			}
+			for _, s := range test.absent {
+				if strings.Contains(script.String(), s) {
+					t.Errorf("expected script to not contain %q", s)
+				}
+			}
+		})
+	}
+}
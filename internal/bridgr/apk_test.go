@@ -0,0 +1,47 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/distribution/reference"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestApkImage(t *testing.T) {
+	dflt, _ := reference.ParseNormalizedNamed("alpine:latest")
+	apk := bridgr.Apk{}
+	if !cmp.Equal(dflt, apk.Image(), namedComparer) {
+		t.Error(cmp.Diff(dflt, apk.Image()))
+	}
+
+	branch, _ := reference.ParseNormalizedNamed("alpine:3.19")
+	apk2 := bridgr.Apk{Branch: "v3.19"}
+	if !cmp.Equal(branch, apk2.Image(), namedComparer) {
+		t.Error(cmp.Diff(branch, apk2.Image()))
+	}
+
+	custom, _ := reference.ParseNormalizedNamed("registry.bluth.com/alpine:3.19")
+	apk3 := bridgr.Apk{Branch: "v3.19", BaseImage: custom}
+	if !cmp.Equal(custom, apk3.Image(), namedComparer) {
+		t.Error(cmp.Diff(custom, apk3.Image()))
+	}
+}
+
+func TestApkName(t *testing.T) {
+	expected := "apk"
+	apk := bridgr.Apk{}
+	if !cmp.Equal(expected, apk.Name()) {
+		t.Error(cmp.Diff(expected, apk.Name()))
+	}
+}
+
+func TestApkHook(t *testing.T) {
+	apk := bridgr.Apk{}
+	result := reflect.TypeOf(apk.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
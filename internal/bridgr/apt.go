@@ -0,0 +1,151 @@
+package bridgr
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+
+	"github.com/aztechian/bridgr/internal/bridgr/asset"
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/mitchellh/mapstructure"
+	log "unknwon.dev/clog/v2"
+)
+
+const (
+	defaultAptDistribution = "jammy"
+	defaultAptComponent    = "main"
+	defaultAptArchitecture = "amd64"
+)
+
+var (
+	aptScript *template.Template
+	aptList   *template.Template
+)
+
+func init() {
+	aptScript = asset.Template("apt.sh")
+	aptList = asset.Template("apt.list")
+}
+
+// Apt sets up and creates an APT repository based on user configuration
+type Apt struct {
+	Distribution  string
+	BaseImage     aptImage `mapstructure:"image"`
+	Components    []string
+	Architectures []string
+	Sources       []string
+	Packages      []string
+	Key           string
+}
+
+type aptImage reference.Named
+
+// dir is the top-level directory name for all objects written out under the Apt worker
+func (a Apt) dir() string {
+	return BaseDir(a.Name())
+}
+
+// Name returns the name of this Configuration
+func (a Apt) Name() string {
+	return "apt"
+}
+
+// Image returns the docker image that will be used for the batch execution. By default, this is the Ubuntu image for the distribution.
+func (a Apt) Image() reference.Named {
+	if a.BaseImage != nil {
+		return a.BaseImage
+	}
+	distribution := a.Distribution
+	if distribution == "" {
+		distribution = defaultAptDistribution
+	}
+	img, _ := reference.ParseNormalizedNamed(baseImage["apt"] + ":" + distribution)
+	return img
+}
+
+func stringToAptImage(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf((*aptImage)(nil)).Elem() {
+		return data, nil
+	}
+	return reference.ParseNormalizedNamed(data.(string))
+}
+
+func arrayToApt(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Slice || t != reflect.TypeOf(Apt{}) {
+		return data, nil
+	}
+	var pkgList []string
+	for _, pkg := range data.([]interface{}) {
+		if pkg, ok := pkg.(string); ok {
+			pkgList = append(pkgList, pkg)
+		}
+	}
+	return Apt{Packages: pkgList}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (a *Apt) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		stringToAptImage,
+		arrayToApt,
+	)
+}
+
+// Run sets up, creates and fetches an APT repository based on the settings from the config file
+func (a *Apt) Run() error {
+	if err := a.Setup(); err != nil {
+		return err
+	}
+
+	script := bytes.Buffer{}
+	if err := asset.Render(aptScript, a, &script); err != nil {
+		return err
+	}
+
+	batcher := newBatch(a.Image().String(), a.dir(), path.Join(a.dir(), "bridgr.list"), "/etc/apt/sources.list.d/bridgr.list")
+	if a.Key != "" {
+		key, err := filepath.Abs(a.Key)
+		if err != nil {
+			return err
+		}
+		batcher.Mounts = append(batcher.Mounts, mount.Mount{Type: mount.TypeBind, Source: key, Target: "/bridgr.key", ReadOnly: true})
+	}
+	return batcher.runContainer("bridgr_apt", script.String())
+}
+
+// Setup only does the setup step of the APT worker
+func (a *Apt) Setup() error {
+	log.Trace("Called Apt Setup()")
+	if a.Distribution == "" {
+		a.Distribution = defaultAptDistribution
+	}
+	if len(a.Components) == 0 {
+		a.Components = []string{defaultAptComponent}
+	}
+	if len(a.Architectures) == 0 {
+		a.Architectures = []string{defaultAptArchitecture}
+	}
+	if a.Key != "" {
+		if _, err := os.Stat(a.Key); err != nil {
+			return fmt.Errorf("unable to read APT signing key: %s", err)
+		}
+	}
+	for _, source := range a.Sources {
+		if !strings.HasPrefix(source, "deb") {
+			log.Warn("APT source \"%s\" does not look like a sources.list entry, ie \"deb http://... %s main\"", source, a.Distribution)
+		}
+	}
+	_ = os.MkdirAll(a.dir(), os.ModePerm)
+
+	listFile, err := os.Create(path.Join(a.dir(), "bridgr.list"))
+	if err != nil {
+		return fmt.Errorf("Unable to create APT sources file: %s", err)
+	}
+	return asset.RenderFile(aptList, a.Sources, listFile)
+}
@@ -0,0 +1,127 @@
+package bridgr
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr/asset"
+	"github.com/distribution/reference"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAptDir(t *testing.T) {
+	expected := BaseDir("apt")
+	result := Apt{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestStringToAptImage(t *testing.T) {
+	img, _ := reference.ParseNormalizedNamed("debian:bookworm")
+	target := reflect.TypeOf((*aptImage)(nil)).Elem()
+	result, err := stringToAptImage(reflect.TypeOf(""), target, "debian:bookworm")
+	if err != nil {
+		t.Error(err)
+	}
+	if !cmp.Equal(img, result, namedComparer) {
+		t.Error(cmp.Diff(img, result, namedComparer))
+	}
+
+	other, _ := stringToAptImage(reflect.TypeOf(""), reflect.TypeOf(""), "bookworm")
+	if !cmp.Equal("bookworm", other) {
+		t.Error(cmp.Diff("bookworm", other))
+	}
+}
+
+func TestArrayToApt(t *testing.T) {
+	tests := []struct {
+		name   string
+		target reflect.Type
+		input  interface{}
+		expect interface{}
+	}{
+		{"invalid target", reflect.TypeOf(4.23), "monster", "monster"},
+		{"invalid input", reflect.TypeOf(Apt{}), 33, 33},
+		{"valid", reflect.TypeOf(Apt{}), []interface{}{"curl", "git"}, Apt{Packages: []string{"curl", "git"}}},
+		{"invalid array", reflect.TypeOf(Apt{}), []interface{}{83, 9.4822}, Apt{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := arrayToApt(reflect.TypeOf(test.input), test.target, test.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestAptSetup(t *testing.T) {
+	t.Chdir(t.TempDir())
+	apt := Apt{Sources: []string{"deb http://ppa.launchpad.net/bluth/banana/ubuntu jammy main"}}
+	if err := apt.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	expect := Apt{Distribution: "jammy", Components: []string{"main"}, Architectures: []string{"amd64"}, Sources: apt.Sources}
+	if !cmp.Equal(expect, apt) {
+		t.Error(cmp.Diff(expect, apt))
+	}
+	content, _ := os.ReadFile(path.Join(apt.dir(), "bridgr.list"))
+	if !cmp.Equal(apt.Sources[0]+"\n", string(content)) {
+		t.Error(cmp.Diff(apt.Sources[0]+"\n", string(content)))
+	}
+
+	missing := Apt{Key: "no-key-for-you.gpg"}
+	if err := missing.Setup(); err == nil {
+		t.Error("expected an error for a missing signing key")
+	}
+}
+
+func TestAptScript(t *testing.T) {
+	tests := []struct {
+		name   string
+		apt    Apt
+		expect []string
+		absent []string
+	}{
+		{
+			"unsigned",
+			Apt{Distribution: "jammy", Components: []string{"main", "universe"}, Architectures: []string{"amd64", "arm64"}, Packages: []string{"curl"}},
+			[]string{"dpkg --add-architecture arm64", "curl:$arch", "universe/*) component=universe", "Suite=jammy", `Components="main universe"`},
+			[]string{"gpg --batch --import"},
+		},
+		{
+			"signed",
+			Apt{Distribution: "bookworm", Components: []string{"main"}, Architectures: []string{"amd64"}, Packages: []string{"git"}, Key: "bridgr.key"},
+			[]string{"gpg --batch --import /bridgr.key", "dists/bookworm/InRelease"},
+			nil,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			script := bytes.Buffer{}
+			if err := asset.Render(aptScript, test.apt, &script); err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range test.expect {
+				if !strings.Contains(script.String(), s) {
+					t.Errorf("expected script to contain %q", s)
+				}
+			}
+			for _, s := range test.absent {
+				if strings.Contains(script.String(), s) {
+					t.Errorf("expected script to not contain %q", s)
+				}
+			}
+		})
+	}
+}
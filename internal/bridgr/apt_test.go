@@ -0,0 +1,47 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/distribution/reference"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAptImage(t *testing.T) {
+	dflt, _ := reference.ParseNormalizedNamed("ubuntu:jammy")
+	apt := bridgr.Apt{}
+	if !cmp.Equal(dflt, apt.Image(), namedComparer) {
+		t.Error(cmp.Diff(dflt, apt.Image()))
+	}
+
+	noble, _ := reference.ParseNormalizedNamed("ubuntu:noble")
+	apt2 := bridgr.Apt{Distribution: "noble"}
+	if !cmp.Equal(noble, apt2.Image(), namedComparer) {
+		t.Error(cmp.Diff(noble, apt2.Image()))
+	}
+
+	debian, _ := reference.ParseNormalizedNamed("debian:bookworm")
+	apt3 := bridgr.Apt{Distribution: "bookworm", BaseImage: debian}
+	if !cmp.Equal(debian, apt3.Image(), namedComparer) {
+		t.Error(cmp.Diff(debian, apt3.Image()))
+	}
+}
+
+func TestAptName(t *testing.T) {
+	expected := "apt"
+	apt := bridgr.Apt{}
+	if !cmp.Equal(expected, apt.Name()) {
+		t.Error(cmp.Diff(expected, apt.Name()))
+	}
+}
+
+func TestAptHook(t *testing.T) {
+	apt := bridgr.Apt{}
+	result := reflect.TypeOf(apt.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
@@ -0,0 +1,33 @@
+#!/bin/sh
+set -e
+{{if .Key}}apk add -q abuild openssl
+{{end}}
+for arch in {{Join .Architectures " "}}; do
+  echo "Resolving packages for $arch..."
+  root=/tmp/root-$arch
+  mkdir -p "$root/etc/apk/keys" /tmp/apks-$arch
+  cp /usr/share/apk/keys/$arch/* "$root/etc/apk/keys/"
+  cp /bridgr.repositories "$root/etc/apk/repositories"
+  apk --root "$root" --arch "$arch" --initdb -q update
+  apk --root "$root" --arch "$arch" fetch -q --recursive -o /tmp/apks-$arch {{Join .Packages " "}}
+  {{range .Sources}}
+  # packages are published to the repository they come from upstream
+  mkdir -p "/packages/{{$.Branch}}/{{.Name}}/$arch"
+  wget -q -O /tmp/APKINDEX.tar.gz "{{.URL}}/$arch/APKINDEX.tar.gz"
+  tar -xzOf /tmp/APKINDEX.tar.gz APKINDEX | awk '/^P:/ {p=substr($0,3)} /^V:/ {print p "-" substr($0,3) ".apk"}' > /tmp/APKINDEX.list
+  for apk in /tmp/apks-$arch/*.apk; do
+    [ -f "$apk" ] || continue
+    if grep -qxF "$(basename "$apk")" /tmp/APKINDEX.list; then
+      mv "$apk" "/packages/{{$.Branch}}/{{.Name}}/$arch/"
+    fi
+  done
+  {{if $.Key}}# a repository that none of the packages come from has nothing to index
+  if ls "/packages/{{$.Branch}}/{{.Name}}/$arch"/*.apk >/dev/null 2>&1; then
+    (cd "/packages/{{$.Branch}}/{{.Name}}/$arch" && apk index -q --allow-untrusted -d "Bridgr {{.Name}}" -o APKINDEX.tar.gz *.apk && abuild-sign -q -k /keys/{{$.KeyName}} -p {{$.KeyName}}.pub APKINDEX.tar.gz)
+  fi
+  {{else}}cp /tmp/APKINDEX.tar.gz "/packages/{{$.Branch}}/{{.Name}}/$arch/APKINDEX.tar.gz"
+  {{end}}{{end}}
+done
+{{if .Key}}
+openssl rsa -in /keys/{{.KeyName}} -pubout -out /packages/{{.KeyName}}.pub
+{{end}}
@@ -0,0 +1,60 @@
+#!/bin/sh
+set -e
+export DEBIAN_FRONTEND=noninteractive
+
+{{range .Architectures}}dpkg --add-architecture {{.}}
+{{end}}apt-get update -q
+apt-get install -y -q --no-install-recommends apt-utils gnupg
+
+mkdir -p /tmp/debs
+cd /tmp/debs
+for arch in {{Join .Architectures " "}}; do
+  echo "Resolving packages for $arch..."
+  for pkg in $(apt-cache depends --recurse --no-recommends --no-suggests --no-conflicts --no-breaks --no-replaces --no-enhances {{range .Packages}}{{.}}:$arch {{end}}| grep "^\w" | sort -u); do
+    apt-get download -q "$pkg" || echo "Unable to download $pkg"
+  done
+done
+
+cd /packages
+for deb in /tmp/debs/*.deb; do
+  [ -f "$deb" ] || continue
+  name=$(dpkg-deb -f "$deb" Package)
+  component={{index .Components 0}}
+  case "$(dpkg-deb -f "$deb" Section)" in
+  {{range .Components}}{{.}}/*) component={{.}} ;;
+  {{end}}esac
+  case "$name" in
+  lib?*) prefix=$(echo "$name" | cut -c1-4) ;;
+  *) prefix=$(echo "$name" | cut -c1) ;;
+  esac
+  mkdir -p "pool/$component/$prefix/$name"
+  mv "$deb" "pool/$component/$prefix/$name/"
+done
+
+echo "Creating APT repository..."
+for component in {{Join .Components " "}}; do
+  mkdir -p "pool/$component"
+  for arch in {{Join .Architectures " "}}; do
+    mkdir -p "dists/{{.Distribution}}/$component/binary-$arch"
+    apt-ftparchive --arch "$arch" packages "pool/$component" > "dists/{{.Distribution}}/$component/binary-$arch/Packages"
+    gzip -9 -k -f "dists/{{.Distribution}}/$component/binary-$arch/Packages"
+  done
+done
+rm -f dists/{{.Distribution}}/Release dists/{{.Distribution}}/Release.gpg dists/{{.Distribution}}/InRelease
+apt-ftparchive \
+  -o APT::FTPArchive::Release::Origin=Bridgr \
+  -o APT::FTPArchive::Release::Label=Bridgr \
+  -o APT::FTPArchive::Release::Suite={{.Distribution}} \
+  -o APT::FTPArchive::Release::Codename={{.Distribution}} \
+  -o APT::FTPArchive::Release::Components="{{Join .Components " "}}" \
+  -o APT::FTPArchive::Release::Architectures="{{Join .Architectures " "}}" \
+  release dists/{{.Distribution}} > /tmp/Release
+mv /tmp/Release dists/{{.Distribution}}/Release
+{{if .Key}}
+echo "Signing APT repository..."
+export GNUPGHOME=$(mktemp -d)
+gpg --batch --import /bridgr.key
+gpg --batch --yes --armor --detach-sign -o dists/{{.Distribution}}/Release.gpg dists/{{.Distribution}}/Release
+gpg --batch --yes --clearsign -o dists/{{.Distribution}}/InRelease dists/{{.Distribution}}/Release
+gpg --batch --yes --armor --export -o /packages/bridgr.gpg
+{{end}}
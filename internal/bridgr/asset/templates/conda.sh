@@ -0,0 +1,36 @@
+#!/bin/sh
+set -e
+export CONDA_PKGS_DIRS=/tmp/pkgs
+
+conda install -q -n base -c conda-forge conda-index
+mkdir -p /packages/noarch
+{{range .Platforms}}
+echo "Solving environment for {{.}}..."
+case "{{.}}" in
+osx-*) export CONDA_OVERRIDE_OSX=11.0 ;;
+*) unset CONDA_OVERRIDE_OSX ;;
+esac
+# each solve has an empty package cache, so packages already cached by installing conda-index are still FETCH actions
+CONDA_PKGS_DIRS=/tmp/pkgs-{{.}} CONDA_SUBDIR={{.}} conda create --dry-run --json -p /tmp/env-{{.}} {{range $.Packages}}'{{.}}' {{end}}> /tmp/solve-{{.}}.json
+python - /tmp/solve-{{.}}.json <<'SCRIPT'
+import hashlib, json, os, sys, urllib.request
+
+actions = json.load(open(sys.argv[1])).get("actions", {})
+for pkg in actions.get("FETCH", []):
+    target = os.path.join("/packages", pkg["subdir"], pkg["fn"])
+    if os.path.exists(target):
+        continue
+    os.makedirs(os.path.dirname(target), exist_ok=True)
+    print("Downloading " + pkg["url"])
+    urllib.request.urlretrieve(pkg["url"], target + ".part")
+    if pkg.get("sha256"):
+        with open(target + ".part", "rb") as f:
+            if hashlib.sha256(f.read()).hexdigest() != pkg["sha256"]:
+                os.remove(target + ".part")
+                print("Checksum mismatch for " + pkg["url"])
+                continue
+    os.rename(target + ".part", target)
+SCRIPT
+{{end}}
+echo "Creating conda channel..."
+python -m conda_index /packages
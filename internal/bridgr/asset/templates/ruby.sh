@@ -3,6 +3,6 @@ mkdir -p /packages/gems
 gem install builder
 bundle package --all --no-install --cache-path=/packages/gems
 # 'package' does not grab bundler, even when specified
-gem fetch bundler
+gem fetch bundler ${BUNDLER_VERSION:+-v "$BUNDLER_VERSION"}
 mv bundler*.gem /packages/gems/
 gem generate_index -d /packages
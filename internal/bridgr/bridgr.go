@@ -26,8 +26,14 @@ var (
 	// DryRun holds whether workers should actually retrieve artifacts, or just do setup
 	DryRun = false
 
+	// Locked holds whether workers fetch exactly the artifacts pinned in the lock file, failing when they have drifted
+	Locked = false
+
 	// FileTimeout is the duration used for HTTP/s file download overall timeout. Used in the transport object
 	FileTimeout = time.Second * 20
+
+	// Threads is the maximum number of artifacts (and workers) that are fetched concurrently
+	Threads = 1
 )
 
 // BaseDir gives the runtime absolute directory of the base "packages" directory
@@ -58,6 +64,9 @@ type ImagePuller interface {
 
 // PullImage is a helper function that Pulls a docker image to the local docker daemon
 func PullImage(cli ImagePuller, imageRef reference.Named) error {
+	if err := registryTLS(reference.Domain(imageRef)); err != nil {
+		return err
+	}
 	creds := &DockerCredential{}
 	dockerAuth(imageRef, creds)
 	output, err := cli.ImagePull(context.Background(), imageRef.String(), image.PullOptions{RegistryAuth: creds.String()})
@@ -0,0 +1,381 @@
+package bridgr
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/kdomanski/iso9660"
+	"github.com/klauspost/compress/zstd"
+	log "unknwon.dev/clog/v2"
+)
+
+const manifestVersion = 1
+
+// the names of the manifest and its signatures at the root of a bundle, next to the packages directory
+const (
+	manifestFile  = "manifest.json"
+	manifestSig   = "manifest.sig"
+	manifestGPG   = "manifest.asc"
+	bundleVolume  = "BRIDGR"
+	bundlePackage = "packages"
+)
+
+// bundle formats
+const (
+	BundleTar    = "tar"
+	BundleTarZst = "tar.zst"
+	BundleISO    = "iso"
+)
+
+// Manifest lists every file in a bundle, for checking it after it is carried across
+type Manifest struct {
+	Version int            `json:"version"`
+	Bridgr  string         `json:"bridgr"`
+	Created time.Time      `json:"created"`
+	Files   []ManifestFile `json:"files"`
+}
+
+// ManifestFile is a file in a bundle. Its Path is relative to the packages directory. In an ISO9660 image, file names are
+// restricted, so the file is at ImagePath.
+type ManifestFile struct {
+	Path      string `json:"path"`
+	ImagePath string `json:"image_path,omitempty"`
+	Size      int64  `json:"size"`
+	SHA256    string `json:"sha256"`
+}
+
+// BundleOptions are the options of a bundle. Format is taken from the extension of Output when it is not given. Workers limits the
+// bundle to the directories of those workers. A bundle is signed with an ed25519 SigningKey, a GPG GPGKey, or both.
+type BundleOptions struct {
+	Output     string
+	Format     string
+	Workers    []string
+	SigningKey string
+	GPGKey     string
+}
+
+// format gives the format of the bundle, from its Output when it is not set
+func (o BundleOptions) format() (string, error) {
+	if o.Format != "" {
+		switch o.Format {
+		case BundleTar, BundleTarZst, BundleISO:
+			return o.Format, nil
+		}
+		return "", fmt.Errorf("unknown bundle format %s, expected one of %s, %s or %s", o.Format, BundleTar, BundleTarZst, BundleISO)
+	}
+	switch {
+	case strings.HasSuffix(o.Output, ".tar.zst"), strings.HasSuffix(o.Output, ".tzst"):
+		return BundleTarZst, nil
+	case strings.HasSuffix(o.Output, ".iso"):
+		return BundleISO, nil
+	case strings.HasSuffix(o.Output, ".tar"):
+		return BundleTar, nil
+	}
+	return "", fmt.Errorf("unable to tell the bundle format of %s, give a format", o.Output)
+}
+
+// Bundle writes the packages directory, or the directories of some workers in it, to a single archive with a signed manifest
+func Bundle(opts BundleOptions) error {
+	format, err := opts.format()
+	if err != nil {
+		return err
+	}
+	if opts.SigningKey == "" && opts.GPGKey == "" {
+		return errors.New("an ed25519 signing key or a GPG key is needed to sign the manifest")
+	}
+	output, _ := filepath.Abs(opts.Output)
+	if rel, err := filepath.Rel(BaseDir(""), output); err == nil && !strings.HasPrefix(rel, "..") {
+		return fmt.Errorf("the bundle %s can not be written inside the packages directory", opts.Output)
+	}
+
+	manifest, err := bundleManifest(opts.Workers, format == BundleISO)
+	if err != nil {
+		return err
+	}
+	// the manifest and its signatures are at the root of the bundle
+	files, err := manifest.sign(opts.SigningKey, opts.GPGKey)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	files[manifestFile] = content
+
+	out, err := os.Create(opts.Output)
+	if err != nil {
+		return err
+	}
+	if format == BundleISO {
+		err = writeISO(out, manifest, files)
+	} else {
+		err = writeTar(out, manifest, files, format == BundleTarZst)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(opts.Output)
+		return err
+	}
+	log.Info("Bundled %d files into %s", len(manifest.Files), opts.Output)
+	return nil
+}
+
+// bundleManifest lists the files of the packages directory, or only those of some workers. Partial downloads are left out.
+func bundleManifest(workers []string, image bool) (Manifest, error) {
+	manifest := Manifest{Version: manifestVersion, Bridgr: Version, Created: time.Now().UTC()}
+	roots := []string{BaseDir("")}
+	if len(workers) > 0 && strings.ToLower(workers[0]) != "all" {
+		roots = nil
+		for _, worker := range workers {
+			dir := BaseDir(worker)
+			if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+				return manifest, fmt.Errorf("%s has no packages to bundle", worker)
+			}
+			roots = append(roots, dir)
+		}
+	}
+
+	images := map[string]string{}
+	for _, root := range roots {
+		err := filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() || strings.HasSuffix(file, ".part") {
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return fmt.Errorf("%s is not a regular file", file)
+			}
+			rel := lockPath(file)
+			entry := ManifestFile{Path: rel}
+			if image {
+				entry.ImagePath = isoPath(path.Join(bundlePackage, rel))
+				if other, ok := images[entry.ImagePath]; ok {
+					return fmt.Errorf("%s and %s have the same ISO9660 name %s", other, rel, entry.ImagePath)
+				}
+				images[entry.ImagePath] = rel
+			}
+			if entry.Size, entry.SHA256, err = sha256File(file); err != nil {
+				return err
+			}
+			if image && entry.Size > math.MaxUint32 {
+				return fmt.Errorf("%s is too large for an ISO9660 image", rel)
+			}
+			manifest.Files = append(manifest.Files, entry)
+			return nil
+		})
+		if err != nil {
+			return manifest, err
+		}
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool { return manifest.Files[i].Path < manifest.Files[j].Path })
+	return manifest, nil
+}
+
+func sha256File(file string) (int64, string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	return size, hex.EncodeToString(hash.Sum(nil)), err
+}
+
+// sign signs the manifest, as it is written to the bundle, giving the signatures by their names in the bundle
+func (m Manifest) sign(signingKey, gpgKey string) (map[string][]byte, error) {
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	signatures := map[string][]byte{}
+	if signingKey != "" {
+		key, err := readEd25519Key(signingKey)
+		if err != nil {
+			return nil, fmt.Errorf("signing key %s: %s", signingKey, err)
+		}
+		signatures[manifestSig] = ed25519.Sign(key, content)
+	}
+	if gpgKey != "" {
+		signer, err := readSigningKey(gpgKey)
+		if err != nil {
+			return nil, fmt.Errorf("gpg key %s: %s", gpgKey, err)
+		}
+		signature := bytes.Buffer{}
+		if err := openpgp.ArmoredDetachSign(&signature, signer, bytes.NewReader(content), nil); err != nil {
+			return nil, err
+		}
+		signatures[manifestGPG] = signature.Bytes()
+	}
+	return signatures, nil
+}
+
+// readEd25519Key reads a PEM encoded PKCS #8 ed25519 private key, as written by `openssl genpkey -algorithm ed25519`
+func readEd25519Key(file string) (ed25519.PrivateKey, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("no PEM encoded private key found")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%T is not an ed25519 key", key)
+	}
+	return private, nil
+}
+
+// bundleFile copies a file of the manifest to a bundle, checking that it has not changed since the manifest was made
+func bundleFile(out io.Writer, entry ManifestFile) error {
+	f, err := os.Open(path.Join(BaseDir(""), entry.Path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(out, hash), io.LimitReader(f, entry.Size))
+	if err != nil {
+		return err
+	}
+	if size != entry.Size || hex.EncodeToString(hash.Sum(nil)) != entry.SHA256 {
+		return fmt.Errorf("%s changed while it was bundled", entry.Path)
+	}
+	return nil
+}
+
+// writeTar writes a bundle as a tar archive, with the manifest and its signatures first
+func writeTar(out io.Writer, manifest Manifest, extra map[string][]byte, compress bool) error {
+	if compress {
+		encoder, err := zstd.NewWriter(out)
+		if err != nil {
+			return err
+		}
+		if err := writeTar(encoder, manifest, extra, false); err != nil {
+			encoder.Close()
+			return err
+		}
+		return encoder.Close()
+	}
+
+	archive := tar.NewWriter(out)
+	for _, name := range []string{manifestFile, manifestSig, manifestGPG} {
+		content, ok := extra[name]
+		if !ok {
+			continue
+		}
+		header := &tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), ModTime: manifest.Created, Format: tar.FormatPAX}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if _, err := archive.Write(content); err != nil {
+			return err
+		}
+	}
+	for _, entry := range manifest.Files {
+		info, err := os.Stat(path.Join(BaseDir(""), entry.Path))
+		if err != nil {
+			return err
+		}
+		header := &tar.Header{Name: path.Join(bundlePackage, entry.Path), Mode: 0644, Size: entry.Size, ModTime: info.ModTime(), Format: tar.FormatPAX}
+		if err := archive.WriteHeader(header); err != nil {
+			return err
+		}
+		if err := bundleFile(archive, entry); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// writeISO writes a bundle as an ISO9660 image, ie for burning to a DVD
+func writeISO(out io.Writer, manifest Manifest, extra map[string][]byte) error {
+	writer, err := iso9660.NewWriter()
+	if err != nil {
+		return err
+	}
+	defer writer.Cleanup() //nolint:errcheck // the staging directory is temporary
+	for name, content := range extra {
+		if err := writer.AddFile(bytes.NewReader(content), name); err != nil {
+			return err
+		}
+	}
+	for _, entry := range manifest.Files {
+		// files are staged by copying them, rather than linking, so that they are checked against the manifest
+		pr, pw := io.Pipe()
+		go func(entry ManifestFile) { _ = pw.CloseWithError(bundleFile(pw, entry)) }(entry)
+		if err := writer.AddFile(pr, path.Join(bundlePackage, entry.Path)); err != nil {
+			_ = pr.CloseWithError(err)
+			return err
+		}
+	}
+	return writer.WriteTo(out, bundleVolume)
+}
+
+// isoPath gives the path that the ISO9660 image writer gives a file, in lower case as Linux shows it. Directory and file names are
+// restricted to ECMA-119 d-characters, with a single extension, and are truncated.
+func isoPath(file string) string {
+	segments := strings.Split(file, "/")
+	for i, segment := range segments[:len(segments)-1] {
+		segments[i] = isoName(segment, 31)
+	}
+	name := strings.ToLower(segments[len(segments)-1])
+	parts := strings.Split(name, ".")
+	base, extension := parts[0], ""
+	if len(parts) > 1 {
+		base, extension = strings.Join(parts[:len(parts)-1], "_"), isoName(parts[len(parts)-1], 8)
+	}
+	// the file name has room for the ";1" version too
+	length := 30 - 2
+	if extension != "" {
+		length -= 1 + len(extension)
+	}
+	segments[len(segments)-1] = isoName(base, length)
+	if extension != "" {
+		segments[len(segments)-1] += "." + extension
+	}
+	return strings.Join(segments, "/")
+}
+
+// isoName is a name in ECMA-119 d-characters, in lower case. Like the image writer, every byte that is not one is replaced.
+func isoName(name string, length int) string {
+	name = strings.ToLower(name)
+	if len(name) > length {
+		name = name[:length]
+	}
+	mangled := []byte(name)
+	for i, b := range mangled {
+		if !((b >= 'a' && b <= 'z') || (b >= '0' && b <= '9') || strings.IndexByte("_!\"%&'()*+,-./:;<=>?", b) >= 0) {
+			mangled[i] = '_'
+		}
+	}
+	return string(mangled)
+}
@@ -0,0 +1,233 @@
+package bridgr
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+	"github.com/kdomanski/iso9660"
+	"github.com/klauspost/compress/zstd"
+)
+
+// testPackages writes a packages directory to bundle, giving the content of its files
+func testPackages(t *testing.T) map[string]string {
+	t.Helper()
+	files := map[string]string{
+		"files/banana.tar.gz":                "there's always money in the banana stand",
+		"files/packer_1.4.3_linux_amd64.zip": "packer",
+		"git/stair-car.git/HEAD":             "ref: refs/heads/master",
+		"docker/bluth/banana-latest.tar":     "image",
+	}
+	for name, content := range files {
+		_ = os.MkdirAll(path.Dir(path.Join(BaseDir(""), name)), os.ModePerm)
+		_ = os.WriteFile(path.Join(BaseDir(""), name), []byte(content), 0644)
+	}
+	_ = os.WriteFile(path.Join(BaseDir("files"), "download.iso.part"), []byte("part"), 0644)
+	return files
+}
+
+// testEd25519Key writes an ed25519 private key, giving its public key
+func testEd25519Key(t *testing.T, file string) ed25519.PublicKey {
+	t.Helper()
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+	return public
+}
+
+// readBundle reads the files of a bundle by their path in it
+func readBundle(t *testing.T, file, format string) map[string]string {
+	t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	files := map[string]string{}
+	if format == BundleISO {
+		image, err := iso9660.OpenImage(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		root, _ := image.RootDir()
+		var walk func(dir *iso9660.File, prefix string)
+		walk = func(dir *iso9660.File, prefix string) {
+			children, _ := dir.GetChildren()
+			for _, child := range children {
+				if child.IsDir() {
+					walk(child, path.Join(prefix, child.Name()))
+					continue
+				}
+				content, _ := io.ReadAll(child.Reader())
+				files[path.Join(prefix, child.Name())] = string(content)
+			}
+		}
+		walk(root, "")
+		return files
+	}
+
+	var in io.Reader = f
+	if format == BundleTarZst {
+		decoder, err := zstd.NewReader(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer decoder.Close()
+		in = decoder
+	}
+	archive := tar.NewReader(in)
+	for first := true; ; first = false {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if first && header.Name != manifestFile {
+			t.Errorf("expected the manifest to be first in the bundle, got %s", header.Name)
+		}
+		content, _ := io.ReadAll(archive)
+		files[header.Name] = string(content)
+	}
+	return files
+}
+
+func TestBundle(t *testing.T) {
+	t.Chdir(t.TempDir())
+	packages := testPackages(t)
+	public := testEd25519Key(t, "bundle.key")
+	signer := testSigner(t, "bluth.asc", true)
+	secret := bytes.Buffer{}
+	w, _ := armor.Encode(&secret, openpgp.PrivateKeyType, nil)
+	_ = signer.SerializePrivate(w, nil)
+	w.Close()
+	_ = os.WriteFile("bluth-secret.asc", secret.Bytes(), 0600)
+	keyring, _ := readKeyring("bluth.asc")
+
+	tests := []struct {
+		name    string
+		opts    BundleOptions
+		workers []string
+	}{
+		{"tar", BundleOptions{Output: "bundle.tar", SigningKey: "bundle.key"}, []string{"docker", "files", "git"}},
+		{"tar.zst", BundleOptions{Output: "bundle.tar.zst", GPGKey: "bluth-secret.asc"}, []string{"docker", "files", "git"}},
+		{"iso", BundleOptions{Output: "bundle.iso", SigningKey: "bundle.key", GPGKey: "bluth-secret.asc"}, []string{"docker", "files", "git"}},
+		{"format", BundleOptions{Output: "bundle.dvd", Format: BundleISO, SigningKey: "bundle.key"}, []string{"docker", "files", "git"}},
+		{"workers", BundleOptions{Output: "files.tar", SigningKey: "bundle.key", Workers: []string{"files"}}, []string{"files"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := Bundle(test.opts); err != nil {
+				t.Fatal(err)
+			}
+			format, _ := test.opts.format()
+			bundle := readBundle(t, test.opts.Output, format)
+
+			manifest := Manifest{}
+			if err := json.Unmarshal([]byte(bundle[manifestFile]), &manifest); err != nil {
+				t.Fatal(err)
+			}
+			if sig, ok := bundle[manifestSig]; ok != (test.opts.SigningKey != "") || (ok && !ed25519.Verify(public, []byte(bundle[manifestFile]), []byte(sig))) {
+				t.Errorf("expected the manifest to be signed with the ed25519 key: %t", test.opts.SigningKey != "")
+			}
+			if sig, ok := bundle[manifestGPG]; ok != (test.opts.GPGKey != "") || (ok && verifySignature(keyring, strings.NewReader(bundle[manifestFile]), []byte(sig)) != nil) {
+				t.Errorf("expected the manifest to be signed with the gpg key: %t", test.opts.GPGKey != "")
+			}
+
+			workers := map[string]bool{}
+			for _, entry := range manifest.Files {
+				workers[strings.Split(entry.Path, "/")[0]] = true
+				name := path.Join(bundlePackage, entry.Path)
+				if format == BundleISO {
+					name = entry.ImagePath
+				}
+				if bundle[name] != packages[entry.Path] {
+					t.Errorf("expected %s in the bundle to be %q, got %q", name, packages[entry.Path], bundle[name])
+				}
+				if entry.Size != int64(len(packages[entry.Path])) || entry.SHA256 != sha256Of(packages[entry.Path]) {
+					t.Errorf("expected the size and SHA-256 of %s in the manifest, got %+v", entry.Path, entry)
+				}
+				if strings.HasSuffix(entry.Path, ".part") {
+					t.Errorf("expected no partial downloads in the bundle, got %s", entry.Path)
+				}
+			}
+			var got []string
+			for worker := range workers {
+				got = append(got, worker)
+			}
+			sorted := cmpopts.SortSlices(func(a, b string) bool { return a < b })
+			if !cmp.Equal(test.workers, got, sorted) {
+				t.Error(cmp.Diff(test.workers, got, sorted))
+			}
+		})
+	}
+}
+
+func TestBundleErrors(t *testing.T) {
+	t.Chdir(t.TempDir())
+	testPackages(t)
+	testEd25519Key(t, "bundle.key")
+	_ = os.WriteFile(path.Join(BaseDir("files"), "banana_tar.gz"), []byte("frozen"), 0644)
+
+	tests := []struct {
+		name string
+		opts BundleOptions
+	}{
+		{"unsigned", BundleOptions{Output: "bundle.tar"}},
+		{"unknown extension", BundleOptions{Output: "bundle.zip", SigningKey: "bundle.key"}},
+		{"unknown format", BundleOptions{Output: "bundle.tar", Format: "zip", SigningKey: "bundle.key"}},
+		{"inside packages", BundleOptions{Output: "packages/bundle.tar", SigningKey: "bundle.key"}},
+		{"unknown worker", BundleOptions{Output: "bundle.tar", SigningKey: "bundle.key", Workers: []string{"tobias"}}},
+		{"missing key", BundleOptions{Output: "bundle.tar", SigningKey: "missing.key"}},
+		{"not an ed25519 key", BundleOptions{Output: "bundle.tar", SigningKey: path.Join(BaseDir("files"), "banana.tar.gz")}},
+		{"iso9660 name collision", BundleOptions{Output: "bundle.iso", SigningKey: "bundle.key"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := Bundle(test.opts); err == nil {
+				t.Error("expected an error")
+			}
+			if _, err := os.Stat(test.opts.Output); err == nil {
+				t.Errorf("expected no bundle to be written, but %s exists", test.opts.Output)
+			}
+		})
+	}
+}
+
+func TestISOPath(t *testing.T) {
+	tests := []struct {
+		file   string
+		expect string
+	}{
+		{"packages/files/banana.tar.gz", "packages/files/banana_tar.gz"},
+		{"packages/Docker/Banana-Latest.TAR", "packages/docker/banana-latest.tar"},
+		{"packages/git/HEAD", "packages/git/head"},
+		{"packages/files/a very long name for a file in bluth company.json", "packages/files/a_very_long_name_for_a_.json"},
+		{"packages/files/bänana", "packages/files/b__nana"},
+		{"packages/a directory name longer than thirty one characters/x", "packages/a_directory_name_longer_than_th/x"},
+	}
+	for _, test := range tests {
+		t.Run(test.file, func(t *testing.T) {
+			if got := isoPath(test.file); got != test.expect {
+				t.Errorf("expected %s, got %s", test.expect, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package bridgr
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"sync"
+	"time"
+)
+
+// cacheEntry is what was last fetched from a source, to tell on later runs whether it has changed
+type cacheEntry struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Digest       string `json:"digest,omitempty"`
+	// Size and ModTime are of the local file, so that a file that was changed or removed since is fetched again
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+type contentCache struct {
+	mu      sync.Mutex
+	entries map[string]cacheEntry
+}
+
+var cache = &contentCache{entries: map[string]cacheEntry{}}
+
+// CacheFile is where the content cache is kept between runs, next to the packages directory
+func CacheFile() string {
+	return path.Join(path.Dir(BaseDir("")), ".bridgr", "cache.json")
+}
+
+// ReadCache reads the content cache of earlier runs. A missing cache is empty.
+func ReadCache() error {
+	content, err := os.ReadFile(CacheFile())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	entries := map[string]cacheEntry{}
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return err
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.entries = entries
+	return nil
+}
+
+// WriteCache writes the content cache for later runs
+func WriteCache() error {
+	cache.mu.Lock()
+	content, err := json.MarshalIndent(cache.entries, "", "  ")
+	cache.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(CacheFile()), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(CacheFile(), content, 0644)
+}
+
+// cacheKey identifies a source fetched to a local file. The same source may be fetched to more than one file, each with its own entry.
+func cacheKey(source, file string) string {
+	if file == "" {
+		return source
+	}
+	return source + " " + lockPath(file)
+}
+
+// cacheGet gives what was cached for a source, when the local file it was fetched to is unchanged since.
+// Sources that are not fetched to a local file, like images pushed to a registry, have no file.
+func cacheGet(source, file string) (cacheEntry, bool) {
+	cache.mu.Lock()
+	entry, ok := cache.entries[cacheKey(source, file)]
+	cache.mu.Unlock()
+	if !ok || file == "" {
+		return entry, ok
+	}
+	info, err := os.Stat(file)
+	if err != nil || info.Size() != entry.Size || !info.ModTime().Equal(entry.ModTime) {
+		return cacheEntry{}, false
+	}
+	return entry, true
+}
+
+// cachePut records what was fetched from a source to the local file
+func cachePut(source, file string, entry cacheEntry) {
+	if file != "" {
+		info, err := os.Stat(file)
+		if err != nil {
+			return
+		}
+		entry.Size, entry.ModTime = info.Size(), info.ModTime()
+	}
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+	cache.entries[cacheKey(source, file)] = entry
+}
@@ -0,0 +1,81 @@
+package bridgr
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// resetCache gives a test its own, empty content cache
+func resetCache(t *testing.T) {
+	t.Helper()
+	original := cache
+	t.Cleanup(func() { cache = original })
+	cache = &contentCache{entries: map[string]cacheEntry{}}
+}
+
+func TestCacheGetPut(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resetCache(t)
+	_ = os.WriteFile("banana.tar.gz", []byte("banana"), 0644)
+	cachePut("https://bluth.com/banana.tar.gz", "banana.tar.gz", cacheEntry{ETag: `"frozen"`})
+	cachePut("https://bluth.com/missing.tar.gz", "missing.tar.gz", cacheEntry{ETag: `"missing"`})
+	cachePut("registry.bluth.com/banana:latest", "", cacheEntry{Digest: "sha256:abc"})
+
+	if entry, ok := cacheGet("https://bluth.com/banana.tar.gz", "banana.tar.gz"); !ok || entry.ETag != `"frozen"` {
+		t.Errorf("expected the cached entry, got %+v", entry)
+	}
+	if _, ok := cacheGet("https://bluth.com/missing.tar.gz", "missing.tar.gz"); ok {
+		t.Error("expected a source that was not written to not be cached")
+	}
+	if entry, ok := cacheGet("registry.bluth.com/banana:latest", ""); !ok || entry.Digest != "sha256:abc" {
+		t.Errorf("expected the cached entry without a file, got %+v", entry)
+	}
+
+	_ = os.WriteFile("frozen.tar.gz", []byte("frozen banana"), 0644)
+	cachePut("https://bluth.com/banana.tar.gz", "frozen.tar.gz", cacheEntry{ETag: `"frozen"`})
+	if _, ok := cacheGet("https://bluth.com/banana.tar.gz", "banana.tar.gz"); !ok {
+		t.Error("expected a source fetched to another file to keep the entry of the first file")
+	}
+	if _, ok := cacheGet("https://bluth.com/banana.tar.gz", "frozen.tar.gz"); !ok {
+		t.Error("expected a source fetched to another file to have its own entry")
+	}
+
+	later := time.Now().Add(time.Hour)
+	_ = os.Chtimes("banana.tar.gz", later, later)
+	if _, ok := cacheGet("https://bluth.com/banana.tar.gz", "banana.tar.gz"); ok {
+		t.Error("expected a file changed since it was cached to not be cached")
+	}
+}
+
+func TestReadWriteCache(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resetCache(t)
+	if err := ReadCache(); err != nil {
+		t.Errorf("expected a missing cache to be empty, got %s", err)
+	}
+	_ = os.WriteFile("banana.tar.gz", []byte("banana"), 0644)
+	cachePut("https://bluth.com/banana.tar.gz", "banana.tar.gz", cacheEntry{ETag: `"frozen"`, LastModified: "Wed, 02 Nov 2005 09:00:00 GMT"})
+	if err := WriteCache(); err != nil {
+		t.Fatal(err)
+	}
+	expect := cache.entries
+
+	resetCache(t)
+	if err := ReadCache(); err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(expect, cache.entries) {
+		t.Error(cmp.Diff(expect, cache.entries))
+	}
+	if _, ok := cacheGet("https://bluth.com/banana.tar.gz", "banana.tar.gz"); !ok {
+		t.Error("expected the cache read back to match the file")
+	}
+
+	_ = os.WriteFile(CacheFile(), []byte("{"), 0644)
+	if err := ReadCache(); err == nil {
+		t.Error("expected an error for an invalid cache")
+	}
+}
@@ -0,0 +1,481 @@
+package bridgr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/distribution/reference"
+	"github.com/mitchellh/mapstructure"
+	log "unknwon.dev/clog/v2"
+)
+
+const (
+	defaultCargoIndex    = "https://index.crates.io"
+	defaultCargoDownload = "https://static.crates.io/crates"
+	cargoIndexLineLimit  = 4 * 1024 * 1024
+)
+
+// Cargo is the configuration object for creating a Rust sparse registry
+type Cargo struct {
+	Index    string
+	Download string
+	Host     string
+	Crates   []cargoCrate
+}
+
+type cargoCrate struct {
+	Package  string
+	Version  string
+	Features []string
+}
+
+// cargoVersion is a single line in a registry index file, describing one published version of a crate
+type cargoVersion struct {
+	Name      string              `json:"name"`
+	Vers      string              `json:"vers"`
+	Deps      []cargoDependency   `json:"deps"`
+	Cksum     string              `json:"cksum"`
+	Features  map[string][]string `json:"features"`
+	Features2 map[string][]string `json:"features2"`
+	Yanked    bool                `json:"yanked"`
+	raw       []byte
+}
+
+type cargoDependency struct {
+	Name            string   `json:"name"`
+	Req             string   `json:"req"`
+	Features        []string `json:"features"`
+	Optional        bool     `json:"optional"`
+	DefaultFeatures bool     `json:"default_features"`
+	Kind            string   `json:"kind"`
+	Registry        string   `json:"registry"`
+	Package         string   `json:"package"`
+}
+
+func (cc cargoCrate) String() string {
+	if cc.Version != "" {
+		return cc.Package + "@" + cc.Version
+	}
+	return cc.Package
+}
+
+// crate gives the name of the crate a dependency refers to, as dependencies may be renamed
+func (cd cargoDependency) crate() string {
+	if cd.Package != "" {
+		return cd.Package
+	}
+	return cd.Name
+}
+
+// dir is the top-level directory name for all objects written out under the Cargo worker
+func (c Cargo) dir() string {
+	return BaseDir(c.Name())
+}
+
+// Name returns the name of this Configuration
+func (c Cargo) Name() string {
+	return "cargo"
+}
+
+// Image implements the Imager interface
+func (c Cargo) Image() reference.Named {
+	return nil
+}
+
+func stringToCargoCrate(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf(cargoCrate{}) {
+		return data, nil
+	}
+	parts := strings.SplitN(data.(string), "@", 2)
+	crate := cargoCrate{Package: parts[0]}
+	if len(parts) > 1 {
+		crate.Version = parts[1]
+	}
+	return crate, nil
+}
+
+func arrayToCargo(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Slice || t != reflect.TypeOf(Cargo{}) {
+		return data, nil
+	}
+	return map[string]interface{}{"crates": data}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (c *Cargo) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		arrayToCargo,
+		stringToCargoCrate,
+	)
+}
+
+// Setup prepares the directory for the Cargo registry
+func (c *Cargo) Setup() error {
+	log.Trace("Called Cargo.Setup()")
+	if c.Index == "" {
+		c.Index = defaultCargoIndex
+	}
+	if c.Download == "" {
+		c.Download = defaultCargoDownload
+	}
+	c.Index = strings.TrimSuffix(strings.TrimPrefix(c.Index, "sparse+"), "/")
+	c.Download = strings.TrimSuffix(c.Download, "/")
+	if c.Host == "" {
+		log.Warn("Cargo: no host is configured, the download URL in config.json will be relative and must be rewritten before cargo can use it")
+	}
+	return os.MkdirAll(c.dir(), os.ModePerm)
+}
+
+// Run resolves the configured crates and their dependencies, then downloads them and writes the sparse index
+func (c *Cargo) Run() error {
+	if err := c.Setup(); err != nil {
+		return err
+	}
+	resolver := cargoResolver{cargo: c, index: map[string][]cargoVersion{}, enabled: map[string]map[string]bool{}, selected: map[string]cargoVersion{}}
+	resolver.resolve(c.Crates)
+
+	keys := make([]string, 0, len(resolver.selected))
+	for key := range resolver.selected {
+		keys = append(keys, key)
+	}
+	downloaded := map[string][]cargoVersion{}
+	mu := sync.Mutex{}
+	forEach(len(keys), func(i int) {
+		version := resolver.selected[keys[i]]
+		if err := c.download(version); err != nil {
+			log.Info("Cargo: unable to download %s %s - %s", version.Name, version.Vers, err)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		downloaded[version.Name] = append(downloaded[version.Name], version)
+	})
+
+	for name, versions := range downloaded {
+		if err := c.writeIndex(name, versions); err != nil {
+			log.Info("Cargo: unable to write index for %s - %s", name, err)
+		}
+	}
+	return c.writeConfig()
+}
+
+// download fetches a crate file, and verifies it against the checksum in the index
+func (c *Cargo) download(version cargoVersion) error {
+	source, err := url.Parse(fmt.Sprintf("%s/%s/%s-%s.crate", c.Download, version.Name, version.Name, version.Vers))
+	if err != nil {
+		return err
+	}
+	target := c.crateFile(version)
+	if err := download(source, target); err != nil {
+		return err
+	}
+	sum, err := fileChecksum(target, "sha256")
+	if err != nil {
+		return err
+	}
+	if sum != version.Cksum {
+		_ = os.Remove(target)
+		return fmt.Errorf("checksum mismatch, expected %s but got %s", version.Cksum, sum)
+	}
+	return nil
+}
+
+// crateFile gives the location of a crate file in the registry
+func (c *Cargo) crateFile(version cargoVersion) string {
+	return path.Join(c.dir(), "crates", version.Name, version.Name+"-"+version.Vers+".crate")
+}
+
+// writeIndex writes the index file of a crate, with only the versions that are in this registry. Versions from earlier runs
+// are kept in the index for as long as their crate file is.
+func (c *Cargo) writeIndex(name string, versions []cargoVersion) error {
+	target := path.Join(c.dir(), cargoIndexPath(name))
+	if existing, err := os.Open(target); err == nil {
+		previous, err := parseCargoIndex(existing)
+		existing.Close()
+		if err != nil {
+			log.Warn("Cargo: unable to read the existing index of %s, it will only have the versions of this run - %s", name, err)
+			previous = nil
+		}
+		written := map[string]bool{}
+		for _, version := range versions {
+			written[version.Vers] = true
+		}
+		for _, version := range previous {
+			if _, err := os.Stat(c.crateFile(version)); err == nil && !written[version.Vers] {
+				versions = append(versions, version)
+			}
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		vi, _ := semver.NewVersion(versions[i].Vers)
+		vj, _ := semver.NewVersion(versions[j].Vers)
+		return vi != nil && vj != nil && vi.LessThan(vj)
+	})
+	content := bytes.Buffer{}
+	for _, version := range versions {
+		content.Write(version.raw)
+		content.WriteByte('\n')
+	}
+	if err := os.MkdirAll(path.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(target, content.Bytes(), 0644) //nolint:gosec // repository content is meant to be readable
+}
+
+// writeConfig writes the registry config.json, pointing cargo at the crate files hosted by Bridgr
+func (c *Cargo) writeConfig() error {
+	config := map[string]interface{}{
+		"dl": strings.TrimSuffix(c.Host, "/") + "/" + path.Join(c.Name(), "crates") + "/{crate}/{crate}-{version}.crate",
+	}
+	content, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(c.dir(), "config.json"), content, 0644) //nolint:gosec // repository content is meant to be readable
+}
+
+// cargoIndexPath gives the location of a crate's index file, relative to the root of the index
+func cargoIndexPath(name string) string {
+	name = strings.ToLower(name)
+	switch len(name) {
+	case 1:
+		return path.Join("1", name)
+	case 2:
+		return path.Join("2", name)
+	case 3:
+		return path.Join("3", name[:1], name)
+	}
+	return path.Join(name[:2], name[2:4], name)
+}
+
+// cargoConstraint reads a cargo version requirement. A bare version in cargo is a caret requirement, ie "1.2" is "^1.2".
+func cargoConstraint(req string) (*semver.Constraints, error) {
+	if strings.TrimSpace(req) == "" {
+		req = "*"
+	}
+	parts := strings.Split(req, ",")
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if part != "" && part[0] >= '0' && part[0] <= '9' {
+			part = "^" + part
+		}
+		parts[i] = part
+	}
+	return semver.NewConstraint(strings.Join(parts, ", "))
+}
+
+// features gives all features of a crate version. Newer index entries put some features in "features2".
+func (cv cargoVersion) features() map[string][]string {
+	all := map[string][]string{}
+	for name, list := range cv.Features {
+		all[name] = list
+	}
+	for name, list := range cv.Features2 {
+		all[name] = list
+	}
+	return all
+}
+
+// activate expands enabled features, and gives the dependencies they require along with the features enabled on each dependency.
+// Dev-dependencies are never needed. Dependencies for every target are included, since cargo resolves all targets in Cargo.lock.
+func (cv cargoVersion) activate(enabled map[string]bool) map[string]cargoRequest {
+	features := cv.features()
+	optional := map[string]bool{}
+	extra := map[string][]string{}
+	seen := map[string]bool{}
+	queue := make([]string, 0, len(enabled))
+	for feature := range enabled {
+		queue = append(queue, feature)
+	}
+	for len(queue) > 0 {
+		feature := queue[0]
+		queue = queue[1:]
+		if seen[feature] {
+			continue
+		}
+		seen[feature] = true
+		list, ok := features[feature]
+		if !ok {
+			optional[feature] = true // an optional dependency is implicitly a feature of the same name
+			continue
+		}
+		for _, item := range list {
+			switch {
+			case strings.HasPrefix(item, "dep:"):
+				optional[strings.TrimPrefix(item, "dep:")] = true
+			case strings.Contains(item, "/"):
+				parts := strings.SplitN(item, "/", 2)
+				dep := strings.TrimSuffix(parts[0], "?")
+				extra[dep] = append(extra[dep], parts[1])
+				if !strings.HasSuffix(parts[0], "?") {
+					optional[dep] = true
+				}
+			default:
+				queue = append(queue, item)
+			}
+		}
+	}
+
+	requests := map[string]cargoRequest{}
+	for _, dep := range cv.Deps {
+		if dep.Kind == "dev" || dep.Registry != "" || (dep.Optional && !optional[dep.Name]) {
+			continue
+		}
+		key := dep.crate() + " " + dep.Req
+		request := requests[key]
+		request.name = dep.crate()
+		request.req = dep.Req
+		request.features = append(append(request.features, dep.Features...), extra[dep.Name]...)
+		request.defaultFeatures = request.defaultFeatures || dep.DefaultFeatures
+		requests[key] = request
+	}
+	return requests
+}
+
+type cargoRequest struct {
+	name            string
+	req             string
+	features        []string
+	defaultFeatures bool
+}
+
+type cargoResolver struct {
+	cargo    *Cargo
+	mu       sync.Mutex
+	index    map[string][]cargoVersion
+	enabled  map[string]map[string]bool
+	selected map[string]cargoVersion
+}
+
+// resolve selects the newest version matching each requirement, following the dependencies enabled by features.
+// Crate versions are revisited whenever a dependent enables more features on them.
+func (r *cargoResolver) resolve(crates []cargoCrate) {
+	var queue []cargoRequest
+	for _, crate := range crates {
+		queue = append(queue, cargoRequest{name: crate.Package, req: crate.Version, features: crate.Features, defaultFeatures: true})
+	}
+	for len(queue) > 0 {
+		r.fetchIndexes(queue)
+		var next []cargoRequest
+		for _, request := range queue {
+			version, err := r.pick(request)
+			if err != nil {
+				log.Info("Cargo: unable to resolve %s %s - %s", request.name, request.req, err)
+				continue
+			}
+			key := version.Name + "@" + version.Vers
+			enabled, visited := r.enabled[key]
+			if !visited {
+				enabled = map[string]bool{}
+				r.enabled[key] = enabled
+				r.selected[key] = version
+			}
+			added := !visited
+			features := append([]string{}, request.features...)
+			if _, ok := version.features()["default"]; ok && request.defaultFeatures {
+				features = append(features, "default")
+			}
+			for _, feature := range features {
+				if !enabled[feature] {
+					enabled[feature] = true
+					added = true
+				}
+			}
+			if !added {
+				continue
+			}
+			for _, dep := range version.activate(enabled) {
+				next = append(next, dep)
+			}
+		}
+		queue = next
+	}
+}
+
+// fetchIndexes reads the upstream index files of all requested crates that haven't been read yet
+func (r *cargoResolver) fetchIndexes(requests []cargoRequest) {
+	var names []string
+	seen := map[string]bool{}
+	for _, request := range requests {
+		if _, ok := r.index[request.name]; !ok && !seen[request.name] {
+			seen[request.name] = true
+			names = append(names, request.name)
+		}
+	}
+	forEach(len(names), func(i int) {
+		versions, err := r.cargo.readIndex(names[i])
+		if err != nil {
+			log.Info("Cargo: unable to get index for %s - %s", names[i], err)
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.index[names[i]] = versions
+	})
+}
+
+// pick gives the newest, non-yanked version of a crate matching the request
+func (r *cargoResolver) pick(request cargoRequest) (cargoVersion, error) {
+	constraint, err := cargoConstraint(request.req)
+	if err != nil {
+		return cargoVersion{}, err
+	}
+	var (
+		best       cargoVersion
+		bestParsed *semver.Version
+	)
+	for _, candidate := range r.index[request.name] {
+		parsed, err := semver.NewVersion(candidate.Vers)
+		if err != nil || candidate.Yanked || !constraint.Check(parsed) {
+			continue
+		}
+		if bestParsed == nil || parsed.GreaterThan(bestParsed) {
+			best, bestParsed = candidate, parsed
+		}
+	}
+	if bestParsed == nil {
+		return cargoVersion{}, errors.New("no matching version")
+	}
+	return best, nil
+}
+
+// readIndex gets every version of a crate from the upstream sparse index
+func (c *Cargo) readIndex(name string) ([]cargoVersion, error) {
+	resp, err := httpGet(c.Index + "/" + cargoIndexPath(name))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return parseCargoIndex(resp.Body)
+}
+
+// parseCargoIndex reads the versions of a crate from its index file, one JSON document per line
+func parseCargoIndex(r io.Reader) ([]cargoVersion, error) {
+	var versions []cargoVersion
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), cargoIndexLineLimit)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		version := cargoVersion{}
+		if err := json.Unmarshal(line, &version); err != nil {
+			return nil, err
+		}
+		version.raw = append([]byte{}, line...)
+		versions = append(versions, version)
+	}
+	return versions, scanner.Err()
+}
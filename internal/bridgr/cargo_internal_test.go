@@ -0,0 +1,252 @@
+package bridgr
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func cargoCrateContent(name, version string) string {
+	return fmt.Sprintf("crate %s %s", name, version)
+}
+
+func cargoIndexLine(name, version string, deps []cargoDependency, features map[string][]string) string {
+	entry := cargoVersion{Name: name, Vers: version, Deps: deps, Features: features, Cksum: fmt.Sprintf("%x", sha256.Sum256([]byte(cargoCrateContent(name, version))))}
+	if name == "windows-thing" {
+		entry.Cksum = "bad"
+	}
+	if version == "1.1.0" {
+		entry.Yanked = true
+	}
+	line, _ := json.Marshal(entry)
+	return string(line)
+}
+
+func cargoRegistry() *httptest.Server {
+	index := map[string][]string{
+		"/st/ai/stair-car": {
+			cargoIndexLine("stair-car", "0.9.0", nil, nil),
+			cargoIndexLine("stair-car", "1.0.0", []cargoDependency{
+				{Name: "banana", Req: "0.2", DefaultFeatures: true, Kind: "normal"},
+				{Name: "seal", Req: "1", Optional: true, DefaultFeatures: true, Kind: "normal"},
+				{Name: "hop-on", Req: "1", DefaultFeatures: true, Kind: "dev"},
+				{Name: "windows-thing", Req: "0.1", DefaultFeatures: true, Kind: "normal"},
+			}, map[string][]string{"default": {"std"}, "std": {"banana/std"}, "fast": {"seal"}}),
+			cargoIndexLine("stair-car", "1.1.0", nil, nil),
+		},
+		"/ba/na/banana": {
+			cargoIndexLine("banana", "0.2.1", nil, nil),
+			cargoIndexLine("banana", "0.2.5", []cargoDependency{{Name: "corn", Package: "cornballer", Req: "=1.0.0", Optional: true, Kind: "normal"}}, map[string][]string{"std": {"dep:corn"}}),
+			cargoIndexLine("banana", "0.3.0", nil, nil),
+		},
+		"/co/rn/cornballer":    {cargoIndexLine("cornballer", "1.0.0", nil, nil), cargoIndexLine("cornballer", "1.0.1", nil, nil)},
+		"/wi/nd/windows-thing": {cargoIndexLine("windows-thing", "0.1.0", nil, nil)},
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lines, ok := index[r.URL.Path]; ok {
+			fmt.Fprint(w, strings.Join(lines, "\n"))
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/crates/") {
+			file := strings.TrimSuffix(path.Base(r.URL.Path), ".crate")
+			name := path.Base(path.Dir(r.URL.Path))
+			fmt.Fprint(w, cargoCrateContent(name, strings.TrimPrefix(file, name+"-")))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+}
+
+func TestCargoDir(t *testing.T) {
+	expected := BaseDir("cargo")
+	result := Cargo{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestStringToCargoCrate(t *testing.T) {
+	result, err := stringToCargoCrate(reflect.TypeOf(""), reflect.TypeOf(cargoCrate{}), "serde@1.0")
+	if err != nil {
+		t.Error(err)
+	}
+	if !cmp.Equal(cargoCrate{Package: "serde", Version: "1.0"}, result) {
+		t.Error(cmp.Diff(cargoCrate{Package: "serde", Version: "1.0"}, result))
+	}
+	other, _ := stringToCargoCrate(reflect.TypeOf(42), reflect.TypeOf(cargoCrate{}), 42)
+	if !cmp.Equal(42, other) {
+		t.Error(cmp.Diff(42, other))
+	}
+}
+
+func TestCargoIndexPath(t *testing.T) {
+	tests := []struct {
+		name   string
+		expect string
+	}{
+		{"a", "1/a"},
+		{"cc", "2/cc"},
+		{"syn", "3/s/syn"},
+		{"Serde", "se/rd/serde"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := cargoIndexPath(test.name)
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestCargoConstraint(t *testing.T) {
+	tests := []struct {
+		req     string
+		version string
+		expect  bool
+	}{
+		{"1.2", "1.9.0", true},
+		{"1.2", "2.0.0", false},
+		{"0.2.3", "0.2.9", true},
+		{"0.2.3", "0.3.0", false},
+		{"=1.0.0", "1.0.1", false},
+		{">= 1.0, < 1.5", "1.4.0", true},
+		{"~1.2", "1.3.0", false},
+		{"", "5.0.0", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.req+" "+test.version, func(t *testing.T) {
+			constraint, err := cargoConstraint(test.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := constraint.Check(semver.MustParse(test.version))
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestCargoActivate(t *testing.T) {
+	version := cargoVersion{
+		Deps: []cargoDependency{
+			{Name: "a", Req: "1", DefaultFeatures: true},
+			{Name: "b", Req: "1", Optional: true},
+			{Name: "c", Req: "1", Optional: true},
+			{Name: "d", Req: "1", Optional: true},
+			{Name: "e", Req: "1", Kind: "dev"},
+		},
+		Features:  map[string][]string{"default": {"extra"}, "extra": {"a/fast", "dep:b"}},
+		Features2: map[string][]string{"weak": {"c?/std"}},
+	}
+	tests := []struct {
+		name    string
+		enabled map[string]bool
+		expect  []string
+	}{
+		{"no features", map[string]bool{}, []string{"a"}},
+		{"default", map[string]bool{"default": true}, []string{"a", "b"}},
+		{"implicit feature", map[string]bool{"d": true}, []string{"a", "d"}},
+		{"weak dependency feature", map[string]bool{"weak": true}, []string{"a"}},
+	}
+
+	sorted := cmpopts.SortSlices(func(a, b string) bool { return a < b })
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var result []string
+			for _, request := range version.activate(test.enabled) {
+				result = append(result, request.name)
+			}
+			if !cmp.Equal(test.expect, result, sorted) {
+				t.Error(cmp.Diff(test.expect, result, sorted))
+			}
+		})
+	}
+
+	requests := version.activate(map[string]bool{"default": true})
+	if !cmp.Equal([]string{"fast"}, requests["a 1"].features) {
+		t.Error(cmp.Diff([]string{"fast"}, requests["a 1"].features))
+	}
+}
+
+func TestCargoRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := cargoRegistry()
+	defer server.Close()
+
+	cargo := Cargo{Index: "sparse+" + server.URL + "/", Download: server.URL + "/crates", Host: "http://bridgr.bluth.com", Crates: []cargoCrate{{Package: "stair-car"}}}
+	if err := cargo.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectFiles := []string{
+		"crates/stair-car/stair-car-1.0.0.crate",
+		"crates/banana/banana-0.2.5.crate",
+		"crates/cornballer/cornballer-1.0.0.crate",
+		"st/ai/stair-car",
+		"ba/na/banana",
+		"co/rn/cornballer",
+	}
+	for _, file := range expectFiles {
+		if _, err := os.Stat(path.Join(cargo.dir(), file)); err != nil {
+			t.Errorf("expected %s to be written: %s", file, err)
+		}
+	}
+	unexpected := []string{"crates/seal", "crates/hop-on", "crates/windows-thing/windows-thing-0.1.0.crate", "wi/nd/windows-thing", "crates/stair-car/stair-car-1.1.0.crate"}
+	for _, file := range unexpected {
+		if _, err := os.Stat(path.Join(cargo.dir(), file)); err == nil {
+			t.Errorf("expected %s to not be written", file)
+		}
+	}
+
+	index, _ := os.ReadFile(path.Join(cargo.dir(), "co/rn/cornballer"))
+	if lines := strings.Split(strings.TrimSpace(string(index)), "\n"); len(lines) != 1 || !strings.Contains(lines[0], `"vers":"1.0.0"`) {
+		t.Errorf("expected only the downloaded version in the index, but got %s", index)
+	}
+	config, _ := os.ReadFile(path.Join(cargo.dir(), "config.json"))
+	expect := `{"dl":"http://bridgr.bluth.com/cargo/crates/{crate}/{crate}-{version}.crate"}`
+	if !cmp.Equal(expect, string(config)) {
+		t.Error(cmp.Diff(expect, string(config)))
+	}
+}
+
+func TestCargoWriteIndex(t *testing.T) {
+	t.Chdir(t.TempDir())
+	cargo := Cargo{}
+	version := func(vers string) cargoVersion {
+		raw := `{"name":"banana","vers":"` + vers + `","deps":[],"cksum":"` + vers + `"}`
+		return cargoVersion{Name: "banana", Vers: vers, Cksum: vers, raw: []byte(raw)}
+	}
+	for _, vers := range []string{"0.1.0", "0.2.0", "0.3.0"} {
+		_ = os.MkdirAll(path.Dir(cargo.crateFile(version(vers))), os.ModePerm)
+		_ = os.WriteFile(cargo.crateFile(version(vers)), []byte("crate"), 0644)
+	}
+	if err := cargo.writeIndex("banana", []cargoVersion{version("0.2.0"), version("0.1.0"), version("0.0.1")}); err != nil {
+		t.Fatal(err)
+	}
+	// a later run keeps the versions of earlier runs that are still in the registry
+	_ = os.Remove(cargo.crateFile(version("0.1.0")))
+	if err := cargo.writeIndex("banana", []cargoVersion{version("0.3.0"), version("0.2.0")}); err != nil {
+		t.Fatal(err)
+	}
+
+	index, _ := os.ReadFile(path.Join(cargo.dir(), cargoIndexPath("banana")))
+	expect := string(version("0.2.0").raw) + "\n" + string(version("0.3.0").raw) + "\n"
+	if !cmp.Equal(expect, string(index)) {
+		t.Error(cmp.Diff(expect, string(index)))
+	}
+}
@@ -0,0 +1,33 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCargoImage(t *testing.T) {
+	cargo := bridgr.Cargo{}
+	if cargo.Image() != nil {
+		t.Errorf("expected nil, but got %+v", cargo.Image())
+	}
+}
+
+func TestCargoName(t *testing.T) {
+	expected := "cargo"
+	cargo := bridgr.Cargo{}
+	if !cmp.Equal(expected, cargo.Name()) {
+		t.Error(cmp.Diff(expected, cargo.Name()))
+	}
+}
+
+func TestCargoHook(t *testing.T) {
+	cargo := bridgr.Cargo{}
+	result := reflect.TypeOf(cargo.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
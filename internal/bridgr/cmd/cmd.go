@@ -1,12 +1,14 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"net/url"
 	"os"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aztechian/bridgr/internal/bridgr"
@@ -56,6 +58,49 @@ func New(f io.ReadCloser) (*Bridgr, error) {
 			section = &bridgr.Git{}
 		case "helm":
 			section = &bridgr.Helm{}
+		case "npm":
+			section = &bridgr.Npm{}
+		case "maven":
+			section = &bridgr.Maven{}
+		case "jenkins":
+			section = &bridgr.Jenkins{}
+		case "vagrant":
+			section = &bridgr.Vagrant{}
+		case "apt":
+			section = &bridgr.Apt{}
+		case "golang":
+			section = &bridgr.Golang{}
+		case "cargo":
+			section = &bridgr.Cargo{}
+		case "nuget":
+			section = &bridgr.Nuget{}
+		case "conda":
+			section = &bridgr.Conda{}
+		case "apk":
+			section = &bridgr.Apk{}
+		case "terraform":
+			section = &bridgr.Terraform{}
+		case "ansible":
+			section = &bridgr.Ansible{}
+		case "oci":
+			section = &bridgr.OCI{}
+		case "r":
+			section = &bridgr.R{}
+		case "composer":
+			section = &bridgr.Composer{}
+		case "vscode":
+			section = &bridgr.VSCode{}
+		case "toolchains":
+			section = &bridgr.Toolchains{}
+		case "vulndb":
+			section = &bridgr.VulnDB{}
+		case "isos":
+			section = &bridgr.ISO{}
+		case "tls":
+			if err = configureTLS(cfg); err != nil {
+				return &c, fmt.Errorf("invalid tls section: %s", err)
+			}
+			continue
 		default:
 			log.Warn("Repository of type \"%s\" is invalid or not implemented, skipping.", key)
 			continue
@@ -70,7 +115,7 @@ func New(f io.ReadCloser) (*Bridgr, error) {
 	return &c, nil
 }
 
-// Execute runs the specified workers from the configuration
+// Execute runs the specified workers from the configuration. With bridgr.Locked, the error describes every worker that drifted from the lock file.
 func (b Bridgr) Execute(filter []string) error {
 	spin := spinner.New(spinner.CharSets[11], spinnerSpeed, spinner.WithWriter(os.Stderr))
 	spin.Suffix = "  | Starting Bridgr"
@@ -79,27 +124,60 @@ func (b Bridgr) Execute(filter []string) error {
 	if isTty() && !bridgr.Verbose {
 		spin.Start()
 	}
+	sem := make(chan struct{}, threads())
+	wg := sync.WaitGroup{}
+	errsMu := sync.Mutex{}
+	var errs []error
 	for _, w := range b {
 		if len(filter) > 0 && !contains(w.Name(), filter) {
 			log.Trace("skipping worker %s, not in %s", w.Name(), filter)
 			continue
 		}
-		spin.Lock()
-		spin.Suffix = fmt.Sprintf("  | Processing %s...", w.Name())
-		spin.Unlock()
-		log.Info("Processing %s...", w.Name())
-		var err error
-		if bridgr.DryRun {
-			err = w.Setup()
-		} else {
-			err = w.Run()
-		}
-		if err != nil {
-			log.Warn("Error processing %s: %s", w.Name(), err)
-		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(w bridgr.Configuration) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			if err := process(w, spin); err != nil {
+				errsMu.Lock()
+				errs = append(errs, err)
+				errsMu.Unlock()
+			}
+		}(w)
 	}
+	wg.Wait()
 	spin.Stop()
-	return nil
+	return errors.Join(errs...)
+}
+
+// process runs a worker, then locks its artifacts. Only drift from the lock file is returned as an error, workers log their own errors.
+func process(w bridgr.Configuration, spin *spinner.Spinner) error {
+	spin.Lock()
+	spin.Suffix = fmt.Sprintf("  | Processing %s...", w.Name())
+	spin.Unlock()
+	log.Info("Processing %s...", w.Name())
+	var err error
+	if bridgr.DryRun {
+		err = w.Setup()
+	} else {
+		err = w.Run()
+	}
+	if err != nil {
+		log.Warn("Error processing %s: %s", w.Name(), err)
+	}
+	if bridgr.DryRun {
+		return nil
+	}
+	return bridgr.LockArtifacts(w)
+}
+
+func threads() int {
+	if bridgr.Threads < 1 {
+		return 1
+	}
+	return bridgr.Threads
 }
 
 func contains(item string, list []string) bool {
@@ -124,6 +202,21 @@ func decode(p bridgr.Configuration, configSection interface{}) error {
 	return decoder.Decode(configSection)
 }
 
+// configureTLS applies the tls section, which is not a worker, to the connections of every worker
+func configureTLS(configSection interface{}) error {
+	conf := bridgr.TLS{}
+	decoder, _ := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:       debugHook,
+		WeaklyTypedInput: true,
+		Result:           &conf,
+		ErrorUnused:      true,
+	})
+	if err := decoder.Decode(configSection); err != nil {
+		return err
+	}
+	return bridgr.ConfigureTLS(conf)
+}
+
 func stringToImage(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
 	if f.Kind() != reflect.String || t != reflect.TypeOf((*reference.Reference)(nil)).Elem() {
 		return data, nil
@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/aztechian/bridgr/internal/bridgr"
@@ -22,7 +23,8 @@ type fakeConfig struct {
 
 func (c *fakeConfig) Image() reference.Named {
 	args := c.Called()
-	return args.Get(0).(reference.Named)
+	named, _ := args.Get(0).(reference.Named)
+	return named
 }
 
 func (c *fakeConfig) Hook() mapstructure.DecodeHookFunc {
@@ -92,6 +94,186 @@ helm:
   - https://repo.bluth.org/illusions/trick-1.0.0.tgz
 `)
 
+	yamlNpm = []byte(`---
+npm:
+  - express
+`)
+
+	yamlMaven = []byte(`---
+maven:
+  - junit:junit:4.12
+  - groupId: commons-io
+    artifactId: commons-io
+    version: 2.6
+`)
+
+	yamlJenkins = []byte(`---
+jenkins:
+  - git
+  - package: blueocean
+    version: 2.2.1
+`)
+
+	yamlApt = []byte(`---
+apt:
+  distribution: jammy
+  architectures: [amd64, arm64]
+  packages:
+    - curl
+    - git
+`)
+
+	yamlGolang = []byte(`---
+golang:
+  - golang.org/x/mod@v0.25.0
+  - github.com/pkg/errors@latest
+`)
+
+	yamlCargo = []byte(`---
+cargo:
+  host: http://bridgr.bluth.com
+  crates:
+    - serde@1.0
+    - package: tokio
+      version: ^1.38
+      features: [full]
+`)
+
+	yamlNuget = []byte(`---
+nuget:
+  host: http://bridgr.bluth.com
+  frameworks: [net8.0]
+  packages:
+    - Newtonsoft.Json@13.0.3
+    - package: Serilog
+      version: "[3.0, 4.0)"
+`)
+
+	yamlConda = []byte(`---
+conda:
+  channels: [conda-forge]
+  subdirs: [linux-64, noarch]
+  packages:
+    - numpy
+    - pandas>=2
+`)
+
+	yamlApk = []byte(`---
+apk:
+  branch: v3.19
+  architectures: [x86_64, aarch64]
+  packages:
+    - curl
+    - git
+`)
+
+	yamlTerraform = []byte(`---
+terraform:
+  platforms: [linux_amd64, darwin_arm64]
+  providers:
+    - hashicorp/aws@~> 5.0
+    - source: hashicorp/random
+      version: ">= 3.5, < 4.0"
+`)
+
+	yamlAnsible = []byte(`---
+ansible:
+  host: http://bridgr.bluth.com
+  collections:
+    - community.general:>=8.0.0,<9.0.0
+    - name: amazon.aws
+      version: 7.2.0
+  roles:
+    - geerlingguy.docker
+`)
+
+	yamlOCI = []byte(`---
+oci:
+  - ghcr.io/bluth/banana-chart:1.0.0
+  - reference: ghcr.io/bluth/stand@sha256:0d6ff1d2c1ae8e1f0b0d9f10b1c1a3bf1f2e0d2e3c4b5a69788796a5b4c3d2e1
+    artifactTypes: [application/vnd.dev.cosign.artifact.sig.v1+json]
+`)
+
+	yamlR = []byte(`---
+r:
+  version: "4.4"
+  binaries: [windows]
+  packages:
+    - ggplot2
+    - data.table
+`)
+
+	yamlComposer = []byte(`---
+composer:
+  host: http://bridgr.bluth.com
+  packages:
+    - monolog/monolog:^3.0
+    - package: symfony/console
+      version: ~6.4
+`)
+
+	yamlVSCode = []byte(`---
+vscode:
+  host: http://bridgr.bluth.com
+  platforms:
+    - linux-x64
+  extensions:
+    - golang.go@0.41.0
+    - id: redhat.vscode-yaml
+`)
+
+	yamlToolchains = []byte(`---
+toolchains:
+  platforms:
+    - linux-amd64
+    - windows-amd64
+  go: [1.22.x]
+  node: [20]
+  rust: [stable]
+  python: "3.12"
+  keyring: /etc/bridgr/toolchains.gpg
+`)
+
+	yamlVulnDB = []byte(`---
+vulndb:
+  host: http://bridgr.bluth.com
+  trivy: true
+  grype:
+    - v5
+    - v6
+  osv:
+    - PyPI
+    - Go
+`)
+
+	yamlISO = []byte(`---
+isos:
+  keyring: /etc/bridgr/distributions.gpg
+  images:
+    - ubuntu/24.04/live-server
+    - distribution: rocky
+      release: "9.4"
+      flavor: boot
+      arch: arm64
+      pxe: true
+`)
+
+	yamlTLS = []byte(`---
+tls:
+  min_version: 1.2
+  hosts:
+    artifacts.bluth.com:
+      insecure: true
+`)
+
+	yamlVagrant = []byte(`---
+vagrant:
+  - centos/7
+  - box: myimage.box
+    name: bluth/myimage
+    version: 1.0.0
+`)
+
 	namedComparer = cmp.Comparer(func(got, want reference.Named) bool {
 		return got.String() == want.String()
 	})
@@ -217,6 +399,7 @@ func TestExecute(t *testing.T) {
 		t.Run(test.name, func(t *testing.T) {
 			c := []bridgr.Configuration{test.config}
 			test.config.On("Name").Return("fake")
+			test.config.On("Image").Return(nil).Maybe()
 			if test.dryrun {
 				if test.isError {
 					test.config.On("Setup").Return(fmt.Errorf("%s", "fake error"))
@@ -239,6 +422,96 @@ func TestExecute(t *testing.T) {
 	}
 }
 
+func TestExecuteThreads(t *testing.T) {
+	original := bridgr.Threads
+	defer func() { bridgr.Threads = original }()
+	bridgr.DryRun = false
+
+	tests := []struct {
+		name    string
+		threads int
+		workers int
+	}{
+		{"serial", 1, 3},
+		{"parallel", 4, 6},
+		{"invalid threads", 0, 2},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bridgr.Threads = test.threads
+			var c Bridgr
+			for i := 0; i < test.workers; i++ {
+				w := &fakeConfig{}
+				w.On("Name").Return("fake")
+				w.On("Image").Return(nil)
+				w.On("Run").Return(nil)
+				c = append(c, w)
+			}
+			if err := c.Execute([]string{}); err != nil {
+				t.Error(err)
+			}
+			for _, w := range c {
+				w.(*fakeConfig).AssertNumberOfCalls(t, "Run", 1)
+			}
+		})
+	}
+}
+
+func TestExecuteLocked(t *testing.T) {
+	t.Chdir(t.TempDir())
+	defer func() { bridgr.Locked = false }()
+	bridgr.DryRun = false
+	tests := []struct {
+		name    string
+		lock    string
+		isError bool
+	}{
+		{"no drift", "version: 1\n", false},
+		{"drift", "version: 1\nartifacts:\n  - {worker: fake, path: fake/banana.tar.gz, sha256: abc}\n", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := bridgr.ReadLock(strings.NewReader(test.lock)); err != nil {
+				t.Fatal(err)
+			}
+			bridgr.Locked = true
+			w := &fakeConfig{}
+			w.On("Name").Return("fake")
+			w.On("Image").Return(nil)
+			w.On("Run").Return(nil)
+			err := Bridgr{w}.Execute([]string{})
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+		})
+	}
+}
+
+func TestNewTLS(t *testing.T) {
+	t.Cleanup(func() { _ = bridgr.ConfigureTLS(bridgr.TLS{}) })
+	tests := []struct {
+		name    string
+		yaml    []byte
+		isError bool
+	}{
+		{"valid", yamlTLS, false},
+		{"insecure everywhere", []byte("tls:\n  insecure: true\n"), true},
+		{"unknown option", []byte("tls:\n  verify: false\n"), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg, err := New(io.NopCloser(bytes.NewReader(test.yaml)))
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+			if err == nil && len(*cfg) != 0 {
+				t.Errorf("expected the tls section to not be a worker, got %d workers", len(*cfg))
+			}
+		})
+	}
+}
+
 func TestNewCmd(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -252,6 +525,25 @@ func TestNewCmd(t *testing.T) {
 		{"python", bytes.NewReader(yamlPython), false},
 		{"files", bytes.NewReader(yamlFile), false},
 		{"helm", bytes.NewReader(yamlHelm), false},
+		{"npm", bytes.NewReader(yamlNpm), false},
+		{"maven", bytes.NewReader(yamlMaven), false},
+		{"jenkins", bytes.NewReader(yamlJenkins), false},
+		{"vagrant", bytes.NewReader(yamlVagrant), false},
+		{"apt", bytes.NewReader(yamlApt), false},
+		{"golang", bytes.NewReader(yamlGolang), false},
+		{"cargo", bytes.NewReader(yamlCargo), false},
+		{"nuget", bytes.NewReader(yamlNuget), false},
+		{"conda", bytes.NewReader(yamlConda), false},
+		{"apk", bytes.NewReader(yamlApk), false},
+		{"terraform", bytes.NewReader(yamlTerraform), false},
+		{"ansible", bytes.NewReader(yamlAnsible), false},
+		{"oci", bytes.NewReader(yamlOCI), false},
+		{"r", bytes.NewReader(yamlR), false},
+		{"composer", bytes.NewReader(yamlComposer), false},
+		{"vscode", bytes.NewReader(yamlVSCode), false},
+		{"toolchains", bytes.NewReader(yamlToolchains), false},
+		{"vulndb", bytes.NewReader(yamlVulnDB), false},
+		{"isos", bytes.NewReader(yamlISO), false},
 		{"blah", bytes.NewReader(yamlBlah), false},
 		{"failed read", bytes.NewReader(yamlBlah), true},
 	}
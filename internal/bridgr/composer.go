@@ -0,0 +1,440 @@
+package bridgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/distribution/reference"
+	"github.com/mitchellh/mapstructure"
+	log "unknwon.dev/clog/v2"
+)
+
+const defaultComposerRepository = "https://repo.packagist.org"
+
+var (
+	composerStability = regexp.MustCompile(`@[a-zA-Z]+`)
+	composerOperator  = regexp.MustCompile(`([<>=!^~]+)\s+`)
+	composerOr        = regexp.MustCompile(`\s*\|\|?\s*`)
+	composerAnd       = regexp.MustCompile(`[\s,]+`)
+)
+
+// Composer is the configuration object for creating a static Composer repository
+type Composer struct {
+	Repository string
+	Host       string
+	Packages   []composerPackage
+}
+
+type composerPackage struct {
+	Package string
+	Version string
+}
+
+// composerVersion is one version of a package from the Composer v2 metadata, kept as a generic document so that every field
+// is written back out
+type composerVersion map[string]interface{}
+
+func (cp composerPackage) String() string {
+	if cp.Version != "" {
+		return cp.Package + ":" + cp.Version
+	}
+	return cp.Package
+}
+
+func (cv composerVersion) version() string {
+	version, _ := cv["version"].(string)
+	return version
+}
+
+// requires gives the packages a version needs. Platform requirements such as "php" and "ext-json" are left out, as
+// they aren't packages in a repository.
+func (cv composerVersion) requires() []composerPackage {
+	require, _ := cv["require"].(map[string]interface{})
+	var requires []composerPackage
+	for name, constraint := range require {
+		if !strings.Contains(name, "/") {
+			continue
+		}
+		spec, _ := constraint.(string)
+		requires = append(requires, composerPackage{Package: name, Version: spec})
+	}
+	return requires
+}
+
+// dir is the top-level directory name for all objects written out under the Composer worker
+func (c Composer) dir() string {
+	return BaseDir(c.Name())
+}
+
+// Name returns the name of this Configuration
+func (c Composer) Name() string {
+	return "composer"
+}
+
+// Image implements the Imager interface
+func (c Composer) Image() reference.Named {
+	return nil
+}
+
+// stringToComposerPackage reads a package the same way as "composer require" does, ie "monolog/monolog:^3.0"
+func stringToComposerPackage(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf(composerPackage{}) {
+		return data, nil
+	}
+	parts := strings.SplitN(data.(string), ":", 2)
+	pkg := composerPackage{Package: strings.ToLower(strings.TrimSpace(parts[0]))}
+	if len(parts) > 1 {
+		pkg.Version = strings.TrimSpace(parts[1])
+	}
+	return pkg, nil
+}
+
+func arrayToComposer(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Slice || t != reflect.TypeOf(Composer{}) {
+		return data, nil
+	}
+	return map[string]interface{}{"packages": data}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (c *Composer) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		arrayToComposer,
+		stringToComposerPackage,
+	)
+}
+
+// Setup prepares the directory for the Composer repository
+func (c *Composer) Setup() error {
+	log.Trace("Called Composer.Setup()")
+	if c.Repository == "" {
+		c.Repository = defaultComposerRepository
+	}
+	c.Repository = strings.TrimSuffix(c.Repository, "/")
+	if c.Host == "" {
+		log.Warn("Composer: no host is configured, dist URLs will be relative to the host that serves the repository")
+	}
+	return os.MkdirAll(c.dir(), os.ModePerm)
+}
+
+// Run resolves the configured packages and their dependencies, downloads their dist archives and writes the repository metadata
+func (c *Composer) Run() error {
+	if err := c.Setup(); err != nil {
+		return err
+	}
+	resolver := composerResolver{composer: c, metadata: map[string][]composerVersion{}}
+	resolved := resolver.resolve(c.Packages)
+
+	downloaded := map[string][]composerVersion{}
+	mu := sync.Mutex{}
+	forEach(len(resolved), func(i int) {
+		name, version := resolved[i].Package, resolver.find(resolved[i].Package, resolved[i].Version)
+		if err := c.download(name, version); err != nil {
+			log.Info("Composer: unable to download %s %s - %s", name, version.version(), err)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		downloaded[name] = append(downloaded[name], version)
+	})
+	for name, versions := range downloaded {
+		if err := c.writeMetadata(name, versions); err != nil {
+			log.Info("Composer: unable to write metadata for %s - %s", name, err)
+		}
+	}
+	return c.writePackages()
+}
+
+// url gives the location of a path in the repository when it is hosted by Bridgr
+func (c *Composer) url(parts ...string) string {
+	return strings.TrimSuffix(c.Host, "/") + "/" + path.Join(append([]string{c.Name()}, parts...)...)
+}
+
+// distFile gives the location of a version's dist archive, relative to the repository
+func (c *Composer) distFile(name string, version composerVersion) string {
+	return path.Join("dist", name, path.Base(name)+"-"+version.version()+".zip")
+}
+
+// download fetches the dist archive of a version, and verifies it against the checksum in the metadata when there is one
+func (c *Composer) download(name string, version composerVersion) error {
+	dist, _ := version["dist"].(map[string]interface{})
+	source, _ := dist["url"].(string)
+	if source == "" {
+		return fmt.Errorf("version %s has no dist archive", version.version())
+	}
+	target := path.Join(c.dir(), c.distFile(name, version))
+	if _, err := os.Stat(target); err == nil {
+		return lockExisting(target)
+	}
+	sourceURL, err := url.Parse(source)
+	if err != nil {
+		return err
+	}
+	if err := download(sourceURL, target); err != nil {
+		return err
+	}
+	if expected, _ := dist["shasum"].(string); expected != "" {
+		sum, err := fileChecksum(target, "sha1")
+		if err != nil {
+			return err
+		}
+		if sum != expected {
+			_ = os.Remove(target)
+			return fmt.Errorf("checksum mismatch, expected %s but got %s", expected, sum)
+		}
+	}
+	return nil
+}
+
+// writeMetadata writes the p2/<vendor>/<name>.json file of a package, with dist URLs pointing at this repository. Versions from
+// earlier runs are kept, as long as their dist archive is still in the repository.
+func (c *Composer) writeMetadata(name string, versions []composerVersion) error {
+	file := path.Join(c.dir(), "p2", name+".json")
+	byVersion := map[string]composerVersion{}
+	existing := struct {
+		Packages map[string][]composerVersion `json:"packages"`
+	}{}
+	if content, err := os.ReadFile(file); err == nil && json.Unmarshal(content, &existing) == nil {
+		for _, version := range existing.Packages[name] {
+			byVersion[version.version()] = version
+		}
+	}
+	for _, version := range versions {
+		byVersion[version.version()] = version
+	}
+
+	var list []composerVersion
+	for _, version := range byVersion {
+		distFile := c.distFile(name, version)
+		sum, err := fileChecksum(path.Join(c.dir(), distFile), "sha1")
+		if err != nil {
+			continue
+		}
+		rewritten := composerVersion{}
+		for key, value := range version {
+			rewritten[key] = value
+		}
+		delete(rewritten, "source")
+		rewritten["dist"] = map[string]interface{}{"type": "zip", "url": c.url(distFile), "shasum": sum}
+		list = append(list, rewritten)
+	}
+	sort.Slice(list, func(i, j int) bool { return compareComposerVersions(list[i].version(), list[j].version()) > 0 })
+
+	content, err := json.Marshal(map[string]interface{}{"packages": map[string][]composerVersion{name: list}})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(path.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	return os.WriteFile(file, content, 0644) //nolint:gosec // repository content is meant to be readable
+}
+
+// writePackages writes the packages.json that Composer uses as the repository URL, listing every package in the repository
+func (c *Composer) writePackages() error {
+	files, err := filepath.Glob(path.Join(c.dir(), "p2", "*", "*.json"))
+	if err != nil {
+		return err
+	}
+	available := make([]string, 0, len(files))
+	for _, file := range files {
+		available = append(available, path.Base(path.Dir(file))+"/"+strings.TrimSuffix(path.Base(file), ".json"))
+	}
+	sort.Strings(available)
+	content, err := json.Marshal(map[string]interface{}{
+		"packages":           map[string]interface{}{},
+		"metadata-url":       c.url("p2") + "/%package%.json",
+		"available-packages": available,
+	})
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(c.dir(), "packages.json"), content, 0644) //nolint:gosec // repository content is meant to be readable
+}
+
+type composerResolver struct {
+	composer *Composer
+	mu       sync.Mutex
+	metadata map[string][]composerVersion
+}
+
+// resolve gives the name and version of every package needed. Each package and dependency uses the newest version matching
+// its constraint, and the Composer solver picks between them when the repository is used.
+func (r *composerResolver) resolve(packages []composerPackage) []composerPackage {
+	queue := packages
+	seen := map[string]bool{}
+	var resolved []composerPackage
+	for len(queue) > 0 {
+		picked := make([]string, len(queue))
+		forEach(len(queue), func(i int) {
+			version, err := r.pick(queue[i])
+			if err != nil {
+				log.Info("Composer: unable to resolve %s - %s", queue[i], err)
+				return
+			}
+			picked[i] = version
+		})
+		var next []composerPackage
+		for i, req := range queue {
+			name := strings.ToLower(req.Package)
+			if picked[i] == "" || seen[name+"@"+picked[i]] {
+				continue
+			}
+			seen[name+"@"+picked[i]] = true
+			resolved = append(resolved, composerPackage{Package: name, Version: picked[i]})
+			next = append(next, r.find(name, picked[i]).requires()...)
+		}
+		queue = next
+	}
+	return resolved
+}
+
+// pick gives the newest stable version of a package matching the constraint. Pre-releases are only picked when the constraint names one.
+func (r *composerResolver) pick(pkg composerPackage) (string, error) {
+	versions, err := r.versions(pkg.Package)
+	if err != nil {
+		return "", err
+	}
+	constraint, err := composerConstraint(pkg.Version)
+	if err != nil {
+		return "", err
+	}
+	var (
+		best       string
+		bestParsed *semver.Version
+	)
+	for _, version := range versions {
+		parsed, err := semver.NewVersion(version.version())
+		if err != nil || !constraint.Check(parsed) {
+			continue
+		}
+		if bestParsed == nil || parsed.GreaterThan(bestParsed) {
+			best, bestParsed = version.version(), parsed
+		}
+	}
+	if bestParsed == nil {
+		return "", fmt.Errorf("no version matching %s", pkg.Version)
+	}
+	return best, nil
+}
+
+// find gives the metadata of a version that has already been read
+func (r *composerResolver) find(name, version string) composerVersion {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, v := range r.metadata[strings.ToLower(name)] {
+		if v.version() == version {
+			return v
+		}
+	}
+	return composerVersion{}
+}
+
+// versions gets the tagged versions of a package from the upstream Composer v2 metadata
+func (r *composerResolver) versions(name string) ([]composerVersion, error) {
+	name = strings.ToLower(name)
+	r.mu.Lock()
+	versions, ok := r.metadata[name]
+	r.mu.Unlock()
+	if ok {
+		return versions, nil
+	}
+	doc := struct {
+		Packages map[string][]composerVersion `json:"packages"`
+		Minified string                       `json:"minified"`
+	}{}
+	if err := getJSON(r.composer.Repository+"/p2/"+name+".json", &doc); err != nil {
+		return nil, err
+	}
+	versions = doc.Packages[name]
+	if doc.Minified == "composer/2.0" {
+		versions = expandComposerVersions(versions)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metadata[name] = versions
+	return versions, nil
+}
+
+// expandComposerVersions undoes the minification of Composer v2 metadata, where each version only has the fields that changed
+// from the version before it, and "__unset" removes a field
+func expandComposerVersions(versions []composerVersion) []composerVersion {
+	expanded := make([]composerVersion, 0, len(versions))
+	current := composerVersion{}
+	for _, version := range versions {
+		for key, value := range version {
+			if value == "__unset" {
+				delete(current, key)
+				continue
+			}
+			current[key] = value
+		}
+		full := composerVersion{}
+		for key, value := range current {
+			full[key] = value
+		}
+		expanded = append(expanded, full)
+	}
+	return expanded
+}
+
+// composerConstraint reads a Composer version constraint. Composer's tilde operator is a pessimistic constraint, ie "~1.2" is
+// ">=1.2, <2" and "~1.2.3" is ">=1.2.3, <1.3", and constraints are ANDed with either a comma or a space.
+func composerConstraint(spec string) (*semver.Constraints, error) {
+	spec = strings.TrimSpace(composerStability.ReplaceAllString(spec, ""))
+	if spec == "" || spec == "self.version" {
+		spec = "*"
+	}
+	alternatives := composerOr.Split(spec, -1)
+	for i, alternative := range alternatives {
+		alternative = composerOperator.ReplaceAllString(strings.TrimSpace(alternative), "$1")
+		if strings.Contains(alternative, " - ") {
+			alternatives[i] = alternative
+			continue
+		}
+		parts := composerAnd.Split(alternative, -1)
+		for j, part := range parts {
+			switch {
+			case strings.HasPrefix(part, "~") && !strings.HasPrefix(part, "~>"):
+				version := strings.TrimPrefix(part, "~")
+				if !strings.Contains(version, ".") {
+					version += ".0"
+				}
+				upper, err := pessimisticUpper(version)
+				if err != nil {
+					return nil, fmt.Errorf("invalid version constraint %s", part)
+				}
+				parts[j] = ">=" + version + ", <" + upper
+			case strings.HasPrefix(part, "=="):
+				parts[j] = part[1:]
+			}
+		}
+		alternatives[i] = strings.Join(parts, ", ")
+	}
+	return semver.NewConstraint(strings.Join(alternatives, " || "))
+}
+
+// compareComposerVersions orders versions, versions that aren't semantic versions sort before any that are
+func compareComposerVersions(a, b string) int {
+	va, errA := semver.NewVersion(a)
+	vb, errB := semver.NewVersion(b)
+	switch {
+	case errA != nil && errB != nil:
+		return strings.Compare(a, b)
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+	return va.Compare(vb)
+}
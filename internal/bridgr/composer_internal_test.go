@@ -0,0 +1,192 @@
+package bridgr
+
+import (
+	"crypto/sha1" //nolint:gosec // Composer dist checksums are SHA-1
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/google/go-cmp/cmp"
+)
+
+func packagist() *httptest.Server {
+	sum := sha1.Sum([]byte("stand-1.2.0")) //nolint:gosec // Composer dist checksums are SHA-1
+	metadata := map[string]string{
+		"/p2/bluth/banana.json": `{"minified":"composer/2.0","packages":{"bluth/banana":[
+			{"name":"bluth/banana","version":"2.0.0","require":{"php":">=8.1","bluth/stand":"^1.1"},"dist":{"type":"zip","url":"%[1]s/dist/banana-2.0.0.zip","shasum":""},"source":{"type":"git","url":"https://github.com/bluth/banana.git"}},
+			{"version":"1.5.0","require":{"bluth/stand":"~1.0"},"dist":{"type":"zip","url":"%[1]s/dist/banana-1.5.0.zip","shasum":""}},
+			{"version":"1.0.0","require":"__unset","dist":{"type":"zip","url":"%[1]s/dist/banana-1.0.0.zip","shasum":""}}
+		]}}`,
+		"/p2/bluth/stand.json": `{"packages":{"bluth/stand":[
+			{"name":"bluth/stand","version":"dev-main","dist":{"type":"zip","url":"%[1]s/dist/stand-main.zip","shasum":""}},
+			{"name":"bluth/stand","version":"2.0.0","dist":{"type":"zip","url":"%[1]s/dist/stand-2.0.0.zip","shasum":""}},
+			{"name":"bluth/stand","version":"v1.2.0","dist":{"type":"zip","url":"%[1]s/dist/stand-1.2.0.zip","shasum":"` + hex.EncodeToString(sum[:]) + `"}},
+			{"name":"bluth/stand","version":"v1.1.0","dist":{"type":"zip","url":"%[1]s/dist/stand-1.1.0.zip","shasum":""}}
+		]}}`,
+	}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if doc, ok := metadata[r.URL.Path]; ok {
+			fmt.Fprintf(w, doc, server.URL)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/dist/") {
+			fmt.Fprint(w, strings.TrimSuffix(path.Base(r.URL.Path), ".zip"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	return server
+}
+
+func TestComposerDir(t *testing.T) {
+	expected := BaseDir("composer")
+	result := Composer{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestStringToComposerPackage(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  interface{}
+		expect interface{}
+	}{
+		{"name only", "Monolog/Monolog", composerPackage{Package: "monolog/monolog"}},
+		{"with version", "monolog/monolog:^3.0", composerPackage{Package: "monolog/monolog", Version: "^3.0"}},
+		{"not a string", 42, 42},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := stringToComposerPackage(reflect.TypeOf(test.input), reflect.TypeOf(composerPackage{}), test.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestArrayToComposer(t *testing.T) {
+	input := []interface{}{"monolog/monolog"}
+	result, _ := arrayToComposer(reflect.TypeOf(input), reflect.TypeOf(Composer{}), input)
+	expect := map[string]interface{}{"packages": input}
+	if !cmp.Equal(expect, result) {
+		t.Error(cmp.Diff(expect, result))
+	}
+}
+
+func TestComposerConstraint(t *testing.T) {
+	tests := []struct {
+		spec    string
+		match   []string
+		noMatch []string
+	}{
+		{"", []string{"1.0.0", "3.2.1"}, []string{"1.0.0-beta1"}},
+		{"^1.2", []string{"1.2.0", "1.9.9"}, []string{"1.1.0", "2.0.0"}},
+		{"~1.2", []string{"1.2.0", "1.9.0"}, []string{"1.1.0", "2.0.0"}},
+		{"~1.2.3", []string{"1.2.3", "1.2.9"}, []string{"1.3.0"}},
+		{"~1", []string{"1.0.0", "1.5.0"}, []string{"2.0.0"}},
+		{">= 1.0 <1.5", []string{"1.0.0", "1.4.9"}, []string{"1.5.0"}},
+		{">=1.0,<1.5", []string{"1.0.0"}, []string{"1.5.0"}},
+		{"^1.0 || ^3.0", []string{"1.1.0", "3.1.0"}, []string{"2.0.0"}},
+		{"^1.0|^3.0", []string{"3.1.0"}, []string{"2.0.0"}},
+		{"1.0 - 2.0", []string{"1.5.0", "2.0.0"}, []string{"2.1.0"}},
+		{"1.2.*", []string{"1.2.7"}, []string{"1.3.0"}},
+		{"==1.2.0", []string{"1.2.0"}, []string{"1.2.1"}},
+		{"^1.0@stable", []string{"1.2.0"}, []string{"2.0.0"}},
+		{"self.version", []string{"4.0.0"}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			constraint, err := composerConstraint(test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, version := range test.match {
+				if !constraint.Check(semver.MustParse(version)) {
+					t.Errorf("expected %s to match %s", version, test.spec)
+				}
+			}
+			for _, version := range test.noMatch {
+				if constraint.Check(semver.MustParse(version)) {
+					t.Errorf("expected %s to not match %s", version, test.spec)
+				}
+			}
+		})
+	}
+}
+
+func TestExpandComposerVersions(t *testing.T) {
+	minified := []composerVersion{
+		{"name": "bluth/banana", "version": "2.0.0", "require": map[string]interface{}{"php": ">=8.1"}},
+		{"version": "1.5.0"},
+		{"version": "1.0.0", "require": "__unset"},
+	}
+	expect := []composerVersion{
+		{"name": "bluth/banana", "version": "2.0.0", "require": map[string]interface{}{"php": ">=8.1"}},
+		{"name": "bluth/banana", "version": "1.5.0", "require": map[string]interface{}{"php": ">=8.1"}},
+		{"name": "bluth/banana", "version": "1.0.0"},
+	}
+	result := expandComposerVersions(minified)
+	if !cmp.Equal(expect, result) {
+		t.Error(cmp.Diff(expect, result))
+	}
+}
+
+func TestComposerRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := packagist()
+	defer server.Close()
+
+	composer := Composer{Repository: server.URL, Host: "http://bridgr.bluth.com", Packages: []composerPackage{{Package: "bluth/banana", Version: "^1.0"}}}
+	if err := composer.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectFiles := []string{"packages.json", "dist/bluth/banana/banana-1.5.0.zip", "dist/bluth/stand/stand-v1.2.0.zip", "p2/bluth/stand.json"}
+	for _, file := range expectFiles {
+		if _, err := os.Stat(path.Join(composer.dir(), file)); err != nil {
+			t.Errorf("expected %s to be written: %s", file, err)
+		}
+	}
+
+	packages := map[string]interface{}{}
+	content, _ := os.ReadFile(path.Join(composer.dir(), "packages.json"))
+	if err := json.Unmarshal(content, &packages); err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal("http://bridgr.bluth.com/composer/p2/%package%.json", packages["metadata-url"]) {
+		t.Error(cmp.Diff("http://bridgr.bluth.com/composer/p2/%package%.json", packages["metadata-url"]))
+	}
+	if !cmp.Equal([]interface{}{"bluth/banana", "bluth/stand"}, packages["available-packages"]) {
+		t.Error(cmp.Diff([]interface{}{"bluth/banana", "bluth/stand"}, packages["available-packages"]))
+	}
+
+	metadata := struct {
+		Packages map[string][]composerVersion `json:"packages"`
+	}{}
+	content, _ = os.ReadFile(path.Join(composer.dir(), "p2/bluth/banana.json"))
+	if err := json.Unmarshal(content, &metadata); err != nil {
+		t.Fatal(err)
+	}
+	versions := metadata.Packages["bluth/banana"]
+	if len(versions) != 1 || versions[0].version() != "1.5.0" {
+		t.Fatalf("expected only version 1.5.0, got %s", content)
+	}
+	dist := versions[0]["dist"].(map[string]interface{})
+	if !cmp.Equal("http://bridgr.bluth.com/composer/dist/bluth/banana/banana-1.5.0.zip", dist["url"]) {
+		t.Error(cmp.Diff("http://bridgr.bluth.com/composer/dist/bluth/banana/banana-1.5.0.zip", dist["url"]))
+	}
+}
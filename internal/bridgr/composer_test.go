@@ -0,0 +1,33 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestComposerImage(t *testing.T) {
+	composer := bridgr.Composer{}
+	if composer.Image() != nil {
+		t.Errorf("expected nil, but got %+v", composer.Image())
+	}
+}
+
+func TestComposerName(t *testing.T) {
+	expected := "composer"
+	composer := bridgr.Composer{}
+	if !cmp.Equal(expected, composer.Name()) {
+		t.Error(cmp.Diff(expected, composer.Name()))
+	}
+}
+
+func TestComposerHook(t *testing.T) {
+	composer := bridgr.Composer{}
+	result := reflect.TypeOf(composer.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
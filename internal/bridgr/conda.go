@@ -0,0 +1,132 @@
+package bridgr
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"reflect"
+	"text/template"
+
+	"github.com/aztechian/bridgr/internal/bridgr/asset"
+	"github.com/distribution/reference"
+	"github.com/mitchellh/mapstructure"
+	log "unknwon.dev/clog/v2"
+)
+
+var (
+	condaImage  reference.Named
+	condaScript *template.Template
+	condaRc     *template.Template
+)
+
+const (
+	defaultCondaChannel = "conda-forge"
+	defaultCondaSubdir  = "linux-64"
+)
+
+func init() {
+	condaImage, _ = reference.ParseNormalizedNamed(baseImage["conda"] + ":latest")
+	condaScript = asset.Template("conda.sh")
+	condaRc = asset.Template("conda.condarc")
+}
+
+// Conda sets up and creates a conda channel based on user configuration
+type Conda struct {
+	BaseImage condaBaseImage `mapstructure:"image"`
+	Channels  []string
+	Subdirs   []string
+	Packages  []string
+}
+
+type condaBaseImage reference.Named
+
+// dir is the top-level directory name for all objects written out under the Conda worker
+func (c Conda) dir() string {
+	return BaseDir(c.Name())
+}
+
+// Name returns the name of this Configuration
+func (c Conda) Name() string {
+	return "conda"
+}
+
+// Image returns the docker image that will be used for the batch execution
+func (c Conda) Image() reference.Named {
+	if c.BaseImage == nil {
+		return condaImage
+	}
+	return c.BaseImage
+}
+
+// Platforms are the subdirs that the environment is solved for. noarch packages are included with every platform, so it isn't solved on its own.
+func (c Conda) Platforms() []string {
+	var platforms []string
+	for _, subdir := range c.Subdirs {
+		if subdir != "noarch" {
+			platforms = append(platforms, subdir)
+		}
+	}
+	return platforms
+}
+
+func stringToCondaImage(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf((*condaBaseImage)(nil)).Elem() {
+		return data, nil
+	}
+	return reference.ParseNormalizedNamed(data.(string))
+}
+
+func arrayToConda(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Slice || t != reflect.TypeOf(Conda{}) {
+		return data, nil
+	}
+	var pkgList []string
+	for _, pkg := range data.([]interface{}) {
+		if pkg, ok := pkg.(string); ok {
+			pkgList = append(pkgList, pkg)
+		}
+	}
+	return Conda{Packages: pkgList}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (c *Conda) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		stringToCondaImage,
+		arrayToConda,
+	)
+}
+
+// Run solves the environment for each subdir, downloads the packages, and indexes the channel
+func (c *Conda) Run() error {
+	if err := c.Setup(); err != nil {
+		return err
+	}
+
+	script := bytes.Buffer{}
+	if err := asset.Render(condaScript, c, &script); err != nil {
+		return err
+	}
+
+	batcher := newBatch(c.Image().String(), c.dir(), path.Join(c.dir(), "bridgr.condarc"), "/root/.condarc")
+	return batcher.runContainer("bridgr_conda", script.String())
+}
+
+// Setup only does the setup step of the Conda worker
+func (c *Conda) Setup() error {
+	log.Trace("Called Conda Setup()")
+	if len(c.Channels) == 0 {
+		c.Channels = []string{defaultCondaChannel}
+	}
+	if len(c.Platforms()) == 0 {
+		c.Subdirs = append(c.Subdirs, defaultCondaSubdir)
+	}
+	_ = os.MkdirAll(c.dir(), os.ModePerm)
+
+	rcFile, err := os.Create(path.Join(c.dir(), "bridgr.condarc"))
+	if err != nil {
+		return fmt.Errorf("Unable to create conda configuration file: %s", err)
+	}
+	return asset.RenderFile(condaRc, c.Channels, rcFile)
+}
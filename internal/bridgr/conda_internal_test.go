@@ -0,0 +1,110 @@
+package bridgr
+
+import (
+	"bytes"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr/asset"
+	"github.com/distribution/reference"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCondaDir(t *testing.T) {
+	expected := BaseDir("conda")
+	result := Conda{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestCondaPlatforms(t *testing.T) {
+	conda := Conda{Subdirs: []string{"linux-64", "noarch", "osx-arm64"}}
+	expect := []string{"linux-64", "osx-arm64"}
+	if !cmp.Equal(expect, conda.Platforms()) {
+		t.Error(cmp.Diff(expect, conda.Platforms()))
+	}
+}
+
+func TestStringToCondaImage(t *testing.T) {
+	img, _ := reference.ParseNormalizedNamed("condaforge/miniforge3:latest")
+	target := reflect.TypeOf((*condaBaseImage)(nil)).Elem()
+	result, err := stringToCondaImage(reflect.TypeOf(""), target, "condaforge/miniforge3:latest")
+	if err != nil {
+		t.Error(err)
+	}
+	if !cmp.Equal(img, result, namedComparer) {
+		t.Error(cmp.Diff(img, result, namedComparer))
+	}
+
+	other, _ := stringToCondaImage(reflect.TypeOf(""), reflect.TypeOf(""), "miniforge3")
+	if !cmp.Equal("miniforge3", other) {
+		t.Error(cmp.Diff("miniforge3", other))
+	}
+}
+
+func TestArrayToConda(t *testing.T) {
+	tests := []struct {
+		name   string
+		target reflect.Type
+		input  interface{}
+		expect interface{}
+	}{
+		{"invalid target", reflect.TypeOf(4.23), "monster", "monster"},
+		{"invalid input", reflect.TypeOf(Conda{}), 33, 33},
+		{"valid", reflect.TypeOf(Conda{}), []interface{}{"numpy", "pandas>=2"}, Conda{Packages: []string{"numpy", "pandas>=2"}}},
+		{"invalid array", reflect.TypeOf(Conda{}), []interface{}{83, 9.4822}, Conda{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := arrayToConda(reflect.TypeOf(test.input), test.target, test.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestCondaSetup(t *testing.T) {
+	t.Chdir(t.TempDir())
+	conda := Conda{Subdirs: []string{"noarch"}}
+	if err := conda.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	expect := Conda{Channels: []string{"conda-forge"}, Subdirs: []string{"noarch", "linux-64"}}
+	if !cmp.Equal(expect, conda) {
+		t.Error(cmp.Diff(expect, conda))
+	}
+	content, _ := os.ReadFile(path.Join(conda.dir(), "bridgr.condarc"))
+	if !strings.Contains(string(content), "  - conda-forge\n") {
+		t.Errorf("expected condarc to list the conda-forge channel, got %q", string(content))
+	}
+}
+
+func TestCondaScript(t *testing.T) {
+	conda := Conda{Subdirs: []string{"linux-64", "osx-arm64", "noarch"}, Packages: []string{"numpy", "pandas>=2"}}
+	script := bytes.Buffer{}
+	if err := asset.Render(condaScript, conda, &script); err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		"CONDA_PKGS_DIRS=/tmp/pkgs-linux-64 CONDA_SUBDIR=linux-64 conda create --dry-run --json -p /tmp/env-linux-64 'numpy' 'pandas>=2'",
+		"CONDA_PKGS_DIRS=/tmp/pkgs-osx-arm64 CONDA_SUBDIR=osx-arm64 conda create",
+		"python -m conda_index /packages",
+	}
+	for _, s := range expect {
+		if !strings.Contains(script.String(), s) {
+			t.Errorf("expected script to contain %q", s)
+		}
+	}
+	if strings.Contains(script.String(), "CONDA_SUBDIR=noarch") {
+		t.Error("expected noarch to not be solved on its own")
+	}
+}
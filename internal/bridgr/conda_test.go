@@ -0,0 +1,41 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/distribution/reference"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCondaImage(t *testing.T) {
+	dflt, _ := reference.ParseNormalizedNamed("continuumio/miniconda3:latest")
+	conda := bridgr.Conda{}
+	if !cmp.Equal(dflt, conda.Image(), namedComparer) {
+		t.Error(cmp.Diff(dflt, conda.Image()))
+	}
+
+	forge, _ := reference.ParseNormalizedNamed("condaforge/miniforge3:24.3.0-0")
+	conda2 := bridgr.Conda{BaseImage: forge}
+	if !cmp.Equal(forge, conda2.Image(), namedComparer) {
+		t.Error(cmp.Diff(forge, conda2.Image()))
+	}
+}
+
+func TestCondaName(t *testing.T) {
+	expected := "conda"
+	conda := bridgr.Conda{}
+	if !cmp.Equal(expected, conda.Name()) {
+		t.Error(cmp.Diff(expected, conda.Name()))
+	}
+}
+
+func TestCondaHook(t *testing.T) {
+	conda := bridgr.Conda{}
+	result := reflect.TypeOf(conda.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
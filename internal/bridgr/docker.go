@@ -15,6 +15,7 @@ import (
 	"github.com/docker/docker/api/types/image"
 	"github.com/docker/docker/client"
 	"github.com/mitchellh/mapstructure"
+	"github.com/opencontainers/go-digest"
 	log "unknwon.dev/clog/v2"
 )
 
@@ -110,33 +111,52 @@ func (d *Docker) Run() error {
 	if setupErr != nil {
 		return setupErr
 	}
-	for _, img := range d.Images {
+	forEach(len(d.Images), func(i int) {
+		img := d.Images[i]
+		dgst, _ := imageDigest(cli, img)
 		if d.Destination != "" {
 			dest := d.tagForRemote(cli, img)
+			if imageUnchanged(dest, "", dgst) {
+				log.Trace("Docker image %s is unchanged since it was pushed to %s", img.String(), dest)
+				return
+			}
 			err := d.writeRemote(cli, dest, img)
 			if err != nil {
 				log.Info("%s", err.Error())
+				return
 			}
+			cachePut(dest, "", cacheEntry{Digest: dgst})
 		} else {
-			re := regexp.MustCompile(`[:/]`)
-			outFile := re.ReplaceAllString(reference.Path(img), "_") + ".tar"
-			out, err := os.Create(path.Join(d.dir(), outFile))
+			outFile := d.archive(img)
+			target := path.Join(d.dir(), outFile)
+			if imageUnchanged(img.String(), target, dgst) {
+				log.Trace("Docker image %s is unchanged since it was saved to %s", img.String(), target)
+				return
+			}
+			out, err := os.Create(target)
 			if err != nil {
 				log.Info("error creating %s for saving Docker image %s - %s", outFile, img.String(), err)
-				continue
+				return
 			}
 			err = d.writeLocal(cli, out, img)
 			if err != nil {
 				log.Info("error saving %s - %s", img.String(), err)
 				os.Remove(out.Name())
-				continue
+				return
 			}
+			cachePut(img.String(), target, cacheEntry{Digest: dgst})
 			log.Trace("saved Docker image %s to %s", img.String(), out.Name())
 		}
-	}
+	})
 	return nil
 }
 
+// imageUnchanged tells whether an image was already saved to target, or pushed when there is no target, at the same digest
+func imageUnchanged(source, target, dgst string) bool {
+	entry, ok := cacheGet(source, target)
+	return ok && dgst != "" && entry.Digest == dgst
+}
+
 // Setup gets the environment ready to run the Docker worker
 func (d *Docker) Setup() error {
 	log.Trace("Called Docker.Setup()")
@@ -145,19 +165,106 @@ func (d *Docker) Setup() error {
 	// filter nil images from parse errors
 	filtered := d.Images[:0]
 	for _, img := range d.Images {
-		if img == nil {
-			continue
+		if img != nil {
+			filtered = append(filtered, img)
+		}
+	}
+	d.Images = filtered
+	if d.Destination == "" {
+		archives := map[string]string{}
+		for _, img := range d.Images {
+			archive := d.archive(img)
+			if other, ok := archives[archive]; ok {
+				return fmt.Errorf("docker images %s and %s would both be saved to %s", other, img, archive)
+			}
+			archives[archive] = img.String()
 		}
-		filtered = append(filtered, img)
+	}
+
+	forEach(len(d.Images), func(i int) {
+		img := d.Images[i]
 		log.Trace("pulling image %s", img.String())
-		if err := PullImage(cli, img); err != nil {
+		if err := d.pull(img); err != nil {
 			log.Error("Error pulling Docker image `%s`: %s", img.String(), err)
 		}
+	})
+	return nil
+}
+
+// archive is the name of the file that an image is saved to, when there is no destination repository. It has the tag and digest
+// of the image, so each version of an image is saved to its own file.
+func (d *Docker) archive(img reference.Named) string {
+	name := reference.Path(img)
+	if tagged, ok := img.(reference.Tagged); ok {
+		name += ":" + tagged.Tag()
 	}
-	d.Images = filtered
+	if digested, ok := img.(reference.Digested); ok {
+		name += "@" + digested.Digest().String()
+	}
+	re := regexp.MustCompile(`[:/@]`)
+	return re.ReplaceAllString(name, "_") + ".tar"
+}
+
+// pull pulls an image and records its digest in the lock file. With Locked, the digest pinned for the image is pulled and tagged as the image.
+func (d *Docker) pull(img reference.Named) error {
+	ref := img
+	if Locked {
+		pin, ok := lockPin(d.Name(), img.String())
+		if !ok {
+			lockDrift(d.Name(), "%s is not in the lock file", img.String())
+			return fmt.Errorf("%s is not in the lock file", img.String())
+		}
+		pinned, err := reference.WithDigest(reference.TrimNamed(img), digest.Digest(pin.Digest))
+		if err != nil {
+			return err
+		}
+		ref = pinned
+	}
+	if err := PullImage(cli, ref); err != nil {
+		return err
+	}
+	if ref != img {
+		if err := cli.ImageTag(context.Background(), ref.String(), img.String()); err != nil {
+			return err
+		}
+	}
+	dgst, err := imageDigest(cli, img)
+	if err != nil {
+		return err
+	}
+	entry := LockEntry{Worker: d.Name(), Name: img.String(), Source: img.Name(), Digest: dgst}
+	if tagged, ok := img.(reference.Tagged); ok {
+		entry.Version = tagged.Tag()
+	}
+	if d.Destination == "" {
+		entry.Path = lockPath(path.Join(d.dir(), d.archive(img)))
+	}
+	lockRecord(entry)
 	return nil
 }
 
+type imageInspector interface {
+	ImageInspect(ctx context.Context, imageID string, inspectOpts ...client.ImageInspectOption) (image.InspectResponse, error)
+}
+
+// imageDigest gives the repository digest of a local image, which is the digest it is pulled by
+func imageDigest(cli imageInspector, img reference.Named) (string, error) {
+	inspect, err := cli.ImageInspect(context.Background(), img.String())
+	if err != nil {
+		return "", err
+	}
+	for _, repoDigest := range inspect.RepoDigests {
+		ref, err := reference.ParseNormalizedNamed(repoDigest)
+		if err != nil {
+			continue
+		}
+		if digested, ok := ref.(reference.Digested); ok && ref.Name() == img.Name() {
+			return digested.Digest().String(), nil
+		}
+	}
+	return "", fmt.Errorf("no digest of %s found, it may not have been pulled from a registry", img.Name())
+}
+
 type imageSaver interface {
 	ImageSave(ctx context.Context, images []string, saveOpts ...client.ImageSaveOption) (io.ReadCloser, error)
 }
@@ -179,6 +286,11 @@ type imagePusher interface {
 }
 
 func (d *Docker) writeRemote(cli imagePusher, remote string, in reference.Named) error {
+	if ref, err := reference.ParseNormalizedNamed(remote); err == nil {
+		if err := registryTLS(reference.Domain(ref)); err != nil {
+			return err
+		}
+	}
 	writer := io.Discard
 	if Verbose {
 		writer = os.Stderr
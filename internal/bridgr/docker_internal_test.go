@@ -5,6 +5,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
@@ -47,6 +48,11 @@ func (d *dockMock) ImageTag(ctx context.Context, image, ref string) error {
 	return args.Error(0)
 }
 
+func (d *dockMock) ImageInspect(ctx context.Context, imageID string, options ...client.ImageInspectOption) (image.InspectResponse, error) {
+	args := d.Called(ctx, imageID)
+	return args.Get(0).(image.InspectResponse), args.Error(1)
+}
+
 func (d *dockMock) ImageSave(ctx context.Context, images []string, options ...client.ImageSaveOption) (io.ReadCloser, error) {
 	args := d.Called(ctx, images)
 	return args.Get(0).(io.ReadCloser), args.Error(1)
@@ -149,6 +155,34 @@ func TestDockerDir(t *testing.T) {
 	}
 }
 
+func TestDockerArchive(t *testing.T) {
+	tests := []struct {
+		image  string
+		expect string
+	}{
+		{"bluth/banana:7", "bluth_banana_7.tar"},
+		{"bluth/banana:8", "bluth_banana_8.tar"},
+		{"registry.bluth.com/banana@sha256:" + strings.Repeat("a", 64), "banana_sha256_" + strings.Repeat("a", 64) + ".tar"},
+	}
+	for _, test := range tests {
+		t.Run(test.image, func(t *testing.T) {
+			img, _ := reference.ParseNormalizedNamed(test.image)
+			if result := (&Docker{}).archive(img); !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestDockerSetupSameArchive(t *testing.T) {
+	t.Chdir(t.TempDir())
+	banana, _ := reference.ParseNormalizedNamed("bluth/banana:7")
+	docker := Docker{Images: []reference.Named{banana, banana}}
+	if err := docker.Setup(); err == nil || !strings.Contains(err.Error(), "bluth_banana_7.tar") {
+		t.Errorf("expected images saved to the same archive to be rejected, got %v", err)
+	}
+}
+
 func TestDockerWriteRemote(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -233,3 +267,58 @@ func TestDockerTagForRemote(t *testing.T) {
 		})
 	}
 }
+
+func TestImageDigest(t *testing.T) {
+	banana := dockerMust(reference.ParseNormalizedNamed("bluth/banana:latest"))
+	tests := []struct {
+		name    string
+		digests []string
+		err     error
+		expect  string
+	}{
+		{"found", []string{"registry.bluth.com/bluth/banana@sha256:aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa", "bluth/banana@sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"}, nil, "sha256:bbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbbb"},
+		{"built locally", nil, nil, ""},
+		{"inspect error", nil, errDefault, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mock := dockMock{}
+			mock.On("ImageInspect", context.Background(), banana.String()).Return(image.InspectResponse{RepoDigests: test.digests}, test.err)
+			result, err := imageDigest(&mock, banana)
+			if (test.expect == "") != (err != nil) {
+				t.Errorf("expected an error only without a digest, got %v", err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestImageUnchanged(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resetCache(t)
+	_ = os.WriteFile("banana.tar", []byte("image"), 0644)
+	cachePut("bluth/banana:latest", "banana.tar", cacheEntry{Digest: "sha256:abc"})
+	cachePut("registry.bluth.com/bluth/banana:latest", "", cacheEntry{Digest: "sha256:abc"})
+	tests := []struct {
+		name   string
+		source string
+		target string
+		digest string
+		expect bool
+	}{
+		{"saved", "bluth/banana:latest", "banana.tar", "sha256:abc", true},
+		{"pushed", "registry.bluth.com/bluth/banana:latest", "", "sha256:abc", true},
+		{"new digest", "bluth/banana:latest", "banana.tar", "sha256:def", false},
+		{"unknown digest", "bluth/banana:latest", "banana.tar", "", false},
+		{"never saved", "bluth/frozen:latest", "frozen.tar", "sha256:abc", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if result := imageUnchanged(test.source, test.target, test.digest); result != test.expect {
+				t.Errorf("expected %t, got %t", test.expect, result)
+			}
+		})
+	}
+}
@@ -1,16 +1,27 @@
 package bridgr
 
 import (
-	"crypto/tls"
+	"bufio"
+	"bytes"
+	"crypto/md5"  //nolint:gosec // md5 is offered for verifying upstream checksums, not used for security
+	"crypto/sha1" //nolint:gosec // sha1 is offered for verifying upstream checksums, not used for security
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"reflect"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -24,32 +35,45 @@ import (
 )
 
 var (
-	s3session                   = session.Must(session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable}))
-	defaultS3     s3iface.S3API = s3.New(s3session) // used for getting the desired files bucket location. A new client is created when the files region is known
-	headerTimeout               = time.Second * 5   // we expect to get headers coming back in 5 seconds
-	keepAlive                   = time.Second * 3   // we create a new client for each file, so no keepalive needed as we won't reuse the client
+	s3session    = session.Must(session.NewSessionWithOptions(session.Options{SharedConfigState: session.SharedConfigEnable}))
+	s3HTTPClient = withHostTLS(s3session.Config.HTTPClient)
+	// defaultS3 is used for getting the desired files bucket location. A new client is created when the files region is known
+	defaultS3     s3iface.S3API = s3.New(s3session, aws.NewConfig().WithHTTPClient(s3HTTPClient))
+	headerTimeout               = time.Second * 5 // we expect to get headers coming back in 5 seconds
+	keepAlive                   = time.Second * 3 // we create a new client for each file, so no keepalive needed as we won't reuse the client
 	httpClient                  = &http.Client{
-		// TODO: this would be much better to do as a fallback - if regular (InsecureSkipVerify: false) fails first
-		Transport: &http.Transport{
+		// each host is connected to with its own TLS configuration, see ConfigureTLS
+		Transport: newHostTransport(&http.Transport{
 			Dial: (&net.Dialer{
 				Timeout:   FileTimeout,
 				KeepAlive: keepAlive,
 			}).Dial,
-			// this will be _really_ bad if someday we supported 2-way SSL
-			TLSClientConfig:       &tls.Config{InsecureSkipVerify: true}, //nolint:gosec  // ignore SSL certificates
 			ResponseHeaderTimeout: headerTimeout,
-		},
+		}),
 	}
 )
 
 // File is the implementation for static File repositories
 type File []*FileItem
 
-// FileItem is a discreet file definition object
+// FileItem is a discreet file definition object. It is verified against any checksums and signatures it has.
+// With a ChecksumURL, the signatures are of the checksum file, as releases usually sign their checksums rather than each file.
 type FileItem struct {
-	Source     *url.URL
-	Target     string
-	normalized bool
+	Source         *url.URL
+	Target         string
+	SHA256         string `mapstructure:"sha256"`
+	SHA512         string `mapstructure:"sha512"`
+	ChecksumURL    string `mapstructure:"checksum_url"`
+	GPGSignature   string `mapstructure:"gpg_signature"`
+	GPGKeyring     string `mapstructure:"gpg_keyring"`
+	Minisign       string
+	MinisignKey    string `mapstructure:"minisign_key"`
+	Cosign         string
+	CosignKey      string `mapstructure:"cosign_key"`
+	CosignIdentity string `mapstructure:"cosign_identity"`
+	CosignIssuer   string `mapstructure:"cosign_issuer"`
+	CosignRoots    string `mapstructure:"cosign_roots"`
+	normalized     bool
 }
 
 type fetcher interface {
@@ -103,6 +127,138 @@ func (fi *FileItem) fetch(fetcher fetcher, cr CredentialReader, output io.WriteC
 	return nil
 }
 
+// get fetches the item to its target, and verifies it. The target is removed if either fails.
+func (fi *FileItem) get(fetcher fetcher, cr CredentialReader) error {
+	if fi.Source.Scheme == "http" || fi.Source.Scheme == "https" {
+		if err := conditionalDownload(fi.Source.String(), fi.Target); err != nil {
+			return err
+		}
+	} else {
+		out, err := os.Create(fi.Target)
+		if err != nil {
+			return err
+		}
+		if err := fi.fetch(fetcher, cr, out); err != nil {
+			_ = os.Remove(fi.Target)
+			return err
+		}
+	}
+	if err := fi.verify(); err != nil {
+		_ = os.Remove(fi.Target)
+		return err
+	}
+	return nil
+}
+
+// verify checks the target against the checksums and signatures of the item
+func (fi FileItem) verify() error {
+	type checksum struct{ algorithm, sum string }
+	var checksums []checksum
+	if fi.SHA256 != "" {
+		checksums = append(checksums, checksum{"sha256", fi.SHA256})
+	}
+	if fi.SHA512 != "" {
+		checksums = append(checksums, checksum{"sha512", fi.SHA512})
+	}
+
+	// signed opens what the signatures are of, the target or its checksum file
+	signed := func() (io.ReadCloser, error) { return os.Open(fi.Target) }
+	if fi.ChecksumURL != "" {
+		content, err := readSource(fi.ChecksumURL)
+		if err != nil {
+			return fmt.Errorf("unable to get checksum file: %s", err)
+		}
+		sum, err := checksumFor(content, path.Base(fi.Source.Path))
+		if err != nil {
+			return err
+		}
+		algorithm, err := checksumAlgorithm(sum)
+		if err != nil {
+			return err
+		}
+		checksums = append(checksums, checksum{algorithm, sum})
+		signed = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(content)), nil }
+	}
+
+	signatures := []struct {
+		source string
+		check  func(io.Reader, []byte) error
+	}{
+		{fi.GPGSignature, func(r io.Reader, sig []byte) error {
+			if fi.GPGKeyring == "" {
+				return errors.New("a gpg_keyring is needed to verify a gpg_signature")
+			}
+			keyring, err := readKeyring(fi.GPGKeyring)
+			if err != nil {
+				return err
+			}
+			return verifySignature(keyring, r, sig)
+		}},
+		{fi.Minisign, func(r io.Reader, sig []byte) error {
+			if fi.MinisignKey == "" {
+				return errors.New("a minisign_key is needed to verify a minisign signature")
+			}
+			return verifyMinisign(fi.MinisignKey, r, sig)
+		}},
+		{fi.Cosign, func(r io.Reader, bundle []byte) error {
+			return verifyCosign(cosignVerifier{Key: fi.CosignKey, Identity: fi.CosignIdentity, Issuer: fi.CosignIssuer, Roots: fi.CosignRoots}, r, bundle)
+		}},
+	}
+	for _, signature := range signatures {
+		if signature.source == "" {
+			continue
+		}
+		sig, err := readSource(signature.source)
+		if err != nil {
+			return fmt.Errorf("unable to get signature %s: %s", signature.source, err)
+		}
+		in, err := signed()
+		if err != nil {
+			return err
+		}
+		err = signature.check(in, sig)
+		in.Close()
+		if err != nil {
+			return fmt.Errorf("signature %s does not verify: %s", signature.source, err)
+		}
+	}
+
+	for _, expect := range checksums {
+		sum, err := fileChecksum(fi.Target, expect.algorithm)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(sum, strings.TrimSpace(expect.sum)) {
+			return fmt.Errorf("%s checksum mismatch, expected %s but got %s", expect.algorithm, expect.sum, sum)
+		}
+	}
+	return nil
+}
+
+// readSource reads a URL, or a local file when it is not an HTTP URL
+func readSource(source string) ([]byte, error) {
+	if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+		return os.ReadFile(source)
+	}
+	resp, err := httpGet(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// checksumFor finds the checksum of a file in a checksum file, which may also hold only the checksum
+func checksumFor(content []byte, name string) (string, error) {
+	if sum, ok := parseChecksumFile(content)[name]; ok {
+		return sum, nil
+	}
+	if fields := strings.Fields(string(content)); len(fields) == 1 {
+		return fields[0], nil
+	}
+	return "", fmt.Errorf("no checksum for %s found", name)
+}
+
 // Image returns the Named image for executing
 func (f File) Image() reference.Named {
 	return nil
@@ -135,17 +291,14 @@ func (f File) Run() error {
 	}
 	credentials := WorkerCredentialReader{}
 	fetcher := fileFetcher{}
-	for _, item := range f {
-		out, createErr := os.Create(item.Target)
-		if createErr != nil {
-			log.Info("Unable to create local file '%s' (for %s) %s", item.Target, item.Source.String(), createErr)
-			continue
-		}
-		if err := item.fetch(&fetcher, &credentials, out); err != nil {
+	forEach(len(f), func(i int) {
+		item := f[i]
+		if err := lockArtifact(item.Target, func() error { return item.get(&fetcher, &credentials) }); err != nil {
 			log.Info("Files '%s' - %+s", item.Source.String(), err)
-			_ = os.Remove(item.Target)
+			return
 		}
-	}
+		lockRecord(LockEntry{Worker: f.Name(), Name: item.Source.String(), Source: item.Source.String(), Path: lockPath(item.Target)})
+	})
 	return nil
 }
 
@@ -156,6 +309,19 @@ func (f File) Setup() error {
 	for _, item := range f {
 		_ = item.Normalize(f.dir())
 	}
+	return sameTarget(f)
+}
+
+// sameTarget gives an error when two normalized items would be written to the same target. Items are fetched concurrently, so
+// they would be written over each other.
+func sameTarget(items []*FileItem) error {
+	targets := map[string]string{}
+	for _, item := range items {
+		if other, ok := targets[item.Target]; ok {
+			return fmt.Errorf("%s and %s would both be written to %s", other, item, item.Target)
+		}
+		targets[item.Target] = item.String()
+	}
 	return nil
 }
 
@@ -195,12 +361,185 @@ func (ff *fileFetcher) httpFetch(httpClient *http.Client, source string, out io.
 		return err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("unable to download %s: %s", source, resp.Status)
+	}
 
 	// Write the body to file
 	_, err = io.Copy(out, resp.Body)
 	return err
 }
 
+// httpGet requests source using any credentials available for its host. Unsuccessful HTTP status codes are returned as errors.
+// The caller must close the response body.
+func httpGet(source string, headers ...string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, source, nil)
+	if err != nil {
+		return nil, err
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	credentials := WorkerCredentialReader{}
+	if creds, ok := credentials.Read(req.URL); ok && creds.IsValid() {
+		log.Trace("Found credentials for %s", req.URL.Hostname())
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		resp.Body.Close()
+		return nil, fmt.Errorf("unable to get %s: %s", source, resp.Status)
+	}
+	return resp, nil
+}
+
+// getJSON decodes the JSON document found at source into v
+func getJSON(source string, v interface{}) error {
+	log.Trace("Fetching JSON document %s", source)
+	resp, err := httpGet(source, "Accept", "application/json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// download fetches source to the target file path, creating any needed directories. The target is removed if the fetch fails.
+// HTTP sources are only fetched again when they have changed since the target was downloaded. With Locked, only targets pinned in
+// the lock file are fetched.
+func download(source *url.URL, target string) error {
+	return lockArtifact(target, func() error {
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return err
+		}
+		if source.Scheme == "http" || source.Scheme == "https" {
+			return conditionalDownload(source.String(), target)
+		}
+		out, err := os.Create(target)
+		if err != nil {
+			return err
+		}
+		item := FileItem{Source: source, Target: target, normalized: true}
+		if err := item.fetch(&fileFetcher{}, &WorkerCredentialReader{}, out); err != nil {
+			_ = os.Remove(target)
+			return err
+		}
+		return nil
+	})
+}
+
+// conditionalDownload fetches an HTTP source to target, unless it is unchanged since it was cached, using If-None-Match and If-Modified-Since.
+// The source is written next to the target and then renamed over it, so a partial download never replaces the target.
+func conditionalDownload(source, target string) error {
+	var headers []string
+	if entry, ok := cacheGet(source, target); ok {
+		if entry.ETag != "" {
+			headers = append(headers, "If-None-Match", entry.ETag)
+		}
+		if entry.LastModified != "" {
+			headers = append(headers, "If-Modified-Since", entry.LastModified)
+		}
+	}
+	resp, err := httpGet(source, headers...)
+	if err != nil {
+		_ = os.Remove(target)
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotModified {
+		log.Trace("%s is unchanged since it was downloaded to %s", source, target)
+		return nil
+	}
+
+	part := target + ".part"
+	out, err := os.Create(part)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, resp.Body)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(part, target)
+	}
+	if err != nil {
+		_ = os.Remove(part)
+		_ = os.Remove(target)
+		return err
+	}
+	cachePut(source, target, cacheEntry{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")})
+	return nil
+}
+
+// checksumAlgorithms are the digests that can be calculated by fileChecksum, by their usual name in repository metadata
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha384": sha512.New384,
+	"sha512": sha512.New,
+}
+
+// fileChecksum gives the hex encoded digest of a file, using the named algorithm
+func fileChecksum(file, algorithm string) (string, error) {
+	newHash, ok := checksumAlgorithms[strings.ToLower(algorithm)]
+	if !ok {
+		return "", fmt.Errorf("unsupported checksum type %s", algorithm)
+	}
+	in, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	h := newHash()
+	if _, err := io.Copy(h, in); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// bsdChecksum matches a line of a checksum file in the BSD format, ie "SHA256 (file.iso) = <hex>"
+var bsdChecksum = regexp.MustCompile(`^\w+ \((.+)\) = ([0-9a-fA-F]+)$`)
+
+// parseChecksumFile reads a checksum file into checksums by file name. Lines may be in the format of sha256sum, ie SHA256SUMS,
+// or in the BSD format, and other lines are skipped.
+func parseChecksumFile(content []byte) map[string]string {
+	sums := map[string]string{}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if match := bsdChecksum.FindStringSubmatch(line); match != nil {
+			sums[match[1]] = match[2]
+			continue
+		}
+		if fields := strings.Fields(line); len(fields) == 2 {
+			sums[strings.TrimPrefix(fields[1], "*")] = fields[0]
+		}
+	}
+	return sums
+}
+
+// checksumAlgorithm gives the name of the digest that a hex encoded checksum was made with, by its length
+func checksumAlgorithm(sum string) (string, error) {
+	switch len(sum) {
+	case 32:
+		return "md5", nil
+	case 40:
+		return "sha1", nil
+	case 64:
+		return "sha256", nil
+	case 96:
+		return "sha384", nil
+	case 128:
+		return "sha512", nil
+	}
+	return "", fmt.Errorf("unknown checksum type for %s", sum)
+}
+
 func (ff *fileFetcher) s3Fetch(client s3iface.S3API, source *url.URL, out io.WriteCloser) error {
 	defer out.Close()
 	if client == (*s3.S3)(nil) {
@@ -227,7 +566,7 @@ func (ff *fileFetcher) regionalClient(source *url.URL, creds Credential) *s3.S3
 	}
 	region := s3.NormalizeBucketLocation(aws.StringValue(loc.LocationConstraint))
 
-	cfg := aws.NewConfig().WithRegion(aws.StringValue(&region))
+	cfg := aws.NewConfig().WithRegion(aws.StringValue(&region)).WithHTTPClient(s3HTTPClient)
 	if len(creds.Username) > 0 {
 		cfg.WithCredentials(credentials.NewStaticCredentials(creds.Username, creds.Password, ""))
 		log.Trace("Using static AWS credentials from bridgr environment")
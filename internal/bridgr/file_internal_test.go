@@ -2,14 +2,23 @@ package bridgr
 
 import (
 	"bytes"
+	"crypto/sha1" //nolint:gosec // test fixture
+	"crypto/sha256"
+	"crypto/sha512"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
+	"os"
+	"path"
 	"reflect"
+	"strings"
 	"testing"
 
+	"github.com/ProtonMail/go-crypto/openpgp"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3iface"
 	"github.com/google/go-cmp/cmp"
@@ -108,6 +117,30 @@ func TestFilesDir(t *testing.T) {
 	}
 }
 
+func TestFilesSetup(t *testing.T) {
+	t.Chdir(t.TempDir())
+	source := func(s string) *url.URL {
+		u, _ := url.Parse(s)
+		return u
+	}
+	tests := []struct {
+		name    string
+		files   File
+		isError bool
+	}{
+		{"different targets", File{{Source: source("https://bluth.com/banana.tar.gz")}, {Source: source("https://bluth.com/frozen.tar.gz")}}, false},
+		{"different directories", File{{Source: source("https://bluth.com/a/banana.tar.gz")}, {Source: source("https://bluth.com/b/banana.tar.gz"), Target: "b"}}, false},
+		{"same target", File{{Source: source("https://bluth.com/a/banana.tar.gz")}, {Source: source("https://bluth.com/b/banana.tar.gz")}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := test.files.Setup(); test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+		})
+	}
+}
+
 func TestFilesHttp(t *testing.T) {
 	client := &http.Client{Transport: &httpMock{}}
 	defaultSrc, _ := url.Parse("https://bluth.com/arock.pdf")
@@ -195,6 +228,32 @@ func TestFilesFile(t *testing.T) {
 	// }
 }
 
+func TestFileChecksum(t *testing.T) {
+	file := path.Join(t.TempDir(), "banana")
+	_ = os.WriteFile(file, []byte("there's always money in the banana stand"), 0600)
+	tests := []struct {
+		algorithm string
+		expect    string
+		isError   bool
+	}{
+		{"sha256", fmt.Sprintf("%x", sha256.Sum256([]byte("there's always money in the banana stand"))), false},
+		{"SHA1", fmt.Sprintf("%x", sha1.Sum([]byte("there's always money in the banana stand"))), false},
+		{"crc32", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.algorithm, func(t *testing.T) {
+			result, err := fileChecksum(file, test.algorithm)
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
 func TestFileFetch(t *testing.T) {
 	httpSrc, _ := url.Parse("https://bluth.com/solid/as/arock.ppt")
 	ftpSrc, _ := url.Parse("ftp://bluth.com/solid/as/arock.ppt")
@@ -257,3 +316,178 @@ func TestRegionalClient(t *testing.T) {
 		t.Error(cmp.Diff(fakeRegion, *client.Client.Config.Region))
 	}
 }
+
+func TestParseChecksumFile(t *testing.T) {
+	content := []byte("abc123  node-v20.15.0-linux-x64.tar.xz\ndef456 *rustup-init.exe\n\nnot a checksum line here\n" +
+		"SHA256 (Rocky-9.4-x86_64-dvd.iso) = 0a1b2c\n")
+	expect := map[string]string{"node-v20.15.0-linux-x64.tar.xz": "abc123", "rustup-init.exe": "def456", "Rocky-9.4-x86_64-dvd.iso": "0a1b2c"}
+	if result := parseChecksumFile(content); !cmp.Equal(expect, result) {
+		t.Error(cmp.Diff(expect, result))
+	}
+}
+
+func TestChecksumAlgorithm(t *testing.T) {
+	for expect, length := range map[string]int{"md5": 32, "sha1": 40, "sha256": 64, "sha384": 96, "sha512": 128} {
+		result, err := checksumAlgorithm(strings.Repeat("a", length))
+		if err != nil {
+			t.Error(err)
+		}
+		if !cmp.Equal(expect, result) {
+			t.Error(cmp.Diff(expect, result))
+		}
+	}
+	if _, err := checksumAlgorithm("abc"); err == nil {
+		t.Error("expected an error for an unknown checksum length")
+	}
+}
+
+func TestConditionalDownload(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resetCache(t)
+	content := "there's always money in the banana stand"
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.URL.Path == "/missing.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("ETag", `"stand"`)
+		if r.Header.Get("If-None-Match") == `"stand"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		_, _ = io.WriteString(w, content)
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		source  string
+		prepare func()
+		expect  string
+		isError bool
+	}{
+		{"first download", "/banana.txt", nil, content, false},
+		{"unchanged", "/banana.txt", nil, content, false},
+		{"changed locally", "/banana.txt", func() { _ = os.WriteFile("banana.txt", []byte("frozen"), 0644) }, content, false},
+		{"missing", "/missing.txt", nil, "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.prepare != nil {
+				test.prepare()
+			}
+			target := path.Base(test.source)
+			err := conditionalDownload(server.URL+test.source, target)
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+			result, _ := os.ReadFile(target)
+			if !cmp.Equal(test.expect, string(result)) {
+				t.Error(cmp.Diff(test.expect, string(result)))
+			}
+			if _, err := os.Stat(target + ".part"); err == nil {
+				t.Error("expected no partial download to be left")
+			}
+		})
+	}
+	if entry, _ := cacheGet(server.URL+"/banana.txt", "banana.txt"); entry.ETag != `"stand"` {
+		t.Errorf("expected the ETag to be cached, got %+v", entry)
+	}
+	if requests != 4 {
+		t.Errorf("expected a request for each download, got %d", requests)
+	}
+}
+
+func TestFileItemGet(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resetCache(t)
+	content := "there's always money in the banana stand"
+	sha512sum := fmt.Sprintf("%x", sha512.Sum512([]byte(content)))
+	sums := sha256Of(content) + "  banana.txt\n" + sha256Of("frozen") + "  frozen.txt\n"
+	signer := testSigner(t, "bluth.asc", true)
+	testSigner(t, "sitwell.asc", true)
+	signature := bytes.Buffer{}
+	_ = openpgp.ArmoredDetachSign(&signature, signer, strings.NewReader(sums), nil)
+	minisignKey, minisign := testMinisign(t)
+	files := map[string]string{
+		"/banana.txt":     content,
+		"/SHA256SUMS":     sums,
+		"/SHA256SUMS.asc": signature.String(),
+		"/banana.txt.sig": string(minisign([]byte(content), minisignHashed)),
+		"/SHA256SUMS.sig": string(minisign([]byte(sums), minisignHashed)),
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		file, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, file)
+	}))
+	defer server.Close()
+	source, _ := url.Parse(server.URL + "/banana.txt")
+
+	tests := []struct {
+		name    string
+		item    FileItem
+		isError bool
+	}{
+		{"unverified", FileItem{}, false},
+		{"sha256", FileItem{SHA256: strings.ToUpper(sha256Of(content))}, false},
+		{"sha256 mismatch", FileItem{SHA256: sha256Of("frozen")}, true},
+		{"sha512", FileItem{SHA512: sha512sum}, false},
+		{"sha512 mismatch", FileItem{SHA256: sha256Of(content), SHA512: sha256Of(content)}, true},
+		{"checksum file", FileItem{ChecksumURL: server.URL + "/SHA256SUMS"}, false},
+		{"missing checksum file", FileItem{ChecksumURL: server.URL + "/MD5SUMS"}, true},
+		{"gpg signed checksum file", FileItem{ChecksumURL: server.URL + "/SHA256SUMS", GPGSignature: server.URL + "/SHA256SUMS.asc", GPGKeyring: "bluth.asc"}, false},
+		{"gpg signed by other key", FileItem{ChecksumURL: server.URL + "/SHA256SUMS", GPGSignature: server.URL + "/SHA256SUMS.asc", GPGKeyring: "sitwell.asc"}, true},
+		{"gpg signature without keyring", FileItem{ChecksumURL: server.URL + "/SHA256SUMS", GPGSignature: server.URL + "/SHA256SUMS.asc"}, true},
+		{"gpg signature of other content", FileItem{GPGSignature: server.URL + "/SHA256SUMS.asc", GPGKeyring: "bluth.asc"}, true},
+		{"missing signature", FileItem{GPGSignature: server.URL + "/banana.txt.asc", GPGKeyring: "bluth.asc"}, true},
+		{"minisign", FileItem{Minisign: server.URL + "/banana.txt.sig", MinisignKey: minisignKey}, false},
+		{"minisign signed checksum file", FileItem{ChecksumURL: server.URL + "/SHA256SUMS", Minisign: server.URL + "/SHA256SUMS.sig", MinisignKey: minisignKey}, false},
+		{"minisign without key", FileItem{Minisign: server.URL + "/banana.txt.sig"}, true},
+		{"cosign without key or identity", FileItem{Cosign: server.URL + "/SHA256SUMS"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			item := test.item
+			item.Source, item.Target = source, "banana.txt"
+			err := item.get(&fileFetcher{}, &WorkerCredentialReader{})
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+			if _, err := os.Stat("banana.txt"); test.isError != os.IsNotExist(err) {
+				t.Errorf("expected the target to be removed only when it does not verify, got %v", err)
+			}
+		})
+	}
+}
+
+func TestChecksumFor(t *testing.T) {
+	sum := sha256Of("banana")
+	tests := []struct {
+		name    string
+		content string
+		expect  string
+		isError bool
+	}{
+		{"sha256sum", sum + "  banana.txt\n" + sha256Of("frozen") + "  frozen.txt\n", sum, false},
+		{"bsd", "SHA256 (banana.txt) = " + sum + "\n", sum, false},
+		{"single checksum", sum + "\n", sum, false},
+		{"missing", sha256Of("frozen") + "  frozen.txt\n", "", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := checksumFor([]byte(test.content), "banana.txt")
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+			if got != test.expect {
+				t.Errorf("expected %s, got %s", test.expect, got)
+			}
+		})
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/distribution/reference"
 	"github.com/mitchellh/mapstructure"
 	"gopkg.in/src-d/go-git.v4"
+	"gopkg.in/src-d/go-git.v4/config"
 	"gopkg.in/src-d/go-git.v4/plumbing"
 	"gopkg.in/src-d/go-git.v4/plumbing/storer"
 	"gopkg.in/src-d/go-git.v4/plumbing/transport/http"
@@ -106,8 +107,17 @@ func (g *Git) Hook() mapstructure.DecodeHookFunc {
 	)
 }
 
-// Setup does any initial setup for the Git worker
+// Setup does any initial setup for the Git worker. Repositories are cloned concurrently into directories named for their URL, so
+// two repositories with the same name would be cloned over each other.
 func (g *Git) Setup() error {
+	repos := map[string]string{}
+	for _, item := range *g {
+		dir := g.cloneDir(item.URL)
+		if other, ok := repos[dir]; ok {
+			return fmt.Errorf("git repositories %s and %s would both be cloned into %s", other, item.URL, dir)
+		}
+		repos[dir] = item.URL.String()
+	}
 	return os.MkdirAll(g.dir(), os.ModePerm)
 }
 
@@ -117,11 +127,23 @@ func (g *Git) Run() error {
 	if err != nil {
 		return err
 	}
-	for _, item := range *g {
+	items := *g
+	forEach(len(items), func(i int) {
+		item := items[i]
 		dir := g.prepDir(item.URL)
-		repo, err := item.clone(dir)
+		repo, err := git.PlainOpen(dir)
+		if err == nil {
+			err = item.update(repo)
+		} else {
+			repo, err = item.clone(dir)
+		}
 		if err != nil {
 			log.Info("Error cloning Git repository '%s': %s", item.URL.String(), err)
+			return
+		}
+		if err := item.lock(g.Name(), repo, dir); err != nil {
+			lockDrift(g.Name(), "%s", err)
+			log.Info("Error locking Git repository '%s': %s", item.URL.String(), err)
 		}
 		if item.Bare {
 			_ = os.MkdirAll(path.Join(dir, "info"), os.ModePerm)
@@ -134,23 +156,64 @@ func (g *Git) Run() error {
 			generatePackInfo(repo, infoPack)
 			infoPack.Close()
 		}
-	}
+	})
 
 	return nil
 }
 
-func (g *Git) prepDir(url *url.URL) string {
+// cloneDir is the directory a repository is cloned into, named for the last element of its URL
+func (g *Git) cloneDir(url *url.URL) string {
 	dir := path.Base(url.Path)
 	dir = strings.TrimSuffix(dir, git.GitDirName)
-	dir = path.Join(g.dir(), dir)
+	return path.Join(g.dir(), dir)
+}
 
+func (g *Git) prepDir(url *url.URL) string {
+	dir := g.cloneDir(url)
 	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		if _, err := git.PlainOpen(dir); err == nil {
+			log.Trace("%s is an existing clone, it will be updated", dir)
+			return dir
+		}
 		log.Trace("%s exists, removing to allow new clone", dir)
 		os.RemoveAll(dir)
 	}
 	return dir
 }
 
+// refSpecs are what is fetched into an existing clone, the same references that were cloned
+func (gi GitItem) refSpecs() []config.RefSpec {
+	if gi.Branch != "" || gi.Tag != "" {
+		ref := gi.reference()
+		return []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", ref, ref))}
+	}
+	return []config.RefSpec{"+refs/heads/*:refs/heads/*", "+refs/tags/*:refs/tags/*"}
+}
+
+// update fetches into an existing clone, so that only objects that are new since it was cloned are downloaded
+func (gi GitItem) update(repo *git.Repository) error {
+	log.Trace("About to fetch %s into its existing clone", gi.URL.String())
+	creds := gitCredentials{}
+	gitAuth(gi.URL, &creds)
+	err := repo.Fetch(&git.FetchOptions{RemoteName: git.DefaultRemoteName, RefSpecs: gi.refSpecs(), Auth: &creds.BasicAuth, Force: true})
+	if err == git.NoErrAlreadyUpToDate {
+		log.Trace("%s is already up to date", gi.URL.String())
+		return nil
+	}
+	if err != nil || gi.Bare {
+		return err
+	}
+	head, err := repo.Reference(plumbing.HEAD, true)
+	if err != nil {
+		return err
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	return worktree.Reset(&git.ResetOptions{Commit: head.Hash(), Mode: git.HardReset})
+}
+
 func (gi GitItem) clone(dir string) (*git.Repository, error) {
 	log.Trace("About to clone %s into %s", gi.URL.String(), dir)
 	creds := gitCredentials{}
@@ -170,6 +233,66 @@ func (gi GitItem) clone(dir string) (*git.Repository, error) {
 	return git.PlainClone(dir, gi.Bare, &opts)
 }
 
+// reference is the name of the reference that is cloned, HEAD when there is no branch or tag
+func (gi GitItem) reference() plumbing.ReferenceName {
+	switch {
+	case gi.Branch != "":
+		return gi.Branch
+	case gi.Tag != "":
+		return gi.Tag
+	}
+	return plumbing.HEAD
+}
+
+// lock records the commit of the cloned reference in the lock file, under the name of the worker. With Locked, the reference is reset
+// to the commit pinned for the repository, which must be in the clone.
+func (gi GitItem) lock(worker string, repo *git.Repository, dir string) error {
+	ref, err := repo.Reference(gi.reference(), true)
+	if err != nil {
+		return err
+	}
+	hash := ref.Hash()
+	if Locked {
+		pin, ok := lockPin(worker, gi.String())
+		if !ok {
+			return fmt.Errorf("%s is not in the lock file", gi.String())
+		}
+		hash = plumbing.NewHash(pin.Digest)
+		if hash != ref.Hash() {
+			log.Trace("resetting %s of %s from %s to the pinned %s", ref.Name(), gi.String(), ref.Hash(), hash)
+			if err := gi.reset(repo, ref.Name(), hash); err != nil {
+				return fmt.Errorf("pinned commit %s of %s is not available: %s", hash, ref.Name().Short(), err)
+			}
+		}
+	}
+	lockRecord(LockEntry{
+		Worker:  worker,
+		Name:    gi.String(),
+		Version: ref.Name().Short(),
+		Source:  gi.String(),
+		Digest:  hash.String(),
+		Path:    lockPath(dir),
+	})
+	return nil
+}
+
+func (gi GitItem) reset(repo *git.Repository, name plumbing.ReferenceName, hash plumbing.Hash) error {
+	if _, err := repo.Object(plumbing.AnyObject, hash); err != nil {
+		return err
+	}
+	if err := repo.Storer.SetReference(plumbing.NewHashReference(name, hash)); err != nil {
+		return err
+	}
+	if gi.Bare {
+		return nil
+	}
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	return worktree.Reset(&git.ResetOptions{Commit: hash, Mode: git.HardReset})
+}
+
 func gitAuth(url *url.URL, rw CredentialReaderWriter) {
 	if creds, ok := rw.Read(url); ok {
 		log.Trace("Git: Found credentials for %s", url.String())
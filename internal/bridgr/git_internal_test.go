@@ -3,14 +3,17 @@ package bridgr
 import (
 	"bytes"
 	"net/url"
+	"os"
 	"path"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/google/go-cmp/cmp"
 	"gopkg.in/src-d/go-git.v4"
 	"gopkg.in/src-d/go-git.v4/plumbing"
+	"gopkg.in/src-d/go-git.v4/plumbing/object"
 	"gopkg.in/src-d/go-git.v4/storage/memory"
 )
 
@@ -251,3 +254,164 @@ func TestGitParseComplex(t *testing.T) {
 		})
 	}
 }
+
+// gitCommits creates a repository with a commit for each message, and gives their hashes
+func gitCommits(t *testing.T, dir string, messages ...string) (*git.Repository, []plumbing.Hash) {
+	t.Helper()
+	repo, err := git.PlainInit(dir, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	worktree, _ := repo.Worktree()
+	var hashes []plumbing.Hash
+	for _, message := range messages {
+		_ = os.WriteFile(path.Join(dir, "README"), []byte(message), 0644)
+		_, _ = worktree.Add("README")
+		hash, err := worktree.Commit(message, &git.CommitOptions{Author: &object.Signature{Name: "George Bluth", Email: "george@bluth.com", When: time.Now()}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		hashes = append(hashes, hash)
+	}
+	return repo, hashes
+}
+
+func TestGitLock(t *testing.T) {
+	t.Chdir(t.TempDir())
+	src, _ := url.Parse("https://git.bluth/michael.git")
+	dir := path.Join(Git{}.dir(), "michael")
+	_, hashes := gitCommits(t, dir, "model home", "banana stand")
+
+	tests := []struct {
+		name    string
+		locked  bool
+		pin     string
+		expect  plumbing.Hash
+		isError bool
+	}{
+		{"unlocked", false, "", hashes[1], false},
+		{"pinned to the latest commit", true, hashes[1].String(), hashes[1], false},
+		{"pinned to an earlier commit", true, hashes[0].String(), hashes[0], false},
+		{"pinned to a missing commit", true, "0123456789012345678901234567890123456789", hashes[0], true},
+		{"not pinned", true, "", hashes[0], true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetLocks(t, test.locked)
+			if test.pin != "" {
+				_ = ReadLock(strings.NewReader("artifacts:\n  - {worker: git, name: '" + src.String() + "', digest: " + test.pin + "}\n"))
+			}
+			repo, _ := git.PlainOpen(dir)
+			err := GitItem{URL: src}.lock(Git{}.Name(), repo, dir)
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+			head, _ := repo.Head()
+			if !cmp.Equal(test.expect, head.Hash()) {
+				t.Error(cmp.Diff(test.expect.String(), head.Hash().String()))
+			}
+			if test.isError {
+				return
+			}
+			expect := []LockEntry{{Worker: "git", Name: src.String(), Version: "master", Source: src.String(), Digest: test.expect.String(), Path: "git/michael"}}
+			if !cmp.Equal(expect, locks.resolved["git"]) {
+				t.Error(cmp.Diff(expect, locks.resolved["git"]))
+			}
+			readme, _ := os.ReadFile(path.Join(dir, "README"))
+			if commit, _ := repo.CommitObject(test.expect); commit != nil && commit.Message != string(readme) {
+				t.Errorf("expected the worktree to be reset to %q, got %q", commit.Message, readme)
+			}
+		})
+	}
+}
+
+func TestGitUpdate(t *testing.T) {
+	t.Chdir(t.TempDir())
+	upstream, _ := gitCommits(t, "upstream", "model home")
+	src, _ := url.Parse(path.Join(BaseDir(""), "..", "upstream"))
+	tests := []struct {
+		name string
+		item GitItem
+	}{
+		{"bare", GitItem{URL: src, Bare: true}},
+		{"branch", GitItem{URL: src, Bare: true, Branch: plumbing.NewBranchReferenceName("master")}},
+		{"worktree", GitItem{URL: src}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := path.Join(t.TempDir(), "clone")
+			repo, err := test.item.clone(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := test.item.update(repo); err != nil {
+				t.Errorf("expected an up to date clone to not be an error, got %s", err)
+			}
+			worktree, _ := upstream.Worktree()
+			_ = os.WriteFile(path.Join("upstream", "README"), []byte(test.name), 0644)
+			_, _ = worktree.Add("README")
+			latest, _ := worktree.Commit(test.name, &git.CommitOptions{Author: &object.Signature{Name: "Lucille Bluth", Email: "lucille@bluth.com", When: time.Now()}})
+
+			if err := test.item.update(repo); err != nil {
+				t.Fatal(err)
+			}
+			head, _ := repo.Reference(plumbing.HEAD, true)
+			if !cmp.Equal(latest, head.Hash()) {
+				t.Error(cmp.Diff(latest.String(), head.Hash().String()))
+			}
+			if !test.item.Bare {
+				readme, _ := os.ReadFile(path.Join(dir, "README"))
+				if !cmp.Equal(test.name, string(readme)) {
+					t.Error(cmp.Diff(test.name, string(readme)))
+				}
+			}
+		})
+	}
+}
+
+func TestGitPrepDirExisting(t *testing.T) {
+	t.Chdir(t.TempDir())
+	g := Git{}
+	src, _ := url.Parse("https://git.bluth/michael.git")
+	dir := path.Join(g.dir(), "michael")
+	gitCommits(t, dir, "model home")
+	if result := g.prepDir(src); !cmp.Equal(dir, result) {
+		t.Error(cmp.Diff(dir, result))
+	}
+	if _, err := git.PlainOpen(dir); err != nil {
+		t.Errorf("expected an existing clone to be kept, got %s", err)
+	}
+
+	src, _ = url.Parse("https://git.bluth/gob.git")
+	dir = path.Join(g.dir(), "gob")
+	_ = os.MkdirAll(dir, os.ModePerm)
+	_ = os.WriteFile(path.Join(dir, "illusion"), []byte("trick"), 0644)
+	g.prepDir(src)
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("expected a directory that is not a clone to be removed")
+	}
+}
+
+func TestGitSetup(t *testing.T) {
+	t.Chdir(t.TempDir())
+	tests := []struct {
+		name    string
+		repos   []string
+		isError bool
+	}{
+		{"different names", []string{"https://github.com/bluth/stair-car.git", "https://github.com/bluth/banana-stand"}, false},
+		{"same name", []string{"https://github.com/bluth/tools.git", "https://github.com/sitwell/tools"}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			g := Git{}
+			for _, repo := range test.repos {
+				g = append(g, NewGitItem(repo))
+			}
+			err := g.Setup()
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,390 @@
+package bridgr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/distribution/reference"
+	"github.com/mitchellh/mapstructure"
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+	log "unknwon.dev/clog/v2"
+)
+
+const defaultGoProxy = "https://proxy.golang.org"
+
+// Golang is the configuration object for creating a Go module proxy
+type Golang struct {
+	Proxy   string
+	Modules []goModule
+}
+
+type goModule struct {
+	Path    string
+	Version string
+}
+
+// goInfo is the version information document from the module proxy protocol
+type goInfo struct {
+	Version string
+	Time    string `json:",omitempty"`
+}
+
+func (gm goModule) String() string {
+	if gm.Version != "" {
+		return gm.Path + "@" + gm.Version
+	}
+	return gm.Path
+}
+
+// dir is the top-level directory name for all objects written out under the Golang worker. It is "go", to match GOPROXY=http://<host>/go
+func (g Golang) dir() string {
+	return BaseDir("go")
+}
+
+// Name returns the name of this Configuration
+func (g Golang) Name() string {
+	return "golang"
+}
+
+// Image implements the Imager interface
+func (g Golang) Image() reference.Named {
+	return nil
+}
+
+func stringToGoModule(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf(goModule{}) {
+		return data, nil
+	}
+	parts := strings.SplitN(data.(string), "@", 2)
+	mod := goModule{Path: parts[0]}
+	if len(parts) > 1 {
+		mod.Version = parts[1]
+	}
+	return mod, nil
+}
+
+func arrayToGolang(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Slice || t != reflect.TypeOf(Golang{}) {
+		return data, nil
+	}
+	return map[string]interface{}{"modules": data}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (g *Golang) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		arrayToGolang,
+		stringToGoModule,
+	)
+}
+
+// Setup prepares the directory for the Go module proxy
+func (g *Golang) Setup() error {
+	log.Trace("Called Golang.Setup()")
+	if g.Proxy == "" {
+		g.Proxy = defaultGoProxy
+	}
+	g.Proxy = strings.TrimSuffix(g.Proxy, "/")
+	return os.MkdirAll(g.dir(), os.ModePerm)
+}
+
+// Run resolves the module graph of the configured modules. The go.mod of every module version in the graph is written,
+// along with the zip and info files of every version that minimal version selection picks in the build list of a configured module.
+func (g *Golang) Run() error {
+	if err := g.Setup(); err != nil {
+		return err
+	}
+	var roots []module.Version
+	for _, mod := range g.Modules {
+		version, err := g.query(mod)
+		if err != nil {
+			log.Info("Golang: unable to resolve %s - %s", mod, err)
+			continue
+		}
+		roots = append(roots, module.Version{Path: mod.Path, Version: version})
+	}
+
+	selected := g.resolve(roots)
+	mods := make([]module.Version, 0, len(selected))
+	for mod := range selected {
+		mods = append(mods, mod)
+	}
+	forEach(len(mods), func(i int) {
+		if err := g.fetch(mods[i], ".info", ".zip"); err != nil {
+			log.Info("Golang: unable to download %s - %s", mods[i], err)
+		}
+	})
+	paths := map[string]bool{}
+	for _, mod := range mods {
+		paths[mod.Path] = true
+	}
+	for modPath := range paths {
+		if err := g.writeList(modPath); err != nil {
+			log.Info("Golang: unable to write version list for %s - %s", modPath, err)
+		}
+	}
+	return nil
+}
+
+// resolve walks the requirements of every go.mod in the module graph, and gives the module versions in the build list of
+// any of the roots. Each root has its own build list, so a version that one root selects is kept even when another selects a higher one.
+func (g *Golang) resolve(roots []module.Version) map[module.Version]bool {
+	graph := map[module.Version][]module.Version{}
+	mu := sync.Mutex{}
+	queue := roots
+	for len(queue) > 0 {
+		var level []module.Version
+		for _, mod := range queue {
+			if _, ok := graph[mod]; !ok {
+				graph[mod] = nil
+				level = append(level, mod)
+			}
+		}
+		var next []module.Version
+		forEach(len(level), func(i int) {
+			requires, err := g.requirements(level[i])
+			if err != nil {
+				log.Info("Golang: unable to read go.mod of %s - %s", level[i], err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			graph[level[i]] = requires
+			next = append(next, requires...)
+		})
+		queue = next
+	}
+
+	selected := map[module.Version]bool{}
+	for _, root := range roots {
+		for modPath, version := range buildList(graph, root) {
+			selected[module.Version{Path: modPath, Version: version}] = true
+		}
+	}
+	return selected
+}
+
+// buildList gives the highest version of each module reachable from root in the module graph, as minimal version selection does
+func buildList(graph map[module.Version][]module.Version, root module.Version) map[string]string {
+	list := map[string]string{}
+	seen := map[module.Version]bool{}
+	queue := []module.Version{root}
+	for len(queue) > 0 {
+		mod := queue[0]
+		queue = queue[1:]
+		if seen[mod] {
+			continue
+		}
+		seen[mod] = true
+		if semver.Compare(mod.Version, list[mod.Path]) > 0 {
+			list[mod.Path] = mod.Version
+		}
+		queue = append(queue, graph[mod]...)
+	}
+	return list
+}
+
+// requirements downloads the go.mod of a module version, and gives the modules it requires
+func (g *Golang) requirements(mod module.Version) ([]module.Version, error) {
+	if err := g.fetch(mod, ".mod"); err != nil {
+		return nil, err
+	}
+	file, err := g.file(mod, ".mod")
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := modfile.ParseLax(file, content, nil)
+	if err != nil {
+		return nil, err
+	}
+	requires := make([]module.Version, 0, len(parsed.Require))
+	for _, req := range parsed.Require {
+		requires = append(requires, req.Mod)
+	}
+	return requires, nil
+}
+
+// query resolves a module's configured version the same way the go command does: an exact version, "latest",
+// a version prefix (ie, "v1.2"), or a comparison (ie, ">=v1.2.0" gives the lowest matching version, "<v2" the highest)
+func (g *Golang) query(mod goModule) (string, error) {
+	if mod.Version == "" || mod.Version == "latest" {
+		info := goInfo{}
+		source, err := g.url(mod.Path, "@latest")
+		if err != nil {
+			return "", err
+		}
+		if err := getJSON(source, &info); err != nil {
+			return "", err
+		}
+		return info.Version, nil
+	}
+	if semver.IsValid(mod.Version) && semver.Canonical(mod.Version) == strings.TrimSuffix(mod.Version, "+incompatible") {
+		return mod.Version, nil
+	}
+	source, err := g.url(mod.Path, "@v/list")
+	if err != nil {
+		return "", err
+	}
+	resp, err := httpGet(source)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	list, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	return queryVersion(strings.Fields(string(list)), mod.Version)
+}
+
+// queryVersion picks the version matching a query from a list of versions. Releases are preferred over pre-releases.
+func queryVersion(versions []string, query string) (string, error) {
+	var match func(string) bool
+	lowest := false
+	switch {
+	case strings.HasPrefix(query, ">="):
+		match, lowest = func(v string) bool { return semver.Compare(v, query[2:]) >= 0 }, true
+	case strings.HasPrefix(query, "<="):
+		match = func(v string) bool { return semver.Compare(v, query[2:]) <= 0 }
+	case strings.HasPrefix(query, ">"):
+		match, lowest = func(v string) bool { return semver.Compare(v, query[1:]) > 0 }, true
+	case strings.HasPrefix(query, "<"):
+		match = func(v string) bool { return semver.Compare(v, query[1:]) < 0 }
+	case semver.IsValid(query):
+		match = func(v string) bool {
+			return v == query || strings.HasPrefix(v, query+".") || strings.HasPrefix(v, query+"-")
+		}
+	default:
+		return "", fmt.Errorf("invalid version query %s", query)
+	}
+
+	var releases, prereleases []string
+	for _, v := range versions {
+		if !semver.IsValid(v) || !match(v) {
+			continue
+		}
+		if semver.Prerelease(v) == "" {
+			releases = append(releases, v)
+		} else {
+			prereleases = append(prereleases, v)
+		}
+	}
+	candidates := releases
+	if len(candidates) == 0 {
+		candidates = prereleases
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no version matching %s", query)
+	}
+	semver.Sort(candidates)
+	if lowest {
+		return candidates[0], nil
+	}
+	return candidates[len(candidates)-1], nil
+}
+
+// fetch downloads files of a module version from the upstream proxy, unless they've already been downloaded
+func (g *Golang) fetch(mod module.Version, exts ...string) error {
+	for _, ext := range exts {
+		target, err := g.file(mod, ext)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(target); err == nil {
+			if err := lockExisting(target); err != nil {
+				return err
+			}
+			continue
+		}
+		version, _ := module.EscapeVersion(mod.Version)
+		source, err := g.url(mod.Path, "@v/"+version+ext)
+		if err != nil {
+			return err
+		}
+		sourceURL, err := url.Parse(source)
+		if err != nil {
+			return err
+		}
+		if err := download(sourceURL, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// url gives the upstream proxy location of a file for the module path
+func (g *Golang) url(modPath, file string) (string, error) {
+	escaped, err := module.EscapePath(modPath)
+	if err != nil {
+		return "", err
+	}
+	return g.Proxy + "/" + escaped + "/" + file, nil
+}
+
+// file gives the location of a module version's file in the GOPROXY layout
+func (g *Golang) file(mod module.Version, ext string) (string, error) {
+	escaped, err := module.EscapePath(mod.Path)
+	if err != nil {
+		return "", err
+	}
+	version, err := module.EscapeVersion(mod.Version)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(g.dir(), filepath.FromSlash(escaped), "@v", version+ext), nil
+}
+
+// writeList writes the @v/list and @latest files for a module, from all versions that have a zip in the proxy directory.
+// This includes versions from earlier runs, so the proxy can grow over time.
+func (g *Golang) writeList(modPath string) error {
+	escaped, err := module.EscapePath(modPath)
+	if err != nil {
+		return err
+	}
+	versionDir := filepath.Join(g.dir(), filepath.FromSlash(escaped), "@v")
+	zips, err := filepath.Glob(filepath.Join(versionDir, "*.zip"))
+	if err != nil {
+		return err
+	}
+	var versions []string
+	for _, zip := range zips {
+		if version, err := module.UnescapeVersion(strings.TrimSuffix(filepath.Base(zip), ".zip")); err == nil {
+			versions = append(versions, version)
+		}
+	}
+	if len(versions) == 0 {
+		return errors.New("no versions have been downloaded")
+	}
+	semver.Sort(versions)
+	if err := os.WriteFile(filepath.Join(versionDir, "list"), []byte(strings.Join(versions, "\n")+"\n"), 0644); err != nil { //nolint:gosec // repository content is meant to be readable
+		return err
+	}
+
+	latest := versions[len(versions)-1]
+	for i := len(versions) - 1; i >= 0; i-- {
+		if semver.Prerelease(versions[i]) == "" {
+			latest = versions[i]
+			break
+		}
+	}
+	escapedLatest, _ := module.EscapeVersion(latest)
+	info, err := os.ReadFile(filepath.Join(versionDir, escapedLatest+".info"))
+	if err != nil {
+		info, _ = json.Marshal(goInfo{Version: latest})
+	}
+	return os.WriteFile(filepath.Join(filepath.Dir(versionDir), "@latest"), info, 0644) //nolint:gosec // repository content is meant to be readable
+}
@@ -0,0 +1,249 @@
+package bridgr
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"golang.org/x/mod/module"
+)
+
+var goProxyContent = map[string]string{
+	"/bluth.com/stair-car/@v/list":         "v0.9.0\nv1.0.0\nv1.1.0-beta\n",
+	"/bluth.com/stair-car/@v/v1.0.0.mod":   "module bluth.com/stair-car\n\nrequire (\n\tbluth.com/banana v1.1.0\n\tbluth.com/Seal v1.0.0\n)\n",
+	"/bluth.com/banana/@v/v1.1.0.mod":      "module bluth.com/banana\n\nrequire bluth.com/Seal v1.2.0 // indirect\n",
+	"/bluth.com/!seal/@v/v1.0.0.mod":       "module bluth.com/Seal\n",
+	"/bluth.com/!seal/@v/v1.2.0.mod":       "module bluth.com/Seal\n",
+	"/bluth.com/stair-car/@v/v1.0.0.info":  `{"Version":"v1.0.0","Time":"2019-05-31T00:00:00Z"}`,
+	"/bluth.com/banana/@v/v1.1.0.info":     `{"Version":"v1.1.0"}`,
+	"/bluth.com/!seal/@v/v1.2.0.info":      `{"Version":"v1.2.0"}`,
+	"/bluth.com/stair-car/@v/v1.0.0.zip":   "zip",
+	"/bluth.com/banana/@v/v1.1.0.zip":      "zip",
+	"/bluth.com/!seal/@v/v1.2.0.zip":       "zip",
+	"/bluth.com/cornballer/@latest":        `{"Version":"v2.0.0"}`,
+	"/bluth.com/cornballer/@v/v2.0.0.mod":  "module bluth.com/cornballer\n\ngo 1.21\n",
+	"/bluth.com/cornballer/@v/v2.0.0.info": `{"Version":"v2.0.0"}`,
+	"/bluth.com/cornballer/@v/v2.0.0.zip":  "zip",
+	"/bluth.com/hot-cops/@v/v1.0.0.mod":    "module bluth.com/hot-cops\n",
+	"/bluth.com/motherboy/@v/v1.0.0.mod":   "module bluth.com/motherboy\n\nrequire bluth.com/Seal v1.0.0\n",
+	"/bluth.com/hot-cops/@v/v1.0.0.info":   `{"Version":"v1.0.0"}`,
+}
+
+func goProxy() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if content, ok := goProxyContent[r.URL.Path]; ok {
+			fmt.Fprint(w, content)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+}
+
+func TestGolangDir(t *testing.T) {
+	expected := BaseDir("go")
+	result := Golang{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestStringToGoModule(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  interface{}
+		expect interface{}
+	}{
+		{"path", "golang.org/x/mod", goModule{Path: "golang.org/x/mod"}},
+		{"version", "golang.org/x/mod@v0.25.0", goModule{Path: "golang.org/x/mod", Version: "v0.25.0"}},
+		{"query", "golang.org/x/mod@>=v0.20", goModule{Path: "golang.org/x/mod", Version: ">=v0.20"}},
+		{"not a string", 42, 42},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := stringToGoModule(reflect.TypeOf(test.input), reflect.TypeOf(goModule{}), test.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestQueryVersion(t *testing.T) {
+	versions := []string{"v1.0.0", "v1.1.0", "v1.2.0", "v1.3.0-rc.1", "v2.0.0+incompatible", "bogus"}
+	tests := []struct {
+		query   string
+		expect  string
+		isError bool
+	}{
+		{"v1", "v1.2.0", false},
+		{"v1.1", "v1.1.0", false},
+		{">=v1.1", "v1.1.0", false},
+		{">v1.0.0", "v1.1.0", false},
+		{"<v1.2.0", "v1.1.0", false},
+		{"<=v1.2.0", "v1.2.0", false},
+		{">v2.0.0", "", true},
+		{"v1.3", "v1.3.0-rc.1", false},
+		{"banana", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.query, func(t *testing.T) {
+			result, err := queryVersion(versions, test.query)
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestGolangRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := goProxy()
+	defer server.Close()
+
+	golang := Golang{Proxy: server.URL, Modules: []goModule{{Path: "bluth.com/stair-car", Version: "v1"}, {Path: "bluth.com/cornballer"}}}
+	if err := golang.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectFiles := []string{
+		"bluth.com/stair-car/@v/v1.0.0.zip",
+		"bluth.com/stair-car/@v/v1.0.0.info",
+		"bluth.com/banana/@v/v1.1.0.zip",
+		"bluth.com/!seal/@v/v1.0.0.mod",
+		"bluth.com/!seal/@v/v1.2.0.zip",
+		"bluth.com/cornballer/@v/v2.0.0.zip",
+		"bluth.com/cornballer/@latest",
+	}
+	for _, file := range expectFiles {
+		if _, err := os.Stat(path.Join(golang.dir(), file)); err != nil {
+			t.Errorf("expected %s to be written: %s", file, err)
+		}
+	}
+	if _, err := os.Stat(path.Join(golang.dir(), "bluth.com/!seal/@v/v1.0.0.zip")); err == nil {
+		t.Error("expected only the selected version of a module to have a zip")
+	}
+
+	list, _ := os.ReadFile(path.Join(golang.dir(), "bluth.com/!seal/@v/list"))
+	if !cmp.Equal("v1.2.0\n", string(list)) {
+		t.Error(cmp.Diff("v1.2.0\n", string(list)))
+	}
+	latest, _ := os.ReadFile(path.Join(golang.dir(), "bluth.com/stair-car/@latest"))
+	info := goInfo{}
+	if err := json.Unmarshal(latest, &info); err != nil || !strings.HasPrefix(info.Time, "2019-05-31") {
+		t.Errorf("expected @latest to be the upstream info, but got %s", latest)
+	}
+}
+
+func TestGolangLocked(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := goProxy()
+	defer server.Close()
+	resetLocks(t, false)
+	golang := Golang{Proxy: server.URL, Modules: []goModule{{Path: "bluth.com/cornballer"}}}
+	_ = golang.Run()
+	if err := LockArtifacts(&golang); err != nil {
+		t.Fatal(err)
+	}
+	lockfile := bytes.Buffer{}
+	if err := WriteLock(&lockfile); err != nil {
+		t.Fatal(err)
+	}
+
+	resetLocks(t, true)
+	if err := ReadLock(&lockfile); err != nil {
+		t.Fatal(err)
+	}
+	_ = golang.Run()
+	if err := LockArtifacts(&golang); err != nil {
+		t.Errorf("expected the pinned modules to be fetched again, got %s", err)
+	}
+
+	resetLocks(t, true)
+	golang.Modules = []goModule{{Path: "bluth.com/stair-car", Version: "v1"}}
+	_ = golang.Run()
+	if _, err := os.Stat(path.Join(golang.dir(), "bluth.com/stair-car/@v/v1.0.0.zip")); err == nil {
+		t.Error("expected a module that is not in the lock file to not be fetched")
+	}
+	if err := LockArtifacts(&golang); err == nil || !strings.Contains(err.Error(), "go/bluth.com/stair-car/@v/v1.0.0.mod is not in the lock file") {
+		t.Errorf("expected drift for a module that is not in the lock file, got %v", err)
+	}
+}
+
+func TestGolangResolve(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := goProxy()
+	defer server.Close()
+	golang := Golang{Proxy: server.URL}
+	_ = golang.Setup()
+
+	stairCar := module.Version{Path: "bluth.com/stair-car", Version: "v1.0.0"}
+	motherboy := module.Version{Path: "bluth.com/motherboy", Version: "v1.0.0"}
+	tests := []struct {
+		name   string
+		roots  []module.Version
+		expect map[module.Version]bool
+	}{
+		{"one root", []module.Version{stairCar}, map[module.Version]bool{
+			stairCar: true,
+			{Path: "bluth.com/banana", Version: "v1.1.0"}: true,
+			{Path: "bluth.com/Seal", Version: "v1.2.0"}:   true,
+		}},
+		{"roots selecting different versions", []module.Version{stairCar, motherboy}, map[module.Version]bool{
+			stairCar:  true,
+			motherboy: true,
+			{Path: "bluth.com/banana", Version: "v1.1.0"}: true,
+			{Path: "bluth.com/Seal", Version: "v1.2.0"}:   true,
+			{Path: "bluth.com/Seal", Version: "v1.0.0"}:   true,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := golang.resolve(test.roots)
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestGolangWriteList(t *testing.T) {
+	t.Chdir(t.TempDir())
+	golang := Golang{}
+	dir := path.Join(golang.dir(), "bluth.com/hot-cops/@v")
+	_ = os.MkdirAll(dir, os.ModePerm)
+	for _, file := range []string{"v1.0.0.zip", "v1.10.0.zip", "v1.2.0.zip", "v2.0.0-beta.zip", "v1.0.0.mod"} {
+		_ = os.WriteFile(path.Join(dir, file), []byte{}, 0600)
+	}
+	if err := golang.writeList("bluth.com/hot-cops"); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := os.ReadFile(path.Join(dir, "list"))
+	expect := "v1.0.0\nv1.2.0\nv1.10.0\nv2.0.0-beta\n"
+	if !cmp.Equal(expect, string(list)) {
+		t.Error(cmp.Diff(expect, string(list)))
+	}
+	latest, _ := os.ReadFile(path.Join(dir, "..", "@latest"))
+	if !cmp.Equal(`{"Version":"v1.10.0"}`, string(latest)) {
+		t.Error(cmp.Diff(`{"Version":"v1.10.0"}`, string(latest)))
+	}
+
+	if err := golang.writeList("bluth.com/nothing"); err == nil {
+		t.Error("expected an error for a module with no versions")
+	}
+}
@@ -0,0 +1,33 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGolangImage(t *testing.T) {
+	golang := bridgr.Golang{}
+	if golang.Image() != nil {
+		t.Errorf("expected nil, but got %+v", golang.Image())
+	}
+}
+
+func TestGolangName(t *testing.T) {
+	expected := "golang"
+	golang := bridgr.Golang{}
+	if !cmp.Equal(expected, golang.Name()) {
+		t.Error(cmp.Diff(expected, golang.Name()))
+	}
+}
+
+func TestGolangHook(t *testing.T) {
+	golang := bridgr.Golang{}
+	result := reflect.TypeOf(golang.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
@@ -0,0 +1,84 @@
+package bridgr
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+)
+
+// armorPrefix begins every ASCII armored OpenPGP block
+var armorPrefix = []byte("-----BEGIN PGP")
+
+// readKeyring reads the OpenPGP public keys in a file, which may be ASCII armored or binary
+func readKeyring(file string) (openpgp.EntityList, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(content), armorPrefix) {
+		return openpgp.ReadArmoredKeyRing(bytes.NewReader(content))
+	}
+	return openpgp.ReadKeyRing(bytes.NewReader(content))
+}
+
+// verifySignature checks a detached signature, ASCII armored or binary, of the signed content
+func verifySignature(keyring openpgp.EntityList, signed io.Reader, signature []byte) error {
+	if bytes.HasPrefix(bytes.TrimSpace(signature), armorPrefix) {
+		block, err := armor.Decode(bytes.NewReader(signature))
+		if err != nil {
+			return err
+		}
+		_, err = openpgp.CheckDetachedSignature(keyring, signed, block.Body, nil)
+		return err
+	}
+	_, err := openpgp.CheckDetachedSignature(keyring, signed, bytes.NewReader(signature), nil)
+	return err
+}
+
+// isClearsigned tells if content is a cleartext signed message
+func isClearsigned(content []byte) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(content), []byte("-----BEGIN PGP SIGNED MESSAGE-----"))
+}
+
+// readClearsigned gives the text of a cleartext signed message. The signature is checked when there is a keyring.
+func readClearsigned(keyring openpgp.EntityList, content []byte) ([]byte, error) {
+	block, _ := clearsign.Decode(content)
+	if block == nil {
+		return nil, errors.New("no cleartext signed message found")
+	}
+	if keyring != nil {
+		if _, err := block.VerifySignature(keyring, nil); err != nil {
+			return nil, err
+		}
+	}
+	return block.Plaintext, nil
+}
+
+// readSigningKey reads the first OpenPGP secret key in a file, decrypting it with the BRIDGR_GPG_PASSPHRASE environment variable
+func readSigningKey(file string) (*openpgp.Entity, error) {
+	keyring, err := readKeyring(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, entity := range keyring {
+		if entity.PrivateKey == nil {
+			continue
+		}
+		if entity.PrivateKey.Encrypted {
+			passphrase, ok := os.LookupEnv("BRIDGR_GPG_PASSPHRASE")
+			if !ok {
+				return nil, errors.New("the signing key is encrypted, and BRIDGR_GPG_PASSPHRASE is not set")
+			}
+			if err := entity.DecryptPrivateKeys([]byte(passphrase)); err != nil {
+				return nil, err
+			}
+		}
+		return entity, nil
+	}
+	return nil, errors.New("no OpenPGP secret key found")
+}
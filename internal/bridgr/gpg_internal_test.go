@@ -0,0 +1,108 @@
+package bridgr
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/clearsign"
+)
+
+// testSigner creates a signing key, and writes its public key to a keyring file
+func testSigner(t *testing.T, keyring string, armored bool) *openpgp.Entity {
+	t.Helper()
+	entity, err := openpgp.NewEntity("George Bluth", "", "george@bluth.com", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := bytes.Buffer{}
+	if armored {
+		w, _ := armor.Encode(&out, openpgp.PublicKeyType, nil)
+		_ = entity.Serialize(w)
+		w.Close()
+	} else {
+		_ = entity.Serialize(&out)
+	}
+	if err := os.WriteFile(keyring, out.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return entity
+}
+
+func TestReadKeyring(t *testing.T) {
+	t.Chdir(t.TempDir())
+	for name, armored := range map[string]bool{"armored.asc": true, "binary.gpg": false} {
+		t.Run(name, func(t *testing.T) {
+			testSigner(t, name, armored)
+			keyring, err := readKeyring(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(keyring) != 1 {
+				t.Errorf("expected one key, got %d", len(keyring))
+			}
+		})
+	}
+	if _, err := readKeyring("missing.gpg"); err == nil {
+		t.Error("expected an error for a missing keyring")
+	}
+}
+
+func TestVerifySignature(t *testing.T) {
+	t.Chdir(t.TempDir())
+	signer := testSigner(t, "keyring.gpg", false)
+	keyring, _ := readKeyring("keyring.gpg")
+	signed := []byte("there's always money in the banana stand")
+
+	binary := bytes.Buffer{}
+	_ = openpgp.DetachSign(&binary, signer, bytes.NewReader(signed), nil)
+	armored := bytes.Buffer{}
+	_ = openpgp.ArmoredDetachSign(&armored, signer, bytes.NewReader(signed), nil)
+
+	for name, signature := range map[string][]byte{"binary": binary.Bytes(), "armored": armored.Bytes()} {
+		t.Run(name, func(t *testing.T) {
+			if err := verifySignature(keyring, bytes.NewReader(signed), signature); err != nil {
+				t.Error(err)
+			}
+			if err := verifySignature(keyring, strings.NewReader("no touching"), signature); err == nil {
+				t.Error("expected an error for content that was not signed")
+			}
+		})
+	}
+}
+
+func TestReadClearsigned(t *testing.T) {
+	t.Chdir(t.TempDir())
+	signer := testSigner(t, "keyring.gpg", true)
+	keyring, _ := readKeyring("keyring.gpg")
+	testSigner(t, "other.gpg", true)
+	otherKeyring, _ := readKeyring("other.gpg")
+
+	message := bytes.Buffer{}
+	w, _ := clearsign.Encode(&message, signer.PrivateKey, nil)
+	_, _ = w.Write([]byte("SHA256 (banana.iso) = 0a1b2c\n"))
+	w.Close()
+	if !isClearsigned(message.Bytes()) {
+		t.Fatal("expected a clearsigned message")
+	}
+
+	plaintext, err := readClearsigned(keyring, message.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != "SHA256 (banana.iso) = 0a1b2c\n" {
+		t.Errorf("unexpected plaintext %q", plaintext)
+	}
+	if _, err := readClearsigned(otherKeyring, message.Bytes()); err == nil {
+		t.Error("expected an error for a message signed by another key")
+	}
+	if _, err := readClearsigned(nil, message.Bytes()); err != nil {
+		t.Errorf("expected no verification without a keyring, got %s", err)
+	}
+	if _, err := readClearsigned(nil, []byte("not signed")); err == nil {
+		t.Error("expected an error for a message that is not clearsigned")
+	}
+}
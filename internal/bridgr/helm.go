@@ -38,6 +38,9 @@ func (h Helm) Setup() error {
 	for _, chart := range h {
 		chart.Normalize(h.dir())
 	}
+	if err := sameTarget(h); err != nil {
+		return err
+	}
 	return os.MkdirAll(h.dir(), os.ModePerm)
 }
 
@@ -48,17 +51,12 @@ func (h Helm) Run() error {
 		return err
 	}
 
-	for _, chart := range h {
-		writer, createErr := os.Create(chart.Target)
-		if createErr != nil {
-			log.Warn("Unable to create local file '%s' (for %s) %s", chart.Target, chart.Source.String(), createErr)
-			continue
+	forEach(len(h), func(i int) {
+		chart := h[i]
+		if err := chart.get(&fileFetcher{}, &WorkerCredentialReader{}); err != nil {
+			log.Info("Helm '%s' - %+s", chart.Source.String(), err)
 		}
-		if err := chart.fetch(&fileFetcher{}, &WorkerCredentialReader{}, writer); err != nil {
-			log.Info("Files '%s' - %+s", chart.Source.String(), err)
-			_ = os.Remove(chart.Target)
-		}
-	}
+	})
 	return h.createHelmIndex()
 }
 
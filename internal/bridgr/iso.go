@@ -0,0 +1,498 @@
+package bridgr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/distribution/reference"
+	"github.com/kdomanski/iso9660"
+	"github.com/mitchellh/mapstructure"
+	log "unknwon.dev/clog/v2"
+)
+
+const defaultISOArch = "amd64"
+
+// ISO is the configuration object for downloading operating system installation images. The checksum file of each image is
+// verified with the OpenPGP keys in Keyring, unless SkipSignature is set.
+type ISO struct {
+	Keyring       string
+	SkipSignature bool `mapstructure:"skip_signature"`
+	Images        []isoImage
+}
+
+type isoImage struct {
+	Distribution  string
+	Release       string
+	Flavor        string
+	Arch          string
+	Mirror        string
+	Keyring       string
+	SkipSignature bool `mapstructure:"skip_signature"`
+	PXE           bool `mapstructure:"pxe"`
+}
+
+// isoLocation is where the images of a release are published
+type isoLocation struct {
+	// dirs are the directories an image may be in, ie the current release and an archive of older releases
+	dirs []string
+	// sums is the checksum file in the directory, and signature is its detached signature, which is not needed for a clearsigned
+	// checksum file
+	sums      string
+	signature string
+	// file matches the name of the image in the checksum file
+	file *regexp.Regexp
+	// pxe are the files and directories in the image that are needed to boot its installer from the network
+	pxe []string
+}
+
+// isoRPMArch is the architecture name used by RHEL and its rebuilds, for architectures that Debian names differently
+var isoRPMArch = map[string]string{"amd64": "x86_64", "arm64": "aarch64", "ppc64el": "ppc64le"}
+
+// isoDebianInstaller is the name of the installer directory in Debian images, where it is not the architecture
+var isoDebianInstaller = map[string]string{"amd64": "amd", "arm64": "a64", "i386": "386"}
+
+// isoDistributions locates images for each supported distribution
+var isoDistributions = map[string]func(isoImage) isoLocation{
+	"ubuntu": func(img isoImage) isoLocation {
+		return isoLocation{
+			dirs: []string{
+				"https://releases.ubuntu.com/" + img.Release,
+				"https://old-releases.ubuntu.com/releases/" + img.Release,
+			},
+			sums:      "SHA256SUMS",
+			signature: "SHA256SUMS.gpg",
+			file:      regexp.MustCompile(`^ubuntu-` + regexp.QuoteMeta(img.Release) + `(\.\d+)?-` + regexp.QuoteMeta(img.Flavor) + `-` + regexp.QuoteMeta(img.Arch) + `\.iso$`),
+			pxe:       []string{"casper/vmlinuz", "casper/initrd"},
+		}
+	},
+	"debian": func(img isoImage) isoLocation {
+		media, suffix := "iso-cd", img.Flavor
+		if img.Flavor == "dvd" {
+			media, suffix = "iso-dvd", "DVD-1"
+		}
+		installer, ok := isoDebianInstaller[img.Arch]
+		if !ok {
+			installer = img.Arch
+		}
+		return isoLocation{
+			dirs: []string{
+				"https://cdimage.debian.org/debian-cd/" + img.Release + "/" + img.Arch + "/" + media,
+				"https://cdimage.debian.org/cdimage/archive/" + img.Release + "/" + img.Arch + "/" + media,
+			},
+			sums:      "SHA256SUMS",
+			signature: "SHA256SUMS.sign",
+			file:      regexp.MustCompile(`^debian-[0-9.]+-` + regexp.QuoteMeta(img.Arch) + `-` + regexp.QuoteMeta(suffix) + `\.iso$`),
+			pxe:       []string{"install." + installer},
+		}
+	},
+	"rocky": func(img isoImage) isoLocation {
+		return rhelLocation(img, "Rocky", []string{
+			"https://download.rockylinux.org/pub/rocky/" + img.Release + "/isos/" + rpmArch(img.Arch),
+			"https://dl.rockylinux.org/vault/rocky/" + img.Release + "/isos/" + rpmArch(img.Arch),
+		})
+	},
+	"almalinux": func(img isoImage) isoLocation {
+		return rhelLocation(img, "AlmaLinux", []string{
+			"https://repo.almalinux.org/almalinux/" + img.Release + "/isos/" + rpmArch(img.Arch),
+			"https://vault.almalinux.org/" + img.Release + "/isos/" + rpmArch(img.Arch),
+		})
+	},
+	// RHEL images need a subscription, so they can only be found with a mirror of them
+	"rhel": func(img isoImage) isoLocation {
+		return rhelLocation(img, "rhel", nil)
+	},
+}
+
+// isoDefaultFlavor is the flavor of each distribution's image that is downloaded when none is configured
+var isoDefaultFlavor = map[string]string{"ubuntu": "live-server", "debian": "netinst", "rocky": "dvd", "almalinux": "dvd", "rhel": "dvd"}
+
+func rpmArch(arch string) string {
+	if name, ok := isoRPMArch[arch]; ok {
+		return name
+	}
+	return arch
+}
+
+// rhelLocation locates images named like RHEL's, ie "rhel-9.4-x86_64-dvd.iso", which its rebuilds also use
+func rhelLocation(img isoImage, prefix string, dirs []string) isoLocation {
+	return isoLocation{
+		dirs:      dirs,
+		sums:      "CHECKSUM",
+		signature: "CHECKSUM.sig",
+		file:      regexp.MustCompile(`^` + prefix + `-[0-9.]+-` + regexp.QuoteMeta(rpmArch(img.Arch)) + `-` + regexp.QuoteMeta(img.Flavor) + `\.iso$`),
+		pxe:       []string{"images/pxeboot", "images/install.img", ".treeinfo"},
+	}
+}
+
+func (img isoImage) String() string {
+	return img.Distribution + " " + img.Release + " " + img.Flavor + " " + img.Arch
+}
+
+// dir is the top-level directory name for all objects written out under the ISO worker
+func (i ISO) dir() string {
+	return BaseDir(i.Name())
+}
+
+// Name returns the name of this Configuration
+func (i ISO) Name() string {
+	return "isos"
+}
+
+// Image implements the Imager interface
+func (i ISO) Image() reference.Named {
+	return nil
+}
+
+func stringToISOImage(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf(isoImage{}) {
+		return data, nil
+	}
+	parts := strings.SplitN(data.(string), "/", 3)
+	img := isoImage{Distribution: parts[0]}
+	if len(parts) > 1 {
+		img.Release = parts[1]
+	}
+	if len(parts) > 2 {
+		img.Flavor = parts[2]
+	}
+	return img, nil
+}
+
+func arrayToISO(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Slice || t != reflect.TypeOf(ISO{}) {
+		return data, nil
+	}
+	return map[string]interface{}{"images": data}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (i *ISO) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		arrayToISO,
+		stringToISOImage,
+	)
+}
+
+// Setup fills in the defaults of each image, and prepares the directory for them
+func (i *ISO) Setup() error {
+	log.Trace("Called ISO.Setup()")
+	for n := range i.Images {
+		img := &i.Images[n]
+		img.Distribution = strings.ToLower(img.Distribution)
+		if img.Arch == "" {
+			img.Arch = defaultISOArch
+		}
+		if img.Flavor == "" {
+			img.Flavor = isoDefaultFlavor[img.Distribution]
+		}
+		if img.Keyring == "" {
+			img.Keyring = i.Keyring
+		}
+		img.SkipSignature = img.SkipSignature || i.SkipSignature
+	}
+	return os.MkdirAll(i.dir(), os.ModePerm)
+}
+
+// Run downloads each image after verifying the signature of its checksum file, and verifies the image against it.
+// Images are in isos/<distribution>/<release>/<arch>/<flavor>, with the checksum file and its signature.
+func (i *ISO) Run() error {
+	if err := i.Setup(); err != nil {
+		return err
+	}
+	forEach(len(i.Images), func(n int) {
+		if err := i.fetch(i.Images[n]); err != nil {
+			log.Info("ISO: unable to download %s - %s", i.Images[n], err)
+		}
+	})
+	return nil
+}
+
+// fetch downloads and verifies an image, and extracts its PXE boot files when they are wanted
+func (i *ISO) fetch(img isoImage) error {
+	locate, ok := isoDistributions[img.Distribution]
+	if !ok {
+		return fmt.Errorf("distribution %s is not supported", img.Distribution)
+	}
+	location := locate(img)
+	if img.Mirror != "" {
+		location.dirs = []string{strings.TrimSuffix(img.Mirror, "/")}
+	}
+	if len(location.dirs) == 0 {
+		return errors.New("a mirror is needed to find its images")
+	}
+
+	var keyring openpgp.EntityList
+	switch {
+	case img.Keyring != "":
+		var err error
+		if keyring, err = readKeyring(img.Keyring); err != nil {
+			return err
+		}
+	case img.SkipSignature:
+		log.Warn("ISO: skip_signature is set for %s, its checksum file is not verified", img)
+	default:
+		return errors.New("a keyring is needed to verify its checksum file, or set skip_signature")
+	}
+
+	var (
+		dir     string
+		sums    []byte
+		sumsErr error
+	)
+	for _, dir = range location.dirs {
+		if sums, sumsErr = isoGet(dir + "/" + location.sums); sumsErr == nil {
+			break
+		}
+	}
+	if sumsErr != nil {
+		return sumsErr
+	}
+	target := path.Join(i.dir(), img.Distribution, img.Release, img.Arch, img.Flavor)
+	checksums, signature, err := verifyISOChecksums(keyring, sums, dir+"/"+location.signature)
+	if err != nil {
+		return err
+	}
+
+	var matches []string
+	available := parseChecksumFile(checksums)
+	for file := range available {
+		if location.file.MatchString(file) {
+			matches = append(matches, file)
+		}
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("no image matching %s in %s/%s", location.file, dir, location.sums)
+	}
+	sort.Slice(matches, func(i, j int) bool { return compareISONames(matches[i], matches[j]) < 0 })
+	file := matches[len(matches)-1]
+	expected := available[file]
+	algorithm, err := checksumAlgorithm(expected)
+	if err != nil {
+		return err
+	}
+
+	iso := path.Join(target, file)
+	if sum, err := fileChecksum(iso, algorithm); err != nil || sum != expected {
+		log.Info("ISO: downloading %s", file)
+		if err := lockArtifact(iso, func() error { return resumableDownload(dir+"/"+file, iso) }); err != nil {
+			return err
+		}
+		if sum, err = fileChecksum(iso, algorithm); err != nil {
+			return err
+		}
+		if sum != expected {
+			_ = os.Remove(iso)
+			return fmt.Errorf("checksum mismatch for %s, expected %s but got %s", file, expected, sum)
+		}
+	} else if err := lockExisting(iso); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path.Join(target, location.sums), sums, 0644); err != nil { //nolint:gosec // repository content is meant to be readable
+		return err
+	}
+	if signature != nil {
+		if err := os.WriteFile(path.Join(target, location.signature), signature, 0644); err != nil { //nolint:gosec // repository content is meant to be readable
+			return err
+		}
+	}
+
+	if img.PXE {
+		pxeDir := path.Join(target, "pxe")
+		if err := os.RemoveAll(pxeDir); err != nil {
+			return err
+		}
+		return extractISO(iso, pxeDir, location.pxe)
+	}
+	return nil
+}
+
+var isoNameRun = regexp.MustCompile(`\d+|\D+`)
+
+// compareISONames orders image file names by the numbers in them, so that ubuntu-24.04.10 is newer than ubuntu-24.04.9
+func compareISONames(a, b string) int {
+	runsA, runsB := isoNameRun.FindAllString(a, -1), isoNameRun.FindAllString(b, -1)
+	for i := 0; i < len(runsA) && i < len(runsB); i++ {
+		x, y := runsA[i], runsB[i]
+		if x[0] >= '0' && x[0] <= '9' && y[0] >= '0' && y[0] <= '9' {
+			x, y = strings.TrimLeft(x, "0"), strings.TrimLeft(y, "0")
+			if len(x) != len(y) {
+				return compareInts(len(x), len(y))
+			}
+		}
+		if c := strings.Compare(x, y); c != 0 {
+			return c
+		}
+	}
+	return compareInts(len(runsA), len(runsB))
+}
+
+// verifyISOChecksums gives the checksums of a checksum file after verifying its signature, which is either in the file itself
+// when it is clearsigned, or a detached signature that is fetched. The detached signature is given too, so it can be kept with
+// the checksum file. Without a keyring nothing is verified.
+func verifyISOChecksums(keyring openpgp.EntityList, sums []byte, signatureSource string) ([]byte, []byte, error) {
+	if isClearsigned(sums) {
+		checksums, err := readClearsigned(keyring, sums)
+		return checksums, nil, err
+	}
+	signature, err := isoGet(signatureSource)
+	if err != nil {
+		if keyring != nil {
+			return nil, nil, err
+		}
+		return sums, nil, nil
+	}
+	if keyring != nil {
+		if err := verifySignature(keyring, bytes.NewReader(sums), signature); err != nil {
+			return nil, nil, fmt.Errorf("checksum file signature is not valid: %s", err)
+		}
+	}
+	return sums, signature, nil
+}
+
+func isoGet(source string) ([]byte, error) {
+	resp, err := httpGet(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// resumableDownload fetches source to the target file through a ".part" file. When a download is interrupted, the next one asks
+// the server for only the rest of the file.
+func resumableDownload(source, target string) error {
+	part := target + ".part"
+	if err := os.MkdirAll(path.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(part, os.O_CREATE|os.O_WRONLY, 0644) //nolint:gosec // repository content is meant to be readable
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	offset, err := out.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, source, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		log.Trace("Resuming download of %s at %d bytes", source, offset)
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	credentials := WorkerCredentialReader{}
+	if creds, ok := credentials.Read(req.URL); ok && creds.IsValid() {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+	case http.StatusOK:
+		// the server sent the whole file
+		if err := out.Truncate(0); err != nil {
+			return err
+		}
+		if _, err := out.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// the part file is already the whole file
+		if offset == 0 {
+			return fmt.Errorf("unable to download %s: %s", source, resp.Status)
+		}
+	default:
+		return fmt.Errorf("unable to download %s: %s", source, resp.Status)
+	}
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		if _, err := io.Copy(out, resp.Body); err != nil {
+			return err
+		}
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(part, target)
+}
+
+// extractISO copies files and directories out of an ISO 9660 image. Names are matched without case, as plain ISO 9660 names are
+// upper case.
+func extractISO(image, dir string, paths []string) error {
+	in, err := os.Open(image)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	iso, err := iso9660.OpenImage(in)
+	if err != nil {
+		return err
+	}
+	root, err := iso.RootDir()
+	if err != nil {
+		return err
+	}
+	for _, name := range paths {
+		file, err := findISOFile(root, strings.Split(name, "/"))
+		if err != nil {
+			return fmt.Errorf("%s: %s", name, err)
+		}
+		if err := copyISOFile(file, path.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func findISOFile(dir *iso9660.File, names []string) (*iso9660.File, error) {
+	children, err := dir.GetChildren()
+	if err != nil {
+		return nil, err
+	}
+	for _, child := range children {
+		if !strings.EqualFold(child.Name(), names[0]) {
+			continue
+		}
+		if len(names) == 1 {
+			return child, nil
+		}
+		if child.IsDir() {
+			return findISOFile(child, names[1:])
+		}
+	}
+	return nil, errors.New("not found in the image")
+}
+
+func copyISOFile(file *iso9660.File, target string) error {
+	if !file.IsDir() {
+		return writeVerified(target, file.Reader())
+	}
+	children, err := file.GetChildren()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(target, os.ModePerm); err != nil {
+		return err
+	}
+	for _, child := range children {
+		if err := copyISOFile(child, path.Join(target, child.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
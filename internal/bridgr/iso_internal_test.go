@@ -0,0 +1,282 @@
+package bridgr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/google/go-cmp/cmp"
+	"github.com/kdomanski/iso9660"
+)
+
+func testISOImage(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	writer, err := iso9660.NewWriter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Cleanup() //nolint:errcheck // test fixture
+	for name, content := range files {
+		if err := writer.AddFile(strings.NewReader(content), name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	out := bytes.Buffer{}
+	if err := writer.WriteTo(&out, "BLUTH"); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// isoMirror serves an Ubuntu release directory, with a SHA256SUMS signed by signer
+func isoMirror(t *testing.T, signer *openpgp.Entity, image []byte) *httptest.Server {
+	t.Helper()
+	sum := sha256.Sum256(image)
+	sums := []byte(hex.EncodeToString(sum[:]) + " *ubuntu-24.04.1-live-server-amd64.iso\n" +
+		hex.EncodeToString(sum[:]) + " *ubuntu-24.04.1-desktop-amd64.iso\n")
+	signature := bytes.Buffer{}
+	if err := openpgp.ArmoredDetachSign(&signature, signer, bytes.NewReader(sums), nil); err != nil {
+		t.Fatal(err)
+	}
+	files := map[string][]byte{
+		"/ubuntu/24.04/SHA256SUMS":                           sums,
+		"/ubuntu/24.04/SHA256SUMS.gpg":                       signature.Bytes(),
+		"/ubuntu/24.04/ubuntu-24.04.1-live-server-amd64.iso": image,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		content, ok := files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, path.Base(r.URL.Path), time.Time{}, bytes.NewReader(content))
+	}))
+}
+
+func TestISODir(t *testing.T) {
+	expected := BaseDir("isos")
+	result := ISO{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestStringToISOImage(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  interface{}
+		expect interface{}
+	}{
+		{"distribution only", "rocky", isoImage{Distribution: "rocky"}},
+		{"with release", "debian/12.6.0", isoImage{Distribution: "debian", Release: "12.6.0"}},
+		{"with flavor", "ubuntu/24.04/desktop", isoImage{Distribution: "ubuntu", Release: "24.04", Flavor: "desktop"}},
+		{"not a string", 42, 42},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := stringToISOImage(reflect.TypeOf(test.input), reflect.TypeOf(isoImage{}), test.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestArrayToISO(t *testing.T) {
+	input := []interface{}{"ubuntu/24.04"}
+	result, _ := arrayToISO(reflect.TypeOf(input), reflect.TypeOf(ISO{}), input)
+	expect := map[string]interface{}{"images": input}
+	if !cmp.Equal(expect, result) {
+		t.Error(cmp.Diff(expect, result))
+	}
+}
+
+func TestISODistributions(t *testing.T) {
+	tests := []struct {
+		img   isoImage
+		dir   string
+		match string
+		pxe   string
+	}{
+		{isoImage{Distribution: "ubuntu", Release: "22.04", Flavor: "live-server", Arch: "amd64"}, "https://releases.ubuntu.com/22.04", "ubuntu-22.04.4-live-server-amd64.iso", "casper/vmlinuz"},
+		{isoImage{Distribution: "debian", Release: "12.6.0", Flavor: "netinst", Arch: "amd64"}, "https://cdimage.debian.org/debian-cd/12.6.0/amd64/iso-cd", "debian-12.6.0-amd64-netinst.iso", "install.amd"},
+		{isoImage{Distribution: "debian", Release: "12.6.0", Flavor: "dvd", Arch: "arm64"}, "https://cdimage.debian.org/debian-cd/12.6.0/arm64/iso-dvd", "debian-12.6.0-arm64-DVD-1.iso", "install.a64"},
+		{isoImage{Distribution: "rocky", Release: "9.4", Flavor: "dvd", Arch: "amd64"}, "https://download.rockylinux.org/pub/rocky/9.4/isos/x86_64", "Rocky-9.4-x86_64-dvd.iso", "images/pxeboot"},
+		{isoImage{Distribution: "almalinux", Release: "9", Flavor: "minimal", Arch: "arm64"}, "https://repo.almalinux.org/almalinux/9/isos/aarch64", "AlmaLinux-9.4-aarch64-minimal.iso", "images/pxeboot"},
+	}
+	for _, test := range tests {
+		t.Run(test.img.String(), func(t *testing.T) {
+			location := isoDistributions[test.img.Distribution](test.img)
+			if !cmp.Equal(test.dir, location.dirs[0]) {
+				t.Error(cmp.Diff(test.dir, location.dirs[0]))
+			}
+			if !location.file.MatchString(test.match) {
+				t.Errorf("expected %s to match %s", location.file, test.match)
+			}
+			if !cmp.Equal(test.pxe, location.pxe[0]) {
+				t.Error(cmp.Diff(test.pxe, location.pxe[0]))
+			}
+		})
+	}
+	rocky := isoDistributions["rocky"](isoImage{Release: "9", Flavor: "dvd", Arch: "amd64"})
+	if rocky.file.MatchString("Rocky-9-latest-x86_64-dvd.iso") {
+		t.Error("expected the latest link of a release to not match")
+	}
+	if rhel := isoDistributions["rhel"](isoImage{Release: "9.4", Flavor: "dvd", Arch: "amd64"}); len(rhel.dirs) != 0 {
+		t.Errorf("expected no public location for RHEL, got %s", rhel.dirs)
+	}
+}
+
+func TestCompareISONames(t *testing.T) {
+	names := []string{
+		"ubuntu-24.04.10-live-server-amd64.iso",
+		"ubuntu-24.04-live-server-amd64.iso",
+		"ubuntu-24.04.9-live-server-amd64.iso",
+		"ubuntu-24.04.1-live-server-amd64.iso",
+		"Rocky-9.10-x86_64-dvd.iso",
+		"Rocky-9.9-x86_64-dvd.iso",
+	}
+	sort.Slice(names, func(i, j int) bool { return compareISONames(names[i], names[j]) < 0 })
+	expect := []string{
+		"Rocky-9.9-x86_64-dvd.iso",
+		"Rocky-9.10-x86_64-dvd.iso",
+		"ubuntu-24.04-live-server-amd64.iso",
+		"ubuntu-24.04.1-live-server-amd64.iso",
+		"ubuntu-24.04.9-live-server-amd64.iso",
+		"ubuntu-24.04.10-live-server-amd64.iso",
+	}
+	if !cmp.Equal(expect, names) {
+		t.Error(cmp.Diff(expect, names))
+	}
+}
+
+func TestISOSetup(t *testing.T) {
+	t.Chdir(t.TempDir())
+	i := ISO{Keyring: "/etc/bridgr/keyring.gpg", Images: []isoImage{{Distribution: "Ubuntu", Release: "24.04"}, {Distribution: "rocky", Release: "9", Flavor: "boot", Arch: "arm64", Keyring: "rocky.gpg", SkipSignature: true}}}
+	if err := i.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	expect := []isoImage{
+		{Distribution: "ubuntu", Release: "24.04", Flavor: "live-server", Arch: "amd64", Keyring: "/etc/bridgr/keyring.gpg"},
+		{Distribution: "rocky", Release: "9", Flavor: "boot", Arch: "arm64", Keyring: "rocky.gpg", SkipSignature: true},
+	}
+	if !cmp.Equal(expect, i.Images) {
+		t.Error(cmp.Diff(expect, i.Images))
+	}
+}
+
+func TestResumableDownload(t *testing.T) {
+	t.Chdir(t.TempDir())
+	content := []byte("there's always money in the banana stand")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/banana.iso" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "banana.iso", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name string
+		part []byte
+	}{
+		{"new download", nil},
+		{"resumed download", content[:10]},
+		{"complete part", content},
+		{"part that cannot be resumed", append(append([]byte{}, content...), []byte("extra")...)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_ = os.Remove("banana.iso")
+			if test.part != nil {
+				_ = os.WriteFile("banana.iso.part", test.part, 0644)
+			}
+			err := resumableDownload(server.URL+"/banana.iso", "banana.iso")
+			if test.name == "part that cannot be resumed" {
+				// the server cannot satisfy the range, so the part is taken as it is and the checksum of the image decides
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, _ := os.ReadFile("banana.iso")
+			if !cmp.Equal(content, result) {
+				t.Error(cmp.Diff(string(content), string(result)))
+			}
+			if _, err := os.Stat("banana.iso.part"); err == nil {
+				t.Error("expected the part file to be renamed")
+			}
+		})
+	}
+	if err := resumableDownload(server.URL+"/missing.iso", "missing.iso"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
+
+func TestISORun(t *testing.T) {
+	t.Chdir(t.TempDir())
+	signer := testSigner(t, "keyring.asc", true)
+	testSigner(t, "other.asc", true)
+	image := testISOImage(t, map[string]string{"casper/vmlinuz": "kernel", "casper/initrd": "initrd", "casper/filesystem.squashfs": "root"})
+	server := isoMirror(t, signer, image)
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		keyring string
+		skip    bool
+		expect  bool
+	}{
+		{"signed by the keyring", "keyring.asc", false, true},
+		{"signed by another key", "other.asc", false, false},
+		{"no keyring", "", false, false},
+		{"skip signature", "", true, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			i := ISO{Keyring: test.keyring, SkipSignature: test.skip, Images: []isoImage{{Distribution: "ubuntu", Release: "24.04", Mirror: server.URL + "/ubuntu/24.04/", PXE: true}}}
+			defer os.RemoveAll(i.dir())
+			if err := i.Run(); err != nil {
+				t.Fatal(err)
+			}
+			dir := path.Join(i.dir(), "ubuntu/24.04/amd64/live-server")
+			expectFiles := []string{"ubuntu-24.04.1-live-server-amd64.iso", "SHA256SUMS", "SHA256SUMS.gpg", "pxe/casper/vmlinuz", "pxe/casper/initrd"}
+			for _, file := range expectFiles {
+				_, err := os.Stat(path.Join(dir, file))
+				if test.expect && err != nil {
+					t.Errorf("expected %s to be written: %s", file, err)
+				}
+				if !test.expect && err == nil {
+					t.Errorf("expected %s to not be written", file)
+				}
+			}
+			if !test.expect {
+				return
+			}
+			kernel, _ := os.ReadFile(path.Join(dir, "pxe/casper/vmlinuz"))
+			if !cmp.Equal("kernel", string(kernel)) {
+				t.Error(cmp.Diff("kernel", string(kernel)))
+			}
+			if _, err := os.Stat(path.Join(dir, "pxe/casper/filesystem.squashfs")); err == nil {
+				t.Error("expected only the PXE boot files to be extracted")
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestISOImage(t *testing.T) {
+	isos := bridgr.ISO{}
+	if isos.Image() != nil {
+		t.Errorf("expected nil, but got %+v", isos.Image())
+	}
+}
+
+func TestISOName(t *testing.T) {
+	expected := "isos"
+	isos := bridgr.ISO{}
+	if !cmp.Equal(expected, isos.Name()) {
+		t.Error(cmp.Diff(expected, isos.Name()))
+	}
+}
+
+func TestISOHook(t *testing.T) {
+	isos := bridgr.ISO{}
+	result := reflect.TypeOf(isos.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
@@ -1 +1,442 @@
 package bridgr
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha1" //nolint:gosec // sha1 digests are part of the Jenkins update-center format
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/distribution/reference"
+	"github.com/mitchellh/mapstructure"
+	log "unknwon.dev/clog/v2"
+)
+
+const (
+	defaultUpdateCenter = "https://updates.jenkins.io/update-center.actual.json"
+	jenkinsManifest     = "META-INF/MANIFEST.MF"
+)
+
+// jenkinsDownloadURL is used for plugins requested at a different version than the update center has
+var jenkinsDownloadURL = "https://updates.jenkins.io/download/plugins/%s/%s/%s.hpi"
+
+// Jenkins is the configuration object for creating a Jenkins update site
+type Jenkins struct {
+	UpdateCenter   string `mapstructure:"update_center"`
+	JenkinsVersion string `mapstructure:"jenkins_version"`
+	Host           string
+	Key            string
+	Certificate    string
+	Plugins        []jenkinsPlugin
+}
+
+type jenkinsPlugin struct {
+	Package string
+	Version string
+}
+
+type jenkinsDependency struct {
+	Name     string `json:"name"`
+	Optional bool   `json:"optional"`
+	Version  string `json:"version"`
+}
+
+type jenkinsSignature struct {
+	Certificates        []string `json:"certificates"`
+	CorrectDigest       string   `json:"correct_digest"`
+	CorrectDigest512    string   `json:"correct_digest512"`
+	CorrectSignature    string   `json:"correct_signature"`
+	CorrectSignature512 string   `json:"correct_signature512"`
+}
+
+func (jp jenkinsPlugin) String() string {
+	if jp.Version != "" {
+		return jp.Package + ":" + jp.Version
+	}
+	return jp.Package
+}
+
+// dir is the top-level directory name for all objects written out under the Jenkins worker
+func (j Jenkins) dir() string {
+	return BaseDir(j.Name())
+}
+
+// Name returns the name of this Configuration
+func (j Jenkins) Name() string {
+	return "jenkins"
+}
+
+// Image implements the Imager interface
+func (j Jenkins) Image() reference.Named {
+	return nil
+}
+
+func stringToJenkinsPlugin(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf(jenkinsPlugin{}) {
+		return data, nil
+	}
+	return jenkinsPlugin{Package: data.(string)}, nil
+}
+
+func arrayToJenkins(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Slice || t != reflect.TypeOf(Jenkins{}) {
+		return data, nil
+	}
+	return map[string]interface{}{"plugins": data}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (j *Jenkins) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		arrayToJenkins,
+		stringToJenkinsPlugin,
+	)
+}
+
+// Setup prepares the Jenkins update site directory
+func (j *Jenkins) Setup() error {
+	log.Trace("Called Jenkins.Setup()")
+	if j.UpdateCenter == "" {
+		j.UpdateCenter = defaultUpdateCenter
+	}
+	if j.Host == "" {
+		log.Warn("Jenkins: no host is configured, plugin URLs in update-center.json will be relative and must be rewritten before Jenkins can use them")
+	}
+	return os.MkdirAll(j.dir(), os.ModePerm)
+}
+
+// Run resolves the configured plugins and their dependencies, downloads them, and writes an update-center.json for the site
+func (j *Jenkins) Run() error {
+	if err := j.Setup(); err != nil {
+		return err
+	}
+	source := j.UpdateCenter
+	if j.JenkinsVersion != "" {
+		source += "?version=" + url.QueryEscape(j.JenkinsVersion)
+	}
+	center := map[string]interface{}{}
+	if err := getJSON(source, &center); err != nil {
+		return fmt.Errorf("unable to read update center %s: %s", source, err)
+	}
+	available, _ := center["plugins"].(map[string]interface{})
+
+	resolver := jenkinsResolver{jenkins: j, available: available, plugins: map[string]interface{}{}}
+	resolver.resolve(j.Plugins)
+
+	center["plugins"] = resolver.plugins
+	delete(center, "signature")
+	if j.Key != "" {
+		signature, err := j.sign(center)
+		if err != nil {
+			return err
+		}
+		center["signature"] = signature
+	}
+	return j.writeUpdateCenter(center)
+}
+
+// writeUpdateCenter writes both the raw JSON, and the JSONP wrapped version of the update center Jenkins requests
+func (j *Jenkins) writeUpdateCenter(center map[string]interface{}) error {
+	content, err := canonicalJSON(center)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path.Join(j.dir(), "update-center.actual.json"), content, 0644); err != nil { //nolint:gosec // repository content is meant to be readable
+		return err
+	}
+	wrapped := append(append([]byte("updateCenter.post(\n"), content...), []byte("\n);")...)
+	return os.WriteFile(path.Join(j.dir(), "update-center.json"), wrapped, 0644) //nolint:gosec // repository content is meant to be readable
+}
+
+// pluginURL gives the location of a plugin when the update site is hosted by Bridgr
+func (j *Jenkins) pluginURL(name, version string) string {
+	return strings.TrimSuffix(j.Host, "/") + "/" + path.Join(j.Name(), "download", "plugins", name, version, name+".hpi")
+}
+
+type jenkinsResolver struct {
+	jenkins   *Jenkins
+	available map[string]interface{}
+	mu        sync.Mutex
+	plugins   map[string]interface{}
+	pinned    map[string]string
+}
+
+// resolve includes every requested plugin, and the required (non-optional) dependencies of each.
+// Dependencies use the version in the update center, unless that plugin was requested at a specific version.
+func (r *jenkinsResolver) resolve(requested []jenkinsPlugin) {
+	r.pinned = map[string]string{}
+	for _, p := range requested {
+		r.pinned[p.Package] = p.Version
+	}
+	queue := make([]string, 0, len(requested))
+	for _, p := range requested {
+		queue = append(queue, p.Package)
+	}
+	seen := map[string]bool{}
+	for len(queue) > 0 {
+		var level []string
+		for _, name := range queue {
+			if !seen[name] {
+				seen[name] = true
+				level = append(level, name)
+			}
+		}
+		deps := make([][]jenkinsDependency, len(level))
+		forEach(len(level), func(i int) {
+			var err error
+			if deps[i], err = r.fetch(level[i]); err != nil {
+				log.Info("Jenkins: unable to get plugin %s - %s", level[i], err)
+			}
+		})
+		queue = queue[:0:0]
+		for _, list := range deps {
+			for _, dep := range list {
+				if !dep.Optional {
+					queue = append(queue, dep.Name)
+				}
+			}
+		}
+	}
+}
+
+// fetch downloads a plugin, and gives its update center entry and dependencies
+func (r *jenkinsResolver) fetch(name string) ([]jenkinsDependency, error) {
+	entry := map[string]interface{}{}
+	if upstream, ok := r.available[name].(map[string]interface{}); ok {
+		for k, v := range upstream {
+			entry[k] = v
+		}
+	}
+	version := r.pinned[name]
+	upstreamVersion, _ := entry["version"].(string)
+	if version == "" {
+		version = upstreamVersion
+	}
+	if version == "" {
+		return nil, errors.New("plugin is not in the update center")
+	}
+	source := fmt.Sprintf(jenkinsDownloadURL, name, version, name)
+	if upstreamURL, ok := entry["url"].(string); ok && version == upstreamVersion {
+		source = upstreamURL
+	}
+	sourceURL, err := url.Parse(source)
+	if err != nil {
+		return nil, err
+	}
+	target := path.Join(r.jenkins.dir(), "download", "plugins", name, version, name+".hpi")
+	if err := download(sourceURL, target); err != nil {
+		return nil, err
+	}
+	sums, err := jenkinsChecksums(target)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range sums {
+		entry[k] = v
+	}
+
+	var deps []jenkinsDependency
+	if version == upstreamVersion {
+		raw, _ := json.Marshal(entry["dependencies"])
+		_ = json.Unmarshal(raw, &deps)
+	} else {
+		manifest, err := readJenkinsManifest(target)
+		if err != nil {
+			return nil, err
+		}
+		deps = parseJenkinsDependencies(manifest["Plugin-Dependencies"])
+		entry["dependencies"] = deps
+		entry["name"] = name
+		if core, ok := manifest["Jenkins-Version"]; ok {
+			entry["requiredCore"] = core
+		}
+	}
+	entry["version"] = version
+	entry["url"] = r.jenkins.pluginURL(name, version)
+	log.Trace("Jenkins: downloaded %s:%s", name, version)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.plugins[name] = entry
+	return deps, nil
+}
+
+// jenkinsChecksums calculates the base64 encoded digests of a file, as used in update center entries
+func jenkinsChecksums(file string) (map[string]string, error) {
+	in, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	sha1sum := sha1.New() //nolint:gosec // sha1 digests are part of the Jenkins update-center format
+	sha256sum := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(sha1sum, sha256sum), in); err != nil {
+		return nil, err
+	}
+	return map[string]string{
+		"sha1":   base64.StdEncoding.EncodeToString(sha1sum.Sum(nil)),
+		"sha256": base64.StdEncoding.EncodeToString(sha256sum.Sum(nil)),
+	}, nil
+}
+
+// readJenkinsManifest reads the main attributes of the jar manifest in a plugin file
+func readJenkinsManifest(file string) (map[string]string, error) {
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return nil, err
+	}
+	defer archive.Close()
+	for _, f := range archive.File {
+		if f.Name != jenkinsManifest {
+			continue
+		}
+		in, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		defer in.Close()
+		return parseManifest(in), nil
+	}
+	return nil, fmt.Errorf("no %s found", jenkinsManifest)
+}
+
+// parseManifest reads a jar manifest, where long values are continued on lines beginning with a space
+func parseManifest(in io.Reader) map[string]string {
+	attrs := map[string]string{}
+	scanner := bufio.NewScanner(in)
+	last := ""
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, " ") && last != "" {
+			attrs[last] += line[1:]
+			continue
+		}
+		if parts := strings.SplitN(line, ":", 2); len(parts) == 2 {
+			last = strings.TrimSpace(parts[0])
+			attrs[last] = strings.TrimSpace(parts[1])
+		}
+	}
+	return attrs
+}
+
+// parseJenkinsDependencies reads the Plugin-Dependencies manifest attribute, ie "a:1.0,b:2.0;resolution:=optional"
+func parseJenkinsDependencies(attr string) []jenkinsDependency {
+	var deps []jenkinsDependency
+	for _, spec := range strings.Split(attr, ",") {
+		spec = strings.TrimSpace(spec)
+		if spec == "" {
+			continue
+		}
+		dep := jenkinsDependency{}
+		if strings.Contains(spec, ";resolution:=optional") {
+			dep.Optional = true
+			spec = strings.Split(spec, ";")[0]
+		}
+		parts := strings.SplitN(spec, ":", 2)
+		dep.Name = parts[0]
+		if len(parts) > 1 {
+			dep.Version = parts[1]
+		}
+		deps = append(deps, dep)
+	}
+	return deps
+}
+
+// canonicalJSON writes a document the same way Jenkins does before verifying its signature: sorted keys, no extra whitespace or escaping.
+func canonicalJSON(doc interface{}) ([]byte, error) {
+	buf := bytes.Buffer{}
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	return bytes.TrimRight(buf.Bytes(), "\n"), nil
+}
+
+// sign creates the signature block of the update center, using the configured RSA key and certificate chain
+func (j *Jenkins) sign(center map[string]interface{}) (*jenkinsSignature, error) {
+	key, certs, err := loadSigningKey(j.Key, j.Certificate)
+	if err != nil {
+		return nil, err
+	}
+	content, err := canonicalJSON(center)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha1.Sum(content) //nolint:gosec // sha1 digests are part of the Jenkins update-center format
+	digest512 := sha512.Sum512(content)
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA1, digest[:])
+	if err != nil {
+		return nil, err
+	}
+	signature512, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA512, digest512[:])
+	if err != nil {
+		return nil, err
+	}
+	result := &jenkinsSignature{
+		CorrectDigest:       base64.StdEncoding.EncodeToString(digest[:]),
+		CorrectDigest512:    hex.EncodeToString(digest512[:]),
+		CorrectSignature:    base64.StdEncoding.EncodeToString(signature),
+		CorrectSignature512: hex.EncodeToString(signature512),
+	}
+	for _, cert := range certs {
+		result.Certificates = append(result.Certificates, base64.StdEncoding.EncodeToString(cert))
+	}
+	return result, nil
+}
+
+// loadSigningKey reads a PEM encoded RSA private key, and the DER bytes of each certificate in a PEM file
+func loadSigningKey(keyFile, certFile string) (*rsa.PrivateKey, [][]byte, error) {
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	block, _ := pem.Decode(keyPEM)
+	if block == nil {
+		return nil, nil, fmt.Errorf("no PEM data found in %s", keyFile)
+	}
+	var key *rsa.PrivateKey
+	if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		parsed, pkcs8Err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if pkcs8Err != nil {
+			return nil, nil, fmt.Errorf("unable to parse private key %s: %s", keyFile, err)
+		}
+		var ok bool
+		if key, ok = parsed.(*rsa.PrivateKey); !ok {
+			return nil, nil, fmt.Errorf("private key %s is not an RSA key", keyFile)
+		}
+	}
+
+	certPEM, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	var certs [][]byte
+	for block, rest := pem.Decode(certPEM); block != nil; block, rest = pem.Decode(rest) {
+		if block.Type == "CERTIFICATE" {
+			certs = append(certs, block.Bytes)
+		}
+	}
+	if len(certs) == 0 {
+		return nil, nil, fmt.Errorf("no certificates found in %s", certFile)
+	}
+	return key, certs, nil
+}
@@ -0,0 +1,201 @@
+package bridgr
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha512"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func jenkinsPluginFile(manifest string) []byte {
+	buf := bytes.Buffer{}
+	archive := zip.NewWriter(&buf)
+	w, _ := archive.Create(jenkinsManifest)
+	_, _ = w.Write([]byte(manifest))
+	archive.Close()
+	return buf.Bytes()
+}
+
+func jenkinsUpdateCenter() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base := "http://" + r.Host
+		switch r.URL.Path {
+		case "/update-center.actual.json":
+			fmt.Fprintf(w, `{"id":"default","core":{"version":"2.440"},"signature":{"correct_digest":"gob"},"plugins":{
+				"stair-car":{"name":"stair-car","version":"2.0","url":"%[1]s/stair-car.hpi","dependencies":[{"name":"banana","optional":false,"version":"1.0"},{"name":"seal","optional":true,"version":"1.0"}]},
+				"banana":{"name":"banana","version":"1.5","url":"%[1]s/banana.hpi","dependencies":[]},
+				"seal":{"name":"seal","version":"1.0","url":"%[1]s/seal.hpi","dependencies":[]},
+				"cornballer":{"name":"cornballer","version":"3.0","url":"%[1]s/cornballer.hpi","dependencies":[]}
+			}}`, base)
+		case "/stair-car.hpi", "/banana.hpi":
+			_, _ = w.Write(jenkinsPluginFile("Manifest-Version: 1.0\n"))
+		case "/download/plugins/cornballer/1.0/cornballer.hpi":
+			_, _ = w.Write(jenkinsPluginFile("Manifest-Version: 1.0\nJenkins-Version: 2.100\nPlugin-Dependencies: banana:1.0,seal:1.0;resolution:=opt\n ional\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestJenkinsDir(t *testing.T) {
+	expected := BaseDir("jenkins")
+	result := Jenkins{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestParseManifest(t *testing.T) {
+	manifest := "Manifest-Version: 1.0\r\nPlugin-Dependencies: a:1.0,b:2.0;resolu\r\n tion:=optional\r\nJenkins-Version: 2.1\r\n"
+	expect := map[string]string{
+		"Manifest-Version":    "1.0",
+		"Plugin-Dependencies": "a:1.0,b:2.0;resolution:=optional",
+		"Jenkins-Version":     "2.1",
+	}
+	result := parseManifest(strings.NewReader(manifest))
+	if !cmp.Equal(expect, result) {
+		t.Error(cmp.Diff(expect, result))
+	}
+}
+
+func TestParseJenkinsDependencies(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  string
+		expect []jenkinsDependency
+	}{
+		{"empty", "", nil},
+		{"single", "banana:1.0", []jenkinsDependency{{Name: "banana", Version: "1.0"}}},
+		{"optional", "banana:1.0,seal:2.1;resolution:=optional", []jenkinsDependency{{Name: "banana", Version: "1.0"}, {Name: "seal", Version: "2.1", Optional: true}}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := parseJenkinsDependencies(test.input)
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestCanonicalJSON(t *testing.T) {
+	result, err := canonicalJSON(map[string]interface{}{"z": "<b>", "a": []int{1, 2}})
+	if err != nil {
+		t.Error(err)
+	}
+	expect := `{"a":[1,2],"z":"<b>"}`
+	if !cmp.Equal(expect, string(result)) {
+		t.Error(cmp.Diff(expect, string(result)))
+	}
+}
+
+func TestJenkinsRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := jenkinsUpdateCenter()
+	defer server.Close()
+
+	jenkins := Jenkins{
+		UpdateCenter: server.URL + "/update-center.actual.json",
+		Host:         "http://bridgr.bluth.com",
+		Plugins:      []jenkinsPlugin{{Package: "stair-car"}, {Package: "cornballer", Version: "1.0"}},
+	}
+	original := jenkinsDownloadURL
+	defer func() { jenkinsDownloadURL = original }()
+	jenkinsDownloadURL = server.URL + "/download/plugins/%s/%s/%s.hpi"
+
+	if err := jenkins.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path.Join(jenkins.dir(), "update-center.actual.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	center := struct {
+		Signature map[string]interface{}
+		Plugins   map[string]struct {
+			Version      string
+			URL          string
+			RequiredCore string
+			Dependencies []jenkinsDependency
+		}
+	}{}
+	if err := json.Unmarshal(content, &center); err != nil {
+		t.Fatal(err)
+	}
+	if center.Signature != nil {
+		t.Errorf("expected upstream signature to be removed, but got %v", center.Signature)
+	}
+	if len(center.Plugins) != 3 {
+		t.Errorf("expected 3 plugins, but got %d", len(center.Plugins))
+	}
+	cornballer := center.Plugins["cornballer"]
+	if cornballer.Version != "1.0" || cornballer.RequiredCore != "2.100" || len(cornballer.Dependencies) != 2 {
+		t.Errorf("pinned plugin was not read from its manifest: %+v", cornballer)
+	}
+	expectURL := "http://bridgr.bluth.com/jenkins/download/plugins/banana/1.5/banana.hpi"
+	if !cmp.Equal(expectURL, center.Plugins["banana"].URL) {
+		t.Error(cmp.Diff(expectURL, center.Plugins["banana"].URL))
+	}
+	if _, ok := center.Plugins["seal"]; ok {
+		t.Error("expected optional dependency to not be included")
+	}
+	wrapped, _ := os.ReadFile(path.Join(jenkins.dir(), "update-center.json"))
+	if !strings.HasPrefix(string(wrapped), "updateCenter.post(") {
+		t.Errorf("expected JSONP update center, but got %s", wrapped)
+	}
+}
+
+func TestJenkinsSign(t *testing.T) {
+	dir := t.TempDir()
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	template := x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "bluth"}, NotAfter: time.Now().Add(time.Hour)}
+	cert, _ := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	keyFile := path.Join(dir, "key.pem")
+	certFile := path.Join(dir, "cert.pem")
+	_ = os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}), 0600)
+	_ = os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0600)
+
+	center := map[string]interface{}{"id": "default", "plugins": map[string]interface{}{}}
+	jenkins := Jenkins{Key: keyFile, Certificate: certFile}
+	signature, err := jenkins.sign(center)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := canonicalJSON(center)
+	digest := sha512.Sum512(content)
+	if !cmp.Equal(hex.EncodeToString(digest[:]), signature.CorrectDigest512) {
+		t.Error(cmp.Diff(hex.EncodeToString(digest[:]), signature.CorrectDigest512))
+	}
+	raw, _ := hex.DecodeString(signature.CorrectSignature512)
+	if err := rsa.VerifyPKCS1v15(&key.PublicKey, crypto.SHA512, digest[:], raw); err != nil {
+		t.Errorf("signature does not verify: %s", err)
+	}
+	if len(signature.Certificates) != 1 {
+		t.Errorf("expected 1 certificate, but got %d", len(signature.Certificates))
+	}
+
+	jenkins.Certificate = keyFile
+	if _, err := jenkins.sign(center); err == nil {
+		t.Error("expected an error without certificates")
+	}
+}
@@ -0,0 +1,33 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestJenkinsImage(t *testing.T) {
+	jenkins := bridgr.Jenkins{}
+	if jenkins.Image() != nil {
+		t.Errorf("expected nil, but got %+v", jenkins.Image())
+	}
+}
+
+func TestJenkinsName(t *testing.T) {
+	expected := "jenkins"
+	jenkins := bridgr.Jenkins{}
+	if !cmp.Equal(expected, jenkins.Name()) {
+		t.Error(cmp.Diff(expected, jenkins.Name()))
+	}
+}
+
+func TestJenkinsHook(t *testing.T) {
+	jenkins := bridgr.Jenkins{}
+	result := reflect.TypeOf(jenkins.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
@@ -0,0 +1,395 @@
+package bridgr
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+	log "unknwon.dev/clog/v2"
+)
+
+const lockVersion = 1
+
+// lockHeader is written at the top of every lock file
+const lockHeader = "# bridge.lock is generated by Bridgr from bridge.yaml. Review it, but do not edit it.\n"
+
+// lockGenerated matches the indexes and metadata that workers generate, or refresh from upstream, on every run, and partial downloads.
+// They follow from the artifacts, so they are left out of the lock file.
+var lockGenerated = regexp.MustCompile(`(^|/)(repodata|quick)/|(^|/)(index\.(json|yaml|html|tab)|packages\.json|metadata\.json|listing\.json|latest\.json|` +
+	`ecosystems\.txt|update-center(\.actual)?\.json|maven-metadata\.xml(\.\w+)?|PACKAGES(\.gz|\.rds)?|Packages(\.gz|\.xz|\.bz2)?|(In)?Release(\.gpg)?|` +
+	`APKINDEX\.tar\.gz|(current_)?repodata\.json(\.bz2)?|\w*specs\.4\.8(\.gz)?|requirements\.txt|Gemfile(\.lock)?|.+\.part)$`)
+
+// Lock is the content of a lock file, every artifact that the workers fetched pinned to an exact version and digest
+type Lock struct {
+	Version   int         `yaml:"version"`
+	Artifacts []LockEntry `yaml:"artifacts"`
+}
+
+// LockEntry pins a single artifact. Artifacts that a worker resolves itself have a Name, as it is in the config file.
+// Everything else that a worker writes is pinned by its Path, relative to the packages directory.
+type LockEntry struct {
+	Worker  string `yaml:"worker"`
+	Name    string `yaml:"name,omitempty"`
+	Version string `yaml:"version,omitempty"`
+	Source  string `yaml:"source,omitempty"`
+	Digest  string `yaml:"digest,omitempty"`
+	Path    string `yaml:"path,omitempty"`
+	SHA256  string `yaml:"sha256,omitempty"`
+}
+
+func (e LockEntry) key() string {
+	if e.Path != "" {
+		return e.Path
+	}
+	return e.Name
+}
+
+// identity is what must stay the same for an artifact to not have drifted. A digest identifies an artifact on its own.
+func (e LockEntry) identity() string {
+	if e.Digest != "" {
+		return e.Digest
+	}
+	if e.SHA256 != "" {
+		return "sha256:" + e.SHA256
+	}
+	return e.Version
+}
+
+type lockState struct {
+	mu sync.Mutex
+	// pinned is the lock file read at startup, and resolved is what this run fetched, both by worker name
+	pinned   map[string][]LockEntry
+	resolved map[string][]LockEntry
+	drift    map[string][]string
+	// paths has the pins by their path, written has the paths of the files this run downloaded or kept, and refused
+	// has why Locked kept a path from being fetched
+	paths   map[string]LockEntry
+	written map[string]bool
+	refused map[string]string
+}
+
+var locks = newLockState()
+
+func newLockState() *lockState {
+	return &lockState{
+		pinned:   map[string][]LockEntry{},
+		resolved: map[string][]LockEntry{},
+		drift:    map[string][]string{},
+		paths:    map[string]LockEntry{},
+		written:  map[string]bool{},
+		refused:  map[string]string{},
+	}
+}
+
+// ReadLock reads a lock file, which pins the artifacts for Locked runs. Workers that do not run keep their pins when the lock file is written.
+func ReadLock(r io.Reader) error {
+	lock := Lock{}
+	if err := yaml.NewDecoder(r).Decode(&lock); err != nil && err != io.EOF {
+		return err
+	}
+	if lock.Version > lockVersion {
+		return fmt.Errorf("lock file version %d is newer than this Bridgr understands", lock.Version)
+	}
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	locks.pinned = map[string][]LockEntry{}
+	locks.paths = map[string]LockEntry{}
+	for _, entry := range lock.Artifacts {
+		locks.pinned[entry.Worker] = append(locks.pinned[entry.Worker], entry)
+		if entry.Path != "" {
+			locks.paths[entry.Path] = entry
+		}
+	}
+	return nil
+}
+
+// WriteLock writes the lock file for the artifacts of this run, and the pins read by ReadLock of workers that did not run
+func WriteLock(w io.Writer) error {
+	locks.mu.Lock()
+	workers := map[string][]LockEntry{}
+	for worker, entries := range locks.pinned {
+		workers[worker] = entries
+	}
+	for worker, entries := range locks.resolved {
+		workers[worker] = entries
+	}
+	locks.mu.Unlock()
+
+	lock := Lock{Version: lockVersion}
+	for _, entries := range workers {
+		lock.Artifacts = append(lock.Artifacts, entries...)
+	}
+	sort.Slice(lock.Artifacts, func(i, j int) bool {
+		a, b := lock.Artifacts[i], lock.Artifacts[j]
+		if a.Worker != b.Worker {
+			return a.Worker < b.Worker
+		}
+		return a.key() < b.key()
+	})
+	if _, err := io.WriteString(w, lockHeader); err != nil {
+		return err
+	}
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(lock); err != nil {
+		return err
+	}
+	return encoder.Close()
+}
+
+// lockPin gives the entry pinned in the lock file for the config item name of a worker
+func lockPin(worker, name string) (LockEntry, bool) {
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	for _, entry := range locks.pinned[worker] {
+		if entry.Name == name {
+			return entry, true
+		}
+	}
+	return LockEntry{}, false
+}
+
+// lockPins gives every entry pinned in the lock file for a worker
+func lockPins(worker string) []LockEntry {
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	return append([]LockEntry{}, locks.pinned[worker]...)
+}
+
+// lockRecord records an artifact resolved by a worker, replacing an earlier record of it
+func lockRecord(entry LockEntry) {
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	entries := locks.resolved[entry.Worker]
+	for i := range entries {
+		if entries[i].key() == entry.key() {
+			entries[i] = entry
+			return
+		}
+	}
+	locks.resolved[entry.Worker] = append(entries, entry)
+}
+
+// lockDrift records that a worker could not fetch what is pinned in the lock file
+func lockDrift(worker, format string, args ...interface{}) {
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	locks.drift[worker] = append(locks.drift[worker], fmt.Sprintf(format, args...))
+}
+
+// lockPath gives the path of a file relative to the packages directory, as it is in the lock file
+func lockPath(file string) string {
+	rel, err := filepath.Rel(BaseDir(""), file)
+	if err != nil {
+		return file
+	}
+	return filepath.ToSlash(rel)
+}
+
+// lockArtifact fetches a file with fetch, and records that this run wrote it. With Locked, a file that is not pinned in the lock file
+// is not fetched at all, and one that does not match its pin is removed. Generated indexes are not pinned, so they are always fetched.
+func lockArtifact(target string, fetch func() error) error {
+	rel := lockPath(target)
+	locks.mu.Lock()
+	pin, pinned := locks.paths[rel]
+	locks.mu.Unlock()
+	if Locked && !pinned && !lockGenerated.MatchString(rel) {
+		return locks.refuse(rel, "%s is not in the lock file", rel)
+	}
+	if err := fetch(); err != nil {
+		return err
+	}
+	if Locked && pinned && pin.SHA256 != "" {
+		sum, err := fileChecksum(target, "sha256")
+		if err != nil {
+			return err
+		}
+		if sum != pin.SHA256 {
+			_ = os.Remove(target)
+			return locks.refuse(rel, "%s is sha256:%s, but sha256:%s is pinned", rel, sum, pin.SHA256)
+		}
+	}
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	locks.written[rel] = true
+	return nil
+}
+
+// lockExisting records that this run kept a file that was already downloaded, with the same checks as lockArtifact
+func lockExisting(target string) error {
+	return lockArtifact(target, func() error { return nil })
+}
+
+// lockOptional reports whether to fetch a file that upstream does not always publish. With Locked, only a pinned one is fetched.
+func lockOptional(target string) bool {
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	_, pinned := locks.paths[lockPath(target)]
+	return !Locked || pinned
+}
+
+// refuse records why a path was not fetched, and gives it as an error
+func (l *lockState) refuse(rel, format string, args ...interface{}) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.refused[rel] = fmt.Sprintf(format, args...)
+	return errors.New(l.refused[rel])
+}
+
+// lockWalked are the workers whose files are written by a container or a library, rather than through lockArtifact, so
+// everything in their directory is locked
+var lockWalked = map[string]bool{"docker": true, "git": true, "helm": true, "oci": true}
+
+// LockArtifacts records the SHA-256 of the files that a worker wrote this run, apart from its generated indexes. With Locked, it gives
+// an error describing every artifact that has drifted from the lock file.
+func LockArtifacts(w Configuration) error {
+	worker := w.Name()
+	dir := BaseDir(worker)
+	if d, ok := w.(interface{ dir() string }); ok {
+		dir = d.dir()
+	}
+	locks.mu.Lock()
+	recorded := map[string]int{}
+	for i, entry := range locks.resolved[worker] {
+		if entry.Path != "" {
+			recorded[entry.Path] = i
+		}
+	}
+	locks.mu.Unlock()
+
+	var (
+		found []LockEntry
+		err   error
+	)
+	if w.Image() != nil || lockWalked[worker] {
+		found, err = lockWalk(worker, dir, recorded)
+	} else {
+		found, err = lockWritten(worker, dir, recorded)
+	}
+	if err != nil {
+		log.Warn("unable to lock the artifacts of %s: %s", worker, err)
+	}
+
+	locks.mu.Lock()
+	defer locks.mu.Unlock()
+	for _, entry := range found {
+		i, ok := recorded[entry.Path]
+		if !ok {
+			locks.resolved[worker] = append(locks.resolved[worker], entry)
+			continue
+		}
+		if resolved := &locks.resolved[worker][i]; resolved.Digest == "" {
+			resolved.SHA256 = entry.SHA256
+		}
+	}
+	if !Locked {
+		return nil
+	}
+	return locks.driftFrom(worker, lockPath(dir))
+}
+
+// lockWalk gives an entry for every file in a worker's directory
+func lockWalk(worker, dir string, recorded map[string]int) ([]LockEntry, error) {
+	var found []LockEntry
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		rel := lockPath(file)
+		if _, ok := recorded[rel]; ok && d.IsDir() {
+			// a directory recorded by the worker, like a Git clone, is pinned as a whole
+			return filepath.SkipDir
+		}
+		if !d.Type().IsRegular() || lockGenerated.MatchString(rel) {
+			return nil
+		}
+		sum, err := fileChecksum(file, "sha256")
+		if err != nil {
+			return err
+		}
+		found = append(found, LockEntry{Worker: worker, Path: rel, SHA256: sum})
+		return nil
+	})
+	return found, err
+}
+
+// lockWritten gives an entry for every file in a worker's directory that this run wrote, or that the worker recorded itself.
+// Files left from earlier runs are not locked.
+func lockWritten(worker, dir string, recorded map[string]int) ([]LockEntry, error) {
+	prefix := lockPath(dir) + "/"
+	locks.mu.Lock()
+	var paths []string
+	for rel := range locks.written {
+		if _, ok := recorded[rel]; !ok && strings.HasPrefix(rel, prefix) {
+			paths = append(paths, rel)
+		}
+	}
+	locks.mu.Unlock()
+	for rel := range recorded {
+		paths = append(paths, rel)
+	}
+	sort.Strings(paths)
+
+	var found []LockEntry
+	for _, rel := range paths {
+		file := filepath.Join(BaseDir(""), filepath.FromSlash(rel))
+		if info, err := os.Stat(file); err != nil || !info.Mode().IsRegular() || lockGenerated.MatchString(rel) {
+			continue
+		}
+		sum, err := fileChecksum(file, "sha256")
+		if err != nil {
+			return found, err
+		}
+		found = append(found, LockEntry{Worker: worker, Path: rel, SHA256: sum})
+	}
+	return found, nil
+}
+
+// driftFrom compares what a worker resolved with its pins, along with the paths in its directory that were refused. It must be
+// called with the lock held.
+func (l *lockState) driftFrom(worker, dir string) error {
+	problems := append([]string{}, l.drift[worker]...)
+	for rel, problem := range l.refused {
+		if strings.HasPrefix(rel, dir+"/") {
+			problems = append(problems, problem)
+		}
+	}
+	resolved := map[string]LockEntry{}
+	for _, entry := range l.resolved[worker] {
+		resolved[entry.key()] = entry
+	}
+	pinned := map[string]bool{}
+	for _, pin := range l.pinned[worker] {
+		pinned[pin.key()] = true
+		entry, ok := resolved[pin.key()]
+		switch {
+		case !ok && l.refused[pin.key()] != "":
+			// why it was refused is already a problem
+		case !ok:
+			problems = append(problems, fmt.Sprintf("%s was not fetched", pin.key()))
+		case entry.identity() != pin.identity():
+			problems = append(problems, fmt.Sprintf("%s is %s, but %s is pinned", pin.key(), entry.identity(), pin.identity()))
+		}
+	}
+	for key := range resolved {
+		if !pinned[key] {
+			problems = append(problems, fmt.Sprintf("%s is not in the lock file", key))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	sort.Strings(problems)
+	return fmt.Errorf("%s has drifted from the lock file:\n  %s", worker, strings.Join(problems, "\n  "))
+}
@@ -0,0 +1,266 @@
+package bridgr
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// resetLocks gives a test its own lock state, with Locked set as given
+func resetLocks(t *testing.T, locked bool) {
+	t.Helper()
+	original, originalLocked := locks, Locked
+	t.Cleanup(func() {
+		locks, Locked = original, originalLocked
+	})
+	locks = newLockState()
+	Locked = locked
+}
+
+func sha256Of(content string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(content)))
+}
+
+func TestReadWriteLock(t *testing.T) {
+	resetLocks(t, false)
+	lockfile := `version: 1
+artifacts:
+  - worker: git
+    name: https://github.com/bluth/stair-car.git
+    digest: 0a1b2c
+  - worker: docker
+    name: bluth/banana:latest
+    digest: sha256:old
+`
+	if err := ReadLock(strings.NewReader(lockfile)); err != nil {
+		t.Fatal(err)
+	}
+	if pin, ok := lockPin("git", "https://github.com/bluth/stair-car.git"); !ok || pin.Digest != "0a1b2c" {
+		t.Errorf("expected the git pin to be read, got %+v", pin)
+	}
+	lockRecord(LockEntry{Worker: "docker", Name: "bluth/banana:latest", Version: "latest", Digest: "sha256:new"})
+	lockRecord(LockEntry{Worker: "docker", Name: "bluth/banana:latest", Version: "latest", Digest: "sha256:newer"})
+	lockRecord(LockEntry{Worker: "docker", Name: "bluth/frozen:1", Digest: "sha256:frozen"})
+
+	out := bytes.Buffer{}
+	if err := WriteLock(&out); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out.String(), lockHeader) {
+		t.Errorf("expected the lock file to start with its header, got %s", out.String())
+	}
+	resetLocks(t, false)
+	if err := ReadLock(&out); err != nil {
+		t.Fatal(err)
+	}
+	expect := []LockEntry{
+		{Worker: "docker", Name: "bluth/banana:latest", Version: "latest", Digest: "sha256:newer"},
+		{Worker: "docker", Name: "bluth/frozen:1", Digest: "sha256:frozen"},
+		{Worker: "git", Name: "https://github.com/bluth/stair-car.git", Digest: "0a1b2c"},
+	}
+	if !cmp.Equal(expect[:2], lockPins("docker")) {
+		t.Error(cmp.Diff(expect[:2], lockPins("docker")))
+	}
+	if !cmp.Equal(expect[2:], lockPins("git")) {
+		t.Error(cmp.Diff(expect[2:], lockPins("git")))
+	}
+}
+
+func TestReadLockErrors(t *testing.T) {
+	resetLocks(t, false)
+	if err := ReadLock(strings.NewReader("version: 99\n")); err == nil {
+		t.Error("expected an error for a newer lock file version")
+	}
+	if err := ReadLock(strings.NewReader("artifacts: [")); err == nil {
+		t.Error("expected an error for an invalid lock file")
+	}
+	if err := ReadLock(strings.NewReader("")); err != nil {
+		t.Errorf("expected an empty lock file to be read, got %s", err)
+	}
+}
+
+func TestLockArtifact(t *testing.T) {
+	t.Chdir(t.TempDir())
+	pins := `version: 1
+artifacts:
+  - worker: files
+    path: files/banana.tar.gz
+    sha256: ` + sha256Of("banana") + `
+`
+	dir := File{}.dir()
+	tests := []struct {
+		name    string
+		locked  bool
+		file    string
+		content string
+		fetched bool
+		err     bool
+	}{
+		{"not locked", false, "stair-car.tar.gz", "stair-car", true, false},
+		{"pinned", true, "banana.tar.gz", "banana", true, false},
+		{"not pinned", true, "stair-car.tar.gz", "stair-car", false, true},
+		{"pin mismatch", true, "banana.tar.gz", "frozen", false, true},
+		{"generated", true, "index.json", "{}", true, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetLocks(t, test.locked)
+			if err := ReadLock(strings.NewReader(pins)); err != nil {
+				t.Fatal(err)
+			}
+			target := path.Join(dir, test.file)
+			_ = os.RemoveAll(dir)
+			_ = os.MkdirAll(dir, os.ModePerm)
+			err := lockArtifact(target, func() error { return os.WriteFile(target, []byte(test.content), 0644) })
+			if test.err != (err != nil) {
+				t.Errorf("expected error %t, got %v", test.err, err)
+			}
+			if _, err := os.Stat(target); test.fetched != (err == nil) {
+				t.Errorf("expected %s to be fetched %t", test.file, test.fetched)
+			}
+			if written := locks.written[lockPath(target)]; written != test.fetched {
+				t.Errorf("expected %s to be written this run %t, got %t", test.file, test.fetched, written)
+			}
+		})
+	}
+}
+
+func TestLockArtifacts(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resetLocks(t, false)
+	dir := Git{}.dir()
+	_ = os.MkdirAll(path.Join(dir, "repodata"), os.ModePerm)
+	_ = os.MkdirAll(path.Join(dir, "clone", "objects"), os.ModePerm)
+	_ = os.WriteFile(path.Join(dir, "banana.tar.gz"), []byte("banana"), 0644)
+	_ = os.WriteFile(path.Join(dir, "recorded.tar.gz"), []byte("recorded"), 0644)
+	_ = os.WriteFile(path.Join(dir, "index.json"), []byte("{}"), 0644)
+	_ = os.WriteFile(path.Join(dir, "repodata", "repomd.xml"), []byte("<repomd/>"), 0644)
+	_ = os.WriteFile(path.Join(dir, "download.iso.part"), []byte("part"), 0644)
+	_ = os.WriteFile(path.Join(dir, "clone", "objects", "pack"), []byte("pack"), 0644)
+	lockRecord(LockEntry{Worker: "git", Name: "https://bluth.com/recorded.tar.gz", Path: "git/recorded.tar.gz"})
+	lockRecord(LockEntry{Worker: "git", Name: "https://bluth.com/clone.git", Digest: "0a1b2c", Path: "git/clone"})
+
+	if err := LockArtifacts(&Git{}); err != nil {
+		t.Fatal(err)
+	}
+	expect := []LockEntry{
+		{Worker: "git", Name: "https://bluth.com/recorded.tar.gz", Path: "git/recorded.tar.gz", SHA256: sha256Of("recorded")},
+		{Worker: "git", Name: "https://bluth.com/clone.git", Digest: "0a1b2c", Path: "git/clone"},
+		{Worker: "git", Path: "git/banana.tar.gz", SHA256: sha256Of("banana")},
+	}
+	if !cmp.Equal(expect, locks.resolved["git"]) {
+		t.Error(cmp.Diff(expect, locks.resolved["git"]))
+	}
+	if err := LockArtifacts(&ISO{}); err != nil {
+		t.Errorf("expected no error for a worker without a directory, got %s", err)
+	}
+}
+
+func TestLockArtifactsWritten(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resetLocks(t, false)
+	write := func(file, content string) error {
+		_ = os.MkdirAll(path.Dir(file), os.ModePerm)
+		return os.WriteFile(file, []byte(content), 0644)
+	}
+	dir := File{}.dir()
+	_ = write(path.Join(dir, "stale.tar.gz"), "stale")
+	_ = write(path.Join(dir, "recorded.tar.gz"), "recorded")
+	for file, content := range map[string]string{"banana.tar.gz": "banana", "index.json": "{}"} {
+		target := path.Join(dir, file)
+		if err := lockArtifact(target, func() error { return write(target, content) }); err != nil {
+			t.Fatal(err)
+		}
+	}
+	seal := path.Join(Golang{}.dir(), "bluth.com", "seal", "@v", "v1.0.0.zip")
+	if err := lockArtifact(seal, func() error { return write(seal, "seal") }); err != nil {
+		t.Fatal(err)
+	}
+	lockRecord(LockEntry{Worker: "files", Name: "https://bluth.com/recorded.tar.gz", Path: "files/recorded.tar.gz"})
+
+	if err := LockArtifacts(&File{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := LockArtifacts(&Golang{}); err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string][]LockEntry{
+		"files": {
+			{Worker: "files", Name: "https://bluth.com/recorded.tar.gz", Path: "files/recorded.tar.gz", SHA256: sha256Of("recorded")},
+			{Worker: "files", Path: "files/banana.tar.gz", SHA256: sha256Of("banana")},
+		},
+		"golang": {{Worker: "golang", Path: "go/bluth.com/seal/@v/v1.0.0.zip", SHA256: sha256Of("seal")}},
+	}
+	if !cmp.Equal(expect, locks.resolved) {
+		t.Error(cmp.Diff(expect, locks.resolved))
+	}
+}
+
+func TestLockArtifactsDrift(t *testing.T) {
+	t.Chdir(t.TempDir())
+	pins := `version: 1
+artifacts:
+  - worker: files
+    path: files/banana.tar.gz
+    sha256: ` + sha256Of("banana") + `
+  - worker: files
+    path: files/frozen.tar.gz
+    sha256: ` + sha256Of("frozen") + `
+  - worker: files
+    path: files/missing.tar.gz
+    sha256: ` + sha256Of("missing") + `
+`
+	dir := File{}.dir()
+	_ = os.MkdirAll(dir, os.ModePerm)
+
+	tests := []struct {
+		name   string
+		locked bool
+		expect []string
+	}{
+		{"not locked", false, nil},
+		{"locked", true, []string{
+			"files/frozen.tar.gz is sha256:" + sha256Of("thawed") + ", but sha256:" + sha256Of("frozen") + " is pinned",
+			"files/missing.tar.gz was not fetched",
+			"files/new.tar.gz is not in the lock file",
+			"stair-car is not in the lock file",
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resetLocks(t, test.locked)
+			if err := ReadLock(strings.NewReader(pins)); err != nil {
+				t.Fatal(err)
+			}
+			for file, content := range map[string]string{"banana.tar.gz": "banana", "frozen.tar.gz": "thawed", "new.tar.gz": "new"} {
+				target := path.Join(dir, file)
+				_ = lockArtifact(target, func() error { return os.WriteFile(target, []byte(content), 0644) })
+			}
+			lockDrift("files", "stair-car is not in the lock file")
+			err := LockArtifacts(&File{})
+			if test.expect == nil {
+				if err != nil {
+					t.Errorf("expected no drift without Locked, got %s", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("expected drift from the lock file")
+			}
+			for _, problem := range test.expect {
+				if !strings.Contains(err.Error(), problem) {
+					t.Errorf("expected %q in %s", problem, err)
+				}
+			}
+			if strings.Contains(err.Error(), "banana") || strings.Contains(err.Error(), "frozen.tar.gz was not fetched") {
+				t.Errorf("expected no drift for an unchanged artifact, or for one that was refused, got %s", err)
+			}
+		})
+	}
+}
@@ -1 +1,822 @@
 package bridgr
+
+import (
+	"bytes"
+	"crypto/md5"  //nolint:gosec // md5 is required by the maven repository layout, not used for security
+	"crypto/sha1" //nolint:gosec // sha1 is required by the maven repository layout, not used for security
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"hash"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/mitchellh/mapstructure"
+	log "unknwon.dev/clog/v2"
+)
+
+const (
+	defaultMavenRepo     = "https://repo.maven.apache.org/maven2"
+	mavenInterpolateMax  = 10
+	mavenMetadataFile    = "maven-metadata.xml"
+	mavenTimestampFormat = "20060102150405"
+)
+
+var (
+	mavenProperty     = regexp.MustCompile(`\$\{([^}]+)\}`)
+	mavenRange        = regexp.MustCompile(`[\[(][^\])]*[\])]`)
+	mavenVersionParts = regexp.MustCompile(`[0-9]+|[a-zA-Z]+`)
+)
+
+// Maven is the configuration object for creating a static Maven 2 repository
+type Maven struct {
+	Repositories []string
+	Artifacts    []MavenArtifact
+}
+
+// MavenArtifact holds the coordinates of a Maven artifact
+type MavenArtifact struct {
+	GroupID    string `mapstructure:"groupId" xml:"groupId"`
+	ArtifactID string `mapstructure:"artifactId" xml:"artifactId"`
+	Version    string `xml:"version"`
+	Packaging  string `xml:"packaging"`
+	Classifier string `xml:"classifier"`
+}
+
+type mavenPOM struct {
+	Parent               *MavenArtifact    `xml:"parent"`
+	GroupID              string            `xml:"groupId"`
+	ArtifactID           string            `xml:"artifactId"`
+	Version              string            `xml:"version"`
+	Packaging            string            `xml:"packaging"`
+	Properties           mavenProperties   `xml:"properties"`
+	DependencyManagement []mavenDependency `xml:"dependencyManagement>dependencies>dependency"`
+	Dependencies         []mavenDependency `xml:"dependencies>dependency"`
+}
+
+type mavenDependency struct {
+	GroupID    string           `xml:"groupId"`
+	ArtifactID string           `xml:"artifactId"`
+	Version    string           `xml:"version"`
+	Type       string           `xml:"type"`
+	Classifier string           `xml:"classifier"`
+	Scope      string           `xml:"scope"`
+	Optional   string           `xml:"optional"`
+	Exclusions []mavenExclusion `xml:"exclusions>exclusion"`
+}
+
+type mavenExclusion struct {
+	GroupID    string `xml:"groupId"`
+	ArtifactID string `xml:"artifactId"`
+}
+
+type mavenProperties map[string]string
+
+// mavenModel is the effective model of a POM, after its parents and imports have been applied
+type mavenModel struct {
+	MavenArtifact
+	props   map[string]string
+	managed map[string]mavenDependency
+	deps    []mavenDependency
+}
+
+type mavenMetadata struct {
+	XMLName    xml.Name `xml:"metadata"`
+	GroupID    string   `xml:"groupId"`
+	ArtifactID string   `xml:"artifactId"`
+	Versioning struct {
+		Latest      string   `xml:"latest,omitempty"`
+		Release     string   `xml:"release,omitempty"`
+		Versions    []string `xml:"versions>version"`
+		LastUpdated string   `xml:"lastUpdated,omitempty"`
+	} `xml:"versioning"`
+}
+
+// UnmarshalXML reads the free-form <properties> element of a POM
+func (mp *mavenProperties) UnmarshalXML(d *xml.Decoder, start xml.StartElement) error {
+	*mp = mavenProperties{}
+	for {
+		token, err := d.Token()
+		if err != nil {
+			return err
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			var value string
+			if err := d.DecodeElement(&value, &t); err != nil {
+				return err
+			}
+			(*mp)[t.Name.Local] = strings.TrimSpace(value)
+		case xml.EndElement:
+			return nil
+		}
+	}
+}
+
+func (ma MavenArtifact) String() string {
+	parts := []string{ma.GroupID, ma.ArtifactID, ma.Version}
+	if ma.Classifier != "" {
+		parts = append(parts, ma.Packaging, ma.Classifier)
+	}
+	return strings.Join(parts, ":")
+}
+
+func (ma MavenArtifact) key() string {
+	return ma.GroupID + ":" + ma.ArtifactID
+}
+
+// id identifies the file of an artifact apart from its version, so that its classified files (ie, a test-jar) are separate artifacts
+func (ma MavenArtifact) id() string {
+	return ma.key() + ":" + ma.extension() + ":" + ma.Classifier
+}
+
+// dir gives the repository relative directory for this artifact version
+func (ma MavenArtifact) dir() string {
+	return path.Join(strings.ReplaceAll(ma.GroupID, ".", "/"), ma.ArtifactID, ma.Version)
+}
+
+// file gives the file name for this artifact with the given extension
+func (ma MavenArtifact) file(ext string) string {
+	name := ma.ArtifactID + "-" + ma.Version
+	if ma.Classifier != "" && ext != "pom" {
+		name += "-" + ma.Classifier
+	}
+	return name + "." + ext
+}
+
+// extension maps a packaging or dependency type to the file extension used in the repository
+func (ma MavenArtifact) extension() string {
+	switch ma.Packaging {
+	case "", "jar", "bundle", "maven-plugin", "eclipse-plugin", "ejb", "test-jar", "java-source", "javadoc":
+		return "jar"
+	default:
+		return ma.Packaging
+	}
+}
+
+// parseMavenArtifact reads the "group:artifact[:version[:packaging[:classifier]]]" shorthand.
+// A single name is used as both the group and artifact, as is common for older artifacts (ie, junit).
+// When the second part is a version (ie, "junit:4"), it is treated the same way.
+func parseMavenArtifact(spec string) (MavenArtifact, error) {
+	parts := strings.Split(strings.TrimSpace(spec), ":")
+	for _, part := range parts {
+		if part == "" {
+			return MavenArtifact{}, fmt.Errorf("invalid maven artifact %q", spec)
+		}
+	}
+	if len(parts) == 1 || (len(parts) == 2 && isMavenVersion(parts[1])) {
+		parts = append([]string{parts[0]}, parts...)
+	}
+	if len(parts) > 5 {
+		return MavenArtifact{}, fmt.Errorf("invalid maven artifact %q", spec)
+	}
+	parts = append(parts, make([]string, 5-len(parts))...)
+	return MavenArtifact{GroupID: parts[0], ArtifactID: parts[1], Version: parts[2], Packaging: parts[3], Classifier: parts[4]}, nil
+}
+
+func isMavenVersion(s string) bool {
+	return len(s) > 0 && (s[0] >= '0' && s[0] <= '9' || s[0] == '[' || s[0] == '(')
+}
+
+// dir is the top-level directory name for all objects written out under the Maven worker
+func (m Maven) dir() string {
+	return BaseDir(m.Name())
+}
+
+// Name returns the name of this Configuration
+func (m Maven) Name() string {
+	return "maven"
+}
+
+// Image implements the Imager interface
+func (m Maven) Image() reference.Named {
+	return nil
+}
+
+func stringToMavenArtifact(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf(MavenArtifact{}) {
+		return data, nil
+	}
+	return parseMavenArtifact(data.(string))
+}
+
+func arrayToMaven(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Slice || t != reflect.TypeOf(Maven{}) {
+		return data, nil
+	}
+	return map[string]interface{}{"artifacts": data}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (m *Maven) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		arrayToMaven,
+		stringToMavenArtifact,
+	)
+}
+
+// Setup prepares the Maven repository directory
+func (m *Maven) Setup() error {
+	log.Trace("Called Maven.Setup()")
+	if len(m.Repositories) == 0 {
+		m.Repositories = []string{defaultMavenRepo}
+	}
+	for i, repo := range m.Repositories {
+		m.Repositories[i] = strings.TrimSuffix(repo, "/")
+	}
+	return os.MkdirAll(m.dir(), os.ModePerm)
+}
+
+// Run resolves the configured artifacts and their transitive dependencies, and writes them in the Maven 2 repository layout
+func (m *Maven) Run() error {
+	if err := m.Setup(); err != nil {
+		return err
+	}
+	resolver := newMavenResolver(m)
+	artifacts := resolver.resolve(m.Artifacts)
+
+	forEach(len(artifacts), func(i int) {
+		artifact := artifacts[i]
+		if artifact.extension() == "pom" {
+			return
+		}
+		if err := resolver.download(artifact); err != nil {
+			log.Info("Maven: unable to download %s - %s", artifact, err)
+		}
+	})
+
+	poms := resolver.poms()
+	forEach(len(poms), func(i int) {
+		if err := m.writeFile(poms[i].dir(), poms[i].file("pom"), resolver.pom(poms[i])); err != nil {
+			log.Info("Maven: unable to write POM for %s - %s", poms[i], err)
+		}
+	})
+	return m.writeMetadata(poms)
+}
+
+// writeFile writes content to the repository, along with its checksum files
+func (m *Maven) writeFile(dir, name string, content []byte) error {
+	target := path.Join(m.dir(), dir, name)
+	if err := os.MkdirAll(path.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	err := lockArtifact(target, func() error {
+		return os.WriteFile(target, content, 0644) //nolint:gosec // repository content is meant to be readable
+	})
+	if err != nil {
+		return err
+	}
+	return writeChecksums(target)
+}
+
+// writeChecksums creates the .sha1 and .md5 files that maven clients expect next to every file
+func writeChecksums(file string) error {
+	for ext, sum := range map[string]func() hash.Hash{"sha1": sha1.New, "md5": md5.New} {
+		h := sum()
+		in, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(h, in)
+		in.Close()
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(file+"."+ext, []byte(hex.EncodeToString(h.Sum(nil))), 0644); err != nil { //nolint:gosec // repository content is meant to be readable
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMetadata creates the maven-metadata.xml for every group/artifact, listing only the versions in this repository
+func (m *Maven) writeMetadata(poms []MavenArtifact) error {
+	versions := map[string][]string{}
+	for _, pom := range poms {
+		versions[pom.key()] = append(versions[pom.key()], pom.Version)
+	}
+	for key, list := range versions {
+		sort.Slice(list, func(i, j int) bool { return compareMavenVersions(list[i], list[j]) < 0 })
+		parts := strings.SplitN(key, ":", 2)
+		meta := mavenMetadata{GroupID: parts[0], ArtifactID: parts[1]}
+		meta.Versioning.Versions = list
+		meta.Versioning.Latest = list[len(list)-1]
+		for _, v := range list {
+			if !strings.HasSuffix(v, "-SNAPSHOT") {
+				meta.Versioning.Release = v
+			}
+		}
+		meta.Versioning.LastUpdated = time.Now().UTC().Format(mavenTimestampFormat)
+		content, err := xml.MarshalIndent(meta, "", "  ")
+		if err != nil {
+			return err
+		}
+		dir := path.Dir(MavenArtifact{GroupID: parts[0], ArtifactID: parts[1], Version: "-"}.dir())
+		if err := m.writeFile(dir, mavenMetadataFile, append([]byte(xml.Header), content...)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type mavenResolver struct {
+	maven    *Maven
+	mu       sync.Mutex
+	models   map[string]*mavenModel
+	raw      map[string][]byte
+	sources  map[string]string
+	metaData map[string]*mavenMetadata
+}
+
+func newMavenResolver(m *Maven) *mavenResolver {
+	return &mavenResolver{
+		maven:    m,
+		models:   map[string]*mavenModel{},
+		raw:      map[string][]byte{},
+		sources:  map[string]string{},
+		metaData: map[string]*mavenMetadata{},
+	}
+}
+
+type mavenNode struct {
+	artifact   MavenArtifact
+	exclusions []mavenExclusion
+	depth      int
+}
+
+// resolve walks the dependency graph breadth first, so the nearest declaration of an artifact wins (as Maven does). Every requested
+// artifact is kept though, even another version of the same artifact. Versions in the dependency management of the requested
+// artifacts override transitive versions.
+func (r *mavenResolver) resolve(roots []MavenArtifact) []MavenArtifact {
+	var queue []mavenNode
+	for _, root := range roots {
+		queue = append(queue, mavenNode{artifact: root})
+	}
+	selected := map[string]bool{}
+	requested := map[string]bool{}
+	var result []MavenArtifact
+	managed := map[string]mavenDependency{}
+
+	for len(queue) > 0 {
+		// fetch the models for this level concurrently, then select in order so that "nearest, first declared" wins
+		forEach(len(queue), func(i int) {
+			node := &queue[i]
+			if node.depth == 0 {
+				version, err := r.pickVersion(node.artifact, true)
+				if err != nil {
+					log.Info("Maven: unable to resolve %s - %s", node.artifact, err)
+					return
+				}
+				node.artifact.Version = version
+			} else if managedDep, ok := managed[node.artifact.key()]; ok && managedDep.Version != "" {
+				node.artifact.Version = managedDep.Version
+			}
+			if strings.ContainsAny(node.artifact.Version, "[(") {
+				version, err := r.pickVersion(node.artifact, false)
+				if err != nil {
+					log.Info("Maven: unable to resolve %s - %s", node.artifact, err)
+					return
+				}
+				node.artifact.Version = version
+			}
+			if _, err := r.model(node.artifact); err != nil {
+				log.Info("Maven: unable to resolve %s - %s", node.artifact, err)
+			}
+		})
+
+		var next []mavenNode
+		for _, node := range queue {
+			model := r.cached(node.artifact)
+			if model == nil {
+				continue
+			}
+			id := node.artifact.id()
+			if node.depth == 0 {
+				if requested[id+":"+node.artifact.Version] {
+					continue
+				}
+				requested[id+":"+node.artifact.Version] = true
+			} else if selected[id] {
+				continue
+			}
+			selected[id] = true
+			artifact := node.artifact
+			if artifact.Packaging == "" {
+				artifact.Packaging = model.Packaging
+			}
+			result = append(result, artifact)
+			log.Trace("Maven: resolved %s", artifact)
+			if node.depth == 0 {
+				for key, dep := range model.managed {
+					if _, ok := managed[key]; !ok {
+						managed[key] = dep
+					}
+				}
+			}
+			next = append(next, r.children(node, model)...)
+		}
+		queue = next
+	}
+	return result
+}
+
+// children lists the dependencies of a node that are included transitively
+func (r *mavenResolver) children(node mavenNode, model *mavenModel) []mavenNode {
+	var nodes []mavenNode
+	for _, dep := range model.deps {
+		switch dep.Scope {
+		case "", "compile", "runtime":
+		default:
+			continue
+		}
+		if dep.Optional == "true" || dep.Version == "" || excluded(dep, node.exclusions) {
+			continue
+		}
+		packaging := dep.Type
+		if packaging == "test-jar" && dep.Classifier == "" {
+			dep.Classifier = "tests"
+		}
+		nodes = append(nodes, mavenNode{
+			artifact:   MavenArtifact{GroupID: dep.GroupID, ArtifactID: dep.ArtifactID, Version: dep.Version, Packaging: packaging, Classifier: dep.Classifier},
+			exclusions: append(append([]mavenExclusion{}, node.exclusions...), dep.Exclusions...),
+			depth:      node.depth + 1,
+		})
+	}
+	return nodes
+}
+
+func excluded(dep mavenDependency, exclusions []mavenExclusion) bool {
+	for _, ex := range exclusions {
+		if (ex.GroupID == "*" || ex.GroupID == dep.GroupID) && (ex.ArtifactID == "*" || ex.ArtifactID == dep.ArtifactID) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *mavenResolver) cached(artifact MavenArtifact) *mavenModel {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.models[artifact.key()+":"+artifact.Version]
+}
+
+func (r *mavenResolver) pom(artifact MavenArtifact) []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.raw[artifact.key()+":"+artifact.Version]
+}
+
+// poms lists every POM that was read, including parents and imported BOMs, which must also be in the repository
+func (r *mavenResolver) poms() []MavenArtifact {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var list []MavenArtifact
+	for key := range r.raw {
+		parts := strings.SplitN(key, ":", 3)
+		list = append(list, MavenArtifact{GroupID: parts[0], ArtifactID: parts[1], Version: parts[2]})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].String() < list[j].String() })
+	return list
+}
+
+// fetch gets a file from the first repository that has it, remembering that repository for the rest of the artifact
+func (r *mavenResolver) fetch(artifact MavenArtifact, name string) ([]byte, error) {
+	repos := r.maven.Repositories
+	r.mu.Lock()
+	if source, ok := r.sources[artifact.key()+":"+artifact.Version]; ok {
+		repos = []string{source}
+	}
+	r.mu.Unlock()
+
+	var lastErr error
+	for _, repo := range repos {
+		resp, err := httpGet(repo + "/" + path.Join(artifact.dir(), name))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		content, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if artifact.Version != "" {
+			r.mu.Lock()
+			r.sources[artifact.key()+":"+artifact.Version] = repo
+			r.mu.Unlock()
+		}
+		return content, nil
+	}
+	return nil, lastErr
+}
+
+// download writes the artifact file itself into the repository
+func (r *mavenResolver) download(artifact MavenArtifact) error {
+	name := artifact.file(artifact.extension())
+	repo := r.maven.Repositories[0]
+	r.mu.Lock()
+	if source, ok := r.sources[artifact.key()+":"+artifact.Version]; ok {
+		repo = source
+	}
+	r.mu.Unlock()
+
+	source, err := url.Parse(repo + "/" + path.Join(artifact.dir(), name))
+	if err != nil {
+		return err
+	}
+	target := path.Join(r.maven.dir(), artifact.dir(), name)
+	if err := download(source, target); err != nil {
+		return err
+	}
+	return writeChecksums(target)
+}
+
+// model builds the effective model for an artifact version, reading its parent and imported POMs as needed
+func (r *mavenResolver) model(artifact MavenArtifact) (*mavenModel, error) {
+	if model := r.cached(artifact); model != nil {
+		return model, nil
+	}
+	content, err := r.fetch(artifact, artifact.file("pom"))
+	if err != nil {
+		return nil, err
+	}
+	pom := mavenPOM{}
+	if err := xml.NewDecoder(bytes.NewReader(content)).Decode(&pom); err != nil {
+		return nil, fmt.Errorf("unable to parse POM: %s", err)
+	}
+
+	model := &mavenModel{props: map[string]string{}, managed: map[string]mavenDependency{}}
+	if pom.Parent != nil {
+		parent, err := r.model(*pom.Parent)
+		if err != nil {
+			return nil, fmt.Errorf("parent %s - %s", pom.Parent, err)
+		}
+		for k, v := range parent.props {
+			model.props[k] = v
+		}
+		for k, v := range parent.managed {
+			model.managed[k] = v
+		}
+		model.deps = append(model.deps, parent.deps...)
+		model.props["project.parent.groupId"] = parent.GroupID
+		model.props["project.parent.version"] = parent.Version
+		model.props["parent.version"] = parent.Version
+		if pom.GroupID == "" {
+			pom.GroupID = parent.GroupID
+		}
+		if pom.Version == "" {
+			pom.Version = parent.Version
+		}
+	}
+	for k, v := range pom.Properties {
+		model.props[k] = v
+	}
+	model.MavenArtifact = MavenArtifact{GroupID: pom.GroupID, ArtifactID: pom.ArtifactID, Version: pom.Version, Packaging: pom.Packaging}
+	if model.Packaging == "" {
+		model.Packaging = "jar"
+	}
+	for _, prefix := range []string{"project.", "pom.", ""} {
+		model.props[prefix+"groupId"] = model.GroupID
+		model.props[prefix+"artifactId"] = model.ArtifactID
+		model.props[prefix+"version"] = model.Version
+	}
+	model.Version = model.interpolate(model.Version)
+
+	for _, dep := range pom.DependencyManagement {
+		dep = model.interpolateDep(dep)
+		if dep.Scope == "import" && dep.Type == "pom" {
+			bom, err := r.model(MavenArtifact{GroupID: dep.GroupID, ArtifactID: dep.ArtifactID, Version: dep.Version})
+			if err != nil {
+				log.Info("Maven: unable to import %s:%s:%s - %s", dep.GroupID, dep.ArtifactID, dep.Version, err)
+				continue
+			}
+			for k, v := range bom.managed {
+				if _, ok := model.managed[k]; !ok {
+					model.managed[k] = v
+				}
+			}
+			continue
+		}
+		model.managed[dep.GroupID+":"+dep.ArtifactID] = dep
+	}
+	for _, dep := range pom.Dependencies {
+		model.deps = append(model.deps, model.interpolateDep(dep))
+	}
+	for i, dep := range model.deps {
+		if managed, ok := model.managed[dep.GroupID+":"+dep.ArtifactID]; ok {
+			if dep.Version == "" {
+				model.deps[i].Version = managed.Version
+			}
+			if dep.Scope == "" {
+				model.deps[i].Scope = managed.Scope
+			}
+			if len(dep.Exclusions) == 0 {
+				model.deps[i].Exclusions = managed.Exclusions
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := artifact.key() + ":" + artifact.Version
+	r.models[key] = model
+	r.raw[key] = content
+	return model, nil
+}
+
+func (model *mavenModel) interpolate(value string) string {
+	for i := 0; i < mavenInterpolateMax && strings.Contains(value, "${"); i++ {
+		value = mavenProperty.ReplaceAllStringFunc(value, func(match string) string {
+			if v, ok := model.props[match[2:len(match)-1]]; ok {
+				return v
+			}
+			return match
+		})
+	}
+	return value
+}
+
+func (model *mavenModel) interpolateDep(dep mavenDependency) mavenDependency {
+	dep.GroupID = model.interpolate(strings.TrimSpace(dep.GroupID))
+	dep.ArtifactID = model.interpolate(strings.TrimSpace(dep.ArtifactID))
+	dep.Version = model.interpolate(strings.TrimSpace(dep.Version))
+	dep.Type = model.interpolate(strings.TrimSpace(dep.Type))
+	dep.Classifier = model.interpolate(strings.TrimSpace(dep.Classifier))
+	dep.Scope = model.interpolate(strings.TrimSpace(dep.Scope))
+	dep.Optional = model.interpolate(strings.TrimSpace(dep.Optional))
+	return dep
+}
+
+// pickVersion finds the version to use from the artifact's maven-metadata.xml. Version ranges give the highest matching version.
+// For requested artifacts (loose is true), an empty version means the latest release, and a partial version (ie, "4") matches by prefix.
+func (r *mavenResolver) pickVersion(artifact MavenArtifact, loose bool) (string, error) {
+	spec := artifact.Version
+	isRange := strings.ContainsAny(spec, "[(")
+	if !isRange && !loose {
+		return spec, nil
+	}
+	meta, err := r.metadata(artifact)
+	if err != nil {
+		if spec != "" && !isRange {
+			return spec, nil
+		}
+		return "", err
+	}
+	versions := meta.Versioning.Versions
+	sort.Slice(versions, func(i, j int) bool { return compareMavenVersions(versions[i], versions[j]) > 0 })
+
+	switch {
+	case isRange:
+		for _, v := range versions {
+			if inMavenRange(v, spec) {
+				return v, nil
+			}
+		}
+	case spec == "":
+		if meta.Versioning.Release != "" {
+			return meta.Versioning.Release, nil
+		}
+		for _, v := range versions {
+			if !strings.HasSuffix(v, "-SNAPSHOT") {
+				return v, nil
+			}
+		}
+	default:
+		for _, v := range versions {
+			if v == spec {
+				return v, nil
+			}
+		}
+		for _, v := range versions {
+			if strings.HasPrefix(v, spec+".") && !strings.HasSuffix(v, "-SNAPSHOT") {
+				return v, nil
+			}
+		}
+		return spec, nil
+	}
+	return "", fmt.Errorf("no version matches %q", spec)
+}
+
+func (r *mavenResolver) metadata(artifact MavenArtifact) (*mavenMetadata, error) {
+	r.mu.Lock()
+	meta, ok := r.metaData[artifact.key()]
+	r.mu.Unlock()
+	if ok {
+		return meta, nil
+	}
+	unversioned := MavenArtifact{GroupID: artifact.GroupID, ArtifactID: artifact.ArtifactID}
+	content, err := r.fetch(unversioned, mavenMetadataFile)
+	if err != nil {
+		return nil, err
+	}
+	meta = &mavenMetadata{}
+	if err := xml.Unmarshal(content, meta); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.metaData[artifact.key()] = meta
+	return meta, nil
+}
+
+// inMavenRange checks a version against a Maven version range, such as "[1.0,2.0)" or "(,1.0],[1.2,)"
+func inMavenRange(version, spec string) bool {
+	ranges := mavenRange.FindAllString(strings.ReplaceAll(spec, " ", ""), -1)
+	for _, r := range ranges {
+		bounds := strings.SplitN(r[1:len(r)-1], ",", 2)
+		if len(bounds) == 1 {
+			if version == bounds[0] {
+				return true
+			}
+			continue
+		}
+		lower, upper := bounds[0], bounds[1]
+		if lower != "" {
+			c := compareMavenVersions(version, lower)
+			if c < 0 || (c == 0 && r[0] == '(') {
+				continue
+			}
+		}
+		if upper != "" {
+			c := compareMavenVersions(version, upper)
+			if c > 0 || (c == 0 && r[len(r)-1] == ')') {
+				continue
+			}
+		}
+		return true
+	}
+	return false
+}
+
+var mavenQualifiers = map[string]int{"alpha": 1, "a": 1, "beta": 2, "b": 2, "milestone": 3, "m": 3, "rc": 4, "cr": 4, "snapshot": 5, "": 6, "ga": 6, "final": 6, "release": 6, "sp": 7}
+
+// compareMavenVersions is a simplified version of Maven's ComparableVersion ordering
+func compareMavenVersions(a, b string) int {
+	pa, pb := splitMavenVersion(a), splitMavenVersion(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y string
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if c := compareMavenPart(x, y); c != 0 {
+			return c
+		}
+	}
+	return 0
+}
+
+func splitMavenVersion(v string) []string {
+	return mavenVersionParts.FindAllString(strings.ToLower(v), -1)
+}
+
+func compareMavenPart(x, y string) int {
+	nx, errX := strconv.Atoi(x)
+	ny, errY := strconv.Atoi(y)
+	switch {
+	case errX == nil && errY == nil:
+		return compareInts(nx, ny)
+	case errX == nil && y == "":
+		return compareInts(nx, 0)
+	case errY == nil && x == "":
+		return compareInts(0, ny)
+	case errX == nil:
+		return 1 // numbers are newer than qualifiers
+	case errY == nil:
+		return -1
+	}
+	qx, okX := mavenQualifiers[x]
+	qy, okY := mavenQualifiers[y]
+	switch {
+	case okX && okY:
+		return compareInts(qx, qy)
+	case okX:
+		return -1
+	case okY:
+		return 1
+	}
+	return strings.Compare(x, y)
+}
+
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
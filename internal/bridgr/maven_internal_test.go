@@ -0,0 +1,243 @@
+package bridgr
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var mavenRepoContent = map[string]string{
+	"/com/bluth/parent/1/parent-1.pom": `<project>
+  <groupId>com.bluth</groupId><artifactId>parent</artifactId><version>1</version><packaging>pom</packaging>
+  <properties><banana.version>2.0</banana.version></properties>
+  <dependencyManagement><dependencies>
+    <dependency><groupId>com.bluth</groupId><artifactId>bom</artifactId><version>3</version><type>pom</type><scope>import</scope></dependency>
+  </dependencies></dependencyManagement>
+</project>`,
+	"/com/bluth/bom/3/bom-3.pom": `<project>
+  <groupId>com.bluth</groupId><artifactId>bom</artifactId><version>3</version><packaging>pom</packaging>
+  <dependencyManagement><dependencies>
+    <dependency><groupId>com.bluth</groupId><artifactId>seal</artifactId><version>1.5</version></dependency>
+  </dependencies></dependencyManagement>
+</project>`,
+	"/com/bluth/stair-car/1.0/stair-car-1.0.pom": `<project>
+  <parent><groupId>com.bluth</groupId><artifactId>parent</artifactId><version>1</version></parent>
+  <artifactId>stair-car</artifactId><version>1.0</version>
+  <dependencies>
+    <dependency><groupId>com.bluth</groupId><artifactId>banana</artifactId><version>${banana.version}</version>
+      <exclusions><exclusion><groupId>com.bluth</groupId><artifactId>hop-on</artifactId></exclusion></exclusions>
+    </dependency>
+    <dependency><groupId>com.bluth</groupId><artifactId>seal</artifactId></dependency>
+    <dependency><groupId>com.bluth</groupId><artifactId>tests</artifactId><version>1</version><scope>test</scope></dependency>
+    <dependency><groupId>com.bluth</groupId><artifactId>optional</artifactId><version>1</version><optional>true</optional></dependency>
+  </dependencies>
+</project>`,
+	"/com/bluth/banana/2.0/banana-2.0.pom": `<project>
+  <groupId>com.bluth</groupId><artifactId>banana</artifactId><version>2.0</version>
+  <dependencies>
+    <dependency><groupId>com.bluth</groupId><artifactId>hop-on</artifactId><version>1</version></dependency>
+    <dependency><groupId>com.bluth</groupId><artifactId>seal</artifactId><version>[1.0,1.2)</version></dependency>
+  </dependencies>
+</project>`,
+	"/com/bluth/stair-car/0.9/stair-car-0.9.pom": `<project><groupId>com.bluth</groupId><artifactId>stair-car</artifactId><version>0.9</version></project>`,
+	"/com/bluth/cornballer/1.0/cornballer-1.0.pom": `<project>
+  <groupId>com.bluth</groupId><artifactId>cornballer</artifactId><version>1.0</version>
+  <dependencies>
+    <dependency><groupId>com.bluth</groupId><artifactId>seal</artifactId><version>1.5</version></dependency>
+    <dependency><groupId>com.bluth</groupId><artifactId>seal</artifactId><version>1.5</version><type>test-jar</type></dependency>
+  </dependencies>
+</project>`,
+	"/com/bluth/seal/1.5/seal-1.5.pom":        `<project><groupId>com.bluth</groupId><artifactId>seal</artifactId><version>1.5</version></project>`,
+	"/com/bluth/stair-car/maven-metadata.xml": `<metadata><versioning><release>1.0</release><versions><version>0.9</version><version>1.0</version></versions></versioning></metadata>`,
+}
+
+func mavenRepository() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if content, ok := mavenRepoContent[r.URL.Path]; ok {
+			fmt.Fprint(w, content)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, ".jar") {
+			fmt.Fprint(w, "jar content")
+			return
+		}
+		http.NotFound(w, r)
+	}))
+}
+
+func TestMavenDir(t *testing.T) {
+	expected := BaseDir("maven")
+	result := Maven{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestParseMavenArtifact(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		expect  MavenArtifact
+		isError bool
+	}{
+		{"name only", "junit", MavenArtifact{GroupID: "junit", ArtifactID: "junit"}, false},
+		{"name and version", "junit:4", MavenArtifact{GroupID: "junit", ArtifactID: "junit", Version: "4"}, false},
+		{"group and artifact", "commons-io:commons-io", MavenArtifact{GroupID: "commons-io", ArtifactID: "commons-io"}, false},
+		{"full", "com.bluth:stair-car:1.0:jar:sources", MavenArtifact{GroupID: "com.bluth", ArtifactID: "stair-car", Version: "1.0", Packaging: "jar", Classifier: "sources"}, false},
+		{"range", "com.bluth:stair-car:[1.0,2.0)", MavenArtifact{GroupID: "com.bluth", ArtifactID: "stair-car", Version: "[1.0,2.0)"}, false},
+		{"empty part", "com.bluth::1.0", MavenArtifact{}, true},
+		{"too many parts", "a:b:c:d:e:f", MavenArtifact{}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := parseMavenArtifact(test.input)
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestArrayToMaven(t *testing.T) {
+	input := []interface{}{"junit:4"}
+	result, err := arrayToMaven(reflect.TypeOf(input), reflect.TypeOf(Maven{}), input)
+	if err != nil {
+		t.Error(err)
+	}
+	expect := map[string]interface{}{"artifacts": input}
+	if !cmp.Equal(expect, result) {
+		t.Error(cmp.Diff(expect, result))
+	}
+
+	other, _ := arrayToMaven(reflect.TypeOf(""), reflect.TypeOf(Maven{}), "tobias")
+	if !cmp.Equal("tobias", other) {
+		t.Error(cmp.Diff("tobias", other))
+	}
+}
+
+func TestCompareMavenVersions(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		expect int
+	}{
+		{"1.0", "1.0.0", 0},
+		{"1.0", "1.1", -1},
+		{"1.10", "1.9", 1},
+		{"1.0-SNAPSHOT", "1.0", -1},
+		{"1.0-alpha-1", "1.0-beta-1", -1},
+		{"1.0-rc1", "1.0", -1},
+		{"1.0.1", "1.0-sp1", 1},
+		{"2.0", "2.0.Final", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.a+" "+test.b, func(t *testing.T) {
+			result := compareMavenVersions(test.a, test.b)
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestInMavenRange(t *testing.T) {
+	tests := []struct {
+		version string
+		spec    string
+		expect  bool
+	}{
+		{"1.0", "[1.0,2.0)", true},
+		{"2.0", "[1.0,2.0)", false},
+		{"1.0", "(1.0,2.0]", false},
+		{"2.0", "(1.0,2.0]", true},
+		{"3.0", "[1.0,)", true},
+		{"0.5", "(,1.0]", true},
+		{"1.1", "(,1.0],[1.2,)", false},
+		{"1.5", "(,1.0],[1.2,)", true},
+		{"1.5", "[1.5]", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.version+" "+test.spec, func(t *testing.T) {
+			result := inMavenRange(test.version, test.spec)
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestMavenRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := mavenRepository()
+	defer server.Close()
+
+	maven := Maven{Repositories: []string{server.URL + "/"}, Artifacts: []MavenArtifact{{GroupID: "com.bluth", ArtifactID: "stair-car"}}}
+	if err := maven.Run(); err != nil {
+		t.Error(err)
+	}
+
+	expectFiles := []string{
+		"com/bluth/stair-car/1.0/stair-car-1.0.pom",
+		"com/bluth/stair-car/1.0/stair-car-1.0.pom.sha1",
+		"com/bluth/stair-car/1.0/stair-car-1.0.jar",
+		"com/bluth/stair-car/1.0/stair-car-1.0.jar.md5",
+		"com/bluth/stair-car/maven-metadata.xml",
+		"com/bluth/stair-car/maven-metadata.xml.sha1",
+		"com/bluth/parent/1/parent-1.pom",
+		"com/bluth/bom/3/bom-3.pom",
+		"com/bluth/banana/2.0/banana-2.0.jar",
+		"com/bluth/seal/1.5/seal-1.5.jar",
+	}
+	for _, file := range expectFiles {
+		if _, err := os.Stat(path.Join(maven.dir(), file)); err != nil {
+			t.Errorf("expected %s to be written: %s", file, err)
+		}
+	}
+
+	unexpected := []string{"com/bluth/hop-on", "com/bluth/tests", "com/bluth/optional", "com/bluth/parent/1/parent-1.jar"}
+	for _, file := range unexpected {
+		if _, err := os.Stat(path.Join(maven.dir(), file)); err == nil {
+			t.Errorf("expected %s to not be written", file)
+		}
+	}
+}
+
+func TestMavenResolve(t *testing.T) {
+	server := mavenRepository()
+	defer server.Close()
+	maven := Maven{Repositories: []string{server.URL}}
+
+	roots := []MavenArtifact{
+		{GroupID: "com.bluth", ArtifactID: "cornballer", Version: "1.0"},
+		{GroupID: "com.bluth", ArtifactID: "stair-car", Version: "0.9"},
+		{GroupID: "com.bluth", ArtifactID: "stair-car", Version: "1.0"},
+		{GroupID: "com.bluth", ArtifactID: "stair-car", Version: "1.0"},
+	}
+	var resolved []string
+	for _, artifact := range newMavenResolver(&maven).resolve(roots) {
+		resolved = append(resolved, artifact.String())
+	}
+	expect := []string{
+		"com.bluth:cornballer:1.0",
+		"com.bluth:stair-car:0.9",
+		"com.bluth:stair-car:1.0",
+		"com.bluth:seal:1.5",
+		"com.bluth:seal:1.5:test-jar:tests",
+		"com.bluth:banana:2.0",
+	}
+	if !cmp.Equal(expect, resolved) {
+		t.Error(cmp.Diff(expect, resolved))
+	}
+}
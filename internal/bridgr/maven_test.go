@@ -0,0 +1,52 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMavenImage(t *testing.T) {
+	maven := bridgr.Maven{}
+	if maven.Image() != nil {
+		t.Errorf("expected nil, but got %+v", maven.Image())
+	}
+}
+
+func TestMavenName(t *testing.T) {
+	expected := "maven"
+	maven := bridgr.Maven{}
+	if !cmp.Equal(expected, maven.Name()) {
+		t.Error(cmp.Diff(expected, maven.Name()))
+	}
+}
+
+func TestMavenHook(t *testing.T) {
+	maven := bridgr.Maven{}
+	result := reflect.TypeOf(maven.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
+
+func TestMavenArtifactString(t *testing.T) {
+	tests := []struct {
+		name     string
+		artifact bridgr.MavenArtifact
+		expect   string
+	}{
+		{"simple", bridgr.MavenArtifact{GroupID: "com.bluth", ArtifactID: "stair-car", Version: "1.0"}, "com.bluth:stair-car:1.0"},
+		{"classifier", bridgr.MavenArtifact{GroupID: "com.bluth", ArtifactID: "stair-car", Version: "1.0", Packaging: "jar", Classifier: "sources"}, "com.bluth:stair-car:1.0:jar:sources"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if !cmp.Equal(test.expect, test.artifact.String()) {
+				t.Error(cmp.Diff(test.expect, test.artifact.String()))
+			}
+		})
+	}
+}
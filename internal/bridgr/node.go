@@ -1 +1,382 @@
 package bridgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/distribution/reference"
+	"github.com/mitchellh/mapstructure"
+	log "unknwon.dev/clog/v2"
+)
+
+const defaultNpmRegistry = "https://registry.npmjs.org"
+
+// Npm is the configuration object for creating a static npm registry
+type Npm struct {
+	NodeVersion string `mapstructure:"node_version"`
+	NpmVersion  string `mapstructure:"npm_version"`
+	Registry    string
+	Host        string
+	Packages    []npmPackage
+}
+
+type npmPackage struct {
+	Package string
+	Version string
+}
+
+// npmPackument is the registry document for a package, listing all of its published versions
+type npmPackument struct {
+	Name     string                     `json:"name"`
+	DistTags map[string]string          `json:"dist-tags"`
+	Versions map[string]json.RawMessage `json:"versions"`
+}
+
+// npmManifest holds the fields of a single version in a packument needed for resolving dependencies
+type npmManifest struct {
+	Name                 string                 `json:"name"`
+	Version              string                 `json:"version"`
+	Dependencies         map[string]string      `json:"dependencies"`
+	OptionalDependencies map[string]string      `json:"optionalDependencies"`
+	PeerDependencies     map[string]string      `json:"peerDependencies"`
+	PeerDependenciesMeta map[string]npmPeerMeta `json:"peerDependenciesMeta"`
+	Engines              json.RawMessage        `json:"engines"`
+	Dist                 struct {
+		Tarball string `json:"tarball"`
+	} `json:"dist"`
+}
+
+// npmPeerMeta is the metadata of a peer dependency, which may mark it optional
+type npmPeerMeta struct {
+	Optional bool `json:"optional"`
+}
+
+// engine gives the version range of the named engine. Very old packages used an array for engines, which are ignored.
+func (m npmManifest) engine(name string) string {
+	engines := map[string]string{}
+	_ = json.Unmarshal(m.Engines, &engines)
+	return engines[name]
+}
+
+func (np npmPackage) String() string {
+	if np.Version != "" {
+		return np.Package + "@" + np.Version
+	}
+	return np.Package
+}
+
+// dir is the top-level directory name for all objects written out under the Npm worker
+func (n Npm) dir() string {
+	return BaseDir(n.Name())
+}
+
+// Name returns the name of this Configuration
+func (n Npm) Name() string {
+	return "npm"
+}
+
+// Image implements the Imager interface
+func (n Npm) Image() reference.Named {
+	return nil
+}
+
+func stringToNpmPackage(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf(npmPackage{}) {
+		return data, nil
+	}
+	return npmPackage{Package: data.(string)}, nil
+}
+
+func arrayToNpm(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Slice || t != reflect.TypeOf(Npm{}) {
+		return data, nil
+	}
+	var pkgs []npmPackage
+	for _, p := range data.([]interface{}) {
+		if pkg, ok := p.(string); ok {
+			pkgs = append(pkgs, npmPackage{Package: pkg})
+		}
+	}
+	return Npm{Packages: pkgs}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (n *Npm) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		arrayToNpm,
+		stringToNpmPackage,
+	)
+}
+
+// Setup prepares the directory for the npm registry
+func (n *Npm) Setup() error {
+	log.Trace("Called Npm.Setup()")
+	if n.Registry == "" {
+		n.Registry = defaultNpmRegistry
+	}
+	n.Registry = strings.TrimSuffix(n.Registry, "/")
+	if n.Host == "" {
+		log.Warn("Npm: no host is configured, tarball URLs in index.json will be relative and must be rewritten before npm can use them")
+	}
+	return os.MkdirAll(n.dir(), os.ModePerm)
+}
+
+// Run resolves the configured packages and all of their dependencies, then writes the tarballs and
+// package documents so the npm directory can be used as a registry
+func (n *Npm) Run() error {
+	if err := n.Setup(); err != nil {
+		return err
+	}
+	resolver := newNpmResolver(n)
+	resolved := resolver.resolve(n.Packages)
+
+	names := make([]string, 0, len(resolved))
+	for name := range resolved {
+		names = append(names, name)
+	}
+	forEach(len(names), func(i int) {
+		name := names[i]
+		if err := n.writePackage(resolver.packument(name), resolved[name]); err != nil {
+			log.Info("Npm: unable to write package %s - %s", name, err)
+		}
+	})
+	return nil
+}
+
+// writePackage downloads the tarball of each resolved version, and writes a packument with those versions. Versions from earlier runs
+// are kept in the packument while their tarballs remain.
+func (n *Npm) writePackage(doc *npmPackument, versions map[string]bool) error {
+	out := npmPackument{Name: doc.Name, DistTags: map[string]string{}, Versions: map[string]json.RawMessage{}}
+	for version := range versions {
+		manifest := map[string]interface{}{}
+		if err := json.Unmarshal(doc.Versions[version], &manifest); err != nil {
+			return err
+		}
+		dist, _ := manifest["dist"].(map[string]interface{})
+		if dist == nil {
+			return fmt.Errorf("version %s has no dist information", version)
+		}
+		tarball, err := url.Parse(fmt.Sprint(dist["tarball"]))
+		if err != nil {
+			return err
+		}
+		file := path.Base(tarball.Path)
+		if err := download(tarball, path.Join(n.dir(), doc.Name, "-", file)); err != nil {
+			log.Info("Npm: unable to download %s - %s", tarball, err)
+			continue
+		}
+		dist["tarball"] = n.tarballURL(doc.Name, file)
+		raw, _ := json.Marshal(manifest)
+		out.Versions[version] = raw
+	}
+	if len(out.Versions) == 0 {
+		return fmt.Errorf("no versions were downloaded")
+	}
+
+	target := path.Join(n.dir(), doc.Name, "index.json")
+	if content, err := os.ReadFile(target); err == nil {
+		previous := npmPackument{}
+		if err := json.Unmarshal(content, &previous); err != nil {
+			log.Warn("Npm: unable to read the existing index of %s, it will only have the versions of this run - %s", doc.Name, err)
+			previous.Versions = nil
+		}
+		for version, raw := range previous.Versions {
+			manifest := npmManifest{}
+			if _, ok := out.Versions[version]; ok || json.Unmarshal(raw, &manifest) != nil {
+				continue
+			}
+			if _, err := os.Stat(path.Join(n.dir(), doc.Name, "-", path.Base(manifest.Dist.Tarball))); err == nil {
+				out.Versions[version] = raw
+			}
+		}
+	}
+
+	var latest *semver.Version
+	for version := range out.Versions {
+		if v, err := semver.NewVersion(version); err == nil && v.Prerelease() == "" && (latest == nil || v.GreaterThan(latest)) {
+			latest = v
+		}
+	}
+	for tag, version := range doc.DistTags {
+		if _, ok := out.Versions[version]; ok {
+			out.DistTags[tag] = version
+		}
+	}
+	if _, ok := out.DistTags["latest"]; !ok && latest != nil {
+		out.DistTags["latest"] = latest.Original()
+	}
+
+	index, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+	return json.NewEncoder(index).Encode(out)
+}
+
+// tarballURL gives the location of a tarball when the registry is hosted by Bridgr
+func (n *Npm) tarballURL(name, file string) string {
+	return strings.TrimSuffix(n.Host, "/") + "/" + path.Join(n.Name(), name, "-", file)
+}
+
+type npmResolver struct {
+	npm      *Npm
+	mu       sync.Mutex
+	docs     map[string]*npmPackument
+	resolved map[string]map[string]bool
+}
+
+func newNpmResolver(n *Npm) *npmResolver {
+	return &npmResolver{
+		npm:      n,
+		docs:     map[string]*npmPackument{},
+		resolved: map[string]map[string]bool{},
+	}
+}
+
+func (r *npmResolver) packument(name string) *npmPackument {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.docs[name]
+}
+
+// resolve walks the dependency tree of the given packages, one level at a time. It returns the resolved versions for each package name.
+func (r *npmResolver) resolve(pkgs []npmPackage) map[string]map[string]bool {
+	queue := pkgs
+	for len(queue) > 0 {
+		next := make([][]npmPackage, len(queue))
+		forEach(len(queue), func(i int) {
+			deps, err := r.visit(queue[i])
+			if err != nil {
+				log.Info("Npm: unable to resolve %s - %s", queue[i], err)
+				return
+			}
+			next[i] = deps
+		})
+		queue = queue[:0:0]
+		for _, deps := range next {
+			queue = append(queue, deps...)
+		}
+	}
+	return r.resolved
+}
+
+// visit resolves a single package spec, returning its dependencies when this version has not been seen before
+func (r *npmResolver) visit(pkg npmPackage) ([]npmPackage, error) {
+	doc, err := r.fetch(pkg.Package)
+	if err != nil {
+		return nil, err
+	}
+	version, err := r.npm.pickVersion(doc, pkg.Version)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	if r.resolved[pkg.Package] == nil {
+		r.resolved[pkg.Package] = map[string]bool{}
+	}
+	seen := r.resolved[pkg.Package][version]
+	r.resolved[pkg.Package][version] = true
+	r.mu.Unlock()
+	if seen {
+		return nil, nil
+	}
+
+	manifest := npmManifest{}
+	if err := json.Unmarshal(doc.Versions[version], &manifest); err != nil {
+		return nil, err
+	}
+	log.Trace("Npm: resolved %s to %s", pkg, version)
+	var deps []npmPackage
+	for _, depList := range []map[string]string{manifest.Dependencies, manifest.OptionalDependencies} {
+		for name, spec := range depList {
+			deps = append(deps, npmPackage{Package: name, Version: spec})
+		}
+	}
+	// npm 7 and later install peer dependencies, unless they are marked optional
+	for name, spec := range manifest.PeerDependencies {
+		if !manifest.PeerDependenciesMeta[name].Optional {
+			deps = append(deps, npmPackage{Package: name, Version: spec})
+		}
+	}
+	return deps, nil
+}
+
+func (r *npmResolver) fetch(name string) (*npmPackument, error) {
+	if doc := r.packument(name); doc != nil {
+		return doc, nil
+	}
+	doc := &npmPackument{}
+	// scoped packages keep their "@", but the slash must be escaped
+	if err := getJSON(r.npm.Registry+"/"+strings.Replace(name, "/", "%2f", 1), doc); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.docs[name]; ok {
+		return existing, nil
+	}
+	r.docs[name] = doc
+	return doc, nil
+}
+
+// pickVersion chooses the highest version in the packument that satisfies spec. Spec may be a semver range or a dist-tag.
+// Versions that declare an engine incompatible with the configured node_version or npm_version are only used when nothing else matches.
+func (n *Npm) pickVersion(doc *npmPackument, spec string) (string, error) {
+	spec = strings.TrimSpace(spec)
+	if spec == "" || spec == "*" || spec == "x" {
+		spec = "latest"
+	}
+	if tagged, ok := doc.DistTags[spec]; ok {
+		return tagged, nil
+	}
+	constraint, err := semver.NewConstraint(spec)
+	if err != nil {
+		return "", fmt.Errorf("unsupported version specification %q", spec)
+	}
+
+	var candidates []*semver.Version
+	for v := range doc.Versions {
+		version, err := semver.NewVersion(v)
+		if err != nil || !constraint.Check(version) {
+			continue
+		}
+		candidates = append(candidates, version)
+	}
+	if len(candidates) == 0 {
+		return "", fmt.Errorf("no version matches %q", spec)
+	}
+	sort.Sort(sort.Reverse(semver.Collection(candidates)))
+	for _, version := range candidates {
+		manifest := npmManifest{}
+		_ = json.Unmarshal(doc.Versions[version.Original()], &manifest)
+		if n.engineAllowed(manifest.engine("node"), n.NodeVersion) && n.engineAllowed(manifest.engine("npm"), n.NpmVersion) {
+			return version.Original(), nil
+		}
+	}
+	return candidates[0].Original(), nil
+}
+
+func (n *Npm) engineAllowed(engine, configured string) bool {
+	if engine == "" || configured == "" {
+		return true
+	}
+	constraint, err := semver.NewConstraint(engine)
+	if err != nil {
+		return true
+	}
+	version, err := semver.NewVersion(configured)
+	if err != nil {
+		return true
+	}
+	return constraint.Check(version)
+}
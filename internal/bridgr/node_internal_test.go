@@ -0,0 +1,261 @@
+package bridgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func npmRegistry() *httptest.Server {
+	version := func(base, name, version string, deps map[string]string, engines string) json.RawMessage {
+		tarball := fmt.Sprintf("%s/%s/-/%s-%s.tgz", base, name, path.Base(name), version)
+		doc := fmt.Sprintf(`{"name":%q,"version":%q,"dependencies":%s,"engines":%s,"dist":{"tarball":%q}}`, name, version, mustJSON(deps), engines, tarball)
+		return json.RawMessage(doc)
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base := "http://" + r.Host
+		docs := map[string]npmPackument{
+			"/loose-seal": {
+				Name:     "loose-seal",
+				DistTags: map[string]string{"latest": "1.1.0"},
+				Versions: map[string]json.RawMessage{
+					"1.0.0": version(base, "loose-seal", "1.0.0", nil, "{}"),
+					"1.1.0": version(base, "loose-seal", "1.1.0", map[string]string{"@bluth/stair-car": "^2.0.0"}, "{}"),
+				},
+			},
+			"/@bluth%2fstair-car": {
+				Name:     "@bluth/stair-car",
+				DistTags: map[string]string{"latest": "2.1.0"},
+				Versions: map[string]json.RawMessage{
+					"2.0.0": version(base, "@bluth/stair-car", "2.0.0", nil, `{"node":">=4"}`),
+					"2.1.0": version(base, "@bluth/stair-car", "2.1.0", nil, `{"node":">=12"}`),
+				},
+			},
+		}
+		docs["/cornballer"] = npmPackument{
+			Name:     "cornballer",
+			DistTags: map[string]string{"latest": "1.0.0"},
+			Versions: map[string]json.RawMessage{"1.0.0": json.RawMessage(`{"name":"cornballer","version":"1.0.0",` +
+				`"peerDependencies":{"loose-seal":"^1.0.0","@bluth/frozen":"^1.0.0"},"peerDependenciesMeta":{"@bluth/frozen":{"optional":true}},` +
+				`"dist":{"tarball":"` + base + `/cornballer/-/cornballer-1.0.0.tgz"}}`)},
+		}
+		if strings.HasSuffix(r.URL.Path, ".tgz") {
+			fmt.Fprint(w, "tarball")
+			return
+		}
+		doc, ok := docs[r.URL.EscapedPath()]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(doc)
+	}))
+}
+
+func mustJSON(v interface{}) string {
+	out, _ := json.Marshal(v)
+	return string(out)
+}
+
+func TestNpmDir(t *testing.T) {
+	expected := BaseDir("npm")
+	result := Npm{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestArrayToNpm(t *testing.T) {
+	tests := []struct {
+		name   string
+		target reflect.Type
+		input  interface{}
+		expect interface{}
+	}{
+		{"invalid target", reflect.TypeOf(4.23), "banana", "banana"},
+		{"invalid input", reflect.TypeOf(Npm{}), 33, 33},
+		{"valid", reflect.TypeOf(Npm{}), []interface{}{"stand", "cornballer"}, Npm{Packages: []npmPackage{{Package: "stand"}, {Package: "cornballer"}}}},
+		{"invalid array", reflect.TypeOf(Npm{}), []interface{}{83, 9.4822}, Npm{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := arrayToNpm(reflect.TypeOf(test.input), test.target, test.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestStringToNpmPackage(t *testing.T) {
+	result, err := stringToNpmPackage(reflect.TypeOf(""), reflect.TypeOf(npmPackage{}), "frozen-banana")
+	if err != nil {
+		t.Error(err)
+	}
+	if !cmp.Equal(npmPackage{Package: "frozen-banana"}, result) {
+		t.Error(cmp.Diff(npmPackage{Package: "frozen-banana"}, result))
+	}
+	other, _ := stringToNpmPackage(reflect.TypeOf(42), reflect.TypeOf(npmPackage{}), 42)
+	if !cmp.Equal(42, other) {
+		t.Error(cmp.Diff(42, other))
+	}
+}
+
+func TestNpmPickVersion(t *testing.T) {
+	doc := &npmPackument{
+		DistTags: map[string]string{"latest": "1.2.0", "next": "2.0.0-beta.1"},
+		Versions: map[string]json.RawMessage{
+			"1.0.0":        json.RawMessage(`{"engines":{"node":">=0.10"}}`),
+			"1.2.0":        json.RawMessage(`{"engines":{"node":">=8"}}`),
+			"1.3.0":        json.RawMessage(`{"engines":["node >= 0.4"]}`),
+			"2.0.0-beta.1": json.RawMessage(`{}`),
+		},
+	}
+	tests := []struct {
+		name    string
+		node    string
+		spec    string
+		expect  string
+		isError bool
+	}{
+		{"empty is latest", "", "", "1.2.0", false},
+		{"dist tag", "", "next", "2.0.0-beta.1", false},
+		{"caret range", "", "^1.0.0", "1.3.0", false},
+		{"exact", "", "1.0.0", "1.0.0", false},
+		{"tilde range", "6.0", "~1.2.0", "1.2.0", false},
+		{"engine filter", "6.0", "1.0.0 - 1.2.0", "1.0.0", false},
+		{"no match", "", ">=3", "", true},
+		{"git url", "", "git+https://github.com/bluth/banana.git", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			npm := Npm{NodeVersion: test.node}
+			result, err := npm.pickVersion(doc, test.spec)
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestNpmTarballURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		host   string
+		expect string
+	}{
+		{"relative", "", "/npm/@bluth/stair-car/-/stair-car-1.0.0.tgz"},
+		{"hosted", "http://bridgr.bluth.com:8080/", "http://bridgr.bluth.com:8080/npm/@bluth/stair-car/-/stair-car-1.0.0.tgz"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			npm := Npm{Host: test.host}
+			result := npm.tarballURL("@bluth/stair-car", "stair-car-1.0.0.tgz")
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestNpmRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := npmRegistry()
+	defer server.Close()
+
+	npm := Npm{Registry: server.URL, NodeVersion: "10.0", Packages: []npmPackage{{Package: "loose-seal"}, {Package: "missing"}}}
+	if err := npm.Run(); err != nil {
+		t.Error(err)
+	}
+
+	expectFiles := []string{
+		"loose-seal/index.json",
+		"loose-seal/-/loose-seal-1.1.0.tgz",
+		"@bluth/stair-car/index.json",
+		"@bluth/stair-car/-/stair-car-2.0.0.tgz",
+	}
+	for _, file := range expectFiles {
+		if _, err := os.Stat(path.Join(npm.dir(), file)); err != nil {
+			t.Errorf("expected %s to be written: %s", file, err)
+		}
+	}
+
+	content, _ := os.ReadFile(path.Join(npm.dir(), "@bluth/stair-car/index.json"))
+	doc := npmPackument{}
+	if err := json.Unmarshal(content, &doc); err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal(map[string]string{"latest": "2.0.0"}, doc.DistTags) {
+		t.Error(cmp.Diff(map[string]string{"latest": "2.0.0"}, doc.DistTags))
+	}
+	if !strings.Contains(string(doc.Versions["2.0.0"]), `"tarball":"/npm/@bluth/stair-car/-/stair-car-2.0.0.tgz"`) {
+		t.Errorf("expected tarball to be rewritten, got %s", doc.Versions["2.0.0"])
+	}
+}
+
+func TestNpmPeerDependencies(t *testing.T) {
+	server := npmRegistry()
+	defer server.Close()
+
+	npm := Npm{Registry: server.URL}
+	resolved := newNpmResolver(&npm).resolve([]npmPackage{{Package: "cornballer"}})
+	if _, ok := resolved["loose-seal"]; !ok {
+		t.Error("expected a peer dependency to be resolved")
+	}
+	if _, ok := resolved["@bluth/frozen"]; ok {
+		t.Error("expected an optional peer dependency to not be resolved")
+	}
+}
+
+func TestNpmWritePackageMerge(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := npmRegistry()
+	defer server.Close()
+
+	versions := func() []string {
+		content, _ := os.ReadFile(path.Join(BaseDir("npm"), "loose-seal", "index.json"))
+		doc := npmPackument{}
+		_ = json.Unmarshal(content, &doc)
+		var list []string
+		for version := range doc.Versions {
+			list = append(list, version)
+		}
+		sort.Strings(list)
+		return list
+	}
+	run := func(version string) {
+		npm := Npm{Registry: server.URL, Packages: []npmPackage{{Package: "loose-seal", Version: version}}}
+		if err := npm.Run(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("1.0.0")
+	run("1.1.0")
+	if expect := []string{"1.0.0", "1.1.0"}; !cmp.Equal(expect, versions()) {
+		t.Error(cmp.Diff(expect, versions()))
+	}
+	_ = os.Remove(path.Join(BaseDir("npm"), "loose-seal", "-", "loose-seal-1.0.0.tgz"))
+	run("1.1.0")
+	if expect := []string{"1.1.0"}; !cmp.Equal(expect, versions()) {
+		t.Error(cmp.Diff(expect, versions()))
+	}
+}
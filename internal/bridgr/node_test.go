@@ -0,0 +1,33 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNpmImage(t *testing.T) {
+	npm := bridgr.Npm{}
+	if npm.Image() != nil {
+		t.Errorf("expected nil, but got %+v", npm.Image())
+	}
+}
+
+func TestNpmName(t *testing.T) {
+	expected := "npm"
+	npm := bridgr.Npm{}
+	if !cmp.Equal(expected, npm.Name()) {
+		t.Error(cmp.Diff(expected, npm.Name()))
+	}
+}
+
+func TestNpmHook(t *testing.T) {
+	npm := bridgr.Npm{}
+	result := reflect.TypeOf(npm.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
@@ -0,0 +1,604 @@
+package bridgr
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/distribution/reference"
+	"github.com/mitchellh/mapstructure"
+	log "unknwon.dev/clog/v2"
+)
+
+const (
+	defaultNugetSource      = "https://api.nuget.org/v3/index.json"
+	nugetPackageBaseAddress = "PackageBaseAddress/3.0.0"
+)
+
+var (
+	nugetRange     = regexp.MustCompile(`^([\[(])([^,]*)(,?)([^,]*)([\])])$`)
+	nugetFramework = regexp.MustCompile(`^\.?(netstandard|netcoreapp|netframework|net)([0-9.]*)`)
+)
+
+// Nuget is the configuration object for creating a static NuGet v3 feed
+type Nuget struct {
+	Source     string
+	Host       string
+	Frameworks []string
+	Packages   []nugetPackage
+}
+
+type nugetPackage struct {
+	Package string
+	Version string
+}
+
+type nugetServiceIndex struct {
+	Version   string          `json:"version"`
+	Resources []nugetResource `json:"resources"`
+}
+
+type nugetResource struct {
+	ID   string `json:"@id"`
+	Type string `json:"@type"`
+}
+
+// nuspec is the package manifest, with the fields needed for resolving dependencies
+type nuspec struct {
+	Metadata struct {
+		ID           string `xml:"id"`
+		Version      string `xml:"version"`
+		Dependencies struct {
+			Dependencies []nuspecDependency `xml:"dependency"`
+			Groups       []nuspecGroup      `xml:"group"`
+		} `xml:"dependencies"`
+	} `xml:"metadata"`
+}
+
+type nuspecGroup struct {
+	TargetFramework string             `xml:"targetFramework,attr" json:"targetFramework,omitempty"`
+	Dependencies    []nuspecDependency `xml:"dependency" json:"dependencies"`
+}
+
+type nuspecDependency struct {
+	ID      string `xml:"id,attr" json:"id"`
+	Version string `xml:"version,attr" json:"range"`
+}
+
+func (np nugetPackage) String() string {
+	if np.Version != "" {
+		return np.Package + "@" + np.Version
+	}
+	return np.Package
+}
+
+// groups gives the dependency groups of a nuspec. Dependencies outside of a group apply to every framework.
+func (n nuspec) groups() []nuspecGroup {
+	groups := n.Metadata.Dependencies.Groups
+	if len(n.Metadata.Dependencies.Dependencies) > 0 {
+		groups = append(groups, nuspecGroup{Dependencies: n.Metadata.Dependencies.Dependencies})
+	}
+	return groups
+}
+
+// dir is the top-level directory name for all objects written out under the Nuget worker
+func (n Nuget) dir() string {
+	return BaseDir(n.Name())
+}
+
+// Name returns the name of this Configuration
+func (n Nuget) Name() string {
+	return "nuget"
+}
+
+// Image implements the Imager interface
+func (n Nuget) Image() reference.Named {
+	return nil
+}
+
+func stringToNugetPackage(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf(nugetPackage{}) {
+		return data, nil
+	}
+	parts := strings.SplitN(data.(string), "@", 2)
+	pkg := nugetPackage{Package: parts[0]}
+	if len(parts) > 1 {
+		pkg.Version = parts[1]
+	}
+	return pkg, nil
+}
+
+func arrayToNuget(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Slice || t != reflect.TypeOf(Nuget{}) {
+		return data, nil
+	}
+	return map[string]interface{}{"packages": data}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (n *Nuget) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		arrayToNuget,
+		stringToNugetPackage,
+	)
+}
+
+// Setup prepares the directory for the NuGet feed
+func (n *Nuget) Setup() error {
+	log.Trace("Called Nuget.Setup()")
+	if n.Source == "" {
+		n.Source = defaultNugetSource
+	}
+	if n.Host == "" {
+		log.Warn("Nuget: no host is configured, resource URLs in index.json will be relative and must be rewritten before NuGet can use them")
+	}
+	return os.MkdirAll(n.dir(), os.ModePerm)
+}
+
+// Run resolves the configured packages and their dependencies for each framework, downloads them,
+// and writes the service index, flat container and registrations of the feed
+func (n *Nuget) Run() error {
+	if err := n.Setup(); err != nil {
+		return err
+	}
+	upstream := nugetServiceIndex{}
+	if err := getJSON(n.Source, &upstream); err != nil {
+		return fmt.Errorf("unable to read service index %s: %s", n.Source, err)
+	}
+	base := ""
+	for _, resource := range upstream.Resources {
+		if resource.Type == nugetPackageBaseAddress {
+			base = strings.TrimSuffix(resource.ID, "/")
+		}
+	}
+	if base == "" {
+		return fmt.Errorf("service index %s has no %s resource", n.Source, nugetPackageBaseAddress)
+	}
+
+	resolver := nugetResolver{nuget: n, base: base, versions: map[string][]string{}}
+	resolved := resolver.resolve(n.Packages)
+	forEach(len(resolved), func(i int) {
+		id, version := resolved[i][0], resolved[i][1]
+		if err := n.fetch(base, id, version, ".nupkg"); err != nil {
+			log.Info("Nuget: unable to download %s %s - %s", id, version, err)
+		}
+	})
+	ids := map[string]bool{}
+	for _, pkg := range resolved {
+		ids[strings.ToLower(pkg[0])] = true
+	}
+	for id := range ids {
+		if err := n.writePackageIndexes(id); err != nil {
+			log.Info("Nuget: unable to write indexes for %s - %s", id, err)
+		}
+	}
+	return n.writeServiceIndex()
+}
+
+// url gives the location of a path in the feed when it is hosted by Bridgr
+func (n *Nuget) url(parts ...string) string {
+	return strings.TrimSuffix(n.Host, "/") + "/" + path.Join(append([]string{n.Name()}, parts...)...)
+}
+
+// file gives the location of a package file in the flat container
+func (n *Nuget) file(id, version, ext string) string {
+	id, version = strings.ToLower(id), strings.ToLower(version)
+	name := id + "." + version + ext
+	if ext == ".nuspec" {
+		name = id + ext
+	}
+	return path.Join(n.dir(), "v3-flatcontainer", id, version, name)
+}
+
+// fetch downloads a package file from the upstream flat container, unless it's already been downloaded
+func (n *Nuget) fetch(base, id, version, ext string) error {
+	target := n.file(id, version, ext)
+	if _, err := os.Stat(target); err == nil {
+		return lockExisting(target)
+	}
+	source, err := url.Parse(base + strings.TrimPrefix(target, path.Join(n.dir(), "v3-flatcontainer")))
+	if err != nil {
+		return err
+	}
+	return download(source, target)
+}
+
+func (n *Nuget) writeJSON(file string, doc interface{}) error {
+	if err := os.MkdirAll(path.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	content, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, content, 0644) //nolint:gosec // repository content is meant to be readable
+}
+
+// writeServiceIndex writes the index.json that NuGet clients use as the feed's source URL
+func (n *Nuget) writeServiceIndex() error {
+	flat := n.url("v3-flatcontainer") + "/"
+	registration := n.url("registration") + "/"
+	index := nugetServiceIndex{
+		Version: "3.0.0",
+		Resources: []nugetResource{
+			{ID: flat, Type: nugetPackageBaseAddress},
+			{ID: registration, Type: "RegistrationsBaseUrl"},
+			{ID: registration, Type: "RegistrationsBaseUrl/3.0.0-beta"},
+			{ID: registration, Type: "RegistrationsBaseUrl/3.0.0-rc"},
+			{ID: registration, Type: "RegistrationsBaseUrl/3.4.0"},
+			{ID: registration, Type: "RegistrationsBaseUrl/3.6.0"},
+		},
+	}
+	return n.writeJSON(path.Join(n.dir(), "index.json"), index)
+}
+
+// writePackageIndexes writes the flat container version list and the registration of a package. Every downloaded version of the
+// package is included, so versions from earlier runs stay in the feed.
+func (n *Nuget) writePackageIndexes(id string) error {
+	id = strings.ToLower(id)
+	dirs, err := filepath.Glob(path.Join(n.dir(), "v3-flatcontainer", id, "*", "*.nupkg"))
+	if err != nil {
+		return err
+	}
+	var versions []string
+	for _, file := range dirs {
+		versions = append(versions, path.Base(path.Dir(file)))
+	}
+	if len(versions) == 0 {
+		return errors.New("no versions have been downloaded")
+	}
+	sort.Slice(versions, func(i, j int) bool { return compareNugetVersions(versions[i], versions[j]) < 0 })
+	if err := n.writeJSON(path.Join(n.dir(), "v3-flatcontainer", id, "index.json"), map[string][]string{"versions": versions}); err != nil {
+		return err
+	}
+
+	leaves := make([]map[string]interface{}, 0, len(versions))
+	for _, version := range versions {
+		spec, err := readNuspec(n.file(id, version, ".nuspec"))
+		if err != nil {
+			return err
+		}
+		leaf := map[string]interface{}{
+			"@id":            n.url("registration", id, version+".json"),
+			"@type":          "Package",
+			"packageContent": n.url("v3-flatcontainer", id, version, id+"."+version+".nupkg"),
+			"registration":   n.url("registration", id, "index.json"),
+			"catalogEntry": map[string]interface{}{
+				"@id":              n.url("registration", id, version+".json"),
+				"@type":            "PackageDetails",
+				"id":               spec.Metadata.ID,
+				"version":          spec.Metadata.Version,
+				"listed":           true,
+				"packageContent":   n.url("v3-flatcontainer", id, version, id+"."+version+".nupkg"),
+				"dependencyGroups": spec.groups(),
+			},
+		}
+		if err := n.writeJSON(path.Join(n.dir(), "registration", id, version+".json"), leaf); err != nil {
+			return err
+		}
+		leaves = append(leaves, leaf)
+	}
+	registration := map[string]interface{}{
+		"@id":   n.url("registration", id, "index.json"),
+		"count": 1,
+		"items": []map[string]interface{}{{
+			"@id":   n.url("registration", id, "index.json") + "#page/" + versions[0] + "/" + versions[len(versions)-1],
+			"count": len(leaves),
+			"lower": versions[0],
+			"upper": versions[len(versions)-1],
+			"items": leaves,
+		}},
+	}
+	return n.writeJSON(path.Join(n.dir(), "registration", id, "index.json"), registration)
+}
+
+type nugetResolver struct {
+	nuget    *Nuget
+	base     string
+	mu       sync.Mutex
+	versions map[string][]string
+}
+
+// resolve gives the id and version of every package needed. The configured packages use the newest version matching their range,
+// and dependencies use the lowest matching version, the same as NuGet restore does.
+func (r *nugetResolver) resolve(packages []nugetPackage) [][2]string {
+	type request struct {
+		id, spec string
+		lowest   bool
+	}
+	var queue []request
+	for _, pkg := range packages {
+		queue = append(queue, request{id: pkg.Package, spec: pkg.Version})
+	}
+	seen := map[string]bool{}
+	var resolved [][2]string
+	for len(queue) > 0 {
+		picked := make([]string, len(queue))
+		forEach(len(queue), func(i int) {
+			version, err := r.pick(queue[i].id, queue[i].spec, queue[i].lowest)
+			if err != nil {
+				log.Info("Nuget: unable to resolve %s %s - %s", queue[i].id, queue[i].spec, err)
+				return
+			}
+			picked[i] = version
+		})
+		var level [][2]string
+		for i, req := range queue {
+			key := strings.ToLower(req.id) + "@" + picked[i]
+			if picked[i] == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			level = append(level, [2]string{req.id, picked[i]})
+		}
+		resolved = append(resolved, level...)
+
+		deps := make([][]nuspecDependency, len(level))
+		forEach(len(level), func(i int) {
+			spec, err := r.nuspec(level[i][0], level[i][1])
+			if err != nil {
+				log.Info("Nuget: unable to read nuspec of %s %s - %s", level[i][0], level[i][1], err)
+				return
+			}
+			deps[i] = r.nuget.dependencies(spec)
+		})
+		queue = queue[:0:0]
+		for _, list := range deps {
+			for _, dep := range list {
+				queue = append(queue, request{id: dep.ID, spec: dep.Version, lowest: true})
+			}
+		}
+	}
+	return resolved
+}
+
+// pick chooses a version of the package from the upstream flat container. Pre-release versions are only used when the range includes one.
+func (r *nugetResolver) pick(id, spec string, lowest bool) (string, error) {
+	versions, err := r.list(id)
+	if err != nil {
+		return "", err
+	}
+	prerelease := strings.Contains(spec, "-")
+	var candidates []string
+	for _, version := range versions {
+		if (!prerelease && strings.Contains(version, "-")) || !inNugetRange(version, spec) {
+			continue
+		}
+		candidates = append(candidates, version)
+	}
+	if len(candidates) == 0 {
+		return "", errors.New("no matching version")
+	}
+	sort.Slice(candidates, func(i, j int) bool { return compareNugetVersions(candidates[i], candidates[j]) < 0 })
+	if lowest {
+		return candidates[0], nil
+	}
+	return candidates[len(candidates)-1], nil
+}
+
+// list gets the versions of a package in the upstream flat container
+func (r *nugetResolver) list(id string) ([]string, error) {
+	id = strings.ToLower(id)
+	r.mu.Lock()
+	versions, ok := r.versions[id]
+	r.mu.Unlock()
+	if ok {
+		return versions, nil
+	}
+	index := struct {
+		Versions []string `json:"versions"`
+	}{}
+	if err := getJSON(r.base+"/"+id+"/index.json", &index); err != nil {
+		return nil, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.versions[id] = index.Versions
+	return index.Versions, nil
+}
+
+// nuspec downloads and reads the nuspec of a package version
+func (r *nugetResolver) nuspec(id, version string) (*nuspec, error) {
+	if err := r.nuget.fetch(r.base, id, version, ".nuspec"); err != nil {
+		return nil, err
+	}
+	return readNuspec(r.nuget.file(id, version, ".nuspec"))
+}
+
+func readNuspec(file string) (*nuspec, error) {
+	in, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	spec := &nuspec{}
+	return spec, xml.NewDecoder(in).Decode(spec)
+}
+
+// dependencies gives the dependencies of a package for the configured frameworks. When no frameworks are configured, every
+// dependency group is used.
+func (n *Nuget) dependencies(spec *nuspec) []nuspecDependency {
+	groups := spec.groups()
+	if len(n.Frameworks) == 0 {
+		var all []nuspecDependency
+		for _, group := range groups {
+			all = append(all, group.Dependencies...)
+		}
+		return all
+	}
+	var deps []nuspecDependency
+	for _, framework := range n.Frameworks {
+		if group := nearestNugetGroup(framework, groups); group != nil {
+			deps = append(deps, group.Dependencies...)
+		}
+	}
+	return deps
+}
+
+// parseNugetFramework gives the family and version of a target framework moniker, in either the short ("net8.0", "net472") or
+// long (".NETStandard2.0") form. .NET 5 and later are the same family as .NET Core.
+func parseNugetFramework(tfm string) (string, string) {
+	match := nugetFramework.FindStringSubmatch(strings.ToLower(tfm))
+	if match == nil {
+		return "", ""
+	}
+	family, version := match[1], match[2]
+	if family == "net" {
+		if !strings.Contains(version, ".") && len(version) > 1 {
+			return "netframework", strings.Join(strings.Split(version, ""), ".")
+		}
+		if compareNugetVersions(version, "5") >= 0 {
+			return "netcoreapp", version
+		}
+		return "netframework", version
+	}
+	return family, version
+}
+
+// netstandardSupport is the highest .NET Standard version supported by versions of other frameworks
+func netstandardSupport(family, version string) string {
+	switch {
+	case family == "netcoreapp" && compareNugetVersions(version, "3.0") >= 0:
+		return "2.1"
+	case family == "netcoreapp" && compareNugetVersions(version, "2.0") >= 0:
+		return "2.0"
+	case family == "netcoreapp":
+		return "1.6"
+	case family == "netframework" && compareNugetVersions(version, "4.6.1") >= 0:
+		return "2.0"
+	case family == "netframework" && compareNugetVersions(version, "4.5") >= 0:
+		return "1.1"
+	}
+	return ""
+}
+
+// nearestNugetGroup chooses the dependency group that NuGet would use for the framework: the highest compatible version of the same
+// framework, then the highest compatible .NET Standard, then a group for any framework
+func nearestNugetGroup(framework string, groups []nuspecGroup) *nuspecGroup {
+	family, version := parseNugetFramework(framework)
+	standard := netstandardSupport(family, version)
+	if family == "netstandard" {
+		standard = version
+	}
+	var same, netstandard, anyFramework *nuspecGroup
+	var sameVersion, standardVersion string
+	for i, group := range groups {
+		if group.TargetFramework == "" {
+			anyFramework = &groups[i]
+			continue
+		}
+		gFamily, gVersion := parseNugetFramework(group.TargetFramework)
+		switch {
+		case gFamily == family && compareNugetVersions(gVersion, version) <= 0:
+			if same == nil || compareNugetVersions(gVersion, sameVersion) > 0 {
+				same, sameVersion = &groups[i], gVersion
+			}
+		case gFamily == "netstandard" && standard != "" && compareNugetVersions(gVersion, standard) <= 0:
+			if netstandard == nil || compareNugetVersions(gVersion, standardVersion) > 0 {
+				netstandard, standardVersion = &groups[i], gVersion
+			}
+		}
+	}
+	switch {
+	case same != nil:
+		return same
+	case netstandard != nil:
+		return netstandard
+	}
+	return anyFramework
+}
+
+// inNugetRange checks a version against a NuGet version range. A bare version is a minimum, ie "1.0" is "[1.0, )".
+func inNugetRange(version, spec string) bool {
+	spec = strings.ReplaceAll(spec, " ", "")
+	if spec == "" {
+		return true
+	}
+	match := nugetRange.FindStringSubmatch(spec)
+	if match == nil {
+		return compareNugetVersions(version, spec) >= 0
+	}
+	lower, comma, upper := match[2], match[3], match[4]
+	if comma == "" {
+		return compareNugetVersions(version, lower) == 0
+	}
+	if lower != "" {
+		c := compareNugetVersions(version, lower)
+		if c < 0 || (c == 0 && match[1] == "(") {
+			return false
+		}
+	}
+	if upper != "" {
+		c := compareNugetVersions(version, upper)
+		if c > 0 || (c == 0 && match[5] == ")") {
+			return false
+		}
+	}
+	return true
+}
+
+// compareNugetVersions orders NuGet versions, which have up to four numeric parts and an optional pre-release label
+func compareNugetVersions(a, b string) int {
+	a, b = strings.SplitN(a, "+", 2)[0], strings.SplitN(b, "+", 2)[0]
+	partsA, preA := splitNugetVersion(a)
+	partsB, preB := splitNugetVersion(b)
+	for i := 0; i < 4; i++ {
+		if partsA[i] != partsB[i] {
+			if partsA[i] < partsB[i] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case preA == preB:
+		return 0
+	case preA == "":
+		return 1
+	case preB == "":
+		return -1
+	}
+	labelsA, labelsB := strings.Split(preA, "."), strings.Split(preB, ".")
+	for i := 0; i < len(labelsA) && i < len(labelsB); i++ {
+		x, errX := strconv.Atoi(labelsA[i])
+		y, errY := strconv.Atoi(labelsB[i])
+		switch {
+		case errX == nil && errY == nil && x != y:
+			if x < y {
+				return -1
+			}
+			return 1
+		case errX == nil && errY != nil:
+			return -1
+		case errX != nil && errY == nil:
+			return 1
+		}
+		if c := strings.Compare(strings.ToLower(labelsA[i]), strings.ToLower(labelsB[i])); c != 0 {
+			return c
+		}
+	}
+	return len(labelsA) - len(labelsB)
+}
+
+func splitNugetVersion(version string) ([4]int, string) {
+	parts := [4]int{}
+	release, prerelease := version, ""
+	if i := strings.Index(version, "-"); i >= 0 {
+		release, prerelease = version[:i], version[i+1:]
+	}
+	for i, part := range strings.SplitN(release, ".", 4) {
+		parts[i], _ = strconv.Atoi(part)
+	}
+	return parts, prerelease
+}
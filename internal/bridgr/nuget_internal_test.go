@@ -0,0 +1,227 @@
+package bridgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var nugetFeedContent = map[string]string{
+	"/flat/bluth.stair-car/index.json": `{"versions":["1.0.0","1.1.0","2.0.0-beta"]}`,
+	"/flat/bluth.stair-car/1.1.0/bluth.stair-car.nuspec": `<?xml version="1.0"?>
+<package xmlns="http://schemas.microsoft.com/packaging/2013/05/nuspec.xsd">
+  <metadata><id>Bluth.Stair-Car</id><version>1.1.0</version>
+    <dependencies>
+      <group targetFramework="net6.0"><dependency id="Bluth.Banana" version="[1.0, )" /></group>
+      <group targetFramework=".NETStandard2.0"><dependency id="Bluth.Seal" version="1.0" /></group>
+      <group targetFramework=".NETFramework4.7.2"><dependency id="Bluth.Hop-On" version="1.0" /></group>
+    </dependencies>
+  </metadata>
+</package>`,
+	"/flat/bluth.banana/index.json":                           `{"versions":["0.9.0","1.0.0","1.2.0"]}`,
+	"/flat/bluth.banana/1.0.0/bluth.banana.nuspec":            `<package><metadata><id>Bluth.Banana</id><version>1.0.0</version></metadata></package>`,
+	"/flat/bluth.banana/1.0.0/bluth.banana.1.0.0.nupkg":       "nupkg",
+	"/flat/bluth.stair-car/1.1.0/bluth.stair-car.1.1.0.nupkg": "nupkg",
+}
+
+func nugetFeed() *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v3/index.json" {
+			fmt.Fprintf(w, `{"version":"3.0.0","resources":[{"@id":"http://%s/flat/","@type":"PackageBaseAddress/3.0.0"}]}`, r.Host)
+			return
+		}
+		if content, ok := nugetFeedContent[r.URL.Path]; ok {
+			fmt.Fprint(w, content)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+}
+
+func TestNugetDir(t *testing.T) {
+	expected := BaseDir("nuget")
+	result := Nuget{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestStringToNugetPackage(t *testing.T) {
+	result, err := stringToNugetPackage(reflect.TypeOf(""), reflect.TypeOf(nugetPackage{}), "Newtonsoft.Json@13.0.3")
+	if err != nil {
+		t.Error(err)
+	}
+	if !cmp.Equal(nugetPackage{Package: "Newtonsoft.Json", Version: "13.0.3"}, result) {
+		t.Error(cmp.Diff(nugetPackage{Package: "Newtonsoft.Json", Version: "13.0.3"}, result))
+	}
+}
+
+func TestCompareNugetVersions(t *testing.T) {
+	tests := []struct {
+		a, b   string
+		expect int
+	}{
+		{"1.0", "1.0.0.0", 0},
+		{"1.0.0.1", "1.0.0", 1},
+		{"1.10.0", "1.9.0", 1},
+		{"1.0.0-beta", "1.0.0", -1},
+		{"1.0.0-beta.2", "1.0.0-beta.10", -1},
+		{"1.0.0-alpha", "1.0.0-beta", -1},
+		{"1.0.0+build", "1.0.0", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.a+" "+test.b, func(t *testing.T) {
+			result := compareNugetVersions(test.a, test.b)
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestInNugetRange(t *testing.T) {
+	tests := []struct {
+		version string
+		spec    string
+		expect  bool
+	}{
+		{"1.0.0", "1.0", true},
+		{"2.5.0", "1.0", true},
+		{"0.9.0", "1.0", false},
+		{"1.0.0", "[1.0]", true},
+		{"1.0.1", "[1.0]", false},
+		{"1.5.0", "[1.0, 2.0)", true},
+		{"2.0.0", "[1.0, 2.0)", false},
+		{"1.0.0", "(1.0, )", false},
+		{"0.1.0", "(, 1.0]", true},
+		{"5.0.0", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.version+" "+test.spec, func(t *testing.T) {
+			result := inNugetRange(test.version, test.spec)
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestParseNugetFramework(t *testing.T) {
+	tests := []struct {
+		tfm     string
+		family  string
+		version string
+	}{
+		{"net8.0", "netcoreapp", "8.0"},
+		{"net8.0-windows", "netcoreapp", "8.0"},
+		{".NETCoreApp3.1", "netcoreapp", "3.1"},
+		{"netstandard2.0", "netstandard", "2.0"},
+		{".NETStandard2.0", "netstandard", "2.0"},
+		{"net472", "netframework", "4.7.2"},
+		{".NETFramework4.6.1", "netframework", "4.6.1"},
+		{"monoandroid", "", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.tfm, func(t *testing.T) {
+			family, version := parseNugetFramework(test.tfm)
+			if !cmp.Equal([]string{test.family, test.version}, []string{family, version}) {
+				t.Error(cmp.Diff([]string{test.family, test.version}, []string{family, version}))
+			}
+		})
+	}
+}
+
+func TestNearestNugetGroup(t *testing.T) {
+	groups := []nuspecGroup{
+		{TargetFramework: "net6.0"},
+		{TargetFramework: "net8.0"},
+		{TargetFramework: ".NETStandard2.0"},
+		{TargetFramework: ".NETFramework4.5"},
+	}
+	tests := []struct {
+		framework string
+		groups    []nuspecGroup
+		expect    string
+	}{
+		{"net7.0", groups, "net6.0"},
+		{"net9.0", groups, "net8.0"},
+		{"netcoreapp3.1", groups, ".NETStandard2.0"},
+		{"net48", groups, ".NETFramework4.5"},
+		{"netstandard1.6", groups, ""},
+		{"netstandard1.6", append(groups, nuspecGroup{}), "any"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.framework, func(t *testing.T) {
+			result := nearestNugetGroup(test.framework, test.groups)
+			name := ""
+			if result != nil {
+				name = result.TargetFramework
+				if name == "" {
+					name = "any"
+				}
+			}
+			if !cmp.Equal(test.expect, name) {
+				t.Error(cmp.Diff(test.expect, name))
+			}
+		})
+	}
+}
+
+func TestNugetRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := nugetFeed()
+	defer server.Close()
+
+	nuget := Nuget{Source: server.URL + "/v3/index.json", Host: "http://bridgr.bluth.com", Frameworks: []string{"net8.0"}, Packages: []nugetPackage{{Package: "Bluth.Stair-Car"}}}
+	if err := nuget.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectFiles := []string{
+		"index.json",
+		"v3-flatcontainer/bluth.stair-car/index.json",
+		"v3-flatcontainer/bluth.stair-car/1.1.0/bluth.stair-car.1.1.0.nupkg",
+		"v3-flatcontainer/bluth.banana/1.0.0/bluth.banana.1.0.0.nupkg",
+		"registration/bluth.stair-car/index.json",
+		"registration/bluth.banana/1.0.0.json",
+	}
+	for _, file := range expectFiles {
+		if _, err := os.Stat(path.Join(nuget.dir(), file)); err != nil {
+			t.Errorf("expected %s to be written: %s", file, err)
+		}
+	}
+	for _, file := range []string{"v3-flatcontainer/bluth.seal", "v3-flatcontainer/bluth.hop-on"} {
+		if _, err := os.Stat(path.Join(nuget.dir(), file)); err == nil {
+			t.Errorf("expected %s to not be written for other frameworks", file)
+		}
+	}
+
+	index := nugetServiceIndex{}
+	content, _ := os.ReadFile(path.Join(nuget.dir(), "index.json"))
+	if err := json.Unmarshal(content, &index); err != nil {
+		t.Fatal(err)
+	}
+	if !cmp.Equal("http://bridgr.bluth.com/nuget/v3-flatcontainer/", index.Resources[0].ID) {
+		t.Error(cmp.Diff("http://bridgr.bluth.com/nuget/v3-flatcontainer/", index.Resources[0].ID))
+	}
+	versions, _ := os.ReadFile(path.Join(nuget.dir(), "v3-flatcontainer/bluth.stair-car/index.json"))
+	if !cmp.Equal(`{"versions":["1.1.0"]}`, string(versions)) {
+		t.Error(cmp.Diff(`{"versions":["1.1.0"]}`, string(versions)))
+	}
+	registration, _ := os.ReadFile(path.Join(nuget.dir(), "registration/bluth.stair-car/index.json"))
+	if !strings.Contains(string(registration), `"packageContent":"http://bridgr.bluth.com/nuget/v3-flatcontainer/bluth.stair-car/1.1.0/bluth.stair-car.1.1.0.nupkg"`) {
+		t.Errorf("expected registration to point at the hosted package, but got %s", registration)
+	}
+}
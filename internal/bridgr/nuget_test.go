@@ -0,0 +1,33 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestNugetImage(t *testing.T) {
+	nuget := bridgr.Nuget{}
+	if nuget.Image() != nil {
+		t.Errorf("expected nil, but got %+v", nuget.Image())
+	}
+}
+
+func TestNugetName(t *testing.T) {
+	expected := "nuget"
+	nuget := bridgr.Nuget{}
+	if !cmp.Equal(expected, nuget.Name()) {
+		t.Error(cmp.Diff(expected, nuget.Name()))
+	}
+}
+
+func TestNugetHook(t *testing.T) {
+	nuget := bridgr.Nuget{}
+	result := reflect.TypeOf(nuget.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
@@ -0,0 +1,151 @@
+package bridgr
+
+import (
+	"context"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/mitchellh/mapstructure"
+	"oras.land/oras-go/v2"
+	"oras.land/oras-go/v2/content/oci"
+	"oras.land/oras-go/v2/registry/remote"
+	"oras.land/oras-go/v2/registry/remote/auth"
+	log "unknwon.dev/clog/v2"
+)
+
+// dockerHubRegistry is where Docker Hub serves the registry API, as "docker.io" in a reference is only a name for it
+const dockerHubRegistry = "registry-1.docker.io"
+
+// OCI is the configuration object for copying OCI artifacts from registries into an OCI Image Layout, without a Docker daemon
+type OCI struct {
+	Artifacts []ociArtifact
+}
+
+type ociArtifact struct {
+	Reference     string
+	ArtifactTypes []string `mapstructure:"artifactTypes"`
+}
+
+// dir is the top-level directory name for all objects written out under the OCI worker. It is an OCI Image Layout.
+func (o OCI) dir() string {
+	return BaseDir(o.Name())
+}
+
+// Name returns the name of this Configuration
+func (o OCI) Name() string {
+	return "oci"
+}
+
+// Image implements the Imager interface
+func (o OCI) Image() reference.Named {
+	return nil
+}
+
+func stringToOCIArtifact(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf(ociArtifact{}) {
+		return data, nil
+	}
+	return ociArtifact{Reference: data.(string)}, nil
+}
+
+func arrayToOCI(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Slice || t != reflect.TypeOf(OCI{}) {
+		return data, nil
+	}
+	return map[string]interface{}{"artifacts": data}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (o *OCI) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		arrayToOCI,
+		stringToOCIArtifact,
+	)
+}
+
+// Setup creates the OCI Image Layout for the artifacts
+func (o *OCI) Setup() error {
+	log.Trace("Called OCI.Setup()")
+	_, err := oci.New(o.dir())
+	return err
+}
+
+// Run copies each artifact, and the artifacts that refer to it (ie, signatures and SBOMs), into the OCI Image Layout.
+// Artifacts are tagged in the layout with their normalized reference.
+func (o *OCI) Run() error {
+	if err := o.Setup(); err != nil {
+		return err
+	}
+	store, err := oci.New(o.dir())
+	if err != nil {
+		return err
+	}
+	forEach(len(o.Artifacts), func(i int) {
+		if err := o.copy(store, o.Artifacts[i]); err != nil {
+			log.Info("OCI: unable to copy %s - %s", o.Artifacts[i].Reference, err)
+		}
+	})
+	return nil
+}
+
+// copy pulls an artifact and its referrers from its registry into the store
+func (o *OCI) copy(store oras.Target, artifact ociArtifact) error {
+	named, err := reference.ParseNormalizedNamed(artifact.Reference)
+	if err != nil {
+		return err
+	}
+	named = reference.TagNameOnly(named)
+	repo, err := ociRepository(named)
+	if err != nil {
+		return err
+	}
+
+	var source string
+	if digested, ok := named.(reference.Digested); ok {
+		source = digested.Digest().String()
+	} else {
+		source = named.(reference.Tagged).Tag()
+	}
+	opts := oras.DefaultExtendedCopyOptions
+	if len(artifact.ArtifactTypes) > 0 {
+		quoted := make([]string, 0, len(artifact.ArtifactTypes))
+		for _, artifactType := range artifact.ArtifactTypes {
+			quoted = append(quoted, regexp.QuoteMeta(artifactType))
+		}
+		opts.FilterArtifactType(regexp.MustCompile("^(" + strings.Join(quoted, "|") + ")$"))
+	}
+	desc, err := oras.ExtendedCopy(context.Background(), repo, source, store, named.String(), opts)
+	if err != nil {
+		return err
+	}
+	log.Info("OCI: copied %s (%s)", named, desc.Digest)
+	return nil
+}
+
+// ociRepository gives a client for the registry repository of a reference. Credentials are read from the environment the same
+// as for other workers, ie BRIDGR_GHCR_IO_USER and BRIDGR_GHCR_IO_TOKEN.
+func ociRepository(named reference.Named) (*remote.Repository, error) {
+	domain := reference.Domain(named)
+	if domain == "docker.io" {
+		domain = dockerHubRegistry
+	}
+	repo, err := remote.NewRepository(domain + "/" + reference.Path(named))
+	if err != nil {
+		return nil, err
+	}
+	repo.Client = &auth.Client{
+		Client: httpClient,
+		Cache:  auth.NewCache(),
+		Credential: func(_ context.Context, hostport string) (auth.Credential, error) {
+			credentials := WorkerCredentialReader{}
+			if creds, ok := credentials.Read(&url.URL{Host: hostport}); ok && creds.IsValid() {
+				return auth.Credential{Username: creds.Username, Password: creds.Password}, nil
+			}
+			return auth.EmptyCredential, nil
+		},
+	}
+	return repo, nil
+}
@@ -0,0 +1,178 @@
+package bridgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/distribution/reference"
+	"github.com/google/go-cmp/cmp"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+type ociContent struct {
+	mediaType string
+	content   []byte
+}
+
+func ociDescriptor(mediaType string, content []byte) ocispec.Descriptor {
+	return ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(content), Size: int64(len(content))}
+}
+
+// ociRegistry serves an artifact tagged "1.0" in the bluth/banana repository, with a signature that refers to it
+func ociRegistry() (*httptest.Server, ocispec.Descriptor, ocispec.Descriptor) {
+	layer := []byte("there's always money in the banana stand")
+	config := []byte("{}")
+	artifact, _ := json.Marshal(ocispec.Manifest{
+		Versioned:    specs.Versioned{SchemaVersion: 2},
+		MediaType:    ocispec.MediaTypeImageManifest,
+		ArtifactType: "application/vnd.bluth.banana",
+		Config:       ociDescriptor(ocispec.MediaTypeEmptyJSON, config),
+		Layers:       []ocispec.Descriptor{ociDescriptor("application/vnd.bluth.banana.layer", layer)},
+	})
+	artifactDesc := ociDescriptor(ocispec.MediaTypeImageManifest, artifact)
+	signature, _ := json.Marshal(ocispec.Manifest{
+		Versioned:    specs.Versioned{SchemaVersion: 2},
+		MediaType:    ocispec.MediaTypeImageManifest,
+		ArtifactType: "application/vnd.bluth.signature",
+		Config:       ociDescriptor(ocispec.MediaTypeEmptyJSON, config),
+		Layers:       []ocispec.Descriptor{ociDescriptor(ocispec.MediaTypeEmptyJSON, config)},
+		Subject:      &artifactDesc,
+	})
+	signatureDesc := ociDescriptor(ocispec.MediaTypeImageManifest, signature)
+	signatureDesc.ArtifactType = "application/vnd.bluth.signature"
+	referrers, _ := json.Marshal(ocispec.Index{Versioned: specs.Versioned{SchemaVersion: 2}, MediaType: ocispec.MediaTypeImageIndex, Manifests: []ocispec.Descriptor{signatureDesc}})
+
+	contents := map[string]ociContent{
+		"/v2/bluth/banana/manifests/1.0":                              {ocispec.MediaTypeImageManifest, artifact},
+		"/v2/bluth/banana/manifests/" + artifactDesc.Digest.String():  {ocispec.MediaTypeImageManifest, artifact},
+		"/v2/bluth/banana/manifests/" + signatureDesc.Digest.String(): {ocispec.MediaTypeImageManifest, signature},
+		"/v2/bluth/banana/blobs/" + digest.FromBytes(config).String(): {"application/octet-stream", config},
+		"/v2/bluth/banana/blobs/" + digest.FromBytes(layer).String():  {"application/octet-stream", layer},
+		"/v2/bluth/banana/referrers/" + artifactDesc.Digest.String():  {ocispec.MediaTypeImageIndex, referrers},
+	}
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			return
+		}
+		item, ok := contents[r.URL.Path]
+		if !ok && strings.HasPrefix(r.URL.Path, "/v2/bluth/banana/referrers/") {
+			item, ok = ociContent{ocispec.MediaTypeImageIndex, []byte(`{"schemaVersion":2,"mediaType":"application/vnd.oci.image.index.v1+json","manifests":[]}`)}, true
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", item.mediaType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(item.content)))
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(item.content).String())
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(item.content)
+		}
+	}))
+	return server, artifactDesc, signatureDesc
+}
+
+func TestOCIDir(t *testing.T) {
+	expected := BaseDir("oci")
+	result := OCI{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestStringToOCIArtifact(t *testing.T) {
+	result, err := stringToOCIArtifact(reflect.TypeOf(""), reflect.TypeOf(ociArtifact{}), "ghcr.io/bluth/banana:1.0")
+	if err != nil {
+		t.Error(err)
+	}
+	if !cmp.Equal(ociArtifact{Reference: "ghcr.io/bluth/banana:1.0"}, result) {
+		t.Error(cmp.Diff(ociArtifact{Reference: "ghcr.io/bluth/banana:1.0"}, result))
+	}
+
+	other, _ := stringToOCIArtifact(reflect.TypeOf(""), reflect.TypeOf(""), "banana")
+	if !cmp.Equal("banana", other) {
+		t.Error(cmp.Diff("banana", other))
+	}
+}
+
+func TestArrayToOCI(t *testing.T) {
+	input := []interface{}{"ghcr.io/bluth/banana:1.0"}
+	result, _ := arrayToOCI(reflect.TypeOf(input), reflect.TypeOf(OCI{}), input)
+	expect := map[string]interface{}{"artifacts": input}
+	if !cmp.Equal(expect, result) {
+		t.Error(cmp.Diff(expect, result))
+	}
+}
+
+func TestOCIRepository(t *testing.T) {
+	tests := []struct {
+		reference string
+		expect    string
+	}{
+		{"alpine", "registry-1.docker.io/library/alpine"},
+		{"ghcr.io/bluth/banana:1.0", "ghcr.io/bluth/banana"},
+		{"localhost:5000/bluth/banana", "localhost:5000/bluth/banana"},
+	}
+	for _, test := range tests {
+		t.Run(test.reference, func(t *testing.T) {
+			named, _ := reference.ParseNormalizedNamed(test.reference)
+			repo, err := ociRepository(named)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(test.expect, repo.Reference.String()) {
+				t.Error(cmp.Diff(test.expect, repo.Reference.String()))
+			}
+		})
+	}
+}
+
+func TestOCIRun(t *testing.T) {
+	server, artifact, signature := ociRegistry()
+	defer server.Close()
+	trustServer(t, server)
+	ref := strings.TrimPrefix(server.URL, "https://") + "/bluth/banana:1.0"
+
+	tests := []struct {
+		name      string
+		artifact  ociArtifact
+		signature bool
+	}{
+		{"with referrers", ociArtifact{Reference: ref}, true},
+		{"filtered referrers", ociArtifact{Reference: ref, ArtifactTypes: []string{"application/spdx+json"}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			t.Chdir(t.TempDir())
+			o := OCI{Artifacts: []ociArtifact{test.artifact}}
+			if err := o.Run(); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := os.Stat(path.Join(o.dir(), "oci-layout")); err != nil {
+				t.Errorf("expected an OCI Image Layout: %s", err)
+			}
+			if _, err := os.Stat(path.Join(o.dir(), "blobs", "sha256", artifact.Digest.Encoded())); err != nil {
+				t.Errorf("expected the artifact manifest to be copied: %s", err)
+			}
+			_, err := os.Stat(path.Join(o.dir(), "blobs", "sha256", signature.Digest.Encoded()))
+			if test.signature != (err == nil) {
+				t.Errorf("expected signature copied to be %t", test.signature)
+			}
+
+			index, _ := os.ReadFile(path.Join(o.dir(), "index.json"))
+			if !strings.Contains(string(index), fmt.Sprintf(`"org.opencontainers.image.ref.name":"%s"`, ref)) {
+				t.Errorf("expected the artifact to be tagged with its reference, got %s", index)
+			}
+		})
+	}
+}
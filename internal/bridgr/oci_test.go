@@ -0,0 +1,33 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestOCIImage(t *testing.T) {
+	oci := bridgr.OCI{}
+	if oci.Image() != nil {
+		t.Errorf("expected nil, but got %+v", oci.Image())
+	}
+}
+
+func TestOCIName(t *testing.T) {
+	expected := "oci"
+	oci := bridgr.OCI{}
+	if !cmp.Equal(expected, oci.Name()) {
+		t.Error(cmp.Diff(expected, oci.Name()))
+	}
+}
+
+func TestOCIHook(t *testing.T) {
+	oci := bridgr.OCI{}
+	result := reflect.TypeOf(oci.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
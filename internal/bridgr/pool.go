@@ -0,0 +1,44 @@
+package bridgr
+
+import (
+	"sync"
+)
+
+var (
+	slotsMu sync.Mutex
+	slots   chan struct{}
+)
+
+// fetchSlots returns the semaphore shared by every worker for limiting concurrent artifact fetches.
+// The semaphore is re-created when Threads changes, callers must hold on to the channel they acquired from.
+func fetchSlots() chan struct{} {
+	slotsMu.Lock()
+	defer slotsMu.Unlock()
+	size := Threads
+	if size < 1 {
+		size = 1
+	}
+	if slots == nil || cap(slots) != size {
+		slots = make(chan struct{}, size)
+	}
+	return slots
+}
+
+// forEach calls fn for every index in [0, count) and waits for all of them to return.
+// At most Threads calls run at once across all workers, so each fn should do a single fetch and not call forEach itself.
+func forEach(count int, fn func(int)) {
+	sem := fetchSlots()
+	wg := sync.WaitGroup{}
+	for i := 0; i < count; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
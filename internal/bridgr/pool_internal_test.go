@@ -0,0 +1,81 @@
+package bridgr
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestFetchSlots(t *testing.T) {
+	original := Threads
+	defer func() { Threads = original }()
+
+	tests := []struct {
+		name    string
+		threads int
+		expect  int
+	}{
+		{"default", 1, 1},
+		{"many", 8, 8},
+		{"zero", 0, 1},
+		{"negative", -4, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			Threads = test.threads
+			result := cap(fetchSlots())
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestForEach(t *testing.T) {
+	original := Threads
+	defer func() { Threads = original }()
+
+	tests := []struct {
+		name    string
+		threads int
+		count   int
+	}{
+		{"serial", 1, 5},
+		{"parallel", 3, 20},
+		{"more threads than items", 10, 2},
+		{"empty", 4, 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			Threads = test.threads
+			var running, peak int32
+			seen := sync.Map{}
+			forEach(test.count, func(i int) {
+				now := atomic.AddInt32(&running, 1)
+				for {
+					old := atomic.LoadInt32(&peak)
+					if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond * 5)
+				seen.Store(i, true)
+				atomic.AddInt32(&running, -1)
+			})
+
+			for i := 0; i < test.count; i++ {
+				if _, ok := seen.Load(i); !ok {
+					t.Errorf("expected item %d to be processed", i)
+				}
+			}
+			if int(peak) > test.threads {
+				t.Errorf("expected at most %d concurrent calls, but got %d", test.threads, peak)
+			}
+		})
+	}
+}
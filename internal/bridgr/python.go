@@ -4,7 +4,11 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"sort"
+	"strings"
 	"text/template"
 
 	"github.com/aztechian/bridgr/internal/bridgr/asset"
@@ -16,6 +20,9 @@ import (
 var (
 	pyImage reference.Named
 	pyReqt  *template.Template
+
+	pyProjectName    = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._-]*[A-Za-z0-9])?`)
+	pyNameSeparators = regexp.MustCompile(`[-_.]+`)
 )
 
 const defaultPySource = "https://pypi.org"
@@ -104,7 +111,69 @@ func (p Python) Setup() error {
 		return fmt.Errorf("Unable to create Python requirements file: %s", err)
 	}
 
-	return asset.RenderFile(pyReqt, p.Packages, reqt)
+	packages := p.Packages
+	if Locked {
+		packages = p.lockedPackages()
+	}
+	return asset.RenderFile(pyReqt, packages, reqt)
+}
+
+// lockedPackages requires exactly the distributions pinned in the lock file, dependencies included
+func (p Python) lockedPackages() []pythonPackage {
+	pinned := map[string]string{}
+	for _, pin := range lockPins(p.Name()) {
+		if pin.Name != "" && pin.Version != "" {
+			pinned[pin.Name] = pin.Version
+		}
+	}
+	for _, pkg := range p.Packages {
+		if name := pythonName(pkg.Package); pinned[name] == "" {
+			lockDrift(p.Name(), "%s is not in the lock file", pkg.Package)
+		}
+	}
+	var packages []pythonPackage
+	for name, version := range pinned {
+		packages = append(packages, pythonPackage{Package: name + "==" + version})
+	}
+	sort.Slice(packages, func(i, j int) bool { return packages[i].Package < packages[j].Package })
+	return packages
+}
+
+// lockPackages records the version of every distribution that was downloaded, from its file name
+func (p Python) lockPackages() {
+	files, _ := filepath.Glob(path.Join(p.dir(), "simple", "*", "*"))
+	for _, file := range files {
+		version := pythonDistVersion(path.Base(file))
+		if version == "" {
+			continue
+		}
+		lockRecord(LockEntry{Worker: p.Name(), Name: pythonName(path.Base(path.Dir(file))), Version: version, Path: lockPath(file)})
+	}
+}
+
+// pythonName gives the normalized project name of a requirement, like "flask" for "Flask <1.1.0"
+func pythonName(requirement string) string {
+	name := pyProjectName.FindString(requirement)
+	return strings.ToLower(pyNameSeparators.ReplaceAllString(name, "-"))
+}
+
+// pythonDistVersion gives the version of a wheel or source distribution from its file name
+func pythonDistVersion(file string) string {
+	if strings.HasSuffix(file, ".whl") {
+		if parts := strings.Split(file, "-"); len(parts) >= 5 {
+			return parts[1]
+		}
+		return ""
+	}
+	for _, ext := range []string{".tar.gz", ".tar.bz2", ".tgz", ".zip"} {
+		if strings.HasSuffix(file, ext) {
+			name := strings.TrimSuffix(file, ext)
+			if i := strings.LastIndex(name, "-"); i > 0 {
+				return name[i+1:]
+			}
+		}
+	}
+	return ""
 }
 
 // Run fetches all artifacts for the Python configuration
@@ -118,5 +187,9 @@ func (p Python) Run() error {
 	}
 
 	batcher := newBatch(p.Image().String(), p.dir(), path.Join(p.dir(), "requirements.txt"), "/requirements.txt")
-	return batcher.runContainer("bridgr_python", shell)
+	if err := batcher.runContainer("bridgr_python", shell); err != nil {
+		return err
+	}
+	p.lockPackages()
+	return nil
 }
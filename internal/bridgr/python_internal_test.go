@@ -1,7 +1,10 @@
 package bridgr
 
 import (
+	"os"
+	"path"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/distribution/reference"
@@ -79,3 +82,64 @@ func TestArrayToPython(t *testing.T) {
 		})
 	}
 }
+
+func TestPythonName(t *testing.T) {
+	tests := map[string]string{"Flask <1.1.0": "flask", "zope.interface": "zope-interface", "Django_Rest": "django-rest", "requests[socks]>=2": "requests"}
+	for input, expect := range tests {
+		if result := pythonName(input); !cmp.Equal(expect, result) {
+			t.Error(cmp.Diff(expect, result))
+		}
+	}
+}
+
+func TestPythonDistVersion(t *testing.T) {
+	tests := map[string]string{
+		"Flask-1.0.4-py2.py3-none-any.whl": "1.0.4",
+		"itsdangerous-1.1.0.tar.gz":        "1.1.0",
+		"python-dateutil-2.8.2.zip":        "2.8.2",
+		"broken.whl":                       "",
+		"index.html":                       "",
+	}
+	for input, expect := range tests {
+		if result := pythonDistVersion(input); !cmp.Equal(expect, result) {
+			t.Error(cmp.Diff(expect, result))
+		}
+	}
+}
+
+func TestPythonLockedPackages(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resetLocks(t, true)
+	_ = ReadLock(strings.NewReader(`version: 1
+artifacts:
+  - {worker: python, name: flask, version: 1.0.4, path: python/simple/flask/Flask-1.0.4-py2.py3-none-any.whl}
+  - {worker: python, name: flask, version: 1.0.4, path: python/simple/flask/Flask-1.0.4.tar.gz}
+  - {worker: python, name: itsdangerous, version: 1.1.0, path: python/simple/itsdangerous/itsdangerous-1.1.0.tar.gz}
+`))
+	p := Python{Packages: []pythonPackage{{Package: "Flask <1.1.0"}, {Package: "requests"}}}
+	if err := p.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	result, _ := os.ReadFile(path.Join(p.dir(), "requirements.txt"))
+	expect := "flask==1.0.4\nitsdangerous==1.1.0\n"
+	if !cmp.Equal(expect, string(result)) {
+		t.Error(cmp.Diff(expect, string(result)))
+	}
+	if expect := []string{"requests is not in the lock file"}; !cmp.Equal(expect, locks.drift["python"]) {
+		t.Error(cmp.Diff(expect, locks.drift["python"]))
+	}
+}
+
+func TestPythonLockPackages(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resetLocks(t, false)
+	p := Python{}
+	_ = os.MkdirAll(path.Join(p.dir(), "simple", "flask"), os.ModePerm)
+	_ = os.WriteFile(path.Join(p.dir(), "simple", "flask", "Flask-1.0.4-py2.py3-none-any.whl"), []byte("wheel"), 0644)
+	_ = os.WriteFile(path.Join(p.dir(), "simple", "flask", "index.html"), []byte("<html/>"), 0644)
+	p.lockPackages()
+	expect := []LockEntry{{Worker: "python", Name: "flask", Version: "1.0.4", Path: "python/simple/flask/Flask-1.0.4-py2.py3-none-any.whl"}}
+	if !cmp.Equal(expect, locks.resolved["python"]) {
+		t.Error(cmp.Diff(expect, locks.resolved["python"]))
+	}
+}
@@ -0,0 +1,313 @@
+package bridgr
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/distribution/reference"
+	"github.com/mitchellh/mapstructure"
+	log "unknwon.dev/clog/v2"
+)
+
+const (
+	defaultRMirror  = "https://cloud.r-project.org"
+	defaultRVersion = "4.4"
+)
+
+// rDependency matches a package in a Depends, Imports or LinkingTo field, without its version requirement
+var rDependency = regexp.MustCompile(`^\s*([A-Za-z][A-Za-z0-9.]*)`)
+
+// rBasePackages are installed with R itself, and are not found in a CRAN repository
+var rBasePackages = map[string]bool{
+	"R": true, "base": true, "compiler": true, "datasets": true, "graphics": true, "grDevices": true, "grid": true, "methods": true,
+	"parallel": true, "splines": true, "stats": true, "stats4": true, "tcltk": true, "tools": true, "translations": true, "utils": true,
+}
+
+// R is the configuration object for creating a CRAN-like repository of R packages
+type R struct {
+	Mirror   string
+	Version  string
+	Binaries []string
+	Packages []string
+}
+
+// rPackage is a record in a repository PACKAGES index
+type rPackage struct {
+	Fields map[string]string
+	raw    string
+}
+
+// dir is the top-level directory name for all objects written out under the R worker
+func (r R) dir() string {
+	return BaseDir(r.Name())
+}
+
+// Name returns the name of this Configuration
+func (r R) Name() string {
+	return "r"
+}
+
+// Image implements the Imager interface
+func (r R) Image() reference.Named {
+	return nil
+}
+
+func arrayToR(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Slice || t != reflect.TypeOf(R{}) {
+		return data, nil
+	}
+	return map[string]interface{}{"packages": data}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (r *R) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		arrayToR,
+	)
+}
+
+// Setup prepares the directory for the CRAN repository
+func (r *R) Setup() error {
+	log.Trace("Called R.Setup()")
+	if r.Mirror == "" {
+		r.Mirror = defaultRMirror
+	}
+	r.Mirror = strings.TrimSuffix(r.Mirror, "/")
+	if r.Version == "" {
+		r.Version = defaultRVersion
+	}
+	return os.MkdirAll(path.Join(r.dir(), "src", "contrib"), os.ModePerm)
+}
+
+// Run resolves the configured packages and their dependencies from the source index of the mirror, then downloads the
+// source packages, and the binary packages for each configured platform
+func (r *R) Run() error {
+	if err := r.Setup(); err != nil {
+		return err
+	}
+	source := "src/contrib"
+	index, err := r.readIndex(source)
+	if err != nil {
+		return err
+	}
+	names := resolveRPackages(index, r.Packages)
+	if err := r.mirror(source, ".tar.gz", index, names); err != nil {
+		return err
+	}
+
+	for _, platform := range r.Binaries {
+		contrib := path.Join("bin", platform, "contrib", r.Version)
+		binaries, err := r.readIndex(contrib)
+		if err != nil {
+			log.Info("R: unable to read %s binary packages - %s", platform, err)
+			continue
+		}
+		ext := ".tgz"
+		if strings.HasPrefix(platform, "windows") {
+			ext = ".zip"
+		}
+		if err := r.mirror(contrib, ext, binaries, names); err != nil {
+			log.Info("R: unable to write %s binary packages - %s", platform, err)
+		}
+	}
+	return nil
+}
+
+// mirror downloads the named packages of a contrib directory, and writes its PACKAGES index
+func (r *R) mirror(contrib, ext string, index map[string]rPackage, names []string) error {
+	downloaded := map[string]rPackage{}
+	mu := sync.Mutex{}
+	forEach(len(names), func(i int) {
+		pkg, ok := index[names[i]]
+		if !ok {
+			log.Info("R: %s is not available in %s", names[i], contrib)
+			return
+		}
+		if err := r.download(contrib, ext, pkg); err != nil {
+			log.Info("R: unable to download %s %s - %s", names[i], pkg.Fields["Version"], err)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		downloaded[names[i]] = pkg
+	})
+	return r.writeIndex(contrib, ext, downloaded)
+}
+
+// download fetches a package file, and verifies it against the MD5 sum in the index
+func (r *R) download(contrib, ext string, pkg rPackage) error {
+	file := pkg.Fields["Package"] + "_" + pkg.Fields["Version"] + ext
+	target := path.Join(r.dir(), contrib, file)
+	expected := pkg.Fields["MD5sum"]
+	if sum, err := fileChecksum(target, "md5"); err == nil && (expected == "" || sum == expected) {
+		return lockExisting(target)
+	}
+	source, err := url.Parse(r.Mirror + "/" + contrib + "/" + file)
+	if err != nil {
+		return err
+	}
+	if err := download(source, target); err != nil {
+		return err
+	}
+	if expected == "" {
+		return nil
+	}
+	sum, err := fileChecksum(target, "md5")
+	if err != nil {
+		return err
+	}
+	if sum != expected {
+		_ = os.Remove(target)
+		return fmt.Errorf("checksum mismatch, expected %s but got %s", expected, sum)
+	}
+	return nil
+}
+
+// readIndex gets the PACKAGES index of a contrib directory on the mirror
+func (r *R) readIndex(contrib string) (map[string]rPackage, error) {
+	resp, err := httpGet(r.Mirror + "/" + contrib + "/PACKAGES.gz")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	in, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	defer in.Close()
+	return parseRPackages(in)
+}
+
+// writeIndex writes the PACKAGES and PACKAGES.gz index of a contrib directory. Packages from earlier runs are kept, as long as
+// their file is still in the directory.
+func (r *R) writeIndex(contrib, ext string, packages map[string]rPackage) error {
+	dir := path.Join(r.dir(), contrib)
+	if in, err := os.Open(path.Join(dir, "PACKAGES")); err == nil {
+		existing, err := parseRPackages(in)
+		in.Close()
+		if err != nil {
+			return err
+		}
+		for name, pkg := range existing {
+			if _, ok := packages[name]; ok {
+				continue
+			}
+			if _, err := os.Stat(path.Join(dir, name+"_"+pkg.Fields["Version"]+ext)); err == nil {
+				packages[name] = pkg
+			}
+		}
+	}
+	names := make([]string, 0, len(packages))
+	for name := range packages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	content := bytes.Buffer{}
+	for _, name := range names {
+		content.WriteString(packages[name].raw)
+		content.WriteString("\n\n")
+	}
+
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path.Join(dir, "PACKAGES"), content.Bytes(), 0644); err != nil { //nolint:gosec // repository content is meant to be readable
+		return err
+	}
+	out, err := os.Create(path.Join(dir, "PACKAGES.gz"))
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	compressed := gzip.NewWriter(out)
+	if _, err := compressed.Write(content.Bytes()); err != nil {
+		return err
+	}
+	return compressed.Close()
+}
+
+// parseRPackages reads the records of a PACKAGES index, which is in Debian control file format
+func parseRPackages(in io.Reader) (map[string]rPackage, error) {
+	packages := map[string]rPackage{}
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	var (
+		lines []string
+		field string
+	)
+	fields := map[string]string{}
+	flush := func() {
+		if name, ok := fields["Package"]; ok {
+			packages[name] = rPackage{Fields: fields, raw: strings.Join(lines, "\n")}
+		}
+		lines, field, fields = nil, "", map[string]string{}
+	}
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.TrimSpace(line) == "":
+			flush()
+			continue
+		case (line[0] == ' ' || line[0] == '\t') && field != "":
+			fields[field] += " " + strings.TrimSpace(line)
+		default:
+			parts := strings.SplitN(line, ":", 2)
+			if len(parts) != 2 {
+				return nil, fmt.Errorf("invalid PACKAGES line: %s", line)
+			}
+			field = parts[0]
+			fields[field] = strings.TrimSpace(parts[1])
+		}
+		lines = append(lines, line)
+	}
+	flush()
+	return packages, scanner.Err()
+}
+
+// dependencies gives the names of the packages needed to install a package, from its Depends, Imports and LinkingTo fields
+func (rp rPackage) dependencies() []string {
+	var deps []string
+	for _, field := range []string{"Depends", "Imports", "LinkingTo"} {
+		for _, dep := range strings.Split(rp.Fields[field], ",") {
+			if match := rDependency.FindStringSubmatch(dep); match != nil && !rBasePackages[match[1]] {
+				deps = append(deps, match[1])
+			}
+		}
+	}
+	return deps
+}
+
+// resolveRPackages gives the names of the packages and all of their dependencies found in the index
+func resolveRPackages(index map[string]rPackage, packages []string) []string {
+	seen := map[string]bool{}
+	var names []string
+	queue := packages
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		pkg, ok := index[name]
+		if !ok {
+			log.Info("R: package %s was not found", name)
+			continue
+		}
+		names = append(names, name)
+		queue = append(queue, pkg.dependencies()...)
+	}
+	sort.Strings(names)
+	return names
+}
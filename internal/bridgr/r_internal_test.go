@@ -0,0 +1,170 @@
+package bridgr
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/md5" //nolint:gosec // CRAN indexes use MD5 sums
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func md5sum(content string) string {
+	sum := md5.Sum([]byte(content)) //nolint:gosec // CRAN indexes use MD5 sums
+	return hex.EncodeToString(sum[:])
+}
+
+func cranMirror() *httptest.Server {
+	files := map[string]string{
+		"/src/contrib/banana_1.0.tar.gz":          "banana",
+		"/src/contrib/stand_2.1.tar.gz":           "stand",
+		"/src/contrib/Rcpp_1.0.12.tar.gz":         "Rcpp",
+		"/src/contrib/seal_0.3.tar.gz":            "not the seal",
+		"/bin/windows/contrib/4.4/banana_1.0.zip": "banana.zip",
+	}
+	source := fmt.Sprintf(`Package: banana
+Version: 1.0
+Depends: R (>= 3.5.0), stand (>= 2.0),
+        utils
+Imports: seal
+MD5sum: %s
+
+Package: stand
+Version: 2.1
+LinkingTo: Rcpp
+MD5sum: %s
+
+Package: Rcpp
+Version: 1.0.12
+Imports: methods, utils
+MD5sum: %s
+
+Package: seal
+Version: 0.3
+Suggests: hotcops
+MD5sum: %s
+
+Package: hotcops
+Version: 1.0
+`, md5sum("banana"), md5sum("stand"), md5sum("Rcpp"), md5sum("seal"))
+	binaries := fmt.Sprintf("Package: banana\nVersion: 1.0\nMD5sum: %s\n", md5sum("banana.zip"))
+	indexes := map[string]string{
+		"/src/contrib/PACKAGES.gz":             source,
+		"/bin/windows/contrib/4.4/PACKAGES.gz": binaries,
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if index, ok := indexes[r.URL.Path]; ok {
+			out := gzip.NewWriter(w)
+			fmt.Fprint(out, index)
+			out.Close()
+			return
+		}
+		if content, ok := files[r.URL.Path]; ok {
+			fmt.Fprint(w, content)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+}
+
+func TestRDir(t *testing.T) {
+	expected := BaseDir("r")
+	result := R{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestArrayToR(t *testing.T) {
+	input := []interface{}{"ggplot2"}
+	result, _ := arrayToR(reflect.TypeOf(input), reflect.TypeOf(R{}), input)
+	expect := map[string]interface{}{"packages": input}
+	if !cmp.Equal(expect, result) {
+		t.Error(cmp.Diff(expect, result))
+	}
+}
+
+func TestParseRPackages(t *testing.T) {
+	index := "Package: banana\nVersion: 1.0\nDepends: R (>= 3.5.0), stand,\n        utils\n\nPackage: stand\nVersion: 2.1\n"
+	packages, err := parseRPackages(strings.NewReader(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]string{"Package": "banana", "Version": "1.0", "Depends": "R (>= 3.5.0), stand, utils"}
+	if !cmp.Equal(expect, packages["banana"].Fields) {
+		t.Error(cmp.Diff(expect, packages["banana"].Fields))
+	}
+	if !cmp.Equal("Package: stand\nVersion: 2.1", packages["stand"].raw) {
+		t.Error(cmp.Diff("Package: stand\nVersion: 2.1", packages["stand"].raw))
+	}
+
+	if _, err := parseRPackages(strings.NewReader("not a field\n")); err == nil {
+		t.Error("expected an error for an invalid index")
+	}
+}
+
+func TestRPackageDependencies(t *testing.T) {
+	pkg := rPackage{Fields: map[string]string{
+		"Depends":   "R (>= 3.5.0), stand (>= 2.0), utils",
+		"Imports":   "seal,\n  data.table (>= 1.14)",
+		"LinkingTo": "Rcpp",
+		"Suggests":  "hotcops",
+	}}
+	expect := []string{"stand", "seal", "data.table", "Rcpp"}
+	if !cmp.Equal(expect, pkg.dependencies()) {
+		t.Error(cmp.Diff(expect, pkg.dependencies()))
+	}
+}
+
+func TestRRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := cranMirror()
+	defer server.Close()
+
+	r := R{Mirror: server.URL, Binaries: []string{"windows"}, Packages: []string{"banana", "cornballer"}}
+	if err := r.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectFiles := []string{
+		"src/contrib/banana_1.0.tar.gz",
+		"src/contrib/stand_2.1.tar.gz",
+		"src/contrib/Rcpp_1.0.12.tar.gz",
+		"src/contrib/PACKAGES.gz",
+		"bin/windows/contrib/4.4/banana_1.0.zip",
+	}
+	for _, file := range expectFiles {
+		if _, err := os.Stat(path.Join(r.dir(), file)); err != nil {
+			t.Errorf("expected %s to be written: %s", file, err)
+		}
+	}
+	if _, err := os.Stat(path.Join(r.dir(), "src/contrib/seal_0.3.tar.gz")); err == nil {
+		t.Error("expected a package with a bad checksum to be removed")
+	}
+	if _, err := os.Stat(path.Join(r.dir(), "src/contrib/hotcops_1.0.tar.gz")); err == nil {
+		t.Error("expected suggested packages to not be downloaded")
+	}
+
+	index, _ := os.ReadFile(path.Join(r.dir(), "src/contrib/PACKAGES"))
+	packages, err := parseRPackages(bytes.NewReader(index))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(packages))
+	for name := range packages {
+		names = append(names, name)
+	}
+	expect := []string{"Rcpp", "banana", "stand"}
+	if !cmp.Equal(expect, names, cmpopts.SortSlices(func(a, b string) bool { return a < b })) {
+		t.Error(cmp.Diff(expect, names))
+	}
+}
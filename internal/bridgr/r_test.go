@@ -0,0 +1,33 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestRImage(t *testing.T) {
+	r := bridgr.R{}
+	if r.Image() != nil {
+		t.Errorf("expected nil, but got %+v", r.Image())
+	}
+}
+
+func TestRName(t *testing.T) {
+	expected := "r"
+	r := bridgr.R{}
+	if !cmp.Equal(expected, r.Name()) {
+		t.Error(cmp.Diff(expected, r.Name()))
+	}
+}
+
+func TestRHook(t *testing.T) {
+	r := bridgr.R{}
+	result := reflect.TypeOf(r.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
@@ -4,7 +4,11 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
 	"reflect"
+	"regexp"
+	"sort"
+	"strings"
 	"text/template"
 
 	"github.com/aztechian/bridgr/internal/bridgr/asset"
@@ -16,6 +20,9 @@ import (
 var (
 	rbImage reference.Named
 	rbGems  *template.Template
+
+	// rbGemFile matches the name and version of a gem file, which may be followed by a platform
+	rbGemFile = regexp.MustCompile(`^(.+?)-(\d[^-]*)(-.+)?\.gem$`)
 )
 
 const defaultRbSource = "https://rubygems.org"
@@ -118,9 +125,47 @@ func (r *Ruby) Setup() error {
 		return fmt.Errorf("Unable to create Ruby Gemfile: %s", err)
 	}
 
+	if Locked {
+		locked := *r
+		locked.Gems = r.lockedGems()
+		return asset.RenderFile(rbGems, locked, gemfile)
+	}
 	return asset.RenderFile(rbGems, r, gemfile)
 }
 
+// lockedGems requires exactly the gems pinned in the lock file, dependencies included. Bundler is fetched on its own, not from the Gemfile.
+func (r *Ruby) lockedGems() []rubyItem {
+	pinned := map[string]string{}
+	for _, pin := range lockPins(r.Name()) {
+		if pin.Name != "" && pin.Version != "" && pin.Name != "bundler" {
+			pinned[pin.Name] = pin.Version
+		}
+	}
+	for _, gem := range r.Gems {
+		if name := strings.Fields(gem.Package); len(name) > 0 && pinned[name[0]] == "" {
+			lockDrift(r.Name(), "%s is not in the lock file", gem.String())
+		}
+	}
+	var gems []rubyItem
+	for name, version := range pinned {
+		gems = append(gems, rubyItem{Package: name, Version: version})
+	}
+	sort.Slice(gems, func(i, j int) bool { return gems[i].Package < gems[j].Package })
+	return gems
+}
+
+// lockGems records the version of every gem that was downloaded, from its file name
+func (r *Ruby) lockGems() {
+	files, _ := filepath.Glob(path.Join(r.dir(), "gems", "*.gem"))
+	for _, file := range files {
+		match := rbGemFile.FindStringSubmatch(path.Base(file))
+		if match == nil {
+			continue
+		}
+		lockRecord(LockEntry{Worker: r.Name(), Name: match[1], Version: match[2], Path: lockPath(file)})
+	}
+}
+
 // Run fetches all artifacts for the Python configuration
 func (r *Ruby) Run() error {
 	log.Trace("Called Ruby.Run()")
@@ -134,5 +179,12 @@ func (r *Ruby) Run() error {
 	}
 
 	batcher := newBatch(r.Image().Name(), r.dir(), path.Join(r.dir(), "Gemfile"), "/Gemfile")
-	return batcher.runContainer("bridgr_ruby", shell)
+	if pin, ok := lockPin(r.Name(), "bundler"); Locked && ok {
+		batcher.ContainerConfig.Env = append(batcher.ContainerConfig.Env, "BUNDLER_VERSION="+pin.Version)
+	}
+	if err := batcher.runContainer("bridgr_ruby", shell); err != nil {
+		return err
+	}
+	r.lockGems()
+	return nil
 }
@@ -1,7 +1,10 @@
 package bridgr
 
 import (
+	"os"
+	"path"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/distribution/reference"
@@ -126,3 +129,44 @@ func TestRubyItemString(t *testing.T) {
 		})
 	}
 }
+
+func TestRubyLockedGems(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resetLocks(t, true)
+	_ = ReadLock(strings.NewReader(`version: 1
+artifacts:
+  - {worker: ruby, name: rails, version: 5.1.7, path: ruby/gems/rails-5.1.7.gem}
+  - {worker: ruby, name: nokogiri, version: 1.10.0, path: ruby/gems/nokogiri-1.10.0-x86_64-linux.gem}
+  - {worker: ruby, name: bundler, version: 2.1.4, path: ruby/gems/bundler-2.1.4.gem}
+`))
+	r := Ruby{Sources: []string{defaultRbSource}, Gems: []rubyItem{{Package: "rails", Version: "~>5.1.0"}, {Package: "sinatra"}}}
+	if err := r.Setup(); err != nil {
+		t.Fatal(err)
+	}
+	result, _ := os.ReadFile(path.Join(r.dir(), "Gemfile"))
+	expect := "source 'https://rubygems.org'\n\n\ngem 'nokogiri', '1.10.0'\ngem 'rails', '5.1.7'\n\n"
+	if !cmp.Equal(expect, string(result)) {
+		t.Error(cmp.Diff(expect, string(result)))
+	}
+	if expect := []string{"sinatra is not in the lock file"}; !cmp.Equal(expect, locks.drift["ruby"]) {
+		t.Error(cmp.Diff(expect, locks.drift["ruby"]))
+	}
+}
+
+func TestRubyLockGems(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resetLocks(t, false)
+	r := Ruby{}
+	_ = os.MkdirAll(path.Join(r.dir(), "gems"), os.ModePerm)
+	for _, gem := range []string{"aws-sdk-s3-1.48.0.gem", "nokogiri-1.10.0-x86_64-linux.gem", "not-a-gem.gem"} {
+		_ = os.WriteFile(path.Join(r.dir(), "gems", gem), []byte("gem"), 0644)
+	}
+	r.lockGems()
+	expect := []LockEntry{
+		{Worker: "ruby", Name: "aws-sdk-s3", Version: "1.48.0", Path: "ruby/gems/aws-sdk-s3-1.48.0.gem"},
+		{Worker: "ruby", Name: "nokogiri", Version: "1.10.0", Path: "ruby/gems/nokogiri-1.10.0-x86_64-linux.gem"},
+	}
+	if !cmp.Equal(expect, locks.resolved["ruby"]) {
+		t.Error(cmp.Diff(expect, locks.resolved["ruby"]))
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path"
 	"time"
 )
 
@@ -52,7 +53,7 @@ func Serve(addr string, root http.FileSystem) error {
 		return fmt.Errorf("filesystem %s does not exist", root)
 	}
 	fs := http.FileServer(root)
-	handlerChain := logMiddleware(customHeaders(fs))
+	handlerChain := logMiddleware(customHeaders(jsonIndex(root, fs)))
 	http.Handle("/", handlerChain)
 	server := &http.Server{Addr: addr}
 
@@ -77,6 +78,27 @@ func customHeaders(next http.Handler) http.Handler {
 	})
 }
 
+// jsonIndex serves the index.json file of a directory, when one exists. Registries such as npm expect
+// a JSON document at the package URL, which is a directory once written to disk.
+func jsonIndex(root http.FileSystem, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := path.Join(r.URL.Path, "index.json")
+		index, err := root.Open(name)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		defer index.Close()
+		stat, err := index.Stat()
+		if err != nil || stat.IsDir() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		http.ServeContent(w, r, name, stat.ModTime(), index)
+	})
+}
+
 func logMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		timestamp := time.Now().Format(logFmt)
@@ -5,6 +5,8 @@ import (
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path"
 	"strings"
 	"testing"
 )
@@ -43,3 +45,34 @@ func TestLogMiddleware(t *testing.T) {
 		t.Error("logMiddleware handler did not call next")
 	}
 }
+
+func TestJSONIndex(t *testing.T) {
+	root := t.TempDir()
+	_ = os.MkdirAll(path.Join(root, "npm", "cornballer"), os.ModePerm)
+	_ = os.WriteFile(path.Join(root, "npm", "cornballer", "index.json"), []byte(`{"name":"cornballer"}`), 0600)
+	ts := httptest.NewServer(jsonIndex(http.Dir(root), GetTestHandler()))
+	defer ts.Close()
+
+	tests := []struct {
+		name   string
+		path   string
+		expect string
+	}{
+		{"directory with index", "/npm/cornballer", `{"name":"cornballer"}`},
+		{"directory without index", "/npm", "Hello"},
+		{"missing", "/npm/banana-stand", "Hello"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := http.Get(ts.URL + test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer res.Body.Close()
+			body, _ := io.ReadAll(res.Body)
+			if string(body) != test.expect {
+				t.Errorf("expected %q but got %q", test.expect, string(body))
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package bridgr
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// minisign signature algorithms, for signing the content itself or its BLAKE2b-512 digest
+var (
+	minisignPure   = []byte("Ed")
+	minisignHashed = []byte("ED")
+)
+
+// minisignLines gives the lines of a minisign key or signature that are not comments
+func minisignLines(content []byte) []string {
+	var lines []string
+	for _, line := range strings.Split(string(content), "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" && !strings.HasPrefix(line, "untrusted comment:") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// readMinisignKey reads a minisign public key, which is either the key itself or the file it is in
+func readMinisignKey(key string) ([]byte, ed25519.PublicKey, error) {
+	content := []byte(key)
+	if file, err := os.ReadFile(key); err == nil {
+		content = file
+	}
+	lines := minisignLines(content)
+	if len(lines) == 0 {
+		return nil, nil, errors.New("no minisign public key found")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(lines[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid minisign public key: %s", err)
+	}
+	if len(decoded) != 2+8+ed25519.PublicKeySize || !bytes.Equal(decoded[:2], minisignPure) {
+		return nil, nil, errors.New("invalid minisign public key")
+	}
+	return decoded[2:10], ed25519.PublicKey(decoded[10:]), nil
+}
+
+// verifyMinisign checks a minisign signature of the signed content, including the signature of its trusted comment
+func verifyMinisign(key string, signed io.Reader, signature []byte) error {
+	keyID, publicKey, err := readMinisignKey(key)
+	if err != nil {
+		return err
+	}
+	lines := minisignLines(signature)
+	if len(lines) != 3 || !strings.HasPrefix(lines[1], "trusted comment: ") {
+		return errors.New("invalid minisign signature")
+	}
+	decoded, err := base64.StdEncoding.DecodeString(lines[0])
+	if err != nil || len(decoded) != 2+8+ed25519.SignatureSize {
+		return errors.New("invalid minisign signature")
+	}
+	algorithm, sigKeyID, sig := decoded[:2], decoded[2:10], decoded[10:]
+	if !bytes.Equal(keyID, sigKeyID) {
+		return fmt.Errorf("minisign signature is by key %X, not %X", sigKeyID, keyID)
+	}
+	var message []byte
+	switch {
+	case bytes.Equal(algorithm, minisignHashed):
+		digest, _ := blake2b.New512(nil)
+		if _, err := io.Copy(digest, signed); err != nil {
+			return err
+		}
+		message = digest.Sum(nil)
+	case bytes.Equal(algorithm, minisignPure):
+		if message, err = io.ReadAll(signed); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported minisign signature algorithm %q", algorithm)
+	}
+	if !ed25519.Verify(publicKey, message, sig) {
+		return errors.New("minisign signature verification failed")
+	}
+	global, err := base64.StdEncoding.DecodeString(lines[2])
+	if err != nil {
+		return errors.New("invalid minisign trusted comment signature")
+	}
+	comment := strings.TrimPrefix(lines[1], "trusted comment: ")
+	if !ed25519.Verify(publicKey, append(append([]byte{}, sig...), comment...), global) {
+		return errors.New("minisign trusted comment verification failed")
+	}
+	return nil
+}
+
+// cosignBundle is a bundle written by cosign sign-blob --bundle, in the original format or the Sigstore bundle format
+type cosignBundle struct {
+	Base64Signature string `json:"base64Signature"`
+	Cert            string `json:"cert"`
+	RekorBundle     struct {
+		Payload struct {
+			IntegratedTime int64 `json:"integratedTime"`
+		} `json:"Payload"`
+	} `json:"rekorBundle"`
+
+	VerificationMaterial struct {
+		Certificate struct {
+			RawBytes string `json:"rawBytes"`
+		} `json:"certificate"`
+		X509CertificateChain struct {
+			Certificates []struct {
+				RawBytes string `json:"rawBytes"`
+			} `json:"certificates"`
+		} `json:"x509CertificateChain"`
+		TlogEntries []struct {
+			IntegratedTime string `json:"integratedTime"`
+		} `json:"tlogEntries"`
+	} `json:"verificationMaterial"`
+	MessageSignature struct {
+		Signature string `json:"signature"`
+	} `json:"messageSignature"`
+}
+
+// cosignVerifier holds what a cosign bundle is checked against: a public key, or the signing certificate's identity and roots
+type cosignVerifier struct {
+	Key      string
+	Identity string
+	Issuer   string
+	Roots    string
+}
+
+// Fulcio certificate extensions holding the OIDC issuer, as a raw string and as a DER encoded string
+var (
+	fulcioIssuerV1 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	fulcioIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+func (b cosignBundle) signature() ([]byte, error) {
+	sig := b.Base64Signature
+	if sig == "" {
+		sig = b.MessageSignature.Signature
+	}
+	if sig == "" {
+		return nil, errors.New("cosign bundle has no signature")
+	}
+	return base64.StdEncoding.DecodeString(sig)
+}
+
+// certificate gives the signing certificate of a bundle, nil when it was signed with a key
+func (b cosignBundle) certificate() (*x509.Certificate, error) {
+	var der []byte
+	switch {
+	case b.Cert != "":
+		content, err := base64.StdEncoding.DecodeString(b.Cert)
+		if err != nil {
+			content = []byte(b.Cert)
+		}
+		block, _ := pem.Decode(content)
+		if block == nil {
+			return nil, errors.New("invalid certificate in cosign bundle")
+		}
+		der = block.Bytes
+	case b.VerificationMaterial.Certificate.RawBytes != "":
+		der, _ = base64.StdEncoding.DecodeString(b.VerificationMaterial.Certificate.RawBytes)
+	case len(b.VerificationMaterial.X509CertificateChain.Certificates) > 0:
+		der, _ = base64.StdEncoding.DecodeString(b.VerificationMaterial.X509CertificateChain.Certificates[0].RawBytes)
+	default:
+		return nil, nil
+	}
+	return x509.ParseCertificate(der)
+}
+
+// signedAt is when the transparency log recorded the signature, which the short lived signing certificate must be valid at
+func (b cosignBundle) signedAt() (time.Time, error) {
+	if b.RekorBundle.Payload.IntegratedTime > 0 {
+		return time.Unix(b.RekorBundle.Payload.IntegratedTime, 0), nil
+	}
+	for _, entry := range b.VerificationMaterial.TlogEntries {
+		if seconds, err := strconv.ParseInt(entry.IntegratedTime, 10, 64); err == nil && seconds > 0 {
+			return time.Unix(seconds, 0), nil
+		}
+	}
+	return time.Time{}, errors.New("cosign bundle has no transparency log entry")
+}
+
+// verifyCosign checks a cosign bundle of the signed content. With a Key, the signature is checked with it. Otherwise the signing
+// certificate in the bundle must chain to the Roots, and be issued to the Identity by the OIDC Issuer.
+func verifyCosign(verifier cosignVerifier, signed io.Reader, bundle []byte) error {
+	b := cosignBundle{}
+	if err := json.Unmarshal(bundle, &b); err != nil {
+		return fmt.Errorf("invalid cosign bundle: %s", err)
+	}
+	sig, err := b.signature()
+	if err != nil {
+		return err
+	}
+
+	var publicKey crypto.PublicKey
+	if verifier.Key != "" {
+		if publicKey, err = readPublicKey(verifier.Key); err != nil {
+			return err
+		}
+	} else {
+		cert, err := b.certificate()
+		if err != nil {
+			return err
+		}
+		if cert == nil {
+			return errors.New("cosign bundle has no certificate, a cosign key is needed to verify it")
+		}
+		if err := verifier.checkCertificate(cert, b); err != nil {
+			return err
+		}
+		publicKey = cert.PublicKey
+	}
+
+	if key, ok := publicKey.(ed25519.PublicKey); ok {
+		message, err := io.ReadAll(signed)
+		if err != nil {
+			return err
+		}
+		if !ed25519.Verify(key, message, sig) {
+			return errors.New("cosign signature verification failed")
+		}
+		return nil
+	}
+	hash := sha256.New()
+	if _, err := io.Copy(hash, signed); err != nil {
+		return err
+	}
+	digest := hash.Sum(nil)
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest, sig) {
+			return errors.New("cosign signature verification failed")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig); err != nil {
+			return fmt.Errorf("cosign signature verification failed: %s", err)
+		}
+	default:
+		return fmt.Errorf("unsupported cosign key type %T", publicKey)
+	}
+	return nil
+}
+
+func (v cosignVerifier) checkCertificate(cert *x509.Certificate, b cosignBundle) error {
+	if v.Roots == "" || v.Identity == "" || v.Issuer == "" {
+		return errors.New("a cosign key, or the certificate identity, OIDC issuer and roots, are needed to verify a cosign bundle")
+	}
+	content, err := os.ReadFile(v.Roots)
+	if err != nil {
+		return err
+	}
+	roots := x509.NewCertPool()
+	if !roots.AppendCertsFromPEM(content) {
+		return fmt.Errorf("no certificates found in %s", v.Roots)
+	}
+	signedAt, err := b.signedAt()
+	if err != nil {
+		return err
+	}
+	// the roots file usually holds the intermediate certificates too
+	opts := x509.VerifyOptions{Roots: roots, Intermediates: roots, CurrentTime: signedAt, KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning}}
+	if _, err := cert.Verify(opts); err != nil {
+		return fmt.Errorf("cosign certificate is not trusted: %s", err)
+	}
+
+	identities := append([]string{}, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		identities = append(identities, uri.String())
+	}
+	if !slices.Contains(identities, v.Identity) {
+		return fmt.Errorf("cosign certificate is issued to %s, not %s", strings.Join(identities, ", "), v.Identity)
+	}
+	issuer := ""
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(fulcioIssuerV2):
+			_, _ = asn1.Unmarshal(ext.Value, &issuer)
+		case ext.Id.Equal(fulcioIssuerV1) && issuer == "":
+			issuer = string(ext.Value)
+		}
+	}
+	if issuer != v.Issuer {
+		return fmt.Errorf("cosign certificate is from OIDC issuer %q, not %q", issuer, v.Issuer)
+	}
+	return nil
+}
+
+// readPublicKey reads a PEM encoded public key file
+func readPublicKey(file string) (crypto.PublicKey, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM encoded public key found in %s", file)
+	}
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
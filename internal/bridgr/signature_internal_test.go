@@ -0,0 +1,190 @@
+package bridgr
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// testMinisign gives a minisign public key and a signer of content, with the algorithm of minisign -H or -l
+func testMinisign(t *testing.T) (string, func(content []byte, algorithm []byte) []byte) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyID := []byte("bluthco!")
+	key := "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), public...)) + "\n"
+	sign := func(content []byte, algorithm []byte) []byte {
+		message := content
+		if bytes.Equal(algorithm, minisignHashed) {
+			digest := blake2b.Sum512(content)
+			message = digest[:]
+		}
+		sig := ed25519.Sign(private, message)
+		comment := "timestamp:1700000000\tfile:banana.tar.gz"
+		global := ed25519.Sign(private, append(append([]byte{}, sig...), comment...))
+		return []byte("untrusted comment: signature from minisign secret key\n" +
+			base64.StdEncoding.EncodeToString(append(append(append([]byte{}, algorithm...), keyID...), sig...)) + "\n" +
+			"trusted comment: " + comment + "\n" +
+			base64.StdEncoding.EncodeToString(global) + "\n")
+	}
+	return key, sign
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	t.Chdir(t.TempDir())
+	key, sign := testMinisign(t)
+	otherKey, _ := testMinisign(t)
+	_ = os.WriteFile("minisign.pub", []byte(key), 0644)
+	content := []byte("there's always money in the banana stand")
+	tampered := bytes.Replace(sign(content, minisignHashed), []byte("trusted comment: timestamp"), []byte("trusted comment: timeshare"), 1)
+
+	tests := []struct {
+		name      string
+		key       string
+		content   []byte
+		signature []byte
+		isError   bool
+	}{
+		{"prehashed", key, content, sign(content, minisignHashed), false},
+		{"legacy", key, content, sign(content, minisignPure), false},
+		{"key file", "minisign.pub", content, sign(content, minisignHashed), false},
+		{"key line", strings.Split(key, "\n")[1], content, sign(content, minisignHashed), false},
+		{"modified content", key, []byte("there's always money"), sign(content, minisignHashed), true},
+		{"other key", otherKey, content, sign(content, minisignHashed), true},
+		{"tampered comment", key, content, tampered, true},
+		{"not a signature", key, content, []byte("gob"), true},
+		{"not a key", "gob", content, sign(content, minisignHashed), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := verifyMinisign(test.key, bytes.NewReader(test.content), test.signature)
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+		})
+	}
+}
+
+// testCosignCA writes a root certificate to roots, and gives a function for issuing signing certificates from it
+func testCosignCA(t *testing.T, roots string) func(email, issuer string, key *ecdsa.PrivateKey) []byte {
+	t.Helper()
+	caKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	ca := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "bluth-fulcio"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, ca, ca, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = os.WriteFile(roots, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}), 0644)
+	ca, _ = x509.ParseCertificate(caDER)
+
+	return func(email, issuer string, key *ecdsa.PrivateKey) []byte {
+		issuerValue, _ := asn1.Marshal(issuer)
+		cert := &x509.Certificate{
+			SerialNumber:    big.NewInt(2),
+			NotBefore:       time.Now().Add(-time.Minute),
+			NotAfter:        time.Now().Add(10 * time.Minute),
+			EmailAddresses:  []string{email},
+			KeyUsage:        x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+			ExtraExtensions: []pkix.Extension{{Id: fulcioIssuerV2, Value: issuerValue}},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, cert, ca, &key.PublicKey, caKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	}
+}
+
+func TestVerifyCosign(t *testing.T) {
+	t.Chdir(t.TempDir())
+	content := []byte("there's always money in the banana stand")
+	digest := sha256.Sum256(content)
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	publicDER, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	_ = os.WriteFile("cosign.pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER}), 0644)
+	otherKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	otherDER, _ := x509.MarshalPKIXPublicKey(&otherKey.PublicKey)
+	_ = os.WriteFile("other.pub", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: otherDER}), 0644)
+	sig, _ := ecdsa.SignASN1(rand.Reader, key, digest[:])
+	issue := testCosignCA(t, "fulcio.pem")
+	testCosignCA(t, "other-fulcio.pem")
+
+	cert := issue("george@bluth.com", "https://accounts.bluth.com", key)
+	bundle := func(b map[string]interface{}) []byte {
+		content, _ := json.Marshal(b)
+		return content
+	}
+	signedAt := time.Now().Unix()
+	legacy := bundle(map[string]interface{}{
+		"base64Signature": base64.StdEncoding.EncodeToString(sig),
+		"cert":            base64.StdEncoding.EncodeToString(cert),
+		"rekorBundle":     map[string]interface{}{"Payload": map[string]interface{}{"integratedTime": signedAt}},
+	})
+	block, _ := pem.Decode(cert)
+	sigstore := bundle(map[string]interface{}{
+		"mediaType": "application/vnd.dev.sigstore.bundle.v0.3+json",
+		"verificationMaterial": map[string]interface{}{
+			"certificate": map[string]interface{}{"rawBytes": base64.StdEncoding.EncodeToString(block.Bytes)},
+			"tlogEntries": []interface{}{map[string]interface{}{"integratedTime": strconv.FormatInt(signedAt, 10)}},
+		},
+		"messageSignature": map[string]interface{}{"signature": base64.StdEncoding.EncodeToString(sig)},
+	})
+	keyed := bundle(map[string]interface{}{"base64Signature": base64.StdEncoding.EncodeToString(sig)})
+	keyless := cosignVerifier{Identity: "george@bluth.com", Issuer: "https://accounts.bluth.com", Roots: "fulcio.pem"}
+
+	tests := []struct {
+		name     string
+		verifier cosignVerifier
+		content  []byte
+		bundle   []byte
+		isError  bool
+	}{
+		{"key", cosignVerifier{Key: "cosign.pub"}, content, keyed, false},
+		{"other key", cosignVerifier{Key: "other.pub"}, content, keyed, true},
+		{"modified content", cosignVerifier{Key: "cosign.pub"}, []byte("there's always money"), keyed, true},
+		{"keyless", keyless, content, legacy, false},
+		{"keyless sigstore bundle", keyless, content, sigstore, false},
+		{"keyless without certificate", keyless, content, keyed, true},
+		{"other identity", cosignVerifier{Identity: "gob@bluth.com", Issuer: keyless.Issuer, Roots: keyless.Roots}, content, legacy, true},
+		{"other issuer", cosignVerifier{Identity: keyless.Identity, Issuer: "https://accounts.sitwell.com", Roots: keyless.Roots}, content, legacy, true},
+		{"untrusted certificate", cosignVerifier{Identity: keyless.Identity, Issuer: keyless.Issuer, Roots: "other-fulcio.pem"}, content, legacy, true},
+		{"no identity", cosignVerifier{Roots: keyless.Roots}, content, legacy, true},
+		{"not a bundle", keyless, content, []byte("gob"), true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := verifyCosign(test.verifier, bytes.NewReader(test.content), test.bundle)
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+		})
+	}
+}
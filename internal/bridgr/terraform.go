@@ -0,0 +1,367 @@
+package bridgr
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/distribution/reference"
+	"github.com/mitchellh/mapstructure"
+	"golang.org/x/mod/sumdb/dirhash"
+	log "unknwon.dev/clog/v2"
+)
+
+const (
+	defaultTerraformRegistry = "registry.terraform.io"
+	defaultTerraformPlatform = "linux_amd64"
+)
+
+// Terraform is the configuration object for creating a Terraform provider network mirror
+type Terraform struct {
+	Platforms []string
+	Providers []terraformProvider
+}
+
+type terraformProvider struct {
+	Source  string
+	Version string
+}
+
+// terraformVersions is the list of available versions of a provider, from the provider registry protocol
+type terraformVersions struct {
+	Versions []struct {
+		Version   string `json:"version"`
+		Platforms []struct {
+			OS   string `json:"os"`
+			Arch string `json:"arch"`
+		} `json:"platforms"`
+	} `json:"versions"`
+}
+
+// terraformDownload is the location of a provider package for one platform, from the provider registry protocol
+type terraformDownload struct {
+	Filename    string `json:"filename"`
+	DownloadURL string `json:"download_url"`
+	Shasum      string `json:"shasum"`
+}
+
+// terraformArchive is a provider package in a <version>.json file of the network mirror protocol
+type terraformArchive struct {
+	URL    string   `json:"url"`
+	Hashes []string `json:"hashes,omitempty"`
+}
+
+func (tp terraformProvider) String() string {
+	if tp.Version != "" {
+		return tp.Source + "@" + tp.Version
+	}
+	return tp.Source
+}
+
+// address splits a provider source address into its registry hostname, namespace and type.
+// The hostname can be left out of the address, ie "hashicorp/aws" is "registry.terraform.io/hashicorp/aws".
+func (tp terraformProvider) address() (string, string, string, error) {
+	parts := strings.Split(strings.ToLower(tp.Source), "/")
+	switch len(parts) {
+	case 2:
+		return defaultTerraformRegistry, parts[0], parts[1], nil
+	case 3:
+		return parts[0], parts[1], parts[2], nil
+	}
+	return "", "", "", fmt.Errorf("invalid provider source address %s", tp.Source)
+}
+
+// dir is the top-level directory name for all objects written out under the Terraform worker
+func (t Terraform) dir() string {
+	return BaseDir(t.Name())
+}
+
+// Name returns the name of this Configuration
+func (t Terraform) Name() string {
+	return "terraform"
+}
+
+// Image implements the Imager interface
+func (t Terraform) Image() reference.Named {
+	return nil
+}
+
+func stringToTerraformProvider(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf(terraformProvider{}) {
+		return data, nil
+	}
+	parts := strings.SplitN(data.(string), "@", 2)
+	provider := terraformProvider{Source: strings.TrimSpace(parts[0])}
+	if len(parts) > 1 {
+		provider.Version = strings.TrimSpace(parts[1])
+	}
+	return provider, nil
+}
+
+func arrayToTerraform(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Slice || t != reflect.TypeOf(Terraform{}) {
+		return data, nil
+	}
+	return map[string]interface{}{"providers": data}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (t *Terraform) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		arrayToTerraform,
+		stringToTerraformProvider,
+	)
+}
+
+// Setup prepares the directory for the Terraform provider mirror
+func (t *Terraform) Setup() error {
+	log.Trace("Called Terraform.Setup()")
+	if len(t.Platforms) == 0 {
+		t.Platforms = []string{defaultTerraformPlatform}
+	}
+	return os.MkdirAll(t.dir(), os.ModePerm)
+}
+
+// Run downloads the newest version of each provider matching its constraint, for every configured platform, and writes the
+// network mirror metadata for it
+func (t *Terraform) Run() error {
+	if err := t.Setup(); err != nil {
+		return err
+	}
+	forEach(len(t.Providers), func(i int) {
+		if err := t.mirror(t.Providers[i]); err != nil {
+			log.Info("Terraform: unable to mirror %s - %s", t.Providers[i], err)
+		}
+	})
+	return nil
+}
+
+// mirror fetches one provider from its registry into the mirror
+func (t *Terraform) mirror(provider terraformProvider) error {
+	hostname, namespace, name, err := provider.address()
+	if err != nil {
+		return err
+	}
+	base, err := terraformProviderService(hostname)
+	if err != nil {
+		return err
+	}
+	base = base + namespace + "/" + name + "/"
+
+	available := terraformVersions{}
+	if err := getJSON(base+"versions", &available); err != nil {
+		return err
+	}
+	candidates := make([]string, 0, len(available.Versions))
+	for _, v := range available.Versions {
+		candidates = append(candidates, v.Version)
+	}
+	version, err := pickTerraformVersion(candidates, provider.Version)
+	if err != nil {
+		return err
+	}
+
+	offered := map[string]bool{}
+	for _, v := range available.Versions {
+		if v.Version == version {
+			for _, p := range v.Platforms {
+				offered[p.OS+"_"+p.Arch] = true
+			}
+		}
+	}
+	providerDir := filepath.Join(t.dir(), hostname, namespace, name)
+	archives := map[string]terraformArchive{}
+	for _, platform := range t.Platforms {
+		if !offered[platform] {
+			log.Info("Terraform: %s/%s %s is not available for %s", namespace, name, version, platform)
+			continue
+		}
+		archive, err := t.download(base+version+"/download/"+strings.Replace(platform, "_", "/", 1), providerDir)
+		if err != nil {
+			log.Info("Terraform: unable to download %s/%s %s for %s - %s", namespace, name, version, platform, err)
+			continue
+		}
+		archives[platform] = archive
+	}
+	if len(archives) == 0 {
+		return errors.New("no provider packages were downloaded")
+	}
+	if err := writeTerraformVersion(providerDir, version, archives); err != nil {
+		return err
+	}
+	return writeTerraformIndex(providerDir)
+}
+
+// download fetches the provider package for a platform, verifies it against the registry's checksum, and gives its mirror archive entry
+func (t *Terraform) download(source, providerDir string) (terraformArchive, error) {
+	dl := terraformDownload{}
+	if err := getJSON(source, &dl); err != nil {
+		return terraformArchive{}, err
+	}
+	downloadURL, err := url.Parse(source)
+	if err != nil {
+		return terraformArchive{}, err
+	}
+	if downloadURL, err = downloadURL.Parse(dl.DownloadURL); err != nil {
+		return terraformArchive{}, err
+	}
+	filename := dl.Filename
+	if filename == "" {
+		filename = path.Base(downloadURL.Path)
+	}
+	target := filepath.Join(providerDir, filename)
+	if sum, err := fileChecksum(target, "sha256"); err != nil || sum != dl.Shasum {
+		if err := download(downloadURL, target); err != nil {
+			return terraformArchive{}, err
+		}
+		if sum, err = fileChecksum(target, "sha256"); err != nil {
+			return terraformArchive{}, err
+		}
+		if sum != dl.Shasum {
+			_ = os.Remove(target)
+			return terraformArchive{}, fmt.Errorf("checksum mismatch, expected %s but got %s", dl.Shasum, sum)
+		}
+	} else if err := lockExisting(target); err != nil {
+		return terraformArchive{}, err
+	}
+	h1, err := dirhash.HashZip(target, dirhash.Hash1)
+	if err != nil {
+		return terraformArchive{}, err
+	}
+	return terraformArchive{URL: filename, Hashes: []string{h1, "zh:" + dl.Shasum}}, nil
+}
+
+// terraformProviderService discovers the base URL of the provider registry protocol for a registry hostname
+func terraformProviderService(hostname string) (string, error) {
+	discovery, err := url.Parse("https://" + hostname + "/.well-known/terraform.json")
+	if err != nil {
+		return "", err
+	}
+	services := map[string]interface{}{}
+	if err := getJSON(discovery.String(), &services); err != nil {
+		return "", err
+	}
+	providers, ok := services["providers.v1"].(string)
+	if !ok {
+		return "", fmt.Errorf("%s does not offer the provider registry protocol", hostname)
+	}
+	service, err := discovery.Parse(providers)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(service.String(), "/") + "/", nil
+}
+
+// pickTerraformVersion gives the newest version matching a Terraform version constraint. Pre-releases are only picked when asked for exactly.
+func pickTerraformVersion(versions []string, spec string) (string, error) {
+	constraint, err := terraformConstraint(spec)
+	if err != nil {
+		return "", err
+	}
+	var best *semver.Version
+	for _, candidate := range versions {
+		parsed, err := semver.NewVersion(candidate)
+		if err != nil || !constraint.Check(parsed) {
+			continue
+		}
+		if best == nil || parsed.GreaterThan(best) {
+			best = parsed
+		}
+	}
+	if best == nil {
+		return "", fmt.Errorf("no version matching %s", spec)
+	}
+	return best.Original(), nil
+}
+
+// terraformConstraint reads a Terraform version constraint. The pessimistic "~>" operator only allows the rightmost
+// version segment to increase, ie "~> 5.1" is ">= 5.1, < 6.0" and "~> 5.1.0" is ">= 5.1.0, < 5.2.0".
+func terraformConstraint(spec string) (*semver.Constraints, error) {
+	if strings.TrimSpace(spec) == "" {
+		spec = "*"
+	}
+	parts := strings.Split(spec, ",")
+	for i, part := range parts {
+		part = strings.TrimSpace(part)
+		if !strings.HasPrefix(part, "~>") {
+			parts[i] = part
+			continue
+		}
+		version := strings.TrimSpace(strings.TrimPrefix(part, "~>"))
+		if !strings.Contains(version, ".") {
+			parts[i] = ">= " + version
+			continue
+		}
+		upper, err := pessimisticUpper(version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %s", part)
+		}
+		parts[i] = ">= " + version + ", < " + upper
+	}
+	return semver.NewConstraint(strings.Join(parts, ", "))
+}
+
+// pessimisticUpper gives the exclusive upper bound of a pessimistic version constraint, where only the rightmost segment of
+// the version can increase, ie "5.1" gives "6" and "5.1.0" gives "5.2". The version must have at least two segments.
+func pessimisticUpper(version string) (string, error) {
+	segments := strings.Split(strings.SplitN(version, "-", 2)[0], ".")
+	if len(segments) < 2 {
+		return "", fmt.Errorf("%s needs at least two version segments", version)
+	}
+	upper := segments[:len(segments)-1]
+	last, err := strconv.Atoi(upper[len(upper)-1])
+	if err != nil {
+		return "", err
+	}
+	upper[len(upper)-1] = strconv.Itoa(last + 1)
+	return strings.Join(upper, "."), nil
+}
+
+// writeTerraformVersion writes the <version>.json file for a provider version. Archives for platforms from earlier runs are kept.
+func writeTerraformVersion(providerDir, version string, archives map[string]terraformArchive) error {
+	target := filepath.Join(providerDir, version+".json")
+	existing := struct {
+		Archives map[string]terraformArchive `json:"archives"`
+	}{Archives: map[string]terraformArchive{}}
+	if content, err := os.ReadFile(target); err == nil {
+		_ = json.Unmarshal(content, &existing)
+	}
+	for platform, archive := range archives {
+		existing.Archives[platform] = archive
+	}
+	content, err := json.MarshalIndent(existing, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(target, content, 0644) //nolint:gosec // repository content is meant to be readable
+}
+
+// writeTerraformIndex writes the index.json file for a provider, listing every version that has a <version>.json in the mirror
+func writeTerraformIndex(providerDir string) error {
+	files, err := filepath.Glob(filepath.Join(providerDir, "*.json"))
+	if err != nil {
+		return err
+	}
+	index := struct {
+		Versions map[string]struct{} `json:"versions"`
+	}{Versions: map[string]struct{}{}}
+	for _, file := range files {
+		version := strings.TrimSuffix(filepath.Base(file), ".json")
+		if _, err := semver.NewVersion(version); err == nil {
+			index.Versions[version] = struct{}{}
+		}
+	}
+	content, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(providerDir, "index.json"), content, 0644) //nolint:gosec // repository content is meant to be readable
+}
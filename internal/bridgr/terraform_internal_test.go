@@ -0,0 +1,195 @@
+package bridgr
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func terraformProviderZip() []byte {
+	content := bytes.Buffer{}
+	archive := zip.NewWriter(&content)
+	f, _ := archive.Create("terraform-provider-banana_v1.1.0")
+	_, _ = f.Write([]byte("there's always money in the banana stand"))
+	_ = archive.Close()
+	return content.Bytes()
+}
+
+func terraformRegistry() *httptest.Server {
+	pkg := terraformProviderZip()
+	sum := sha256.Sum256(pkg)
+	shasum := hex.EncodeToString(sum[:])
+	return httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/terraform.json":
+			fmt.Fprint(w, `{"providers.v1":"/v1/providers/"}`)
+		case "/v1/providers/bluth/banana/versions":
+			fmt.Fprint(w, `{"versions":[
+				{"version":"1.0.0","platforms":[{"os":"linux","arch":"amd64"}]},
+				{"version":"1.1.0","platforms":[{"os":"linux","arch":"amd64"},{"os":"darwin","arch":"arm64"}]},
+				{"version":"2.0.0","platforms":[{"os":"linux","arch":"amd64"}]},
+				{"version":"2.1.0-beta","platforms":[{"os":"linux","arch":"amd64"}]}
+			]}`)
+		case "/v1/providers/bluth/banana/1.1.0/download/linux/amd64":
+			fmt.Fprintf(w, `{"filename":"terraform-provider-banana_1.1.0_linux_amd64.zip","download_url":"/files/banana_linux_amd64.zip","shasum":"%s"}`, shasum)
+		case "/v1/providers/bluth/banana/1.1.0/download/darwin/arm64":
+			fmt.Fprint(w, `{"filename":"terraform-provider-banana_1.1.0_darwin_arm64.zip","download_url":"/files/banana_darwin_arm64.zip","shasum":"0000"}`)
+		case "/files/banana_linux_amd64.zip", "/files/banana_darwin_arm64.zip":
+			_, _ = w.Write(pkg)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestTerraformDir(t *testing.T) {
+	expected := BaseDir("terraform")
+	result := Terraform{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestStringToTerraformProvider(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  interface{}
+		expect interface{}
+	}{
+		{"source only", "hashicorp/aws", terraformProvider{Source: "hashicorp/aws"}},
+		{"with version", "hashicorp/aws@~> 5.0", terraformProvider{Source: "hashicorp/aws", Version: "~> 5.0"}},
+		{"not a string", 42, 42},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := stringToTerraformProvider(reflect.TypeOf(test.input), reflect.TypeOf(terraformProvider{}), test.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestArrayToTerraform(t *testing.T) {
+	input := []interface{}{"hashicorp/aws"}
+	result, _ := arrayToTerraform(reflect.TypeOf(input), reflect.TypeOf(Terraform{}), input)
+	expect := map[string]interface{}{"providers": input}
+	if !cmp.Equal(expect, result) {
+		t.Error(cmp.Diff(expect, result))
+	}
+}
+
+func TestTerraformProviderAddress(t *testing.T) {
+	tests := []struct {
+		source string
+		expect []string
+		err    bool
+	}{
+		{"hashicorp/aws", []string{"registry.terraform.io", "hashicorp", "aws"}, false},
+		{"tf.bluth.com/Bluth/Banana", []string{"tf.bluth.com", "bluth", "banana"}, false},
+		{"aws", []string{"", "", ""}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.source, func(t *testing.T) {
+			hostname, namespace, name, err := terraformProvider{Source: test.source}.address()
+			if (err != nil) != test.err {
+				t.Errorf("unexpected error result: %v", err)
+			}
+			if !cmp.Equal(test.expect, []string{hostname, namespace, name}) {
+				t.Error(cmp.Diff(test.expect, []string{hostname, namespace, name}))
+			}
+		})
+	}
+}
+
+func TestPickTerraformVersion(t *testing.T) {
+	versions := []string{"4.9.0", "5.0.0", "5.1.0", "5.1.3", "5.2.0", "6.0.0", "6.1.0-beta1"}
+	tests := []struct {
+		spec   string
+		expect string
+	}{
+		{"", "6.0.0"},
+		{"~> 5.0", "5.2.0"},
+		{"~> 5.1.0", "5.1.3"},
+		{">= 5.0, < 5.2", "5.1.3"},
+		{"5.0.0", "5.0.0"},
+		{"= 6.1.0-beta1", "6.1.0-beta1"},
+		{"!= 6.0.0, < 7", "5.2.0"},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			result, err := pickTerraformVersion(versions, test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+
+	if _, err := pickTerraformVersion(versions, "~> 7.0"); err == nil {
+		t.Error("expected an error when no version matches")
+	}
+}
+
+func TestTerraformRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := terraformRegistry()
+	defer server.Close()
+	trustServer(t, server)
+	hostname := server.Listener.Addr().String()
+
+	terraform := Terraform{
+		Platforms: []string{"linux_amd64", "darwin_arm64", "windows_amd64"},
+		Providers: []terraformProvider{{Source: hostname + "/bluth/banana", Version: "~> 1.0"}},
+	}
+	if err := terraform.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	providerDir := filepath.Join(terraform.dir(), hostname, "bluth", "banana")
+	index, _ := os.ReadFile(filepath.Join(providerDir, "index.json"))
+	if !strings.Contains(string(index), `"1.1.0": {}`) {
+		t.Errorf("expected index.json to list version 1.1.0, got %s", index)
+	}
+
+	version := struct {
+		Archives map[string]terraformArchive `json:"archives"`
+	}{}
+	content, _ := os.ReadFile(filepath.Join(providerDir, "1.1.0.json"))
+	if err := json.Unmarshal(content, &version); err != nil {
+		t.Fatal(err)
+	}
+	archive, ok := version.Archives["linux_amd64"]
+	if !ok {
+		t.Fatalf("expected a linux_amd64 archive, got %s", content)
+	}
+	if archive.URL != "terraform-provider-banana_1.1.0_linux_amd64.zip" {
+		t.Errorf("unexpected archive url %s", archive.URL)
+	}
+	if len(archive.Hashes) != 2 || !strings.HasPrefix(archive.Hashes[0], "h1:") || !strings.HasPrefix(archive.Hashes[1], "zh:") {
+		t.Errorf("expected h1 and zh hashes, got %v", archive.Hashes)
+	}
+	if _, ok := version.Archives["darwin_arm64"]; ok {
+		t.Error("expected the archive with a bad checksum to be left out")
+	}
+	if _, err := os.Stat(filepath.Join(providerDir, "terraform-provider-banana_1.1.0_darwin_arm64.zip")); err == nil {
+		t.Error("expected the archive with a bad checksum to be removed")
+	}
+}
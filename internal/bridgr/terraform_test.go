@@ -0,0 +1,33 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTerraformImage(t *testing.T) {
+	terraform := bridgr.Terraform{}
+	if terraform.Image() != nil {
+		t.Errorf("expected nil, but got %+v", terraform.Image())
+	}
+}
+
+func TestTerraformName(t *testing.T) {
+	expected := "terraform"
+	terraform := bridgr.Terraform{}
+	if !cmp.Equal(expected, terraform.Name()) {
+		t.Error(cmp.Diff(expected, terraform.Name()))
+	}
+}
+
+func TestTerraformHook(t *testing.T) {
+	terraform := bridgr.Terraform{}
+	result := reflect.TypeOf(terraform.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
@@ -0,0 +1,242 @@
+package bridgr
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/client"
+	gitclient "gopkg.in/src-d/go-git.v4/plumbing/transport/client"
+	githttp "gopkg.in/src-d/go-git.v4/plumbing/transport/http"
+	log "unknwon.dev/clog/v2"
+)
+
+// TLS is the tls section of the config file. Its options apply to every host, and the options of a host under Hosts
+// take their place for that host. Certificates are always verified, unless a host is explicitly made Insecure.
+type TLS struct {
+	TLSOptions `mapstructure:",squash"`
+	Hosts      map[string]TLSOptions `mapstructure:"hosts"`
+}
+
+// TLSOptions are the TLS settings for connecting to a host
+type TLSOptions struct {
+	// CA is a PEM file of certificates that are trusted along with the system's, ie for a proxy that intercepts TLS
+	CA string `mapstructure:"ca"`
+	// Cert and Key are the PEM files of a client certificate, for servers that require mutual TLS
+	Cert string `mapstructure:"cert"`
+	Key  string `mapstructure:"key"`
+	// MinVersion is the lowest TLS version allowed, one of 1.0, 1.1, 1.2 or 1.3
+	MinVersion string `mapstructure:"min_version"`
+	// Insecure skips the verification of certificates. It may only be set for a host.
+	Insecure bool `mapstructure:"insecure"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1":   tls.VersionTLS10, // an unquoted 1.0 in YAML is a number
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// tlsTrust is the TLS configuration of every host, made from a TLS config section
+type tlsTrust struct {
+	global *tls.Config
+	hosts  map[string]*tls.Config
+	// warned has the registries already warned about by registryTLS
+	warned map[string]bool
+}
+
+var (
+	trustMu sync.Mutex
+	trust   = &tlsTrust{global: &tls.Config{}, hosts: map[string]*tls.Config{}, warned: map[string]bool{}}
+)
+
+// ConfigureTLS loads the CA bundles and client certificates of a TLS config section, and applies them to the connections of every
+// worker. Git, S3 and HTTP fetches all verify with it, as does the connection to a Docker daemon at a tcp:// DOCKER_HOST listed in Hosts.
+func ConfigureTLS(conf TLS) error {
+	if conf.Insecure {
+		return errors.New("insecure may only be set for a host, not for every host")
+	}
+	global, err := conf.config(conf.TLSOptions)
+	if err != nil {
+		return err
+	}
+	next := &tlsTrust{global: global, hosts: map[string]*tls.Config{}, warned: map[string]bool{}}
+	for host, options := range conf.Hosts {
+		if options.Insecure {
+			log.Warn("TLS certificates of %s will not be verified", host)
+		}
+		if next.hosts[strings.ToLower(host)], err = conf.config(options); err != nil {
+			return fmt.Errorf("tls for %s: %s", host, err)
+		}
+	}
+	trustMu.Lock()
+	trust = next
+	trustMu.Unlock()
+	return configureDocker(next)
+}
+
+// config makes the TLS configuration of host options, with the global options in place of any that are not set
+func (t TLS) config(options TLSOptions) (*tls.Config, error) {
+	if options.CA == "" {
+		options.CA = t.CA
+	}
+	if options.Cert == "" && options.Key == "" {
+		options.Cert, options.Key = t.Cert, t.Key
+	}
+	if options.MinVersion == "" {
+		options.MinVersion = t.MinVersion
+	}
+
+	config := &tls.Config{InsecureSkipVerify: options.Insecure} //nolint:gosec // only for hosts that are explicitly insecure
+	if options.MinVersion != "" {
+		version, ok := tlsVersions[options.MinVersion]
+		if !ok {
+			return nil, fmt.Errorf("unknown min_version %s, expected one of 1.0, 1.1, 1.2 or 1.3", options.MinVersion)
+		}
+		config.MinVersion = version
+	}
+	if options.CA != "" {
+		pem, err := os.ReadFile(options.CA)
+		if err != nil {
+			return nil, err
+		}
+		roots, err := x509.SystemCertPool()
+		if err != nil {
+			roots = x509.NewCertPool()
+		}
+		if !roots.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", options.CA)
+		}
+		config.RootCAs = roots
+	}
+	if options.Cert != "" || options.Key != "" {
+		cert, err := tls.LoadX509KeyPair(options.Cert, options.Key)
+		if err != nil {
+			return nil, fmt.Errorf("client certificate: %s", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// tlsConfig gives the TLS configuration for connecting to a host
+func tlsConfig(host string) *tls.Config {
+	trustMu.Lock()
+	defer trustMu.Unlock()
+	if config, ok := trust.hosts[strings.ToLower(host)]; ok {
+		return config.Clone()
+	}
+	return trust.global.Clone()
+}
+
+// hostTransport is an http.RoundTripper that connects to each host with its own TLS configuration
+type hostTransport struct {
+	template   *http.Transport
+	mu         sync.Mutex
+	trust      *tlsTrust
+	transports map[string]*http.Transport
+}
+
+func newHostTransport(template *http.Transport) *hostTransport {
+	return &hostTransport{template: template, transports: map[string]*http.Transport{}}
+}
+
+// RoundTrip sends the request with the transport for its host
+func (h *hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return h.transport(req.URL.Hostname()).RoundTrip(req)
+}
+
+func (h *hostTransport) transport(host string) *http.Transport {
+	trustMu.Lock()
+	current := trust
+	trustMu.Unlock()
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.trust != current {
+		// the TLS configuration changed, so the transports of the old one are no longer used
+		for _, t := range h.transports {
+			t.CloseIdleConnections()
+		}
+		h.trust, h.transports = current, map[string]*http.Transport{}
+	}
+	t, ok := h.transports[host]
+	if !ok {
+		config := tlsConfig(host)
+		if config.RootCAs == nil && h.template.TLSClientConfig != nil {
+			// roots the template was made with, like the AWS_CA_BUNDLE of S3, are kept unless a CA is configured
+			config.RootCAs = h.template.TLSClientConfig.RootCAs
+		}
+		t = h.template.Clone()
+		t.TLSClientConfig = config
+		h.transports[host] = t
+	}
+	return t
+}
+
+// withHostTLS gives a client that sends requests like c does, with the TLS configuration of each host
+func withHostTLS(c *http.Client) *http.Client {
+	template, ok := c.Transport.(*http.Transport)
+	if !ok {
+		template = http.DefaultTransport.(*http.Transport)
+	}
+	return &http.Client{Transport: newHostTransport(template.Clone()), Timeout: c.Timeout}
+}
+
+func init() {
+	// go-git clones with http.DefaultClient, which would not have the TLS configuration
+	gitclient.InstallProtocol("https", githttp.NewClient(withHostTLS(http.DefaultClient)))
+}
+
+// configureDocker connects to a Docker daemon at a tcp:// DOCKER_HOST with the TLS configuration of its host, when it is listed
+// in Hosts. Otherwise the daemon is connected to as before, with DOCKER_TLS_VERIFY and DOCKER_CERT_PATH. Images are pulled and pushed
+// by the daemon, which verifies registries with its own configuration, see registryTLS.
+func configureDocker(t *tlsTrust) error {
+	daemon, err := url.Parse(os.Getenv(client.EnvOverrideHost))
+	if err != nil || daemon.Scheme != "tcp" {
+		return nil
+	}
+	config, ok := t.hosts[strings.ToLower(daemon.Hostname())]
+	if !ok {
+		return nil
+	}
+	transport := &http.Transport{TLSClientConfig: config.Clone()}
+	docker, err := client.NewClientWithOpts(client.WithHTTPClient(&http.Client{Transport: transport}), client.WithHostFromEnv(),
+		client.WithVersionFromEnv(), client.WithAPIVersionNegotiation())
+	if err != nil {
+		return fmt.Errorf("docker daemon %s: %s", daemon.Host, err)
+	}
+	cli = docker
+	return nil
+}
+
+// registryTLS gives an error for a registry that is listed in Hosts, as its options can not be applied to the daemon's connections to
+// it. The daemon verifies registries with its own configuration, in /etc/docker/certs.d. The options for every host do not apply to
+// registries either, which is only warned about, as they are usually meant for the other workers.
+func registryTLS(registry string) error {
+	trustMu.Lock()
+	defer trustMu.Unlock()
+	hosts := []string{strings.ToLower(registry)}
+	if hosts[0] == "docker.io" {
+		hosts = append(hosts, "registry-1.docker.io")
+	}
+	for _, host := range hosts {
+		if _, ok := trust.hosts[host]; ok {
+			return fmt.Errorf("tls for %s can not be applied to Docker images, as the Docker daemon connects to the registry. "+
+				"Configure it in /etc/docker/certs.d/%s on the daemon instead, and remove it from the tls section", host, host)
+		}
+	}
+	if (trust.global.RootCAs != nil || len(trust.global.Certificates) > 0) && !trust.warned[hosts[0]] {
+		trust.warned[hosts[0]] = true
+		log.Warn("the tls ca and client certificate are not used by the Docker daemon to connect to %s", registry)
+	}
+	return nil
+}
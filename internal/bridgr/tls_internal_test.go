@@ -0,0 +1,220 @@
+package bridgr
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/distribution/reference"
+)
+
+// resetTLS gives a test its own TLS configuration
+func resetTLS(t *testing.T) {
+	t.Helper()
+	trustMu.Lock()
+	original := trust
+	trustMu.Unlock()
+	t.Cleanup(func() {
+		trustMu.Lock()
+		trust = original
+		trustMu.Unlock()
+	})
+}
+
+// trustServer verifies the certificate of a TLS test server for the rest of a test
+func trustServer(t *testing.T, server *httptest.Server) {
+	t.Helper()
+	resetTLS(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	trustMu.Lock()
+	trust = &tlsTrust{global: &tls.Config{RootCAs: roots}, hosts: map[string]*tls.Config{}, warned: map[string]bool{}}
+	trustMu.Unlock()
+}
+
+// testClientCert writes a self-signed client certificate and its key, and gives the certificate
+func testClientCert(t *testing.T, cert, key string) *x509.Certificate {
+	t.Helper()
+	private, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "george-michael"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &private.PublicKey, private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, _ := x509.MarshalECPrivateKey(private)
+	_ = os.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+	_ = os.WriteFile(key, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600)
+	parsed, _ := x509.ParseCertificate(der)
+	return parsed
+}
+
+func TestConfigureTLS(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resetTLS(t)
+	testClientCert(t, "client.pem", "client.key")
+	_ = os.WriteFile("empty.pem", []byte("gob"), 0644)
+
+	tests := []struct {
+		name    string
+		conf    TLS
+		isError bool
+	}{
+		{"empty", TLS{}, false},
+		{"global", TLS{TLSOptions: TLSOptions{CA: "client.pem", Cert: "client.pem", Key: "client.key", MinVersion: "1.2"}}, false},
+		{"insecure host", TLS{Hosts: map[string]TLSOptions{"stair-car.bluth.com": {Insecure: true}}}, false},
+		{"insecure everywhere", TLS{TLSOptions: TLSOptions{Insecure: true}}, true},
+		{"unknown version", TLS{TLSOptions: TLSOptions{MinVersion: "2.0"}}, true},
+		{"missing ca", TLS{TLSOptions: TLSOptions{CA: "missing.pem"}}, true},
+		{"ca without certificates", TLS{TLSOptions: TLSOptions{CA: "empty.pem"}}, true},
+		{"cert without key", TLS{Hosts: map[string]TLSOptions{"stair-car.bluth.com": {Cert: "client.pem"}}}, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ConfigureTLS(test.conf)
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+		})
+	}
+
+	_ = ConfigureTLS(TLS{
+		TLSOptions: TLSOptions{MinVersion: "1.2"},
+		Hosts:      map[string]TLSOptions{"Stair-Car.bluth.com": {MinVersion: "1.3", Cert: "client.pem", Key: "client.key"}},
+	})
+	if config := tlsConfig("banana.bluth.com"); config.MinVersion != tls.VersionTLS12 || config.InsecureSkipVerify || len(config.Certificates) != 0 {
+		t.Errorf("expected the global configuration for other hosts, got %+v", config)
+	}
+	if config := tlsConfig("stair-car.bluth.com"); config.MinVersion != tls.VersionTLS13 || len(config.Certificates) != 1 {
+		t.Errorf("expected the configuration of the host, got %+v", config)
+	}
+}
+
+func TestRegistryTLS(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resetTLS(t)
+	testClientCert(t, "client.pem", "client.key")
+	err := ConfigureTLS(TLS{
+		TLSOptions: TLSOptions{CA: "client.pem"},
+		Hosts: map[string]TLSOptions{
+			"Registry.bluth.com":   {Insecure: true},
+			"registry-1.docker.io": {CA: "client.pem"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		registry string
+		isError  bool
+	}{
+		{"registry.bluth.com", true},
+		{"docker.io", true},
+		{"quay.io", false},
+	}
+	for _, test := range tests {
+		t.Run(test.registry, func(t *testing.T) {
+			err := registryTLS(test.registry)
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+		})
+	}
+
+	img, _ := reference.ParseNormalizedNamed("registry.bluth.com/bluth/banana:latest")
+	if err := PullImage(&mockClient{}, img); err == nil || !strings.Contains(err.Error(), "/etc/docker/certs.d/registry.bluth.com") {
+		t.Errorf("expected the pull to be refused, got %v", err)
+	}
+}
+
+func TestHostTransport(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resetTLS(t)
+	clientCert := testClientCert(t, "client.pem", "client.key")
+	testClientCert(t, "other.pem", "other.key")
+	clients := x509.NewCertPool()
+	clients.AddCert(clientCert)
+
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "banana")
+	})
+	server := httptest.NewTLSServer(handler)
+	defer server.Close()
+	_ = os.WriteFile("server.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0644)
+	mutual := httptest.NewUnstartedServer(handler)
+	mutual.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clients, MaxVersion: tls.VersionTLS12}
+	mutual.StartTLS()
+	defer mutual.Close()
+
+	tests := []struct {
+		name    string
+		conf    TLS
+		url     string
+		isError bool
+	}{
+		{"unverified", TLS{}, server.URL, true},
+		{"ca", TLS{TLSOptions: TLSOptions{CA: "server.pem"}}, server.URL, false},
+		{"insecure host", TLS{Hosts: map[string]TLSOptions{"127.0.0.1": {Insecure: true}}}, server.URL, false},
+		{"insecure other host", TLS{Hosts: map[string]TLSOptions{"stair-car.bluth.com": {Insecure: true}}}, server.URL, true},
+		{"client certificate", TLS{TLSOptions: TLSOptions{CA: "server.pem"}, Hosts: map[string]TLSOptions{"127.0.0.1": {Cert: "client.pem", Key: "client.key"}}}, mutual.URL, false},
+		{"no client certificate", TLS{TLSOptions: TLSOptions{CA: "server.pem"}}, mutual.URL, true},
+		{"other client certificate", TLS{TLSOptions: TLSOptions{CA: "server.pem", Cert: "other.pem", Key: "other.key"}}, mutual.URL, true},
+		{"min version", TLS{TLSOptions: TLSOptions{CA: "server.pem", Cert: "client.pem", Key: "client.key", MinVersion: "1.3"}}, mutual.URL, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := ConfigureTLS(test.conf); err != nil {
+				t.Fatal(err)
+			}
+			resp, err := httpClient.Get(test.url)
+			if err == nil {
+				resp.Body.Close()
+			}
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+		})
+	}
+}
+
+func TestWithHostTLS(t *testing.T) {
+	t.Chdir(t.TempDir())
+	resetTLS(t)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+	// the roots of the client, like an AWS_CA_BUNDLE, are kept without a configured CA
+	client := withHostTLS(&http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots}}})
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("expected the roots of the client to be used, got %s", err)
+	}
+	resp.Body.Close()
+
+	_ = os.WriteFile("other.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: testClientCert(t, "client.pem", "client.key").Raw}), 0644)
+	if err := ConfigureTLS(TLS{TLSOptions: TLSOptions{CA: "other.pem"}}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(server.URL); err == nil {
+		t.Error("expected a configured CA to replace the roots of the client")
+	}
+}
@@ -0,0 +1,749 @@
+package bridgr
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/Masterminds/semver/v3"
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/distribution/reference"
+	"github.com/mitchellh/mapstructure"
+	log "unknwon.dev/clog/v2"
+)
+
+const defaultToolchainPlatform = "linux-amd64"
+
+// The release indexes and download sites of each toolchain
+var (
+	goReleases  = "https://go.dev/dl/?mode=json&include=all"
+	goDownloads = "https://dl.google.com/go"
+	nodeDist    = "https://nodejs.org/dist"
+	rustDist    = "https://static.rust-lang.org"
+	pythonFTP   = "https://www.python.org/ftp/python"
+)
+
+// nodePlatforms is the Node.js name of each platform, where platforms are named by Go's GOOS-GOARCH
+var nodePlatforms = map[string]string{
+	"linux-amd64":   "linux-x64",
+	"linux-arm64":   "linux-arm64",
+	"linux-arm":     "linux-armv7l",
+	"linux-ppc64le": "linux-ppc64le",
+	"linux-s390x":   "linux-s390x",
+	"darwin-amd64":  "darwin-x64",
+	"darwin-arm64":  "darwin-arm64",
+	"windows-amd64": "win-x64",
+	"windows-arm64": "win-arm64",
+	"windows-386":   "win-x86",
+}
+
+// rustTargets is the Rust target triple of each platform
+var rustTargets = map[string]string{
+	"linux-amd64":   "x86_64-unknown-linux-gnu",
+	"linux-arm64":   "aarch64-unknown-linux-gnu",
+	"linux-386":     "i686-unknown-linux-gnu",
+	"linux-ppc64le": "powerpc64le-unknown-linux-gnu",
+	"linux-s390x":   "s390x-unknown-linux-gnu",
+	"darwin-amd64":  "x86_64-apple-darwin",
+	"darwin-arm64":  "aarch64-apple-darwin",
+	"windows-amd64": "x86_64-pc-windows-msvc",
+	"windows-arm64": "aarch64-pc-windows-msvc",
+	"windows-386":   "i686-pc-windows-msvc",
+}
+
+// rustDefaultComponents are installed by rustup's default profile, for manifests that do not list their profiles
+var rustDefaultComponents = []string{"rustc", "cargo", "rust-std", "rust-docs", "rustfmt", "clippy"}
+
+// rustDatedChannel matches a dated rustup channel, ie "nightly-2024-06-01"
+var rustDatedChannel = regexp.MustCompile(`^(stable|beta|nightly)-(\d{4}-\d{2}-\d{2})$`)
+
+// pythonRelease matches a release directory in the python.org FTP listing
+var pythonRelease = regexp.MustCompile(`href="(\d+\.\d+\.\d+)/"`)
+
+// Toolchains is the configuration object for mirroring language runtime distributions. Node.js and Python releases are
+// verified by their signatures, with the OpenPGP keys in Keyring, unless SkipSignature is set.
+type Toolchains struct {
+	Platforms     []string
+	Go            []string
+	Node          []string
+	Rust          []string
+	Python        []string
+	Keyring       string
+	SkipSignature bool `mapstructure:"skip_signature"`
+}
+
+// goRelease is a release in the go.dev/dl JSON index
+type goRelease struct {
+	Version string   `json:"version"`
+	Stable  bool     `json:"stable"`
+	Files   []goFile `json:"files"`
+}
+
+type goFile struct {
+	Filename string `json:"filename"`
+	OS       string `json:"os"`
+	Arch     string `json:"arch"`
+	Version  string `json:"version"`
+	Sha256   string `json:"sha256"`
+	Size     int64  `json:"size"`
+	Kind     string `json:"kind"`
+}
+
+// nodeRelease is a release in the Node.js dist index.json. It is kept as a generic document so that every field is written
+// back out.
+type nodeRelease map[string]interface{}
+
+// rustManifest is the part of a rustup channel manifest needed to find the packages of a toolchain
+type rustManifest struct {
+	Date     string              `toml:"date"`
+	Profiles map[string][]string `toml:"profiles"`
+	Pkg      map[string]struct {
+		Target map[string]rustTarget `toml:"target"`
+	} `toml:"pkg"`
+}
+
+type rustTarget struct {
+	Available bool   `toml:"available"`
+	URL       string `toml:"url"`
+	Hash      string `toml:"hash"`
+	XzURL     string `toml:"xz_url"`
+	XzHash    string `toml:"xz_hash"`
+}
+
+// archive gives the binary distribution of a Go release for a platform
+func (gr goRelease) archive(platform string) (goFile, bool) {
+	for _, file := range gr.Files {
+		if file.Kind == "archive" && file.OS+"-"+file.Arch == platform {
+			return file, true
+		}
+	}
+	return goFile{}, false
+}
+
+func (nr nodeRelease) version() string {
+	version, _ := nr["version"].(string)
+	return version
+}
+
+// lts gives the codename of a long term support release, or "" when the release is not LTS
+func (nr nodeRelease) lts() string {
+	codename, _ := nr["lts"].(string)
+	return codename
+}
+
+// dir is the top-level directory name for all objects written out under the Toolchains worker
+func (t Toolchains) dir() string {
+	return BaseDir(t.Name())
+}
+
+// Name returns the name of this Configuration
+func (t Toolchains) Name() string {
+	return "toolchains"
+}
+
+// Image implements the Imager interface
+func (t Toolchains) Image() reference.Named {
+	return nil
+}
+
+func stringToToolchainVersions(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf([]string{}) {
+		return data, nil
+	}
+	return []string{data.(string)}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (t *Toolchains) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		stringToToolchainVersions,
+	)
+}
+
+// Setup prepares the directory for the toolchain mirrors
+func (t *Toolchains) Setup() error {
+	log.Trace("Called Toolchains.Setup()")
+	if len(t.Platforms) == 0 {
+		t.Platforms = []string{defaultToolchainPlatform}
+	}
+	return os.MkdirAll(t.dir(), os.ModePerm)
+}
+
+// Run resolves the configured versions of each toolchain from its release index, then downloads the distributions for every
+// configured platform, in the layout of the project's own download site
+func (t *Toolchains) Run() error {
+	if err := t.Setup(); err != nil {
+		return err
+	}
+	toolchains := []struct {
+		name     string
+		versions []string
+		mirror   func([]string) error
+	}{
+		{"Go", t.Go, t.mirrorGo},
+		{"Node.js", t.Node, t.mirrorNode},
+		{"Rust", t.Rust, t.mirrorRust},
+		{"Python", t.Python, t.mirrorPython},
+	}
+	for _, toolchain := range toolchains {
+		if len(toolchain.versions) == 0 {
+			continue
+		}
+		if err := toolchain.mirror(toolchain.versions); err != nil {
+			log.Info("Toolchains: unable to mirror %s - %s", toolchain.name, err)
+		}
+	}
+	return nil
+}
+
+// mirrorGo downloads Go releases like dl.google.com/go, and writes an index.json in the format of go.dev/dl/?mode=json
+func (t *Toolchains) mirrorGo(specs []string) error {
+	releases := []goRelease{}
+	if err := getJSON(goReleases, &releases); err != nil {
+		return err
+	}
+	candidates := make([]string, 0, len(releases))
+	for _, release := range releases {
+		candidates = append(candidates, strings.TrimPrefix(release.Version, "go"))
+	}
+	dir := path.Join(t.dir(), "go")
+	forEach(len(specs), func(i int) {
+		matches := matchToolchainVersions(candidates, strings.TrimPrefix(specs[i], "go"))
+		if len(matches) == 0 {
+			log.Info("Toolchains: no Go release matching %s", specs[i])
+			return
+		}
+		for _, release := range releases {
+			if release.Version != "go"+matches[0] {
+				continue
+			}
+			for _, platform := range t.Platforms {
+				file, ok := release.archive(platform)
+				if !ok {
+					log.Info("Toolchains: %s is not available for %s", release.Version, platform)
+					continue
+				}
+				target := path.Join(dir, file.Filename)
+				if err := toolchainDownload(goDownloads+"/"+file.Filename, target, file.Sha256); err != nil {
+					log.Info("Toolchains: unable to download %s - %s", file.Filename, err)
+					continue
+				}
+				if err := os.WriteFile(target+".sha256", []byte(file.Sha256), 0644); err != nil { //nolint:gosec // repository content is meant to be readable
+					log.Info("Toolchains: unable to write checksum of %s - %s", file.Filename, err)
+				}
+			}
+		}
+	})
+
+	// releases from earlier runs are listed too, as the upstream index has every release
+	index := []goRelease{}
+	for _, release := range releases {
+		var files []goFile
+		for _, file := range release.Files {
+			if _, err := os.Stat(path.Join(dir, file.Filename)); err == nil {
+				files = append(files, file)
+			}
+		}
+		if len(files) > 0 {
+			release.Files = files
+			index = append(index, release)
+		}
+	}
+	return writeToolchainJSON(path.Join(dir, "index.json"), index)
+}
+
+// mirrorNode downloads Node.js releases like nodejs.org/dist, with their SHASUMS256.txt and its signatures. The index.json and
+// index.tab used by nvm are written for the releases in the mirror.
+func (t *Toolchains) mirrorNode(specs []string) error {
+	releases := []nodeRelease{}
+	if err := getJSON(nodeDist+"/index.json", &releases); err != nil {
+		return err
+	}
+	keyring, err := t.keyring()
+	if err != nil {
+		return err
+	}
+	dir := path.Join(t.dir(), "node")
+	forEach(len(specs), func(i int) {
+		version, err := pickNodeVersion(releases, specs[i])
+		if err != nil {
+			log.Info("Toolchains: %s", err)
+			return
+		}
+		if err := t.downloadNode(dir, version, keyring); err != nil {
+			log.Info("Toolchains: unable to download Node.js %s - %s", version, err)
+		}
+	})
+
+	mirrored := map[string]bool{}
+	index := []nodeRelease{}
+	for _, release := range releases {
+		if _, err := os.Stat(path.Join(dir, release.version(), "SHASUMS256.txt")); err == nil {
+			mirrored[release.version()] = true
+			index = append(index, release)
+		}
+	}
+	if err := writeToolchainJSON(path.Join(dir, "index.json"), index); err != nil {
+		return err
+	}
+
+	resp, err := httpGet(nodeDist + "/index.tab")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	tab := bytes.Buffer{}
+	scanner := bufio.NewScanner(resp.Body)
+	for first := true; scanner.Scan(); first = false {
+		line := scanner.Text()
+		if first || mirrored[strings.SplitN(line, "\t", 2)[0]] {
+			tab.WriteString(line + "\n")
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(dir, "index.tab"), tab.Bytes(), 0644) //nolint:gosec // repository content is meant to be readable
+}
+
+// downloadNode fetches the archives of a Node.js release for each platform, and verifies them against its SHASUMS256.txt. The
+// signature of SHASUMS256.txt is checked first when there is a keyring.
+func (t *Toolchains) downloadNode(dir, version string, keyring openpgp.EntityList) error {
+	source := nodeDist + "/" + version + "/SHASUMS256.txt"
+	shasums, err := toolchainGet(source)
+	if err != nil {
+		return err
+	}
+	if keyring != nil {
+		if err := verifyNodeChecksums(keyring, source, shasums); err != nil {
+			return fmt.Errorf("SHASUMS256.txt signature is not valid: %s", err)
+		}
+	}
+	sums := parseChecksumFile(shasums)
+
+	downloaded := 0
+	for _, platform := range t.Platforms {
+		id, ok := nodePlatforms[platform]
+		if !ok {
+			log.Info("Toolchains: %s is not a Node.js platform", platform)
+			continue
+		}
+		ext := ".tar.xz"
+		if strings.HasPrefix(id, "win-") {
+			ext = ".zip"
+		}
+		filename := "node-" + version + "-" + id + ext
+		sum, ok := sums[filename]
+		if !ok {
+			log.Info("Toolchains: Node.js %s is not available for %s", version, platform)
+			continue
+		}
+		if err := toolchainDownload(nodeDist+"/"+version+"/"+filename, path.Join(dir, version, filename), sum); err != nil {
+			log.Info("Toolchains: unable to download %s - %s", filename, err)
+			continue
+		}
+		downloaded++
+	}
+	if downloaded == 0 {
+		return errors.New("no archives were downloaded")
+	}
+	if err := os.WriteFile(path.Join(dir, version, "SHASUMS256.txt"), shasums, 0644); err != nil { //nolint:gosec // repository content is meant to be readable
+		return err
+	}
+	toolchainOptional(nodeDist+"/"+version+"/SHASUMS256.txt.sig", path.Join(dir, version, "SHASUMS256.txt.sig"))
+	toolchainOptional(nodeDist+"/"+version+"/SHASUMS256.txt.asc", path.Join(dir, version, "SHASUMS256.txt.asc"))
+	return nil
+}
+
+// verifyNodeChecksums checks a SHASUMS256.txt with its detached SHASUMS256.txt.sig, or with the clearsigned SHASUMS256.txt.asc
+// of releases that have no detached signature
+func verifyNodeChecksums(keyring openpgp.EntityList, source string, shasums []byte) error {
+	if signature, err := toolchainGet(source + ".sig"); err == nil {
+		return verifySignature(keyring, bytes.NewReader(shasums), signature)
+	}
+	clearsigned, err := toolchainGet(source + ".asc")
+	if err != nil {
+		return errors.New("no signature is published")
+	}
+	signed, err := readClearsigned(keyring, clearsigned)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(bytes.TrimSpace(signed), bytes.TrimSpace(shasums)) {
+		return errors.New("SHASUMS256.txt.asc does not sign SHASUMS256.txt")
+	}
+	return nil
+}
+
+// pickNodeVersion gives the newest Node.js release matching a spec. Besides version ranges, the spec can be "lts" for any LTS
+// release, the codename of an LTS line (ie "iron" or "lts/iron", as nvm names them), or "latest".
+func pickNodeVersion(releases []nodeRelease, spec string) (string, error) {
+	name := strings.ToLower(strings.TrimSpace(spec))
+	codename := ""
+	switch {
+	case name == "lts" || name == "lts/*":
+		codename = "*"
+	case strings.HasPrefix(name, "lts/") || isNodeCodename(releases, name):
+		codename = strings.TrimPrefix(name, "lts/")
+	}
+	var candidates []string
+	for _, release := range releases {
+		if codename != "" {
+			lts := strings.ToLower(release.lts())
+			if lts == "" || (codename != "*" && lts != codename) {
+				continue
+			}
+		}
+		candidates = append(candidates, strings.TrimPrefix(release.version(), "v"))
+	}
+	if codename != "" {
+		name = "*"
+	}
+	matches := matchToolchainVersions(candidates, name)
+	if len(matches) == 0 {
+		return "", fmt.Errorf("no Node.js release matching %s", spec)
+	}
+	return "v" + matches[0], nil
+}
+
+// isNodeCodename tells if a name is the codename of an LTS line
+func isNodeCodename(releases []nodeRelease, name string) bool {
+	for _, release := range releases {
+		if name != "" && strings.EqualFold(release.lts(), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// mirrorRust downloads rustup channel manifests like static.rust-lang.org, and the packages of rustup's default profile for each
+// platform. Package URLs in the manifests are left as they are, as rustup replaces the upstream server with RUSTUP_DIST_SERVER.
+// The packages are verified by the hashes in a manifest, so each manifest is verified by its .asc signature when there is a keyring.
+func (t *Toolchains) mirrorRust(specs []string) error {
+	keyring, err := t.keyring()
+	if err != nil {
+		return err
+	}
+	dir := path.Join(t.dir(), "rust")
+	forEach(len(specs), func(i int) {
+		if err := t.downloadRust(dir, specs[i], keyring); err != nil {
+			log.Info("Toolchains: unable to download Rust %s - %s", specs[i], err)
+		}
+	})
+	return t.downloadRustup(dir)
+}
+
+// downloadRust fetches the channel manifest of a Rust toolchain, ie "stable", "1.79.0" or "nightly-2024-06-01", and its packages
+func (t *Toolchains) downloadRust(dir, spec string, keyring openpgp.EntityList) error {
+	manifestPath := "dist/channel-rust-" + spec + ".toml"
+	if match := rustDatedChannel.FindStringSubmatch(spec); match != nil {
+		manifestPath = "dist/" + match[2] + "/channel-rust-" + match[1] + ".toml"
+	}
+	sum, err := toolchainChecksum(rustDist + "/" + manifestPath + ".sha256")
+	if err != nil {
+		return err
+	}
+	target := path.Join(dir, manifestPath)
+	if err := toolchainDownload(rustDist+"/"+manifestPath, target, sum); err != nil {
+		return err
+	}
+	if keyring != nil {
+		if err := verifyToolchainFile(keyring, rustDist+"/"+manifestPath+".asc", target); err != nil {
+			_ = os.Remove(target)
+			return fmt.Errorf("signature of %s is not valid: %s", path.Base(target), err)
+		}
+	}
+	if err := os.WriteFile(target+".sha256", []byte(sum+"  "+path.Base(target)+"\n"), 0644); err != nil { //nolint:gosec // repository content is meant to be readable
+		return err
+	}
+	toolchainOptional(rustDist+"/"+manifestPath+".asc", target+".asc")
+
+	manifest := rustManifest{}
+	if _, err := toml.DecodeFile(target, &manifest); err != nil {
+		return err
+	}
+	components, ok := manifest.Profiles["default"]
+	if !ok {
+		components = rustDefaultComponents
+	}
+	for _, platform := range t.Platforms {
+		triple, ok := rustTargets[platform]
+		if !ok {
+			log.Info("Toolchains: %s is not a Rust platform", platform)
+			continue
+		}
+		for _, component := range components {
+			pkg, ok := manifest.Pkg[component].Target[triple]
+			if !ok {
+				pkg = manifest.Pkg[component].Target["*"]
+			}
+			if !pkg.Available {
+				log.Trace("Toolchains: Rust %s %s is not available for %s", spec, component, triple)
+				continue
+			}
+			source, hash := pkg.XzURL, pkg.XzHash
+			if source == "" {
+				source, hash = pkg.URL, pkg.Hash
+			}
+			sourceURL, err := url.Parse(source)
+			if err != nil {
+				return err
+			}
+			if err := toolchainDownload(source, path.Join(dir, sourceURL.Path), hash); err != nil {
+				log.Info("Toolchains: unable to download %s - %s", path.Base(sourceURL.Path), err)
+			}
+		}
+	}
+	return nil
+}
+
+// downloadRustup fetches rustup-init for each platform, and the release file that rustup reads to update itself
+func (t *Toolchains) downloadRustup(dir string) error {
+	for _, platform := range t.Platforms {
+		triple, ok := rustTargets[platform]
+		if !ok {
+			continue
+		}
+		file := "rustup/dist/" + triple + "/rustup-init"
+		if strings.HasPrefix(platform, "windows") {
+			file += ".exe"
+		}
+		sum, err := toolchainChecksum(rustDist + "/" + file + ".sha256")
+		if err != nil {
+			log.Info("Toolchains: unable to download rustup for %s - %s", platform, err)
+			continue
+		}
+		target := path.Join(dir, file)
+		if err := toolchainDownload(rustDist+"/"+file, target, sum); err != nil {
+			log.Info("Toolchains: unable to download rustup for %s - %s", platform, err)
+			continue
+		}
+		if err := os.WriteFile(target+".sha256", []byte(sum+"  "+path.Base(target)+"\n"), 0644); err != nil { //nolint:gosec // repository content is meant to be readable
+			return err
+		}
+	}
+	toolchainOptional(rustDist+"/rustup/release-stable.toml", path.Join(dir, "rustup", "release-stable.toml"))
+	return nil
+}
+
+// mirrorPython downloads CPython releases like python.org/ftp/python. python.org publishes signatures rather than checksums,
+// so each release file is verified by its .asc signature when there is a keyring. The .asc and .sigstore files are kept next
+// to each release file, for verifying it again after it is carried across.
+func (t *Toolchains) mirrorPython(specs []string) error {
+	resp, err := httpGet(pythonFTP + "/")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	listing, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var candidates []string
+	for _, match := range pythonRelease.FindAllStringSubmatch(string(listing), -1) {
+		candidates = append(candidates, match[1])
+	}
+	keyring, err := t.keyring()
+	if err != nil {
+		return err
+	}
+	dir := path.Join(t.dir(), "python")
+	forEach(len(specs), func(i int) {
+		// a release directory is created for the first pre-release, so fall back to older releases until one has its source
+		for _, version := range matchToolchainVersions(candidates, specs[i]) {
+			err := t.downloadPython(dir, version, keyring)
+			if err == nil {
+				return
+			}
+			log.Trace("Toolchains: Python %s is not released - %s", version, err)
+		}
+		log.Info("Toolchains: no Python release matching %s", specs[i])
+	})
+	return nil
+}
+
+// downloadPython fetches the source of a CPython release, and its installers for Windows and macOS platforms
+func (t *Toolchains) downloadPython(dir, version string, keyring openpgp.EntityList) error {
+	files := []string{"Python-" + version + ".tar.xz", "Python-" + version + ".tgz"}
+	for _, platform := range t.Platforms {
+		switch {
+		case platform == "windows-amd64":
+			files = append(files, "python-"+version+"-amd64.exe")
+		case platform == "windows-arm64":
+			files = append(files, "python-"+version+"-arm64.exe")
+		case platform == "windows-386":
+			files = append(files, "python-"+version+".exe")
+		case strings.HasPrefix(platform, "darwin-"):
+			files = append(files, "python-"+version+"-macos11.pkg")
+		}
+	}
+	seen := map[string]bool{}
+	for i, file := range files {
+		if seen[file] {
+			continue
+		}
+		seen[file] = true
+		source := pythonFTP + "/" + version + "/" + file
+		target := path.Join(dir, version, file)
+		if err := toolchainDownload(source, target, ""); err != nil {
+			if i == 0 {
+				return err
+			}
+			log.Info("Toolchains: unable to download %s - %s", file, err)
+			continue
+		}
+		if keyring != nil {
+			if err := verifyToolchainFile(keyring, source+".asc", target); err != nil {
+				_ = os.Remove(target)
+				if i == 0 {
+					return fmt.Errorf("signature of %s is not valid: %s", file, err)
+				}
+				log.Info("Toolchains: signature of %s is not valid - %s", file, err)
+				continue
+			}
+		}
+		toolchainOptional(source+".asc", target+".asc")
+		toolchainOptional(source+".sigstore", target+".sigstore")
+	}
+	return nil
+}
+
+// verifyToolchainFile checks a downloaded file with the detached signature published at signatureSource
+func verifyToolchainFile(keyring openpgp.EntityList, signatureSource, file string) error {
+	signature, err := toolchainGet(signatureSource)
+	if err != nil {
+		return fmt.Errorf("no signature is published - %s", err)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return verifySignature(keyring, f, signature)
+}
+
+// keyring reads the keys that verify Node.js, Python and Rust releases. It is needed unless signatures are explicitly not checked.
+func (t *Toolchains) keyring() (openpgp.EntityList, error) {
+	if t.Keyring == "" {
+		if t.SkipSignature {
+			log.Warn("Toolchains: skip_signature is set, signatures of Node.js, Python and Rust releases are not verified")
+			return nil, nil
+		}
+		return nil, errors.New("a keyring is needed to verify the signatures of Node.js, Python and Rust releases, or set skip_signature")
+	}
+	return readKeyring(t.Keyring)
+}
+
+// matchToolchainVersions gives the versions matching a spec, newest first. The spec is a version range, where a partial version
+// matches any release in it (ie "1.22" or "1.22.x"), or "latest"/"stable" for any release. Versions that are not semantic
+// versions, like pre-releases named "1.23rc1", only match exactly.
+func matchToolchainVersions(candidates []string, spec string) []string {
+	spec = strings.TrimPrefix(strings.TrimSpace(spec), "v")
+	if spec == "" || spec == "latest" || spec == "stable" {
+		spec = "*"
+	}
+	constraint, constraintErr := semver.NewConstraint(spec)
+	var matches semver.Collection
+	for _, candidate := range candidates {
+		version, err := semver.NewVersion(candidate)
+		if err != nil {
+			if candidate == spec {
+				return []string{candidate}
+			}
+			continue
+		}
+		if candidate == spec || (constraintErr == nil && constraint.Check(version)) {
+			matches = append(matches, version)
+		}
+	}
+	sort.Sort(sort.Reverse(matches))
+	versions := make([]string, 0, len(matches))
+	for _, version := range matches {
+		versions = append(versions, version.Original())
+	}
+	return versions
+}
+
+// toolchainDownload fetches a file, unless it is already in the mirror with the expected SHA-256, and verifies it. When no
+// checksum is expected, a file that is already in the mirror is kept.
+func toolchainDownload(source, target, sha256 string) error {
+	if sum, err := fileChecksum(target, "sha256"); err == nil && (sha256 == "" || strings.EqualFold(sum, sha256)) {
+		return lockExisting(target)
+	}
+	sourceURL, err := url.Parse(source)
+	if err != nil {
+		return err
+	}
+	if err := download(sourceURL, target); err != nil {
+		return err
+	}
+	if sha256 == "" {
+		return nil
+	}
+	sum, err := fileChecksum(target, "sha256")
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(sum, sha256) {
+		_ = os.Remove(target)
+		return fmt.Errorf("checksum mismatch, expected %s but got %s", sha256, sum)
+	}
+	return nil
+}
+
+// toolchainOptional fetches a file that is not published for every release, such as a signature. With Locked, only one that is
+// pinned is fetched, as it may not have been published when the lock file was written.
+func toolchainOptional(source, target string) {
+	sourceURL, err := url.Parse(source)
+	if err != nil || !lockOptional(target) {
+		return
+	}
+	if err := download(sourceURL, target); err != nil {
+		log.Trace("Toolchains: %s was not downloaded - %s", source, err)
+	}
+}
+
+// toolchainGet gives the content of a small published file, such as a checksum file or a signature
+func toolchainGet(source string) ([]byte, error) {
+	resp, err := httpGet(source)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(resp.Body)
+}
+
+// toolchainChecksum reads the checksum from a published .sha256 file
+func toolchainChecksum(source string) (string, error) {
+	content, err := toolchainGet(source)
+	if err != nil {
+		return "", err
+	}
+	fields := strings.Fields(string(content))
+	if len(fields) == 0 {
+		return "", fmt.Errorf("%s is empty", source)
+	}
+	return fields[0], nil
+}
+
+func writeToolchainJSON(file string, doc interface{}) error {
+	if err := os.MkdirAll(path.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, content, 0644) //nolint:gosec // repository content is meant to be readable
+}
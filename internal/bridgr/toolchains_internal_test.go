@@ -0,0 +1,279 @@
+package bridgr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/google/go-cmp/cmp"
+)
+
+func toolchainSum(content string) string {
+	sum := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(sum[:])
+}
+
+// toolchainSites serves the release sites of every toolchain, with Node.js, Rust and Python releases signed by signer
+func toolchainSites(signer *openpgp.Entity) *httptest.Server {
+	documents := map[string]string{
+		"/go/dl": `[
+			{"version":"go1.23rc1","stable":false,"files":[{"filename":"go1.23rc1.linux-amd64.tar.gz","os":"linux","arch":"amd64","kind":"archive","sha256":"` + toolchainSum("go1.23rc1.linux-amd64.tar.gz") + `"}]},
+			{"version":"go1.22.5","stable":true,"files":[
+				{"filename":"go1.22.5.src.tar.gz","os":"","arch":"","kind":"source","sha256":""},
+				{"filename":"go1.22.5.linux-amd64.tar.gz","os":"linux","arch":"amd64","kind":"archive","sha256":"` + toolchainSum("go1.22.5.linux-amd64.tar.gz") + `"},
+				{"filename":"go1.22.5.windows-amd64.zip","os":"windows","arch":"amd64","kind":"archive","sha256":""}]},
+			{"version":"go1.21.12","stable":true,"files":[{"filename":"go1.21.12.linux-amd64.tar.gz","os":"linux","arch":"amd64","kind":"archive","sha256":""}]}
+		]`,
+		"/node/index.json": `[{"version":"v22.3.0","lts":false},{"version":"v20.15.0","lts":"Iron"},{"version":"v20.14.0","lts":"Iron"}]`,
+		"/node/index.tab":  "version\tdate\tfiles\nv22.3.0\t2024-06-11\tlinux-x64\nv20.15.0\t2024-06-20\tlinux-x64\n",
+		"/node/v20.15.0/SHASUMS256.txt": toolchainSum("node-v20.15.0-linux-x64.tar.xz") + "  node-v20.15.0-linux-x64.tar.xz\n" +
+			toolchainSum("node-v20.15.0-win-x64.zip") + "  node-v20.15.0-win-x64.zip\n",
+		"/rust/dist/channel-rust-stable.toml": `manifest-version = "2"
+date = "2024-06-13"
+[pkg.rustc.target.x86_64-unknown-linux-gnu]
+available = true
+url = "%[1]s/dist/2024-06-13/rustc-1.79.0-x86_64-unknown-linux-gnu.tar.gz"
+hash = "` + toolchainSum("rustc-1.79.0-x86_64-unknown-linux-gnu.tar.gz") + `"
+xz_url = "%[1]s/dist/2024-06-13/rustc-1.79.0-x86_64-unknown-linux-gnu.tar.xz"
+xz_hash = "` + toolchainSum("rustc-1.79.0-x86_64-unknown-linux-gnu.tar.xz") + `"
+[pkg.rust-docs.target.x86_64-unknown-linux-gnu]
+available = false
+[profiles]
+default = ["rustc", "rust-docs"]
+`,
+		"/rust/rustup/dist/x86_64-unknown-linux-gnu/rustup-init.sha256": toolchainSum("rustup-init") + " *rustup-init",
+		"/python/": `<a href="../">../</a><a href="3.12.3/">3.12.3/</a><a href="3.12.4/">3.12.4/</a><a href="3.13.0/">3.13.0/</a><a href="doc/">doc/</a>`,
+	}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if doc, ok := documents[r.URL.Path]; ok {
+			if strings.Contains(doc, "%[1]s") {
+				doc = fmt.Sprintf(doc, server.URL)
+			}
+			fmt.Fprint(w, doc)
+			return
+		}
+		if manifest, ok := documents[strings.TrimSuffix(r.URL.Path, ".sha256")]; ok {
+			fmt.Fprint(w, toolchainSum(fmt.Sprintf(manifest, server.URL))+"  channel-rust-stable.toml")
+			return
+		}
+		file := path.Base(r.URL.Path)
+		if strings.HasPrefix(r.URL.Path, "/python/3.13.0/") || strings.HasSuffix(file, ".sigstore") {
+			http.NotFound(w, r)
+			return
+		}
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/node/") && strings.HasSuffix(file, ".sig"):
+			_ = openpgp.DetachSign(w, signer, strings.NewReader(documents[strings.TrimSuffix(r.URL.Path, ".sig")]), nil)
+		case strings.HasPrefix(r.URL.Path, "/rust/") && strings.HasSuffix(file, ".asc"):
+			_ = openpgp.ArmoredDetachSign(w, signer, strings.NewReader(fmt.Sprintf(documents[strings.TrimSuffix(r.URL.Path, ".asc")], server.URL)), nil)
+		case strings.HasPrefix(r.URL.Path, "/python/") && strings.HasSuffix(file, ".asc"):
+			_ = openpgp.ArmoredDetachSign(w, signer, strings.NewReader(strings.TrimSuffix(file, ".asc")), nil)
+		case strings.HasSuffix(file, ".sig"):
+			http.NotFound(w, r)
+		default:
+			fmt.Fprint(w, file)
+		}
+	}))
+	return server
+}
+
+func TestToolchainsDir(t *testing.T) {
+	expected := BaseDir("toolchains")
+	result := Toolchains{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestStringToToolchainVersions(t *testing.T) {
+	result, _ := stringToToolchainVersions(reflect.TypeOf(""), reflect.TypeOf([]string{}), "1.22.x")
+	if !cmp.Equal([]string{"1.22.x"}, result) {
+		t.Error(cmp.Diff([]string{"1.22.x"}, result))
+	}
+	result, _ = stringToToolchainVersions(reflect.TypeOf(""), reflect.TypeOf(""), "1.22.x")
+	if !cmp.Equal("1.22.x", result) {
+		t.Error(cmp.Diff("1.22.x", result))
+	}
+}
+
+func TestMatchToolchainVersions(t *testing.T) {
+	candidates := []string{"1.21.12", "1.23rc1", "1.22.5", "1.22.0", "1.22"}
+	tests := []struct {
+		spec   string
+		expect []string
+	}{
+		{"1.22.x", []string{"1.22.5", "1.22.0", "1.22"}},
+		{"1.22", []string{"1.22.5", "1.22.0", "1.22"}},
+		{"v1.21.12", []string{"1.21.12"}},
+		{"stable", []string{"1.22.5", "1.22.0", "1.22", "1.21.12"}},
+		{"1.23rc1", []string{"1.23rc1"}},
+		{"2", []string{}},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			result := matchToolchainVersions(candidates, test.spec)
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestPickNodeVersion(t *testing.T) {
+	releases := []nodeRelease{
+		{"version": "v22.3.0", "lts": false},
+		{"version": "v20.15.0", "lts": "Iron"},
+		{"version": "v18.20.3", "lts": "Hydrogen"},
+	}
+	tests := []struct {
+		spec   string
+		expect string
+	}{
+		{"latest", "v22.3.0"},
+		{"20", "v20.15.0"},
+		{"lts", "v20.15.0"},
+		{"lts/*", "v20.15.0"},
+		{"hydrogen", "v18.20.3"},
+		{"lts/Hydrogen", "v18.20.3"},
+	}
+	for _, test := range tests {
+		t.Run(test.spec, func(t *testing.T) {
+			result, err := pickNodeVersion(releases, test.spec)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+	if _, err := pickNodeVersion(releases, "16"); err == nil {
+		t.Error("expected an error for a release that is not in the index")
+	}
+}
+
+func TestToolchainDownloadMismatch(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := toolchainSites(testSigner(t, "keyring.asc", true))
+	defer server.Close()
+
+	if err := toolchainDownload(server.URL+"/go/files/go1.22.5.linux-amd64.tar.gz", "go.tar.gz", toolchainSum("something else")); err == nil {
+		t.Error("expected a checksum mismatch")
+	}
+	if _, err := os.Stat("go.tar.gz"); err == nil {
+		t.Error("expected the mismatched file to be removed")
+	}
+}
+
+// useToolchainSites points the release sites of every toolchain at a test server for the rest of a test
+func useToolchainSites(t *testing.T, server *httptest.Server) {
+	t.Helper()
+	sites := []*string{&goReleases, &goDownloads, &nodeDist, &rustDist, &pythonFTP}
+	original := []string{goReleases, goDownloads, nodeDist, rustDist, pythonFTP}
+	t.Cleanup(func() {
+		for i, site := range sites {
+			*site = original[i]
+		}
+	})
+	goReleases, goDownloads, nodeDist, rustDist, pythonFTP = server.URL+"/go/dl", server.URL+"/go/files", server.URL+"/node", server.URL+"/rust", server.URL+"/python"
+}
+
+func TestToolchainsRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := toolchainSites(testSigner(t, "keyring.asc", true))
+	defer server.Close()
+	useToolchainSites(t, server)
+
+	toolchains := Toolchains{Go: []string{"1.22.x"}, Node: []string{"lts"}, Rust: []string{"stable"}, Python: []string{"3.12", "3.13"}, Keyring: "keyring.asc"}
+	if err := toolchains.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectFiles := []string{
+		"go/go1.22.5.linux-amd64.tar.gz",
+		"go/go1.22.5.linux-amd64.tar.gz.sha256",
+		"go/index.json",
+		"node/v20.15.0/node-v20.15.0-linux-x64.tar.xz",
+		"node/v20.15.0/SHASUMS256.txt",
+		"node/v20.15.0/SHASUMS256.txt.asc",
+		"node/index.json",
+		"node/index.tab",
+		"rust/dist/channel-rust-stable.toml",
+		"rust/dist/channel-rust-stable.toml.sha256",
+		"rust/dist/2024-06-13/rustc-1.79.0-x86_64-unknown-linux-gnu.tar.xz",
+		"rust/rustup/dist/x86_64-unknown-linux-gnu/rustup-init",
+		"python/3.12.4/Python-3.12.4.tar.xz",
+		"python/3.12.4/Python-3.12.4.tar.xz.asc",
+		"python/3.12.4/Python-3.12.4.tgz",
+	}
+	for _, file := range expectFiles {
+		if _, err := os.Stat(path.Join(toolchains.dir(), file)); err != nil {
+			t.Errorf("expected %s to be written: %s", file, err)
+		}
+	}
+	for _, file := range []string{"python/3.13.0/Python-3.13.0.tar.xz", "python/3.12.3/Python-3.12.3.tar.xz"} {
+		if _, err := os.Stat(path.Join(toolchains.dir(), file)); err == nil {
+			t.Errorf("expected %s to not be downloaded", file)
+		}
+	}
+
+	index := []goRelease{}
+	content, _ := os.ReadFile(path.Join(toolchains.dir(), "go/index.json"))
+	if err := json.Unmarshal(content, &index); err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 1 || index[0].Version != "go1.22.5" || len(index[0].Files) != 1 {
+		t.Errorf("expected only the go1.22.5 linux-amd64 archive in the index, got %s", content)
+	}
+
+	tab, _ := os.ReadFile(path.Join(toolchains.dir(), "node/index.tab"))
+	expectTab := "version\tdate\tfiles\nv20.15.0\t2024-06-20\tlinux-x64\n"
+	if !cmp.Equal(expectTab, string(tab)) {
+		t.Error(cmp.Diff(expectTab, string(tab)))
+	}
+}
+
+func TestToolchainsSignatures(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := toolchainSites(testSigner(t, "keyring.asc", true))
+	defer server.Close()
+	useToolchainSites(t, server)
+	testSigner(t, "other.asc", true)
+
+	tests := []struct {
+		name     string
+		keyring  string
+		skip     bool
+		verified bool
+	}{
+		{"keyring", "keyring.asc", false, true},
+		{"other keyring", "other.asc", false, false},
+		{"no keyring", "", false, false},
+		{"skip signature", "", true, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_ = os.RemoveAll(BaseDir(""))
+			toolchains := Toolchains{Node: []string{"lts"}, Rust: []string{"stable"}, Python: []string{"3.12"}, Keyring: test.keyring, SkipSignature: test.skip}
+			if err := toolchains.Run(); err != nil {
+				t.Fatal(err)
+			}
+			files := []string{"node/v20.15.0/node-v20.15.0-linux-x64.tar.xz", "rust/dist/channel-rust-stable.toml", "python/3.12.4/Python-3.12.4.tar.xz"}
+			for _, file := range files {
+				if _, err := os.Stat(path.Join(toolchains.dir(), file)); (err == nil) != test.verified {
+					t.Errorf("expected %s to be downloaded: %t, but got %v", file, test.verified, err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestToolchainsImage(t *testing.T) {
+	toolchains := bridgr.Toolchains{}
+	if toolchains.Image() != nil {
+		t.Errorf("expected nil, but got %+v", toolchains.Image())
+	}
+}
+
+func TestToolchainsName(t *testing.T) {
+	expected := "toolchains"
+	toolchains := bridgr.Toolchains{}
+	if !cmp.Equal(expected, toolchains.Name()) {
+		t.Error(cmp.Diff(expected, toolchains.Name()))
+	}
+}
+
+func TestToolchainsHook(t *testing.T) {
+	toolchains := bridgr.Toolchains{}
+	result := reflect.TypeOf(toolchains.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
@@ -0,0 +1,401 @@
+package bridgr
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/distribution/reference"
+	"github.com/mitchellh/mapstructure"
+	log "unknwon.dev/clog/v2"
+)
+
+const (
+	defaultVagrantCloud    = "https://vagrantcloud.com"
+	defaultVagrantProvider = "virtualbox"
+	defaultVagrantVersion  = "0"
+)
+
+// Vagrant is the configuration object for creating a Vagrant box repository
+type Vagrant struct {
+	Cloud        string
+	Host         string
+	Providers    []string
+	Architecture string
+	Boxes        []vagrantBox
+}
+
+// vagrantBox is either a Vagrant Cloud box name (ie, "centos/7"), or the location of a .box file
+type vagrantBox struct {
+	Box       string
+	Name      string
+	Version   string
+	Providers []string
+}
+
+// vagrantCatalog is the box metadata document that `vagrant box add` reads
+type vagrantCatalog struct {
+	Name        string           `json:"name"`
+	Description string           `json:"description,omitempty"`
+	Versions    []vagrantVersion `json:"versions"`
+}
+
+type vagrantVersion struct {
+	Version   string            `json:"version"`
+	Status    string            `json:"status,omitempty"`
+	Providers []vagrantProvider `json:"providers"`
+}
+
+type vagrantProvider struct {
+	Name                string `json:"name"`
+	URL                 string `json:"url"`
+	Checksum            string `json:"checksum,omitempty"`
+	ChecksumType        string `json:"checksum_type,omitempty"`
+	Architecture        string `json:"architecture,omitempty"`
+	DefaultArchitecture bool   `json:"default_architecture,omitempty"`
+}
+
+func (vb vagrantBox) String() string {
+	if vb.Version != "" {
+		return vb.Box + ":" + vb.Version
+	}
+	return vb.Box
+}
+
+// isFile is true when the box is a .box file to be copied, rather than a Vagrant Cloud box
+func (vb vagrantBox) isFile() bool {
+	return strings.HasSuffix(vb.Box, ".box")
+}
+
+// dir is the top-level directory name for all objects written out under the Vagrant worker
+func (v Vagrant) dir() string {
+	return BaseDir(v.Name())
+}
+
+// Name returns the name of this Configuration
+func (v Vagrant) Name() string {
+	return "vagrant"
+}
+
+// Image implements the Imager interface
+func (v Vagrant) Image() reference.Named {
+	return nil
+}
+
+func stringToVagrantBox(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf(vagrantBox{}) {
+		return data, nil
+	}
+	return vagrantBox{Box: data.(string)}, nil
+}
+
+func arrayToVagrant(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Slice || t != reflect.TypeOf(Vagrant{}) {
+		return data, nil
+	}
+	return map[string]interface{}{"boxes": data}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (v *Vagrant) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		arrayToVagrant,
+		stringToVagrantBox,
+	)
+}
+
+// Setup prepares the directory for the Vagrant box repository
+func (v *Vagrant) Setup() error {
+	log.Trace("Called Vagrant.Setup()")
+	if v.Cloud == "" {
+		v.Cloud = defaultVagrantCloud
+	}
+	v.Cloud = strings.TrimSuffix(v.Cloud, "/")
+	if len(v.Providers) == 0 {
+		v.Providers = []string{defaultVagrantProvider}
+	}
+	return os.MkdirAll(v.dir(), os.ModePerm)
+}
+
+// Run downloads the configured boxes, and writes the catalog metadata for each box name
+func (v *Vagrant) Run() error {
+	if err := v.Setup(); err != nil {
+		return err
+	}
+	catalogs := map[string]*vagrantCatalog{}
+	mu := sync.Mutex{}
+	forEach(len(v.Boxes), func(i int) {
+		box := v.Boxes[i]
+		var (
+			catalog *vagrantCatalog
+			err     error
+		)
+		if box.isFile() {
+			catalog, err = v.fetchFile(box)
+		} else {
+			catalog, err = v.fetchCloud(box)
+		}
+		if err != nil {
+			log.Info("Vagrant: unable to get box %s - %s", box, err)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if existing, ok := catalogs[catalog.Name]; ok {
+			existing.Versions = append(existing.Versions, catalog.Versions...)
+			return
+		}
+		catalogs[catalog.Name] = catalog
+	})
+
+	for _, catalog := range catalogs {
+		if err := v.writeCatalog(catalog); err != nil {
+			log.Info("Vagrant: unable to write metadata for %s - %s", catalog.Name, err)
+		}
+	}
+	return nil
+}
+
+// fetchCloud downloads the newest version of a Vagrant Cloud box matching the configured version, for each configured provider
+func (v *Vagrant) fetchCloud(box vagrantBox) (*vagrantCatalog, error) {
+	upstream := vagrantCatalog{}
+	if err := getJSON(v.Cloud+"/"+box.Box, &upstream); err != nil {
+		return nil, err
+	}
+	version, err := pickVagrantVersion(upstream.Versions, box.Version)
+	if err != nil {
+		return nil, err
+	}
+	providers := v.providers(box)
+	result := vagrantVersion{Version: version.Version, Status: version.Status}
+	for _, provider := range version.Providers {
+		if !slices.Contains(providers, provider.Name) || !v.matchArchitecture(provider) {
+			continue
+		}
+		source, err := url.Parse(provider.URL)
+		if err != nil {
+			log.Info("Vagrant: invalid URL for %s %s - %s", box.Box, provider.Name, err)
+			continue
+		}
+		target := path.Join(v.dir(), box.Box, version.Version, boxFile(provider))
+		if err := download(source, target); err != nil {
+			log.Info("Vagrant: unable to download %s %s - %s", box.Box, provider.Name, err)
+			continue
+		}
+		if err := v.addBox(&provider, target); err != nil {
+			_ = os.Remove(target)
+			log.Info("Vagrant: %s %s - %s", box.Box, provider.Name, err)
+			continue
+		}
+		result.Providers = append(result.Providers, provider)
+	}
+	if len(result.Providers) == 0 {
+		return nil, fmt.Errorf("no providers of version %s matched %s", version.Version, providers)
+	}
+	return &vagrantCatalog{Name: box.Box, Description: upstream.Description, Versions: []vagrantVersion{result}}, nil
+}
+
+// fetchFile copies a .box file into the repository. The provider is read from the box, unless one is configured.
+func (v *Vagrant) fetchFile(box vagrantBox) (*vagrantCatalog, error) {
+	source, err := url.Parse(box.Box)
+	if err != nil {
+		return nil, err
+	}
+	name := box.Name
+	if name == "" {
+		name = strings.TrimSuffix(path.Base(source.Path), ".box")
+	}
+	version := box.Version
+	if version == "" {
+		version = defaultVagrantVersion
+	}
+	target := path.Join(v.dir(), name, version, path.Base(source.Path))
+	if err := download(source, target); err != nil {
+		return nil, err
+	}
+	provider := vagrantProvider{}
+	if len(box.Providers) > 0 {
+		provider.Name = box.Providers[0]
+	} else if provider.Name, err = readBoxProvider(target); err != nil {
+		_ = os.Remove(target)
+		return nil, err
+	}
+	final := path.Join(path.Dir(target), boxFile(provider))
+	if err := os.Rename(target, final); err != nil {
+		return nil, err
+	}
+	if err := v.addBox(&provider, final); err != nil {
+		return nil, err
+	}
+	return &vagrantCatalog{Name: name, Versions: []vagrantVersion{{Version: version, Providers: []vagrantProvider{provider}}}}, nil
+}
+
+// addBox verifies the downloaded box against its upstream checksum (when there is one), then points the provider at the local copy
+func (v *Vagrant) addBox(provider *vagrantProvider, file string) error {
+	if provider.Checksum != "" {
+		sum, err := fileChecksum(file, provider.ChecksumType)
+		if err != nil {
+			return err
+		}
+		if !strings.EqualFold(sum, provider.Checksum) {
+			return fmt.Errorf("%s checksum mismatch, expected %s but got %s", provider.ChecksumType, provider.Checksum, sum)
+		}
+	}
+	sum, err := fileChecksum(file, "sha256")
+	if err != nil {
+		return err
+	}
+	provider.Checksum = sum
+	provider.ChecksumType = "sha256"
+	provider.URL = v.boxURL(file)
+	return nil
+}
+
+// boxURL gives the location of a box file when the repository is hosted by Bridgr
+func (v *Vagrant) boxURL(file string) string {
+	rel, _ := filepath.Rel(v.dir(), file)
+	return strings.TrimSuffix(v.Host, "/") + "/" + path.Join(v.Name(), filepath.ToSlash(rel))
+}
+
+// providers gives the providers to download for a box, a box's own list takes precedence over the worker list
+func (v *Vagrant) providers(box vagrantBox) []string {
+	if len(box.Providers) > 0 {
+		return box.Providers
+	}
+	return v.Providers
+}
+
+// matchArchitecture filters multi-architecture boxes to the configured architecture, or the box's default architecture
+func (v *Vagrant) matchArchitecture(provider vagrantProvider) bool {
+	if provider.Architecture == "" {
+		return true
+	}
+	if v.Architecture == "" {
+		return provider.DefaultArchitecture
+	}
+	return provider.Architecture == v.Architecture
+}
+
+// writeCatalog writes the metadata for a box name, so it's served for requests to the box's directory
+func (v *Vagrant) writeCatalog(catalog *vagrantCatalog) error {
+	sort.Slice(catalog.Versions, func(i, j int) bool {
+		return compareVagrantVersions(catalog.Versions[i].Version, catalog.Versions[j].Version) > 0
+	})
+	content, err := json.MarshalIndent(catalog, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(v.dir(), catalog.Name, "index.json"), content, 0644) //nolint:gosec // repository content is meant to be readable
+}
+
+// boxFile is the file name for a provider's box
+func boxFile(provider vagrantProvider) string {
+	if provider.Architecture != "" {
+		return provider.Name + "-" + provider.Architecture + ".box"
+	}
+	return provider.Name + ".box"
+}
+
+// pickVagrantVersion gives the newest active version matching the constraint. Constraints use the same format as Vagrant, ie ">= 1.0, < 2.0"
+func pickVagrantVersion(versions []vagrantVersion, spec string) (vagrantVersion, error) {
+	var constraint *semver.Constraints
+	if spec != "" {
+		var err error
+		if constraint, err = semver.NewConstraint(spec); err != nil {
+			return vagrantVersion{}, err
+		}
+	}
+	var best *vagrantVersion
+	for i, candidate := range versions {
+		if candidate.Status != "" && candidate.Status != "active" {
+			continue
+		}
+		if constraint != nil {
+			parsed, err := semver.NewVersion(candidate.Version)
+			if err != nil || !constraint.Check(parsed) {
+				continue
+			}
+		}
+		if best == nil || compareVagrantVersions(candidate.Version, best.Version) > 0 {
+			best = &versions[i]
+		}
+	}
+	if best == nil {
+		if spec == "" {
+			return vagrantVersion{}, errors.New("no versions available")
+		}
+		return vagrantVersion{}, fmt.Errorf("no version matching %s", spec)
+	}
+	return *best, nil
+}
+
+// compareVagrantVersions orders box versions, versions that aren't semantic versions sort before any that are
+func compareVagrantVersions(a, b string) int {
+	va, errA := semver.NewVersion(a)
+	vb, errB := semver.NewVersion(b)
+	switch {
+	case errA != nil && errB != nil:
+		return strings.Compare(a, b)
+	case errA != nil:
+		return -1
+	case errB != nil:
+		return 1
+	}
+	return va.Compare(vb)
+}
+
+// readBoxProvider reads the provider from the metadata.json in a box file. Boxes are tar archives, which may be gzipped.
+func readBoxProvider(file string) (string, error) {
+	in, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+	buffered := bufio.NewReader(in)
+	var archive io.Reader = buffered
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		gz, err := gzip.NewReader(buffered)
+		if err != nil {
+			return "", err
+		}
+		defer gz.Close()
+		archive = gz
+	}
+	reader := tar.NewReader(archive)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return "", errors.New("no metadata.json found in box")
+		}
+		if err != nil {
+			return "", err
+		}
+		if path.Clean(header.Name) != "metadata.json" {
+			continue
+		}
+		metadata := struct {
+			Provider string `json:"provider"`
+		}{}
+		if err := json.NewDecoder(reader).Decode(&metadata); err != nil {
+			return "", err
+		}
+		if metadata.Provider == "" {
+			return "", errors.New("box metadata.json has no provider")
+		}
+		return metadata.Provider, nil
+	}
+}
@@ -0,0 +1,218 @@
+package bridgr
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func vagrantBoxFile(provider string, compress bool) []byte {
+	content := bytes.Buffer{}
+	archive := tar.NewWriter(&content)
+	metadata := fmt.Sprintf(`{"provider":%q}`, provider)
+	_ = archive.WriteHeader(&tar.Header{Name: "./metadata.json", Mode: 0644, Size: int64(len(metadata))})
+	_, _ = archive.Write([]byte(metadata))
+	archive.Close()
+	if !compress {
+		return content.Bytes()
+	}
+	buf := bytes.Buffer{}
+	gz := gzip.NewWriter(&buf)
+	_, _ = gz.Write(content.Bytes())
+	gz.Close()
+	return buf.Bytes()
+}
+
+func vagrantCloud() *httptest.Server {
+	box := vagrantBoxFile("virtualbox", true)
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		base := "http://" + r.Host
+		switch r.URL.Path {
+		case "/bluth/stair-car":
+			fmt.Fprintf(w, `{"name":"bluth/stair-car","versions":[
+				{"version":"1.0.0","status":"active","providers":[{"name":"virtualbox","url":"%[1]s/old.box"}]},
+				{"version":"1.1.0","status":"active","providers":[
+					{"name":"virtualbox","url":"%[1]s/stair-car.box","checksum":"%[2]x","checksum_type":"sha256"},
+					{"name":"libvirt","url":"%[1]s/libvirt.box"}
+				]},
+				{"version":"2.0.0","status":"revoked","providers":[{"name":"virtualbox","url":"%[1]s/revoked.box"}]}
+			]}`, base, sha256.Sum256(box))
+		case "/bluth/seal":
+			fmt.Fprintf(w, `{"name":"bluth/seal","versions":[{"version":"1.0.0","providers":[{"name":"virtualbox","url":"%s/seal.box","checksum":"abc123","checksum_type":"sha1"}]}]}`, base)
+		case "/stair-car.box", "/seal.box", "/local.box":
+			_, _ = w.Write(box)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+}
+
+func TestVagrantDir(t *testing.T) {
+	expected := BaseDir("vagrant")
+	result := Vagrant{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestArrayToVagrant(t *testing.T) {
+	input := []interface{}{"centos/7"}
+	result, err := arrayToVagrant(reflect.TypeOf(input), reflect.TypeOf(Vagrant{}), input)
+	if err != nil {
+		t.Error(err)
+	}
+	expect := map[string]interface{}{"boxes": input}
+	if !cmp.Equal(expect, result) {
+		t.Error(cmp.Diff(expect, result))
+	}
+
+	other, _ := arrayToVagrant(reflect.TypeOf(""), reflect.TypeOf(Vagrant{}), "gob")
+	if !cmp.Equal("gob", other) {
+		t.Error(cmp.Diff("gob", other))
+	}
+}
+
+func TestPickVagrantVersion(t *testing.T) {
+	versions := []vagrantVersion{
+		{Version: "1.0.0", Status: "active"},
+		{Version: "2004.01", Status: "active"},
+		{Version: "1.5.0"},
+		{Version: "3000.0", Status: "revoked"},
+	}
+	tests := []struct {
+		name    string
+		spec    string
+		expect  string
+		isError bool
+	}{
+		{"latest", "", "2004.01", false},
+		{"exact", "1.0.0", "1.0.0", false},
+		{"constraint", ">= 1.0, < 2.0", "1.5.0", false},
+		{"no match", "> 5000", "", true},
+		{"invalid", "banana", "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := pickVagrantVersion(versions, test.spec)
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+			if !cmp.Equal(test.expect, result.Version) {
+				t.Error(cmp.Diff(test.expect, result.Version))
+			}
+		})
+	}
+}
+
+func TestReadBoxProvider(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content []byte
+		expect  string
+		isError bool
+	}{
+		{"gzip", vagrantBoxFile("libvirt", true), "libvirt", false},
+		{"tar", vagrantBoxFile("vmware_desktop", false), "vmware_desktop", false},
+		{"not a box", []byte("solid as a rock"), "", true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := path.Join(dir, test.name+".box")
+			_ = os.WriteFile(file, test.content, 0600)
+			result, err := readBoxProvider(file)
+			if test.isError != (err != nil) {
+				t.Errorf("expected error: %t, but got %v", test.isError, err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestVagrantMatchArchitecture(t *testing.T) {
+	tests := []struct {
+		name     string
+		arch     string
+		provider vagrantProvider
+		expect   bool
+	}{
+		{"single architecture", "", vagrantProvider{}, true},
+		{"default architecture", "", vagrantProvider{Architecture: "amd64", DefaultArchitecture: true}, true},
+		{"other architecture", "", vagrantProvider{Architecture: "arm64"}, false},
+		{"configured architecture", "arm64", vagrantProvider{Architecture: "arm64"}, true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			vagrant := Vagrant{Architecture: test.arch}
+			if !cmp.Equal(test.expect, vagrant.matchArchitecture(test.provider)) {
+				t.Error(cmp.Diff(test.expect, vagrant.matchArchitecture(test.provider)))
+			}
+		})
+	}
+}
+
+func TestVagrantRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := vagrantCloud()
+	defer server.Close()
+
+	vagrant := Vagrant{
+		Cloud: server.URL,
+		Boxes: []vagrantBox{
+			{Box: "bluth/stair-car", Version: "< 2.0"},
+			{Box: "bluth/seal"},
+			{Box: server.URL + "/local.box", Name: "bluth/stair-car", Version: "0.1.0"},
+		},
+	}
+	if err := vagrant.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(path.Join(vagrant.dir(), "bluth/stair-car/index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog := vagrantCatalog{}
+	if err := json.Unmarshal(content, &catalog); err != nil {
+		t.Fatal(err)
+	}
+	if len(catalog.Versions) != 2 || catalog.Versions[0].Version != "1.1.0" || catalog.Versions[1].Version != "0.1.0" {
+		t.Fatalf("expected versions 1.1.0 and 0.1.0, but got %+v", catalog.Versions)
+	}
+	providers := catalog.Versions[0].Providers
+	if len(providers) != 1 || providers[0].Name != "virtualbox" {
+		t.Errorf("expected only the virtualbox provider, but got %+v", providers)
+	}
+	expectURL := "/vagrant/bluth/stair-car/1.1.0/virtualbox.box"
+	if !cmp.Equal(expectURL, providers[0].URL) {
+		t.Error(cmp.Diff(expectURL, providers[0].URL))
+	}
+	if providers[0].ChecksumType != "sha256" || providers[0].Checksum == "" {
+		t.Errorf("expected a sha256 checksum, but got %+v", providers[0])
+	}
+	if _, err := os.Stat(path.Join(vagrant.dir(), "bluth/stair-car/0.1.0/virtualbox.box")); err != nil {
+		t.Errorf("expected local box to be named for its provider: %s", err)
+	}
+
+	for _, file := range []string{"bluth/seal/1.0.0/virtualbox.box", "bluth/seal/index.json"} {
+		if _, err := os.Stat(path.Join(vagrant.dir(), file)); err == nil {
+			t.Errorf("expected %s to not be written for a box with a mismatched checksum", file)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestVagrantImage(t *testing.T) {
+	vagrant := bridgr.Vagrant{}
+	if vagrant.Image() != nil {
+		t.Errorf("expected nil, but got %+v", vagrant.Image())
+	}
+}
+
+func TestVagrantName(t *testing.T) {
+	expected := "vagrant"
+	vagrant := bridgr.Vagrant{}
+	if !cmp.Equal(expected, vagrant.Name()) {
+		t.Error(cmp.Diff(expected, vagrant.Name()))
+	}
+}
+
+func TestVagrantHook(t *testing.T) {
+	vagrant := bridgr.Vagrant{}
+	result := reflect.TypeOf(vagrant.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
@@ -0,0 +1,405 @@
+package bridgr
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/Masterminds/semver/v3"
+	"github.com/distribution/reference"
+	"github.com/mitchellh/mapstructure"
+	log "unknwon.dev/clog/v2"
+)
+
+const (
+	defaultVSCodeRegistry = "https://open-vsx.org"
+	defaultVSCodePlatform = "linux-x64"
+	vscodeUniversal       = "universal"
+)
+
+// VSCode is the configuration object for creating a static Open VSX extension registry
+type VSCode struct {
+	Registry   string
+	Host       string
+	Platforms  []string
+	Extensions []vscodeExtension
+}
+
+type vscodeExtension struct {
+	ID      string
+	Version string
+}
+
+// vscodeMetadata is the Open VSX API document of an extension version. It is kept as a generic document so that every field is
+// written back out.
+type vscodeMetadata map[string]interface{}
+
+func (ve vscodeExtension) String() string {
+	if ve.Version != "" {
+		return ve.ID + "@" + ve.Version
+	}
+	return ve.ID
+}
+
+// split gives the namespace (publisher) and name of an extension
+func (ve vscodeExtension) split() (string, string, error) {
+	parts := strings.SplitN(ve.ID, ".", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", fmt.Errorf("%s is not in the form publisher.extension", ve.ID)
+	}
+	return strings.ToLower(parts[0]), strings.ToLower(parts[1]), nil
+}
+
+func (vm vscodeMetadata) str(key string) string {
+	value, _ := vm[key].(string)
+	return value
+}
+
+// target gives the platform of the extension version, which is "universal" unless it was built for a specific platform
+func (vm vscodeMetadata) target() string {
+	if target := vm.str("targetPlatform"); target != "" {
+		return target
+	}
+	return vscodeUniversal
+}
+
+// references gives the extensions in a list field of the metadata, ie "dependencies" or "bundledExtensions"
+func (vm vscodeMetadata) references(key string) []vscodeExtension {
+	list, _ := vm[key].([]interface{})
+	var refs []vscodeExtension
+	for _, item := range list {
+		ref, _ := item.(map[string]interface{})
+		namespace, _ := ref["namespace"].(string)
+		extension, _ := ref["extension"].(string)
+		if namespace != "" && extension != "" {
+			refs = append(refs, vscodeExtension{ID: namespace + "." + extension})
+		}
+	}
+	return refs
+}
+
+// dir is the top-level directory name for all objects written out under the VSCode worker
+func (v VSCode) dir() string {
+	return BaseDir(v.Name())
+}
+
+// Name returns the name of this Configuration
+func (v VSCode) Name() string {
+	return "vscode"
+}
+
+// Image implements the Imager interface
+func (v VSCode) Image() reference.Named {
+	return nil
+}
+
+func stringToVSCodeExtension(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.String || t != reflect.TypeOf(vscodeExtension{}) {
+		return data, nil
+	}
+	parts := strings.SplitN(data.(string), "@", 2)
+	ext := vscodeExtension{ID: strings.TrimSpace(parts[0])}
+	if len(parts) > 1 {
+		ext.Version = strings.TrimSpace(parts[1])
+	}
+	return ext, nil
+}
+
+func arrayToVSCode(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Slice || t != reflect.TypeOf(VSCode{}) {
+		return data, nil
+	}
+	return map[string]interface{}{"extensions": data}, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (v *VSCode) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		arrayToVSCode,
+		stringToVSCodeExtension,
+	)
+}
+
+// Setup prepares the directory for the extension registry
+func (v *VSCode) Setup() error {
+	log.Trace("Called VSCode.Setup()")
+	if v.Registry == "" {
+		v.Registry = defaultVSCodeRegistry
+	}
+	v.Registry = strings.TrimSuffix(v.Registry, "/")
+	if len(v.Platforms) == 0 {
+		v.Platforms = []string{defaultVSCodePlatform}
+	}
+	if v.Host == "" {
+		log.Warn("VSCode: no host is configured, download URLs will be relative to the host that serves the registry")
+	}
+	return os.MkdirAll(v.dir(), os.ModePerm)
+}
+
+// Run downloads the configured extensions, along with the extensions they depend on and the extensions in their extension packs,
+// and writes the Open VSX API documents for them
+func (v *VSCode) Run() error {
+	if err := v.Setup(); err != nil {
+		return err
+	}
+	queue := v.Extensions
+	seen := map[string]bool{}
+	updated := map[string]bool{}
+	mu := sync.Mutex{}
+	for len(queue) > 0 {
+		var level []vscodeExtension
+		for _, ext := range queue {
+			if key := strings.ToLower(ext.String()); !seen[key] {
+				seen[key] = true
+				level = append(level, ext)
+			}
+		}
+		var next []vscodeExtension
+		forEach(len(level), func(i int) {
+			metadata, err := v.mirror(level[i])
+			if err != nil {
+				log.Info("VSCode: unable to mirror %s - %s", level[i], err)
+				return
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			updated[strings.ToLower(level[i].ID)] = true
+			next = append(next, metadata.references("dependencies")...)
+			next = append(next, metadata.references("bundledExtensions")...)
+		})
+		queue = next
+	}
+	for id := range updated {
+		if err := v.writeLatest(vscodeExtension{ID: id}); err != nil {
+			log.Info("VSCode: unable to write API documents for %s - %s", id, err)
+		}
+	}
+	return nil
+}
+
+// url gives the location of a path in the registry when it is hosted by Bridgr
+func (v *VSCode) url(parts ...string) string {
+	return strings.TrimSuffix(v.Host, "/") + "/" + path.Join(append([]string{v.Name()}, parts...)...)
+}
+
+// mirror downloads one version of an extension, for each configured platform it is built for, and writes its version documents
+func (v *VSCode) mirror(ext vscodeExtension) (vscodeMetadata, error) {
+	namespace, name, err := ext.split()
+	if err != nil {
+		return nil, err
+	}
+	metadata := vscodeMetadata{}
+	if err := getJSON(v.Registry+"/"+path.Join("api", namespace, name, ext.Version), &metadata); err != nil {
+		return nil, err
+	}
+	version := metadata.str("version")
+
+	var targets []vscodeMetadata
+	if metadata.target() == vscodeUniversal {
+		targets = append(targets, metadata)
+	} else {
+		available, _ := metadata["downloads"].(map[string]interface{})
+		for _, platform := range v.Platforms {
+			if _, ok := available[platform]; !ok {
+				continue
+			}
+			if platform == metadata.target() {
+				targets = append(targets, metadata)
+				continue
+			}
+			targetMetadata := vscodeMetadata{}
+			if err := getJSON(v.Registry+"/"+path.Join("api", namespace, name, platform, version), &targetMetadata); err != nil {
+				log.Info("VSCode: unable to read %s %s for %s - %s", ext.ID, version, platform, err)
+				continue
+			}
+			targets = append(targets, targetMetadata)
+		}
+	}
+
+	downloads := map[string]interface{}{}
+	var written []vscodeMetadata
+	for _, target := range targets {
+		file, err := v.download(namespace, name, target)
+		if err != nil {
+			log.Info("VSCode: unable to download %s %s for %s - %s", ext.ID, version, target.target(), err)
+			continue
+		}
+		downloads[target.target()] = file
+		written = append(written, target)
+	}
+	if len(written) == 0 {
+		return nil, fmt.Errorf("%s %s is not available for %s", ext.ID, version, strings.Join(v.Platforms, ", "))
+	}
+
+	for _, target := range written {
+		doc := vscodeMetadata{}
+		for key, value := range target {
+			doc[key] = value
+		}
+		doc["files"] = map[string]interface{}{"download": downloads[target.target()]}
+		doc["downloads"] = downloads
+		delete(doc, "allVersions")
+		docPath := []string{"api", namespace, name, version}
+		if target.target() != vscodeUniversal {
+			docPath = []string{"api", namespace, name, target.target(), version}
+			// the version document without a platform is for the first platform, unless there is a universal build of it
+			if _, universal := downloads[vscodeUniversal]; !universal && target.target() == written[0].target() {
+				if err := v.writeJSON(path.Join(v.dir(), "api", namespace, name, version, "index.json"), doc); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if err := v.writeJSON(path.Join(append([]string{v.dir()}, append(docPath, "index.json")...)...), doc); err != nil {
+			return nil, err
+		}
+	}
+	return metadata, nil
+}
+
+// download fetches the .vsix file of an extension version, verifies it against the published SHA-256 when there is one, and
+// gives the URL of the file when it is hosted by Bridgr
+func (v *VSCode) download(namespace, name string, metadata vscodeMetadata) (string, error) {
+	files, _ := metadata["files"].(map[string]interface{})
+	source, _ := files["download"].(string)
+	if source == "" {
+		return "", fmt.Errorf("no download is available")
+	}
+	sourceURL, err := url.Parse(source)
+	if err != nil {
+		return "", err
+	}
+	version := metadata.str("version")
+	parts := []string{"api", namespace, name, version, "file", path.Base(sourceURL.Path)}
+	if metadata.target() != vscodeUniversal {
+		parts = []string{"api", namespace, name, metadata.target(), version, "file", path.Base(sourceURL.Path)}
+	}
+	target := path.Join(append([]string{v.dir()}, parts...)...)
+	if _, err := os.Stat(target); err != nil {
+		if err := download(sourceURL, target); err != nil {
+			return "", err
+		}
+	} else if err := lockExisting(target); err != nil {
+		return "", err
+	}
+
+	if checksum, _ := files["sha256"].(string); checksum != "" {
+		resp, err := httpGet(checksum)
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		content, err := io.ReadAll(resp.Body)
+		if err != nil {
+			return "", err
+		}
+		expected := strings.Fields(string(content))
+		sum, err := fileChecksum(target, "sha256")
+		if err != nil {
+			return "", err
+		}
+		if len(expected) == 0 || !strings.EqualFold(expected[0], sum) {
+			_ = os.Remove(target)
+			return "", fmt.Errorf("checksum mismatch for %s", path.Base(target))
+		}
+	}
+	return v.url(parts...), nil
+}
+
+func (v *VSCode) writeJSON(file string, doc interface{}) error {
+	if err := os.MkdirAll(path.Dir(file), os.ModePerm); err != nil {
+		return err
+	}
+	content, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(file, content, 0644) //nolint:gosec // repository content is meant to be readable
+}
+
+// writeLatest writes the documents for the newest version of an extension, both without a platform and for each platform.
+// Every version in the registry is listed in allVersions, including versions from earlier runs.
+func (v *VSCode) writeLatest(ext vscodeExtension) error {
+	namespace, name, err := ext.split()
+	if err != nil {
+		return err
+	}
+	extDir := path.Join(v.dir(), "api", namespace, name)
+	entries, err := os.ReadDir(extDir)
+	if err != nil {
+		return err
+	}
+	var (
+		versions []*semver.Version
+		targets  []string
+	)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if version, err := semver.NewVersion(entry.Name()); err == nil {
+			versions = append(versions, version)
+		} else {
+			targets = append(targets, entry.Name())
+		}
+	}
+	latest, err := latestVSCodeDocument(extDir, versions)
+	if err != nil {
+		return err
+	}
+	allVersions := map[string]string{"latest": v.url("api", namespace, name)}
+	for _, version := range versions {
+		allVersions[version.Original()] = v.url("api", namespace, name, version.Original())
+	}
+	latest["allVersions"] = allVersions
+	if err := v.writeJSON(path.Join(extDir, "index.json"), latest); err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		dirs, err := filepath.Glob(path.Join(extDir, target, "*", "index.json"))
+		if err != nil {
+			return err
+		}
+		var targetVersions []*semver.Version
+		for _, dir := range dirs {
+			if version, err := semver.NewVersion(path.Base(path.Dir(dir))); err == nil {
+				targetVersions = append(targetVersions, version)
+			}
+		}
+		doc, err := latestVSCodeDocument(path.Join(extDir, target), targetVersions)
+		if err != nil {
+			return err
+		}
+		doc["allVersions"] = allVersions
+		if err := v.writeJSON(path.Join(extDir, target, "index.json"), doc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// latestVSCodeDocument reads the version document of the newest version in a directory
+func latestVSCodeDocument(dir string, versions []*semver.Version) (vscodeMetadata, error) {
+	var newest *semver.Version
+	for _, version := range versions {
+		if newest == nil || version.GreaterThan(newest) {
+			newest = version
+		}
+	}
+	if newest == nil {
+		return nil, fmt.Errorf("no versions have been downloaded")
+	}
+	content, err := os.ReadFile(path.Join(dir, newest.Original(), "index.json"))
+	if err != nil {
+		return nil, err
+	}
+	doc := vscodeMetadata{}
+	return doc, json.Unmarshal(content, &doc)
+}
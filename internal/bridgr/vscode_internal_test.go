@@ -0,0 +1,191 @@
+package bridgr
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func openVSX() *httptest.Server {
+	sum := sha256.Sum256([]byte("bluth.banana-2.0.0.vsix"))
+	metadata := map[string]string{
+		"/api/bluth/banana": `{"namespace":"bluth","name":"banana","version":"2.0.0","targetPlatform":"universal",
+			"files":{"download":"%[1]s/api/bluth/banana/2.0.0/file/bluth.banana-2.0.0.vsix","sha256":"%[1]s/api/bluth/banana/2.0.0/file/bluth.banana-2.0.0.sha256","icon":"%[1]s/icon.png"},
+			"allVersions":{"2.0.0":"%[1]s/api/bluth/banana/2.0.0"},
+			"dependencies":[{"namespace":"bluth","extension":"stand"}],"bundledExtensions":[]}`,
+		"/api/bluth/banana/2.0.0/file/bluth.banana-2.0.0.sha256": hex.EncodeToString(sum[:]) + "  bluth.banana-2.0.0.vsix",
+		"/api/bluth/stand": `{"namespace":"bluth","name":"stand","version":"1.2.0","targetPlatform":"win32-x64",
+			"files":{"download":"%[1]s/api/bluth/stand/win32-x64/1.2.0/file/bluth.stand-1.2.0@win32-x64.vsix"},
+			"downloads":{"win32-x64":"%[1]s/api/bluth/stand/win32-x64/1.2.0/file/bluth.stand-1.2.0@win32-x64.vsix","linux-x64":"%[1]s/api/bluth/stand/linux-x64/1.2.0/file/bluth.stand-1.2.0@linux-x64.vsix"},
+			"bundledExtensions":[{"namespace":"bluth","extension":"missing"}]}`,
+		"/api/bluth/stand/linux-x64/1.2.0": `{"namespace":"bluth","name":"stand","version":"1.2.0","targetPlatform":"linux-x64",
+			"files":{"download":"%[1]s/api/bluth/stand/linux-x64/1.2.0/file/bluth.stand-1.2.0@linux-x64.vsix"}}`,
+	}
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if doc, ok := metadata[r.URL.Path]; ok {
+			fmt.Fprintf(w, doc, server.URL)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, ".vsix") {
+			fmt.Fprint(w, path.Base(r.URL.Path))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	return server
+}
+
+func TestVSCodeDir(t *testing.T) {
+	expected := BaseDir("vscode")
+	result := VSCode{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestStringToVSCodeExtension(t *testing.T) {
+	tests := []struct {
+		name   string
+		input  interface{}
+		expect interface{}
+	}{
+		{"id only", "golang.Go", vscodeExtension{ID: "golang.Go"}},
+		{"with version", "golang.go@0.41.0", vscodeExtension{ID: "golang.go", Version: "0.41.0"}},
+		{"not a string", 42, 42},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, err := stringToVSCodeExtension(reflect.TypeOf(test.input), reflect.TypeOf(vscodeExtension{}), test.input)
+			if err != nil {
+				t.Error(err)
+			}
+			if !cmp.Equal(test.expect, result) {
+				t.Error(cmp.Diff(test.expect, result))
+			}
+		})
+	}
+}
+
+func TestArrayToVSCode(t *testing.T) {
+	input := []interface{}{"golang.go"}
+	result, _ := arrayToVSCode(reflect.TypeOf(input), reflect.TypeOf(VSCode{}), input)
+	expect := map[string]interface{}{"extensions": input}
+	if !cmp.Equal(expect, result) {
+		t.Error(cmp.Diff(expect, result))
+	}
+}
+
+func TestVSCodeExtensionSplit(t *testing.T) {
+	namespace, name, err := vscodeExtension{ID: "Red-Hat.vscode.yaml"}.split()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if namespace != "red-hat" || name != "vscode.yaml" {
+		t.Errorf("expected red-hat and vscode.yaml, got %s and %s", namespace, name)
+	}
+	if _, _, err := (vscodeExtension{ID: "golang"}).split(); err == nil {
+		t.Error("expected an error for an ID without a publisher")
+	}
+}
+
+func TestVSCodeMetadataReferences(t *testing.T) {
+	metadata := vscodeMetadata{"dependencies": []interface{}{
+		map[string]interface{}{"namespace": "bluth", "extension": "stand"},
+		map[string]interface{}{"namespace": "bluth"},
+	}}
+	expect := []vscodeExtension{{ID: "bluth.stand"}}
+	if result := metadata.references("dependencies"); !cmp.Equal(expect, result) {
+		t.Error(cmp.Diff(expect, result))
+	}
+	if result := metadata.references("bundledExtensions"); result != nil {
+		t.Errorf("expected no references, got %+v", result)
+	}
+}
+
+func TestVSCodeRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := openVSX()
+	defer server.Close()
+
+	vscode := VSCode{Registry: server.URL, Host: "http://bridgr.bluth.com", Extensions: []vscodeExtension{{ID: "bluth.banana"}}}
+	if err := vscode.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectFiles := []string{
+		"api/bluth/banana/index.json",
+		"api/bluth/banana/2.0.0/index.json",
+		"api/bluth/banana/2.0.0/file/bluth.banana-2.0.0.vsix",
+		"api/bluth/stand/index.json",
+		"api/bluth/stand/1.2.0/index.json",
+		"api/bluth/stand/linux-x64/index.json",
+		"api/bluth/stand/linux-x64/1.2.0/index.json",
+		"api/bluth/stand/linux-x64/1.2.0/file/bluth.stand-1.2.0@linux-x64.vsix",
+	}
+	for _, file := range expectFiles {
+		if _, err := os.Stat(path.Join(vscode.dir(), file)); err != nil {
+			t.Errorf("expected %s to be written: %s", file, err)
+		}
+	}
+	if _, err := os.Stat(path.Join(vscode.dir(), "api/bluth/stand/win32-x64")); err == nil {
+		t.Error("expected win32-x64 to not be downloaded")
+	}
+
+	latest := vscodeMetadata{}
+	content, _ := os.ReadFile(path.Join(vscode.dir(), "api/bluth/banana/index.json"))
+	if err := json.Unmarshal(content, &latest); err != nil {
+		t.Fatal(err)
+	}
+	expectDownload := map[string]interface{}{"download": "http://bridgr.bluth.com/vscode/api/bluth/banana/2.0.0/file/bluth.banana-2.0.0.vsix"}
+	if !cmp.Equal(expectDownload, latest["files"]) {
+		t.Error(cmp.Diff(expectDownload, latest["files"]))
+	}
+	expectVersions := map[string]interface{}{
+		"latest": "http://bridgr.bluth.com/vscode/api/bluth/banana",
+		"2.0.0":  "http://bridgr.bluth.com/vscode/api/bluth/banana/2.0.0",
+	}
+	if !cmp.Equal(expectVersions, latest["allVersions"]) {
+		t.Error(cmp.Diff(expectVersions, latest["allVersions"]))
+	}
+
+	stand := vscodeMetadata{}
+	content, _ = os.ReadFile(path.Join(vscode.dir(), "api/bluth/stand/1.2.0/index.json"))
+	if err := json.Unmarshal(content, &stand); err != nil {
+		t.Fatal(err)
+	}
+	expectDownloads := map[string]interface{}{"linux-x64": "http://bridgr.bluth.com/vscode/api/bluth/stand/linux-x64/1.2.0/file/bluth.stand-1.2.0@linux-x64.vsix"}
+	if !cmp.Equal(expectDownloads, stand["downloads"]) {
+		t.Error(cmp.Diff(expectDownloads, stand["downloads"]))
+	}
+}
+
+func TestVSCodeChecksumMismatch(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "0000")
+	}))
+	defer server.Close()
+
+	vscode := VSCode{Registry: server.URL}
+	metadata := vscodeMetadata{"version": "1.0.0", "files": map[string]interface{}{
+		"download": server.URL + "/api/bluth/banana/1.0.0/file/bluth.banana-1.0.0.vsix",
+		"sha256":   server.URL + "/api/bluth/banana/1.0.0/file/bluth.banana-1.0.0.sha256",
+	}}
+	if _, err := vscode.download("bluth", "banana", metadata); err == nil {
+		t.Error("expected a checksum mismatch")
+	}
+	if _, err := os.Stat(path.Join(vscode.dir(), "api/bluth/banana/1.0.0/file/bluth.banana-1.0.0.vsix")); err == nil {
+		t.Error("expected the mismatched file to be removed")
+	}
+}
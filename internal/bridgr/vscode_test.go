@@ -0,0 +1,33 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestVSCodeImage(t *testing.T) {
+	vscode := bridgr.VSCode{}
+	if vscode.Image() != nil {
+		t.Errorf("expected nil, but got %+v", vscode.Image())
+	}
+}
+
+func TestVSCodeName(t *testing.T) {
+	expected := "vscode"
+	vscode := bridgr.VSCode{}
+	if !cmp.Equal(expected, vscode.Name()) {
+		t.Error(cmp.Diff(expected, vscode.Name()))
+	}
+}
+
+func TestVSCodeHook(t *testing.T) {
+	vscode := bridgr.VSCode{}
+	result := reflect.TypeOf(vscode.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
@@ -0,0 +1,410 @@
+package bridgr
+
+import (
+	"archive/tar"
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/md5" //nolint:gosec // Google Cloud Storage publishes MD5 hashes of objects
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/mitchellh/mapstructure"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"oras.land/oras-go/v2/content"
+	log "unknwon.dev/clog/v2"
+)
+
+// The sources of the vulnerability databases
+var (
+	grypeListing   = "https://toolbox-data.anchore.io/grype/databases/listing.json"
+	grypeDatabases = "https://grype.anchore.io/databases"
+	osvBucket      = "https://osv-vulnerabilities.storage.googleapis.com"
+)
+
+// vulnDBDefaults are used for a database that is configured as "true", instead of with a list
+var vulnDBDefaults = map[string][]string{
+	"trivy": {"ghcr.io/aquasecurity/trivy-db:2", "ghcr.io/aquasecurity/trivy-java-db:1"},
+	"grype": {"v6"},
+	"osv":   {"*"},
+}
+
+// VulnDB is the configuration object for mirroring the vulnerability databases of offline scanners
+type VulnDB struct {
+	Host  string
+	Trivy []string
+	Grype []string
+	OSV   []string
+}
+
+// grypeV5Database is an entry in the schema v5 Grype listing.json
+type grypeV5Database struct {
+	Built    string `json:"built"`
+	Version  int    `json:"version"`
+	URL      string `json:"url"`
+	Checksum string `json:"checksum"`
+}
+
+// dir is the top-level directory name for all objects written out under the VulnDB worker
+func (v VulnDB) dir() string {
+	return BaseDir(v.Name())
+}
+
+// Name returns the name of this Configuration
+func (v VulnDB) Name() string {
+	return "vulndb"
+}
+
+// Image implements the Imager interface
+func (v VulnDB) Image() reference.Named {
+	return nil
+}
+
+func boolToVulnDBDefaults(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+	if f.Kind() != reflect.Map || t != reflect.TypeOf(VulnDB{}) {
+		return data, nil
+	}
+	config := map[string]interface{}{}
+	for key, value := range data.(map[string]interface{}) {
+		enabled, ok := value.(bool)
+		switch {
+		case !ok:
+			config[key] = value
+		case enabled:
+			config[key] = vulnDBDefaults[strings.ToLower(key)]
+		}
+	}
+	return config, nil
+}
+
+// Hook implements the Parser interface, returns a function for use by mapstructure when parsing config files
+func (v *VulnDB) Hook() mapstructure.DecodeHookFunc {
+	return mapstructure.ComposeDecodeHookFunc(
+		boolToVulnDBDefaults,
+	)
+}
+
+// Setup prepares the directory for the vulnerability databases
+func (v *VulnDB) Setup() error {
+	log.Trace("Called VulnDB.Setup()")
+	if v.Host == "" && slices.Contains(v.Grype, "v5") {
+		log.Warn("VulnDB: no host is configured, the Grype v5 listing will have URLs relative to the host that serves it")
+	}
+	return os.MkdirAll(v.dir(), os.ModePerm)
+}
+
+// Run fetches each configured database
+func (v *VulnDB) Run() error {
+	if err := v.Setup(); err != nil {
+		return err
+	}
+	forEach(len(v.Trivy), func(i int) {
+		if err := v.trivy(v.Trivy[i]); err != nil {
+			log.Info("VulnDB: unable to fetch the Trivy database %s - %s", v.Trivy[i], err)
+		}
+	})
+	for _, schema := range v.Grype {
+		var err error
+		switch schema {
+		case "v5":
+			err = v.grypeV5()
+		case "v6":
+			err = v.grypeV6()
+		default:
+			err = errors.New("only schemas v5 and v6 are supported")
+		}
+		if err != nil {
+			log.Info("VulnDB: unable to fetch the Grype %s database - %s", schema, err)
+		}
+	}
+	if len(v.OSV) > 0 {
+		if err := v.osv(); err != nil {
+			log.Info("VulnDB: unable to fetch the OSV databases - %s", err)
+		}
+	}
+	return nil
+}
+
+// url gives the location of a path in the mirror when it is hosted by Bridgr
+func (v *VulnDB) url(parts ...string) string {
+	return strings.TrimSuffix(v.Host, "/") + "/" + path.Join(append([]string{v.Name()}, parts...)...)
+}
+
+// trivy pulls a Trivy database artifact, ie ghcr.io/aquasecurity/trivy-db:2, and extracts it in the layout of Trivy's cache
+// directory. The "trivy" directory can be used with "trivy --cache-dir <dir> --skip-db-update --skip-java-db-update".
+// The database archive is kept next to it, for scanners that are given the archive.
+func (v *VulnDB) trivy(ref string) error {
+	named, err := reference.ParseNormalizedNamed(ref)
+	if err != nil {
+		return err
+	}
+	named = reference.TagNameOnly(named)
+	repo, err := ociRepository(named)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	desc, rc, err := repo.FetchReference(ctx, named.(reference.Tagged).Tag())
+	if err != nil {
+		return err
+	}
+	manifest := ocispec.Manifest{}
+	body, err := content.ReadAll(rc, desc)
+	rc.Close()
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return err
+	}
+	if len(manifest.Layers) == 0 {
+		return errors.New("the artifact has no database layer")
+	}
+	layer := manifest.Layers[0]
+
+	// trivy-db is extracted to "db", and trivy-java-db to "java-db"
+	name := strings.TrimPrefix(path.Base(reference.Path(named)), "trivy-")
+	archive := path.Join(v.dir(), "trivy", name+".tar.gz")
+	if sum, err := fileChecksum(archive, "sha256"); err != nil || sum != layer.Digest.Encoded() {
+		blob, err := repo.Fetch(ctx, layer)
+		if err != nil {
+			return err
+		}
+		defer blob.Close()
+		if err := lockArtifact(archive, func() error { return writeVerified(archive, content.NewVerifyReader(blob, layer)) }); err != nil {
+			return err
+		}
+	} else if err := lockExisting(archive); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(path.Join(v.dir(), "trivy", name)); err != nil {
+		return err
+	}
+	return extractTarGz(archive, path.Join(v.dir(), "trivy", name))
+}
+
+// grypeV5 fetches the newest schema v5 Grype database, and writes a listing.json with only that database, for
+// GRYPE_DB_UPDATE_URL=http://<host>/vulndb/grype/listing.json
+func (v *VulnDB) grypeV5() error {
+	listing := struct {
+		Available map[string][]grypeV5Database `json:"available"`
+	}{}
+	if err := getJSON(grypeListing, &listing); err != nil {
+		return err
+	}
+	var newest *grypeV5Database
+	for i, db := range listing.Available["5"] {
+		if newest == nil || db.Built > newest.Built {
+			newest = &listing.Available["5"][i]
+		}
+	}
+	if newest == nil {
+		return errors.New("no schema v5 databases are listed")
+	}
+	source, err := url.Parse(newest.URL)
+	if err != nil {
+		return err
+	}
+	file := path.Base(source.Path)
+	if err := verifiedDownload(source, path.Join(v.dir(), "grype", file), newest.Checksum); err != nil {
+		return err
+	}
+	db := *newest
+	db.URL = v.url("grype", file)
+	mirrored := map[string][]grypeV5Database{"5": {db}}
+	doc, err := json.MarshalIndent(map[string]interface{}{"available": mirrored}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(v.dir(), "grype", "listing.json"), doc, 0644) //nolint:gosec // repository content is meant to be readable
+}
+
+// grypeV6 fetches the latest schema v6 Grype database, for GRYPE_DB_UPDATE_URL=http://<host>/vulndb/grype. Its latest.json names
+// the archive relative to itself, so it is written as it is.
+func (v *VulnDB) grypeV6() error {
+	resp, err := httpGet(grypeDatabases + "/v6/latest.json")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	latest, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	db := struct {
+		Path     string `json:"path"`
+		Checksum string `json:"checksum"`
+	}{}
+	if err := json.Unmarshal(latest, &db); err != nil {
+		return err
+	}
+	if db.Path == "" || path.Base(db.Path) != db.Path {
+		return fmt.Errorf("unexpected database path %q", db.Path)
+	}
+	source, err := url.Parse(grypeDatabases + "/v6/" + db.Path)
+	if err != nil {
+		return err
+	}
+	if err := verifiedDownload(source, path.Join(v.dir(), "grype", "v6", db.Path), db.Checksum); err != nil {
+		return err
+	}
+	return os.WriteFile(path.Join(v.dir(), "grype", "v6", "latest.json"), latest, 0644) //nolint:gosec // repository content is meant to be readable
+}
+
+// osv fetches the all.zip of each OSV ecosystem, in the layout of the osv-vulnerabilities bucket. The "osv-scanner" directory is
+// also the layout of OSV-Scanner's local databases, so OSV_SCANNER_LOCAL_DB_CACHE_DIRECTORY can be a copy of the vulndb directory.
+// An ecosystem of "*" is every ecosystem in the bucket's ecosystems.txt.
+func (v *VulnDB) osv() error {
+	ecosystems := v.OSV
+	if slices.Contains(ecosystems, "*") {
+		resp, err := httpGet(osvBucket + "/ecosystems.txt")
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		ecosystems = nil
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			if ecosystem := strings.TrimSpace(scanner.Text()); ecosystem != "" {
+				ecosystems = append(ecosystems, ecosystem)
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+	}
+	dir := path.Join(v.dir(), "osv-scanner")
+	forEach(len(ecosystems), func(i int) {
+		if err := osvDownload(osvBucket+"/"+url.PathEscape(ecosystems[i])+"/all.zip", path.Join(dir, ecosystems[i], "all.zip")); err != nil {
+			log.Info("VulnDB: unable to fetch the OSV %s database - %s", ecosystems[i], err)
+		}
+	})
+
+	// ecosystems from earlier runs are listed too
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	var mirrored []string
+	for _, entry := range entries {
+		if _, err := os.Stat(path.Join(dir, entry.Name(), "all.zip")); err == nil {
+			mirrored = append(mirrored, entry.Name())
+		}
+	}
+	sort.Strings(mirrored)
+	return os.WriteFile(path.Join(dir, "ecosystems.txt"), []byte(strings.Join(mirrored, "\n")+"\n"), 0644) //nolint:gosec // repository content is meant to be readable
+}
+
+// osvDownload fetches an object from the OSV bucket, and verifies it against the MD5 hash that Cloud Storage sends with it
+func osvDownload(source, target string) error {
+	return lockArtifact(target, func() error { return osvFetch(source, target) })
+}
+
+// osvFetch downloads and verifies an object for osvDownload
+func osvFetch(source, target string) error {
+	resp, err := httpGet(source)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	hash := md5.New() //nolint:gosec // Google Cloud Storage publishes MD5 hashes of objects
+	if err := writeVerified(target, io.TeeReader(resp.Body, hash)); err != nil {
+		return err
+	}
+	for _, value := range strings.Split(resp.Header.Get("X-Goog-Hash"), ",") {
+		expected, ok := strings.CutPrefix(strings.TrimSpace(value), "md5=")
+		if ok && expected != base64.StdEncoding.EncodeToString(hash.Sum(nil)) {
+			_ = os.Remove(target)
+			return fmt.Errorf("checksum mismatch for %s", source)
+		}
+	}
+	return nil
+}
+
+// verifiedDownload fetches a file unless it is already there with the expected checksum, given as "<algorithm>:<hex>"
+func verifiedDownload(source *url.URL, target, checksum string) error {
+	algorithm, expected, ok := strings.Cut(checksum, ":")
+	if !ok {
+		return fmt.Errorf("invalid checksum %q", checksum)
+	}
+	if sum, err := fileChecksum(target, algorithm); err == nil && sum == expected {
+		return lockExisting(target)
+	}
+	if err := download(source, target); err != nil {
+		return err
+	}
+	sum, err := fileChecksum(target, algorithm)
+	if err != nil {
+		return err
+	}
+	if sum != expected {
+		_ = os.Remove(target)
+		return fmt.Errorf("checksum mismatch, expected %s but got %s", expected, sum)
+	}
+	return nil
+}
+
+// writeVerified writes the content of a reader to the target file. The reader may verify its content when it reaches EOF, so the
+// target is removed if reading fails at any point.
+func writeVerified(target string, in io.Reader) error {
+	if err := os.MkdirAll(path.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	out, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if verifier, ok := in.(*content.VerifyReader); ok && err == nil {
+		err = verifier.Verify()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(target)
+	}
+	return err
+}
+
+// extractTarGz writes the regular files of a gzipped tar archive into a directory
+func extractTarGz(archive, dir string) error {
+	in, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	gz, err := gzip.NewReader(in)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		// names are kept inside of the directory, even when they have ".." in them
+		if err := writeVerified(path.Join(dir, path.Clean("/"+header.Name)), reader); err != nil {
+			return err
+		}
+	}
+}
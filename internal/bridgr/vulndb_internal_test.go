@@ -0,0 +1,213 @@
+package bridgr
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/md5" //nolint:gosec // Google Cloud Storage publishes MD5 hashes of objects
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/opencontainers/go-digest"
+	"github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func vulnDBArchive(files map[string]string) []byte {
+	buf := bytes.Buffer{}
+	gz := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gz)
+	for name, body := range files {
+		_ = archive.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(body)), Typeflag: tar.TypeReg})
+		_, _ = archive.Write([]byte(body))
+	}
+	archive.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+// vulnDBSites serves a trivy-db artifact in the bluth/trivy-db repository, Grype listings and databases, and OSV ecosystems
+func vulnDBSites() *httptest.Server {
+	layer := vulnDBArchive(map[string]string{"trivy.db": "banana stand", "metadata.json": `{"Version":2}`})
+	config := []byte("{}")
+	manifest, _ := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		MediaType: ocispec.MediaTypeImageManifest,
+		Config:    ociDescriptor("application/vnd.aquasec.trivy.config.v1+json", config),
+		Layers:    []ocispec.Descriptor{ociDescriptor("application/vnd.aquasec.trivy.db.layer.v1.tar+gzip", layer)},
+	})
+	v5 := sha256.Sum256([]byte("vulnerability-db_v5_new.tar.gz"))
+	v6 := sha256.Sum256([]byte("vulnerability-db_v6.0.2_new.tar.zst"))
+	pypi := md5.Sum([]byte("PyPI")) //nolint:gosec // Google Cloud Storage publishes MD5 hashes of objects
+	contents := map[string]ociContent{
+		"/v2/bluth/trivy-db/manifests/2":                               {ocispec.MediaTypeImageManifest, manifest},
+		"/v2/bluth/trivy-db/blobs/" + digest.FromBytes(layer).String(): {"application/octet-stream", layer},
+		"/grype/listing.json": {"application/json", []byte(`{"available":{"5":[
+			{"built":"2024-06-01T00:00:00Z","version":5,"url":"%[1]s/grype/vulnerability-db_v5_old.tar.gz","checksum":"sha256:0000"},
+			{"built":"2024-06-02T00:00:00Z","version":5,"url":"%[1]s/grype/vulnerability-db_v5_new.tar.gz","checksum":"sha256:` + hex.EncodeToString(v5[:]) + `"}]}}`)},
+		"/grype/v6/latest.json": {"application/json", []byte(`{"status":"active","schemaVersion":"v6.0.2","path":"vulnerability-db_v6.0.2_new.tar.zst","checksum":"sha256:` + hex.EncodeToString(v6[:]) + `"}`)},
+		"/osv/ecosystems.txt":   {"text/plain", []byte("PyPI\nGo\n")},
+	}
+	var server *httptest.Server
+	server = httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/" {
+			return
+		}
+		item, ok := contents[r.URL.Path]
+		if !ok && (strings.HasPrefix(r.URL.Path, "/grype/") || strings.HasPrefix(r.URL.Path, "/osv/")) {
+			item, ok = ociContent{"application/octet-stream", []byte(path.Base(strings.TrimSuffix(r.URL.Path, "/all.zip")))}, true
+		}
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if strings.HasPrefix(r.URL.Path, "/osv/") {
+			// Go is sent with the wrong hash
+			w.Header().Set("X-Goog-Hash", "crc32c=AAAAAA==,md5="+base64.StdEncoding.EncodeToString(pypi[:]))
+		}
+		body := item.content
+		if bytes.Contains(body, []byte("%[1]s")) {
+			body = []byte(fmt.Sprintf(string(body), server.URL))
+		}
+		w.Header().Set("Content-Type", item.mediaType)
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		w.Header().Set("Docker-Content-Digest", digest.FromBytes(body).String())
+		if r.Method != http.MethodHead {
+			_, _ = w.Write(body)
+		}
+	}))
+	return server
+}
+
+func TestVulnDBDir(t *testing.T) {
+	expected := BaseDir("vulndb")
+	result := VulnDB{}.dir()
+	if !cmp.Equal(expected, result) {
+		t.Error(cmp.Diff(expected, result))
+	}
+}
+
+func TestBoolToVulnDBDefaults(t *testing.T) {
+	input := map[string]interface{}{"host": "http://bridgr.bluth.com", "trivy": true, "grype": false, "osv": []interface{}{"PyPI"}}
+	expect := map[string]interface{}{"host": "http://bridgr.bluth.com", "trivy": vulnDBDefaults["trivy"], "osv": []interface{}{"PyPI"}}
+	result, err := boolToVulnDBDefaults(reflect.TypeOf(input), reflect.TypeOf(VulnDB{}), input)
+	if err != nil {
+		t.Error(err)
+	}
+	if !cmp.Equal(expect, result) {
+		t.Error(cmp.Diff(expect, result))
+	}
+
+	other, _ := boolToVulnDBDefaults(reflect.TypeOf(input), reflect.TypeOf(""), input)
+	if !cmp.Equal(input, other) {
+		t.Error(cmp.Diff(input, other))
+	}
+}
+
+func TestExtractTarGz(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("db.tar.gz", vulnDBArchive(map[string]string{"../../escape.db": "banana", "db/trivy.db": "stand"}), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := extractTarGz("db.tar.gz", "out"); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"out/escape.db", "out/db/trivy.db"} {
+		if _, err := os.Stat(file); err != nil {
+			t.Errorf("expected %s to be extracted: %s", file, err)
+		}
+	}
+}
+
+func TestVerifiedDownload(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := vulnDBSites()
+	defer server.Close()
+	trustServer(t, server)
+	source, _ := url.Parse(server.URL + "/grype/vulnerability-db_v5_old.tar.gz")
+
+	if err := verifiedDownload(source, "old.tar.gz", "sha256"); err == nil {
+		t.Error("expected an error for a checksum without an algorithm")
+	}
+	if err := verifiedDownload(source, "old.tar.gz", "sha256:0000"); err == nil {
+		t.Error("expected a checksum mismatch")
+	}
+	if _, err := os.Stat("old.tar.gz"); err == nil {
+		t.Error("expected the mismatched file to be removed")
+	}
+}
+
+func TestVulnDBRun(t *testing.T) {
+	t.Chdir(t.TempDir())
+	server := vulnDBSites()
+	defer server.Close()
+	trustServer(t, server)
+	original := []string{grypeListing, grypeDatabases, osvBucket}
+	defer func() {
+		grypeListing, grypeDatabases, osvBucket = original[0], original[1], original[2]
+	}()
+	grypeListing, grypeDatabases, osvBucket = server.URL+"/grype/listing.json", server.URL+"/grype", server.URL+"/osv"
+
+	vulndb := VulnDB{
+		Host:  "http://bridgr.bluth.com",
+		Trivy: []string{strings.TrimPrefix(server.URL, "https://") + "/bluth/trivy-db:2"},
+		Grype: []string{"v5", "v6"},
+		OSV:   []string{"*"},
+	}
+	if err := vulndb.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectFiles := []string{
+		"trivy/db.tar.gz",
+		"trivy/db/trivy.db",
+		"trivy/db/metadata.json",
+		"grype/listing.json",
+		"grype/vulnerability-db_v5_new.tar.gz",
+		"grype/v6/latest.json",
+		"grype/v6/vulnerability-db_v6.0.2_new.tar.zst",
+		"osv-scanner/PyPI/all.zip",
+		"osv-scanner/ecosystems.txt",
+	}
+	for _, file := range expectFiles {
+		if _, err := os.Stat(path.Join(vulndb.dir(), file)); err != nil {
+			t.Errorf("expected %s to be written: %s", file, err)
+		}
+	}
+	if _, err := os.Stat(path.Join(vulndb.dir(), "osv-scanner/Go/all.zip")); err == nil {
+		t.Error("expected the OSV Go database with a bad hash to be removed")
+	}
+
+	listing := struct {
+		Available map[string][]grypeV5Database `json:"available"`
+	}{}
+	content, _ := os.ReadFile(path.Join(vulndb.dir(), "grype/listing.json"))
+	if err := json.Unmarshal(content, &listing); err != nil {
+		t.Fatal(err)
+	}
+	if len(listing.Available["5"]) != 1 {
+		t.Fatalf("expected one database in the listing, got %s", content)
+	}
+	expectURL := "http://bridgr.bluth.com/vulndb/grype/vulnerability-db_v5_new.tar.gz"
+	if !cmp.Equal(expectURL, listing.Available["5"][0].URL) {
+		t.Error(cmp.Diff(expectURL, listing.Available["5"][0].URL))
+	}
+
+	ecosystems, _ := os.ReadFile(path.Join(vulndb.dir(), "osv-scanner/ecosystems.txt"))
+	if !cmp.Equal("PyPI\n", string(ecosystems)) {
+		t.Error(cmp.Diff("PyPI\n", string(ecosystems)))
+	}
+}
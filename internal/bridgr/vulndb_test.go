@@ -0,0 +1,33 @@
+package bridgr_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/aztechian/bridgr/internal/bridgr"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestVulnDBImage(t *testing.T) {
+	vulndb := bridgr.VulnDB{}
+	if vulndb.Image() != nil {
+		t.Errorf("expected nil, but got %+v", vulndb.Image())
+	}
+}
+
+func TestVulnDBName(t *testing.T) {
+	expected := "vulndb"
+	vulndb := bridgr.VulnDB{}
+	if !cmp.Equal(expected, vulndb.Name()) {
+		t.Error(cmp.Diff(expected, vulndb.Name()))
+	}
+}
+
+func TestVulnDBHook(t *testing.T) {
+	vulndb := bridgr.VulnDB{}
+	result := reflect.TypeOf(vulndb.Hook())
+	if strings.HasPrefix(result.Name(), "func(") {
+		t.Error(cmp.Diff(result.Name(), reflect.Func))
+	}
+}
@@ -22,6 +22,8 @@ import (
 
 var baseImage = map[string]string{
 	"yum":    "centos",
+	"apt":    "ubuntu",
+	"conda":  "continuumio/miniconda3",
 	"ruby":   "ruby",
 	"python": "python",
 }
@@ -82,7 +84,9 @@ func (b *batch) runContainer(name, script string) error {
 	img, _ := reference.ParseNormalizedNamed(b.ContainerConfig.Image)
 	name = fmt.Sprintf("%s_%d", name, os.Getpid()) // suffix the PID to the container name to not conflict with concurrent runs
 	defer b.cleanContainer(name)
-	_ = PullImage(b.Client, img)
+	if err := PullImage(b.Client, img); err != nil {
+		log.Info("unable to pull %s, the local image is used - %s", img, err)
+	}
 
 	resp, err := b.Client.ContainerCreate(ctx, b.ContainerConfig, &containertypes.HostConfig{Mounts: b.Mounts}, nil, DefaultContainerPlatform, name)
 	if err != nil {